@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
 	"github.com/squishmeist/ocpp-go/internal/core"
 	"github.com/squishmeist/ocpp-go/internal/core/utils"
 	"github.com/squishmeist/ocpp-go/pkg/logging"
 	message "github.com/squishmeist/ocpp-go/service/message"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	logging.SetupLogger(logging.LevelDebug, logging.LogEnvDevelopment)
 	configName := os.Getenv("CONFIG_NAME")
@@ -20,28 +27,68 @@ func main() {
 		configName = "azure-service-bus"
 	}
 	conf := utils.GetConfig("./config", configName, "yaml")
-	inbound, outbound := conf.AzureServiceBus.TopicInbound, conf.AzureServiceBus.TopicOutbound
+	inbound, outbound := conf.Topics()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	ctx := context.Background()
-	client, err := core.NewAzureServiceBusClient(
-		core.WithAzureServiceBusServiceName("azure-service-bus"),
-		core.WithAzureServiceBusConnectionString(conf.AzureServiceBus.ConnectionString),
-	)
+	tp := newTracerProvider(conf)
+
+	client, err := core.NewTransport("message", conf)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to create Azure Service Bus client: %v", err))
+		panic(fmt.Sprintf("Failed to create transport: %v", err))
 	}
-	defer client.Close(ctx)
 
 	go client.ReceiveMessage(ctx, inbound.Name, inbound.Subscription, receive())
 	go client.ReceiveMessage(ctx, outbound.Name, outbound.Subscription, receive())
 
 	server := message.NewServer(conf, client)
-	server.Start()
+	go server.Start()
+
+	<-ctx.Done()
+	slog.Info("Shutting down message server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shutdown grpc server", "error", err)
+	}
+	if err := client.Wait(shutdownCtx); err != nil {
+		slog.Error("Failed to wait for in-flight messages", "error", err)
+	}
+	if err := client.Close(shutdownCtx); err != nil {
+		slog.Error("Failed to close transport", "error", err)
+	}
+	if err := tp.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shutdown tracer provider", "error", err)
+	}
+}
+
+// Exports spans when a telemetry endpoint is configured, so sent messages start traces that continue in ocpp.
+// Without one spans are still created, giving every message a valid traceparent.
+func newTracerProvider(conf utils.Configuration) *trace.TracerProvider {
+	if conf.Telemetry.ENDPOINT != "" {
+		return core.NewTelemeter("message", conf.Telemetry.ENDPOINT, "ocpp").NewTracerProvider()
+	}
+
+	tp := trace.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return tp
 }
 
 func receive() core.MessageHandler {
-	return func(ctx context.Context, topic, subscription string, msg *azservicebus.ReceivedMessage) error {
-		slog.Info("Received message", "topic", topic, "subscription", subscription, "body", string(msg.Body))
+	return func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+		event, err := core.CloudEventFromMessage(msg)
+		if err != nil {
+			slog.Warn("Received message that is not a cloud event", "topic", topic, "subscription", subscription, "error", err, "body", string(msg.Body))
+			return nil
+		}
+		slog.Info("Received message", "topic", topic, "subscription", subscription, "type", event.Type, "serialnumber", event.Subject, "body", string(event.Data))
 		return nil
 	}
 }
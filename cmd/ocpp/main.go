@@ -2,18 +2,30 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/squishmeist/ocpp-go/internal/core"
 	"github.com/squishmeist/ocpp-go/internal/core/utils"
 	"github.com/squishmeist/ocpp-go/pkg/logging"
+	"github.com/squishmeist/ocpp-go/service/ocpi"
 	"github.com/squishmeist/ocpp-go/service/ocpp"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	logging.SetupLogger(logging.LevelDebug, logging.LogEnvDevelopment)
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	configName := os.Getenv("CONFIG_NAME")
 	if configName == "" {
@@ -21,22 +33,440 @@ func main() {
 	}
 	conf := utils.GetConfig("./config", configName, "yaml")
 
+	// Migrations only need the database, so they run before the transport and cache are set up
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(ctx, conf.Database, os.Args[2:]); err != nil {
+			slog.Error("Command failed", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	t := core.NewTelemeter("ocpp-machine", conf.Telemetry.ENDPOINT, "ocpp")
 	tp := t.NewTracerProvider()
-	defer func() {
-		if err := tp.Shutdown(ctx); err != nil {
-			slog.Error("Failed to shutdown tracer provider", "error", err)
-		}
-	}()
+	mp := t.NewMeterProvider()
+
+	// Subcommands work on the data of one tenant, the default tenant unless TENANT is set
+	commandCtx := ocpp.WithTenant(ctx, os.Getenv("TENANT"))
 
 	ocpp := ocpp.NewOcpp(
 		ocpp.WithOcppContext(ctx),
 		ocpp.WithOcppTracerProvider(tp),
+		ocpp.WithOcppMeterProvider(mp),
 		ocpp.WithOcppConfig(conf),
 	)
 
-	err := ocpp.Start()
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "quarantine":
+			err = runQuarantine(commandCtx, ocpp, os.Args[2:])
+		case "webhook":
+			err = runWebhook(commandCtx, ocpp, os.Args[2:])
+		case "outbox":
+			err = runOutbox(commandCtx, ocpp, os.Args[2:])
+		case "cache":
+			err = runCache(commandCtx, ocpp, os.Args[2:])
+		case "findings":
+			err = runFindings(commandCtx, ocpp, os.Args[2:])
+		case "journal":
+			err = runJournal(commandCtx, ocpp, os.Args[2:])
+		case "cdrs":
+			err = runCdrs(commandCtx, ocpp, os.Args[2:])
+		case "estimate":
+			err = runEstimate(commandCtx, ocpp, os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		stop()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if shutdownErr := ocpp.Shutdown(shutdownCtx); shutdownErr != nil {
+			slog.Error("Failed to shutdown ocpp", "error", shutdownErr)
+		}
+		if err != nil {
+			slog.Error("Command failed", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Roaming partners are served OCPI alongside the machine, from the same store
+	var ocpiServer *ocpi.Server
+	if conf.Ocpi.Enabled {
+		ocpiServer = ocpi.NewServer(
+			ocpi.WithTracerProvider(tp),
+			ocpi.WithStore(ocpp.Store()),
+			ocpi.WithTariffs(ocpp.Tariffs()),
+			ocpi.WithConfig(conf.Ocpi),
+		)
+		go ocpiServer.Start()
+	}
+
+	if err := ocpp.Start(); err != nil {
+		slog.Error("Ocpp stopped receiving messages", "error", err)
+	}
+	stop()
+	slog.Info("Shutting down ocpp")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if ocpiServer != nil {
+		if err := ocpiServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shutdown OCPI server", "error", err)
+		}
+	}
+	if err := ocpp.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shutdown ocpp", "error", err)
+	}
+	if err := tp.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shutdown tracer provider", "error", err)
+	}
+	if err := mp.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shutdown meter provider", "error", err)
+	}
+}
+
+// Runs the quarantine subcommands:
+//
+//	quarantine list [limit]   lists quarantined messages that have not been redriven
+//	quarantine redrive <id>   sends a quarantined message back to its topic
+func runQuarantine(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: quarantine list [limit] | quarantine redrive <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		limit := 50
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid limit %q: %w", args[1], err)
+			}
+			limit = n
+		}
+
+		messages, err := o.ListQuarantined(ctx, limit)
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				msg.Id, msg.QuarantinedAt.Format(time.RFC3339), msg.MessageId, msg.Serialnumber, msg.ErrorClass, msg.Attempts, msg.Error)
+		}
+		return nil
+	case "redrive":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: quarantine redrive <id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id %q: %w", args[1], err)
+		}
+		if err := o.Redrive(ctx, id); err != nil {
+			return err
+		}
+		slog.Info("Redrove quarantined message", "id", id)
+		return nil
+	default:
+		return fmt.Errorf("unknown quarantine command %q", args[0])
+	}
+}
+
+// Runs the webhook subcommands:
+//
+//	webhook deliveries [limit]   lists the most recent webhook deliveries
+func runWebhook(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	if len(args) == 0 || args[0] != "deliveries" {
+		return fmt.Errorf("usage: webhook deliveries [limit]")
+	}
+
+	limit := 50
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid limit %q: %w", args[1], err)
+		}
+		limit = n
+	}
+
+	deliveries, err := o.ListWebhookDeliveries(ctx, limit)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	for _, delivery := range deliveries {
+		status := "failed"
+		if delivery.DeliveredAt != nil {
+			status = "delivered"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			delivery.Id, delivery.CreatedAt.Format(time.RFC3339), delivery.EventId, delivery.EventType, delivery.URL,
+			status, delivery.StatusCode, delivery.Attempts, delivery.Error)
+	}
+	return nil
+}
+
+// Runs the outbox subcommands:
+//
+//	outbox parked [limit]   lists outbox messages parked after failing to send too many times
+//	outbox unpark <id>      sends a parked outbox message again
+func runOutbox(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: outbox parked [limit] | outbox unpark <id>")
+	}
+
+	switch args[0] {
+	case "parked":
+		limit := 50
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid limit %q: %w", args[1], err)
+			}
+			limit = n
+		}
+
+		messages, err := o.ListParkedOutbox(ctx, limit)
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			fmt.Printf("%d\t%s\t%s\t%s\t%d\t%s\n",
+				msg.Id, msg.ParkedAt.Format(time.RFC3339), msg.Kind, msg.Destination, msg.Attempts, msg.LastError)
+		}
+		return nil
+	case "unpark":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: outbox unpark <id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id %q: %w", args[1], err)
+		}
+		if err := o.UnparkOutbox(ctx, id); err != nil {
+			return err
+		}
+		slog.Info("Unparked outbox message", "id", id)
+		return nil
+	default:
+		return fmt.Errorf("unknown outbox command %q", args[0])
+	}
+}
+
+// Runs the findings subcommand:
+//
+//	findings [limit]   lists the most recently seen data-quality findings
+func runFindings(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	limit := 50
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid limit %q: %w", args[0], err)
+		}
+		limit = n
+	}
+
+	findings, err := o.ListDataQualityFindings(ctx, limit)
+	if err != nil {
+		return err
+	}
+	for _, finding := range findings {
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			finding.Id, finding.LastSeenAt.Format(time.RFC3339), finding.Serialnumber, finding.Kind, finding.Field,
+			finding.Value, finding.Occurrences)
+	}
+	return nil
+}
+
+// Runs the journal subcommand:
+//
+//	journal [-serialnumber s] [-action a] [-from t] [-to t] [-limit n]   lists journaled frames, oldest first
+//
+// From and to are RFC 3339 times; from is inclusive and to exclusive.
+func runJournal(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	flags := flag.NewFlagSet("journal", flag.ContinueOnError)
+	serialnumber := flags.String("serialnumber", "", "only frames of the charge point")
+	action := flags.String("action", "", "only frames of the OCPP action, e.g. BootNotification")
+	from := flags.String("from", "", "only frames recorded at or after the RFC 3339 time")
+	to := flags.String("to", "", "only frames recorded before the RFC 3339 time")
+	limit := flags.Int("limit", 50, "the most frames to list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter := ocpp.JournalFilter{
+		Serialnumber: *serialnumber,
+		Action:       *action,
+		Limit:        *limit,
+	}
+	for _, bound := range []struct {
+		value string
+		time  *time.Time
+	}{{*from, &filter.From}, {*to, &filter.To}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return fmt.Errorf("invalid time %q: %w", bound.value, err)
+		}
+		*bound.time = t
+	}
+
+	entries, err := o.ListJournal(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Id, entry.RecordedAt.Format(time.RFC3339Nano), entry.Direction, entry.Serialnumber, entry.MessageId,
+			entry.Action, entry.Outcome, entry.Latency, entry.Body, entry.Error)
+	}
+	return nil
+}
+
+// Runs the cache subcommands:
+//
+//	cache migrate-requests   deletes pending requests stored before they were scoped by charge point
+func runCache(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	if len(args) == 0 || args[0] != "migrate-requests" {
+		return fmt.Errorf("usage: cache migrate-requests")
+	}
+
+	deleted, err := o.MigrateLegacyRequests(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("Deleted legacy pending requests", "count", deleted)
+	return nil
+}
+
+// Runs the migrate subcommands:
+//
+//	migrate [up]          applies pending migrations
+//	migrate down [steps]  reverts the latest applied migrations, one by default
+//	migrate status        lists migrations and when they were applied
+func runMigrate(ctx context.Context, dbInfo utils.DatabaseConfiguration, args []string) error {
+	database, err := db.Open(dbInfo)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	dialect := db.DialectOf(dbInfo.Driver)
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := db.Migrate(ctx, database, dialect)
+		if err != nil {
+			return err
+		}
+		slog.Info("Applied migrations", "count", applied)
+		return nil
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(ctx, database, dialect, steps)
+		if err != nil {
+			return err
+		}
+		slog.Info("Reverted migrations", "count", reverted)
+		return nil
+	case "status":
+		status, err := db.Status(ctx, database, dialect)
+		if err != nil {
+			return err
+		}
+		for _, migration := range status {
+			appliedAt := "pending"
+			if migration.AppliedAt != nil {
+				appliedAt = migration.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d\t%s\t%s\n", migration.Version, migration.Name, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("usage: migrate [up] | migrate down [steps] | migrate status")
+	}
+}
+
+// Runs the cdrs subcommand:
+//
+//	cdrs [-serialnumber s] [-from t] [-to t] [-limit n] [-format csv|json]   exports CDRs, in the order their transactions stopped
+//
+// From and to are RFC 3339 times bounding when the transaction stopped; from is inclusive and to exclusive.
+func runCdrs(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	flags := flag.NewFlagSet("cdrs", flag.ContinueOnError)
+	serialnumber := flags.String("serialnumber", "", "only CDRs of the charge point")
+	from := flags.String("from", "", "only transactions stopped at or after the RFC 3339 time")
+	to := flags.String("to", "", "only transactions stopped before the RFC 3339 time")
+	limit := flags.Int("limit", 1000, "the most CDRs to export")
+	format := flags.String("format", "csv", "the export format, csv or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	filter := ocpp.CdrFilter{
+		Serialnumber: *serialnumber,
+		Limit:        *limit,
+	}
+	for _, bound := range []struct {
+		value string
+		time  *time.Time
+	}{{*from, &filter.From}, {*to, &filter.To}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return fmt.Errorf("invalid time %q: %w", bound.value, err)
+		}
+		*bound.time = t
+	}
+
+	cdrs, err := o.ListCdrs(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(cdrs)
+	}
+	return ocpp.WriteCdrsCSV(os.Stdout, cdrs)
+}
+
+// Runs the estimate subcommand:
+//
+//	estimate <serialnumber> <transactionId>   prints the cost of a transaction so far as JSON
+func runEstimate(ctx context.Context, o *ocpp.Ocpp, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: estimate <serialnumber> <transactionId>")
+	}
+	transactionId, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid transaction id %q: %w", args[1], err)
+	}
+
+	estimate, ok, err := o.EstimateCost(ctx, args[0], transactionId)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no tariff applies to transaction %d of %s", transactionId, args[0])
 	}
+	return json.NewEncoder(os.Stdout).Encode(estimate)
 }
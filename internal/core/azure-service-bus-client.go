@@ -2,16 +2,32 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+)
+
+const (
+	// Property used to key sessions when sessions are enabled.
+	SessionKeyProperty = "serialnumber"
+	// How long a session receiver waits for a message before releasing the session.
+	sessionIdleTimeout = 5 * time.Second
 )
 
 type AzureServiceBusClient struct {
-	Client           *azservicebus.Client
-	ServiceName      string
-	connectionString string
+	Client                *azservicebus.Client
+	ServiceName           string
+	connectionString      string
+	sessionsEnabled       bool
+	maxConcurrentSessions int
+	maxDeliveryCount      int
+	cloudEventsMode       cloudevents.Mode
+	inflight              sync.WaitGroup
 }
 
 func (c *AzureServiceBusClient) Validate() error {
@@ -24,6 +40,15 @@ func (c *AzureServiceBusClient) Validate() error {
 	if c.connectionString == "" {
 		return fmt.Errorf("missing required dependency: %s", "ConnectionString")
 	}
+	if c.sessionsEnabled && c.maxConcurrentSessions < 1 {
+		return fmt.Errorf("max concurrent sessions must be at least 1, got %d", c.maxConcurrentSessions)
+	}
+	if c.maxDeliveryCount < 1 {
+		return fmt.Errorf("max delivery count must be at least 1, got %d", c.maxDeliveryCount)
+	}
+	if !c.cloudEventsMode.IsValid() {
+		return fmt.Errorf("invalid cloud events mode: %q", c.cloudEventsMode)
+	}
 	return nil
 }
 
@@ -41,8 +66,47 @@ func WithAzureServiceBusConnectionString(connectionString string) AzureServiceBu
 	}
 }
 
+// Enables Service Bus sessions keyed by the charge point serial number.
+// Messages are sent with their SessionID set and received through session receivers, preserving per-charger ordering.
+func WithAzureServiceBusSessions(enabled bool) AzureServiceBusOption {
+	return func(c *AzureServiceBusClient) {
+		c.sessionsEnabled = enabled
+	}
+}
+
+// Sets the max delivery count of the subscriptions, after which Service Bus dead-letters a message.
+func WithAzureServiceBusMaxDeliveryCount(count int) AzureServiceBusOption {
+	return func(c *AzureServiceBusClient) {
+		if count > 0 {
+			c.maxDeliveryCount = count
+		}
+	}
+}
+
+// Sets how many sessions are processed concurrently when sessions are enabled.
+func WithAzureServiceBusMaxConcurrentSessions(max int) AzureServiceBusOption {
+	return func(c *AzureServiceBusClient) {
+		if max > 0 {
+			c.maxConcurrentSessions = max
+		}
+	}
+}
+
+// Sets how events sent with SendEvent are carried: binary (default) or structured.
+func WithAzureServiceBusCloudEventsMode(mode cloudevents.Mode) AzureServiceBusOption {
+	return func(c *AzureServiceBusClient) {
+		if mode != "" {
+			c.cloudEventsMode = mode
+		}
+	}
+}
+
 func NewAzureServiceBusClient(opts ...AzureServiceBusOption) (*AzureServiceBusClient, error) {
-	azureServiceBusClient := &AzureServiceBusClient{}
+	azureServiceBusClient := &AzureServiceBusClient{
+		maxConcurrentSessions: 1,
+		maxDeliveryCount:      10,
+		cloudEventsMode:       cloudevents.ModeBinary,
+	}
 
 	for _, opt := range opts {
 		opt(azureServiceBusClient)
@@ -65,37 +129,134 @@ func (c *AzureServiceBusClient) Close(ctx context.Context) error {
 	return c.Client.Close(ctx)
 }
 
-func (c *AzureServiceBusClient) SendMessage(ctx context.Context, queueOrTopic string, message *azservicebus.Message) error {
+func (c *AzureServiceBusClient) SendMessage(ctx context.Context, queueOrTopic string, message *Message) error {
+	sbMessage, err := c.toServiceBusMessage(message)
+	if err != nil {
+		slog.Error("Failed to set session id on message", "error", err, "queueOrTopic", queueOrTopic)
+		return err
+	}
+	sbMessage.ApplicationProperties = InjectTraceContext(ctx, sbMessage.ApplicationProperties)
+
 	sender, err := c.Client.NewSender(queueOrTopic, nil)
 	if err != nil {
 		slog.Error("Failed to create azure service bus sender", "error", err)
 		return err
 	}
+	defer sender.Close(context.WithoutCancel(ctx))
 
-	err = sender.SendMessage(ctx, message, nil)
+	err = sender.SendMessage(ctx, sbMessage, nil)
 	if err != nil {
 		slog.Error("Failed to send message to topic", "error", err, "queueOrTopic", queueOrTopic)
+		return err
 	}
 
 	return nil
 }
 
-type MessageHandler func(ctx context.Context, topic, subscription string, msg *azservicebus.ReceivedMessage) error
+// Schedules a message to be enqueued at the given time.
+// The properties are sent as is, so a copy of a received message keeps the trace context it arrived with.
+func (c *AzureServiceBusClient) ScheduleMessage(ctx context.Context, queueOrTopic string, message *Message, enqueueAt time.Time) error {
+	sbMessage, err := c.toServiceBusMessage(message)
+	if err != nil {
+		slog.Error("Failed to set session id on message", "error", err, "queueOrTopic", queueOrTopic)
+		return err
+	}
+
+	sender, err := c.Client.NewSender(queueOrTopic, nil)
+	if err != nil {
+		slog.Error("Failed to create azure service bus sender", "error", err)
+		return err
+	}
+	defer sender.Close(context.WithoutCancel(ctx))
+
+	if _, err := sender.ScheduleMessages(ctx, []*azservicebus.Message{sbMessage}, enqueueAt, nil); err != nil {
+		slog.Error("Failed to schedule message", "error", err, "queueOrTopic", queueOrTopic, "enqueueAt", enqueueAt)
+		return err
+	}
+
+	return nil
+}
+
+// Maps a message onto a Service Bus message, keyed by session when sessions are enabled.
+func (c *AzureServiceBusClient) toServiceBusMessage(message *Message) (*azservicebus.Message, error) {
+	sbMessage := &azservicebus.Message{
+		ApplicationProperties: CopyProperties(message.Properties),
+		Body:                  message.Body,
+	}
+	if message.ID != "" {
+		id := message.ID
+		sbMessage.MessageID = &id
+	}
+	if message.ContentType != "" {
+		contentType := message.ContentType
+		sbMessage.ContentType = &contentType
+	}
+
+	if c.sessionsEnabled {
+		sessionID, err := SessionID(sbMessage.ApplicationProperties)
+		if err != nil {
+			return nil, err
+		}
+		sbMessage.SessionID = &sessionID
+	}
+
+	return sbMessage, nil
+}
+
+// Maps a received Service Bus message onto a message.
+func fromReceivedMessage(msg *azservicebus.ReceivedMessage) *Message {
+	message := &Message{
+		ID:            msg.MessageID,
+		Properties:    msg.ApplicationProperties,
+		Body:          msg.Body,
+		DeliveryCount: int(msg.DeliveryCount),
+	}
+	if message.Properties == nil {
+		message.Properties = map[string]any{}
+	}
+	if msg.ContentType != nil {
+		message.ContentType = *msg.ContentType
+	}
+	if msg.EnqueuedTime != nil {
+		message.EnqueuedTime = *msg.EnqueuedTime
+	}
+	return message
+}
+
+// Sends a CloudEvent in the configured cloud events mode.
+func (c *AzureServiceBusClient) SendEvent(ctx context.Context, queueOrTopic string, event cloudevents.Event) error {
+	message, err := NewCloudEventMessage(event, c.cloudEventsMode)
+	if err != nil {
+		slog.Error("Failed to map cloud event to message", "error", err, "queueOrTopic", queueOrTopic)
+		return err
+	}
+
+	return c.SendMessage(ctx, queueOrTopic, message)
+}
 
 func (c *AzureServiceBusClient) ReceiveMessage(
 	ctx context.Context,
 	topic, subscription string,
 	handler MessageHandler,
 ) error {
+	if c.sessionsEnabled {
+		return c.receiveSessionMessages(ctx, topic, subscription, handler)
+	}
+
 	receiver, err := c.Client.NewReceiverForSubscription(topic, subscription, nil)
 	if err != nil {
 		slog.Error("Failed to create azure service bus receiver", "error", err)
 		return err
 	}
+	defer receiver.Close(context.WithoutCancel(ctx))
 
 	for {
 		messages, err := receiver.ReceiveMessages(ctx, 10, nil)
 		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Stopped receiving messages from topic", "topic", topic, "subscription", subscription)
+				return nil
+			}
 			slog.Error("Failed to receive messages", "error", err)
 			return err
 		}
@@ -107,13 +268,239 @@ func (c *AzureServiceBusClient) ReceiveMessage(
 
 		slog.Info("Received messages from topic", "topic", topic, "messageCount", len(messages))
 
-		for _, msg := range messages {
-			if err := handler(ctx, topic, subscription, msg); err != nil {
-				slog.Error("Azure Client, handler failed to handle message", "error", err)
-				// receiver.AbandonMessage(ctx, msg, nil)
+		c.handleBatch(ctx, topic, subscription, receiver, messages, handler)
+	}
+}
+
+// Handles a batch of received messages, completing each message on success and abandoning it on failure.
+// Handlers run on a context that is not cancelled with ctx, so the batch is finished once received: abandoning the
+// messages not yet started would count a delivery attempt against each of them, and dead-letter healthy messages that
+// are received during shutdowns often enough.
+func (c *AzureServiceBusClient) handleBatch(
+	ctx context.Context,
+	topic, subscription string,
+	receiver settler,
+	messages []*azservicebus.ReceivedMessage,
+	handler MessageHandler,
+) {
+	c.inflight.Add(1)
+	defer c.inflight.Done()
+
+	handlerCtx := context.WithoutCancel(ctx)
+
+	for _, msg := range messages {
+		msgCtx := ExtractTraceContext(handlerCtx, msg.ApplicationProperties)
+		if err := handler(msgCtx, topic, subscription, fromReceivedMessage(msg)); err != nil {
+			slog.Error("Azure Client, handler failed to handle message", "error", err)
+			abandonMessage(handlerCtx, receiver, msg)
+			continue
+		}
+
+		if err := receiver.CompleteMessage(handlerCtx, msg, nil); err != nil {
+			slog.Error("Failed to complete message", "error", err, "id", msg.MessageID)
+		}
+	}
+}
+
+// Blocks until all in-flight handlers have finished or the context is done.
+func (c *AzureServiceBusClient) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight messages did not finish: %w", ctx.Err())
+	}
+}
+
+// Returns how often a message is delivered at most, the max delivery count of the subscriptions.
+func (c *AzureServiceBusClient) MaxDeliveries() int {
+	return c.maxDeliveryCount
+}
+
+// Reports whether the messages of a charge point are received in order, which they are in sessions.
+func (c *AzureServiceBusClient) Ordered() bool {
+	return c.sessionsEnabled
+}
+
+// The settlement subset of the azservicebus receivers, implemented by both Receiver and SessionReceiver.
+type settler interface {
+	CompleteMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.CompleteMessageOptions) error
+	AbandonMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.AbandonMessageOptions) error
+}
+
+func abandonMessage(ctx context.Context, receiver settler, msg *azservicebus.ReceivedMessage) {
+	if err := receiver.AbandonMessage(ctx, msg, nil); err != nil {
+		slog.Error("Failed to abandon message", "error", err, "id", msg.MessageID)
+	}
+}
+
+// Returns the session id for a message, which is the serial number of the charge point it belongs to.
+func SessionID(properties map[string]any) (string, error) {
+	serialnumber, ok := properties[SessionKeyProperty].(string)
+	if !ok || serialnumber == "" {
+		return "", fmt.Errorf("%s not found in message properties", SessionKeyProperty)
+	}
+	return serialnumber, nil
+}
+
+// Runs maxConcurrentSessions workers, each accepting the next available session and processing it until it is idle.
+func (c *AzureServiceBusClient) receiveSessionMessages(
+	ctx context.Context,
+	topic, subscription string,
+	handler MessageHandler,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, c.maxConcurrentSessions)
+
+	for range c.maxConcurrentSessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.acceptSessions(ctx, topic, subscription, handler); err != nil {
+				errs <- err
+				cancel()
 			}
-			// receiver.CompleteMessage(ctx, msg, nil)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+func (c *AzureServiceBusClient) acceptSessions(
+	ctx context.Context,
+	topic, subscription string,
+	handler MessageHandler,
+) error {
+	for {
+		session, err := c.Client.AcceptNextSessionForSubscription(ctx, topic, subscription, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			var sbErr *azservicebus.Error
+			if errors.As(err, &sbErr) && sbErr.Code == azservicebus.CodeTimeout {
+				slog.Debug("No sessions available on subscription", "topic", topic, "subscription", subscription)
+				continue
+			}
+
+			slog.Error("Failed to accept next session", "error", err, "topic", topic, "subscription", subscription)
+			return err
+		}
+
+		if err := c.processSession(ctx, topic, subscription, session, handler); err != nil {
+			slog.Error("Failed to process session", "error", err, "sessionId", session.SessionID())
+		}
+
+		if err := session.Close(context.WithoutCancel(ctx)); err != nil {
+			slog.Error("Failed to close session", "error", err, "sessionId", session.SessionID())
 		}
 	}
+}
+
+// Processes the messages of a single session in order, renewing the session lock in the background.
+// Returns once the session has been idle for sessionIdleTimeout, or a message of it failed.
+func (c *AzureServiceBusClient) processSession(
+	ctx context.Context,
+	topic, subscription string,
+	session *azservicebus.SessionReceiver,
+	handler MessageHandler,
+) error {
+	sessionID := session.SessionID()
+	slog.Info("Accepted session", "topic", topic, "subscription", subscription, "sessionId", sessionID)
+
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	defer stopRenewing()
+	go renewSessionLock(renewCtx, session)
+
+	for {
+		receiveCtx, cancel := context.WithTimeout(ctx, sessionIdleTimeout)
+		messages, err := session.ReceiveMessages(receiveCtx, 10, nil)
+		cancel()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if len(messages) == 0 {
+			slog.Info("Session idle, releasing", "sessionId", sessionID)
+			return nil
+		}
+
+		if !c.handleSessionBatch(ctx, topic, subscription, session, messages, handler) {
+			return nil
+		}
+	}
+}
 
+// Handles a batch of session messages in order. Only a failed message is abandoned, as abandoning counts a delivery
+// attempt: the messages after it are left unsettled, and the session is released so that they are redelivered after
+// it, in order, without using up an attempt. Returns false once a message failed or ctx is cancelled, when the session
+// should be released.
+func (c *AzureServiceBusClient) handleSessionBatch(
+	ctx context.Context,
+	topic, subscription string,
+	session *azservicebus.SessionReceiver,
+	messages []*azservicebus.ReceivedMessage,
+	handler MessageHandler,
+) bool {
+	c.inflight.Add(1)
+	defer c.inflight.Done()
+
+	handlerCtx := context.WithoutCancel(ctx)
+
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		msgCtx := ExtractTraceContext(handlerCtx, msg.ApplicationProperties)
+		if err := handler(msgCtx, topic, subscription, fromReceivedMessage(msg)); err != nil {
+			slog.Error("Azure Client, handler failed to handle session message", "error", err, "sessionId", session.SessionID())
+			abandonMessage(handlerCtx, session, msg)
+			return false
+		}
+
+		if err := session.CompleteMessage(handlerCtx, msg, nil); err != nil {
+			slog.Error("Failed to complete session message", "error", err, "sessionId", session.SessionID())
+		}
+	}
+
+	return true
+}
+
+// Renews the session lock at half the remaining lock duration until the context is cancelled.
+func renewSessionLock(ctx context.Context, session *azservicebus.SessionReceiver) {
+	for {
+		wait := time.Until(session.LockedUntil()) / 2
+		if wait <= 0 {
+			wait = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+			if err := session.RenewSessionLock(ctx, nil); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Error("Failed to renew session lock", "error", err, "sessionId", session.SessionID())
+			}
+		}
+	}
 }
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+)
+
+// Maps a CloudEvent onto a message in the given mode.
+// The serial number is kept as the plain serialnumber property as well, for session keying and existing consumers.
+func NewCloudEventMessage(event cloudevents.Event, mode cloudevents.Mode) (*Message, error) {
+	if err := event.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cloud event: %w", err)
+	}
+
+	var message *Message
+	switch mode {
+	case cloudevents.ModeBinary, "":
+		message = &Message{
+			Properties:  event.BinaryProperties(),
+			ContentType: event.DataContentType,
+			Body:        event.Data,
+		}
+	case cloudevents.ModeStructured:
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal structured cloud event: %w", err)
+		}
+		message = &Message{
+			Properties:  map[string]any{},
+			ContentType: cloudevents.ContentTypeStructured,
+			Body:        body,
+		}
+	default:
+		return nil, fmt.Errorf("unknown cloud events mode %q", mode)
+	}
+
+	message.ID = event.ID
+	if event.Subject != "" {
+		message.Properties[SessionKeyProperty] = event.Subject
+	}
+
+	return message, nil
+}
+
+// Maps a received message onto a CloudEvent.
+// Structured and binary mode messages are decoded as such; messages carrying only the
+// ad-hoc serialnumber/source/target/tenantid properties are mapped onto an equivalent event.
+func CloudEventFromMessage(msg *Message) (cloudevents.Event, error) {
+	if cloudevents.IsStructured(msg.ContentType) {
+		return cloudevents.FromStructured(msg.Body)
+	}
+	if cloudevents.IsBinary(msg.Properties) {
+		return cloudevents.FromBinary(msg.Properties, msg.ContentType, msg.Body)
+	}
+
+	eventType, err := cloudevents.TypeFromFrame(msg.Body)
+	if err != nil {
+		return cloudevents.Event{}, err
+	}
+
+	property := func(name string) string {
+		value, _ := msg.Properties[name].(string)
+		return value
+	}
+
+	event := cloudevents.Event{
+		ID:              OriginalMessageID(msg),
+		Source:          property("source"),
+		SpecVersion:     cloudevents.SpecVersion,
+		Type:            eventType,
+		DataContentType: cloudevents.ContentTypeJSON,
+		Subject:         property(SessionKeyProperty),
+		Target:          property("target"),
+		Tenant:          property("tenantid"),
+		Data:            msg.Body,
+	}
+	if event.Source == "" {
+		event.Source = "unknown"
+	}
+	if !msg.EnqueuedTime.IsZero() {
+		event.Time = msg.EnqueuedTime
+	}
+
+	return event, nil
+}
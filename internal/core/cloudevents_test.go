@@ -0,0 +1,64 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudEventMessage(t *testing.T) {
+	event, err := cloudevents.New("/test", "123456789", []byte(`[2, "uuid-1", "Heartbeat", {}]`))
+	assert.NoError(t, err)
+
+	t.Run("Binary", func(t *testing.T) {
+		message, err := core.NewCloudEventMessage(event, cloudevents.ModeBinary)
+		assert.NoError(t, err)
+		assert.Equal(t, event.ID, message.ID)
+		assert.Equal(t, "123456789", message.Properties["serialnumber"])
+		assert.Equal(t, event.Data, message.Body)
+
+		decoded, err := core.CloudEventFromMessage(message)
+		assert.NoError(t, err)
+		assert.Equal(t, event, decoded)
+	})
+
+	t.Run("Structured", func(t *testing.T) {
+		message, err := core.NewCloudEventMessage(event, cloudevents.ModeStructured)
+		assert.NoError(t, err)
+		assert.Equal(t, cloudevents.ContentTypeStructured, message.ContentType)
+		assert.Equal(t, "123456789", message.Properties["serialnumber"])
+
+		decoded, err := core.CloudEventFromMessage(message)
+		assert.NoError(t, err)
+		assert.Equal(t, event.ID, decoded.ID)
+		assert.Equal(t, event.Subject, decoded.Subject)
+		assert.JSONEq(t, string(event.Data), string(decoded.Data))
+	})
+
+	t.Run("UnknownMode", func(t *testing.T) {
+		_, err := core.NewCloudEventMessage(event, cloudevents.Mode("unknown"))
+		assert.Error(t, err)
+	})
+
+	t.Run("LegacyProperties", func(t *testing.T) {
+		decoded, err := core.CloudEventFromMessage(&core.Message{
+			ID: "message-1",
+			Properties: map[string]any{
+				"serialnumber": "123456789",
+				"type":         "socket.message",
+				"target":       "<target>",
+				"source":       "<source>",
+				"tenantid":     "operator-a",
+			},
+			Body: []byte(`[3, "uuid-1", {}]`),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "message-1", decoded.ID)
+		assert.Equal(t, cloudevents.TypeCallResult, decoded.Type)
+		assert.Equal(t, "123456789", decoded.Subject)
+		assert.Equal(t, "<source>", decoded.Source)
+		assert.Equal(t, "operator-a", decoded.Tenant)
+	})
+}
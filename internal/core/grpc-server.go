@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net"
@@ -73,11 +74,24 @@ func (s *GrpcServer) Start() {
 	}
 }
 
-func (s *GrpcServer) Shutdown() {
-	if s.Grpc != nil {
-		s.Grpc.Stop()
+// Stops accepting new connections and waits for pending RPCs to finish.
+// If the context is done first, the remaining RPCs are cancelled.
+func (s *GrpcServer) Shutdown(ctx context.Context) error {
+	if s.Grpc == nil {
+		return nil
 	}
-	if s.listener != nil {
-		s.listener.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Grpc.Stop()
+		return fmt.Errorf("grpc server did not stop gracefully: %w", ctx.Err())
 	}
 }
@@ -61,3 +61,8 @@ func (s *HttpServer) AddRoute(method, path string, handler echo.HandlerFunc) {
 	defer s.routeLock.Unlock()
 	s.e.Add(method, path, handler)
 }
+
+// Serves a request with the routes added so far, without listening on a port.
+func (s *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.e.ServeHTTP(w, r)
+}
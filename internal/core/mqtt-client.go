@@ -0,0 +1,476 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+)
+
+const (
+	// User property carrying the message id, MQTT has no message id of its own.
+	mqttMessageIdProperty = "messageid"
+	// Topic level holding the charge point serial number in a topic pattern, e.g. ocpp/+/in.
+	mqttSerialLevel = "+"
+	// Size of the buffer between the network loop and a subscription's handler.
+	mqttSubscriptionBuffer = 64
+)
+
+// CloudEvents attributes carried as plain user properties in MQTT 5 binary mode.
+var mqttCloudEventsAttributes = []string{"id", "source", "specversion", "type", "subject", "time", "ocppaction", "target"}
+
+// Represents an MQTT 5 transport for charger gateways.
+// A topic is a pattern with the serial number as a single level wildcard, e.g. ocpp/+/in. Messages are published
+// on the topic with the serial number filled in, ocpp/<serialnumber>/in, and received messages take their serial number
+// from the topic. A subscription is a shared subscription group, so instances with the same subscription share the messages.
+type MqttClient struct {
+	Connection      *autopaho.ConnectionManager
+	ServiceName     string
+	urls            []*url.URL
+	clientId        string
+	username        string
+	password        string
+	qos             byte
+	sessionExpiry   time.Duration
+	cloudEventsMode cloudevents.Mode
+	subscriptions   map[string]*mqttSubscription
+	mu              sync.Mutex
+	inflight        sync.WaitGroup
+}
+
+type mqttSubscription struct {
+	pattern  string
+	messages chan paho.PublishReceived
+}
+
+func (c *MqttClient) Validate() error {
+	if c.Connection == nil {
+		return fmt.Errorf("missing required dependency: %s", "Connection")
+	}
+	if c.ServiceName == "" {
+		return fmt.Errorf("missing required dependency: %s", "ServiceName")
+	}
+	if len(c.urls) == 0 {
+		return fmt.Errorf("missing required dependency: %s", "URL")
+	}
+	if c.qos > 2 {
+		return fmt.Errorf("invalid qos: %d", c.qos)
+	}
+	if !c.cloudEventsMode.IsValid() {
+		return fmt.Errorf("invalid cloud events mode: %q", c.cloudEventsMode)
+	}
+	return nil
+}
+
+type MqttOption func(*MqttClient)
+
+func WithMqttServiceName(serviceName string) MqttOption {
+	return func(c *MqttClient) {
+		c.ServiceName = serviceName
+	}
+}
+
+// Sets the broker url, e.g. mqtt://localhost:1883 or tls://broker:8883. Invalid urls are ignored.
+func WithMqttURL(rawURL string) MqttOption {
+	return func(c *MqttClient) {
+		if u, err := url.Parse(rawURL); err == nil && rawURL != "" {
+			c.urls = append(c.urls, u)
+		}
+	}
+}
+
+// Sets the client id, which identifies the session on the broker. Defaults to the service name.
+func WithMqttClientId(clientId string) MqttOption {
+	return func(c *MqttClient) {
+		if clientId != "" {
+			c.clientId = clientId
+		}
+	}
+}
+
+func WithMqttCredentials(username, password string) MqttOption {
+	return func(c *MqttClient) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// Sets how long the broker keeps the session, and queued QoS 1 messages, while the client is disconnected.
+func WithMqttSessionExpiry(expiry time.Duration) MqttOption {
+	return func(c *MqttClient) {
+		if expiry > 0 {
+			c.sessionExpiry = expiry
+		}
+	}
+}
+
+// Sets how events sent with SendEvent are carried: binary (default) or structured.
+func WithMqttCloudEventsMode(mode cloudevents.Mode) MqttOption {
+	return func(c *MqttClient) {
+		if mode != "" {
+			c.cloudEventsMode = mode
+		}
+	}
+}
+
+// Creates the client and waits for the first connection to the broker.
+// The connection is re-established, and the subscriptions restored, whenever it drops.
+func NewMqttClient(opts ...MqttOption) (*MqttClient, error) {
+	mqttClient := &MqttClient{
+		qos:             1,
+		sessionExpiry:   time.Hour,
+		cloudEventsMode: cloudevents.ModeBinary,
+		subscriptions:   map[string]*mqttSubscription{},
+	}
+
+	for _, opt := range opts {
+		opt(mqttClient)
+	}
+	if mqttClient.clientId == "" {
+		mqttClient.clientId = mqttClient.ServiceName
+	}
+
+	config := autopaho.ClientConfig{
+		ServerUrls:                    mqttClient.urls,
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: false,
+		SessionExpiryInterval:         uint32(mqttClient.sessionExpiry.Seconds()),
+		ConnectUsername:               mqttClient.username,
+		ConnectPassword:               []byte(mqttClient.password),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			go mqttClient.resubscribe(cm)
+		},
+		OnConnectError: func(err error) {
+			slog.Error("Failed to connect to mqtt broker", "error", err)
+		},
+		// Without request problem info some brokers strip user properties from the publishes they deliver
+		ConnectPacketBuilder: func(connect *paho.Connect, _ *url.URL) (*paho.Connect, error) {
+			if connect.Properties == nil {
+				connect.Properties = &paho.ConnectProperties{}
+			}
+			connect.Properties.RequestProblemInfo = true
+			return connect, nil
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:                   mqttClient.clientId,
+			EnableManualAcknowledgment: true,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				mqttClient.route,
+			},
+		},
+	}
+
+	connection, err := autopaho.NewConnection(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	mqttClient.Connection = connection
+
+	if err := mqttClient.Validate(); err != nil {
+		connection.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to validate MqttClient: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := connection.AwaitConnection(ctx); err != nil {
+		connection.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to connect to mqtt broker: %w", err)
+	}
+
+	return mqttClient, nil
+}
+
+func (c *MqttClient) Close(ctx context.Context) error {
+	return c.Connection.Disconnect(ctx)
+}
+
+// Publishes a message with the configured QoS on the topic, with the serial number filled in.
+// Properties are carried as MQTT 5 user properties.
+func (c *MqttClient) SendMessage(ctx context.Context, topic string, message *Message) error {
+	mqttTopic, err := MqttTopic(topic, message.Properties)
+	if err != nil {
+		slog.Error("Failed to build topic for message", "error", err, "topic", topic)
+		return err
+	}
+
+	properties := &paho.PublishProperties{
+		ContentType: message.ContentType,
+		User:        toUserProperties(InjectTraceContext(ctx, CopyProperties(message.Properties))),
+	}
+	if message.ID != "" {
+		properties.User.Add(mqttMessageIdProperty, message.ID)
+	}
+
+	if _, err := c.Connection.Publish(ctx, &paho.Publish{
+		Topic:      mqttTopic,
+		QoS:        c.qos,
+		Payload:    message.Body,
+		Properties: properties,
+	}); err != nil {
+		slog.Error("Failed to publish message to topic", "error", err, "topic", mqttTopic)
+		return err
+	}
+
+	return nil
+}
+
+// Sends a CloudEvent in the configured cloud events mode.
+func (c *MqttClient) SendEvent(ctx context.Context, topic string, event cloudevents.Event) error {
+	message, err := NewCloudEventMessage(event, c.cloudEventsMode)
+	if err != nil {
+		slog.Error("Failed to map cloud event to message", "error", err, "topic", topic)
+		return err
+	}
+
+	return c.SendMessage(ctx, topic, message)
+}
+
+// Subscribes to the topic pattern, in the shared subscription group when subscription is set, and handles the
+// messages one at a time until ctx is cancelled. MQTT has no negative acknowledgement, so every handled message is
+// acknowledged whatever the handler outcome; failures are logged.
+func (c *MqttClient) ReceiveMessage(
+	ctx context.Context,
+	topic, subscription string,
+	handler MessageHandler,
+) error {
+	filter := topic
+	if subscription != "" {
+		filter = fmt.Sprintf("$share/%s/%s", subscription, topic)
+	}
+
+	sub := &mqttSubscription{
+		pattern:  topic,
+		messages: make(chan paho.PublishReceived, mqttSubscriptionBuffer),
+	}
+	c.mu.Lock()
+	c.subscriptions[filter] = sub
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.subscriptions, filter)
+		c.mu.Unlock()
+	}()
+
+	if _, err := c.Connection.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: filter, QoS: c.qos}},
+	}); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		slog.Error("Failed to subscribe to topic", "error", err, "filter", filter)
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped receiving messages from topic", "topic", topic, "subscription", subscription)
+			return nil
+		case received := <-sub.messages:
+			c.handleMessage(ctx, topic, subscription, sub, received, handler)
+		}
+	}
+}
+
+// Handles a received message on a context that is not cancelled with ctx, then acknowledges it.
+func (c *MqttClient) handleMessage(
+	ctx context.Context,
+	topic, subscription string,
+	sub *mqttSubscription,
+	received paho.PublishReceived,
+	handler MessageHandler,
+) {
+	c.inflight.Add(1)
+	defer c.inflight.Done()
+
+	message, err := fromPublish(sub.pattern, received.Packet)
+	if err != nil {
+		slog.Error("Mqtt Client, dropping message", "error", err, "topic", received.Packet.Topic)
+	} else {
+		msgCtx := ExtractTraceContext(context.WithoutCancel(ctx), message.Properties)
+		if err := handler(msgCtx, topic, subscription, message); err != nil {
+			slog.Error("Mqtt Client, handler failed to handle message", "error", err, "id", message.ID)
+		}
+	}
+
+	if err := received.Client.Ack(received.Packet); err != nil {
+		slog.Error("Failed to ack message", "error", err, "topic", received.Packet.Topic)
+	}
+}
+
+// Passes a received publish to the subscription it matches. Runs on the network loop, so a full subscription buffer
+// applies back pressure to the broker. Publishes that match no subscription are acknowledged and dropped.
+func (c *MqttClient) route(received paho.PublishReceived) (bool, error) {
+	c.mu.Lock()
+	var sub *mqttSubscription
+	for _, candidate := range c.subscriptions {
+		if TopicMatches(candidate.pattern, received.Packet.Topic) {
+			sub = candidate
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if sub == nil {
+		slog.Warn("Received message on topic without subscription", "topic", received.Packet.Topic)
+		return false, received.Client.Ack(received.Packet)
+	}
+
+	sub.messages <- received
+	return true, nil
+}
+
+// Restores the subscriptions after a reconnect.
+func (c *MqttClient) resubscribe(cm *autopaho.ConnectionManager) {
+	c.mu.Lock()
+	var subscriptions []paho.SubscribeOptions
+	for filter := range c.subscriptions {
+		subscriptions = append(subscriptions, paho.SubscribeOptions{Topic: filter, QoS: c.qos})
+	}
+	c.mu.Unlock()
+
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := cm.Subscribe(ctx, &paho.Subscribe{Subscriptions: subscriptions}); err != nil {
+		slog.Error("Failed to restore subscriptions", "error", err)
+	}
+}
+
+// Blocks until all in-flight handlers have finished or the context is done.
+func (c *MqttClient) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight messages did not finish: %w", ctx.Err())
+	}
+}
+
+// Returns the topic for a message, with the serial number in place of the + level of the pattern.
+func MqttTopic(pattern string, properties map[string]any) (string, error) {
+	if !strings.Contains(pattern, mqttSerialLevel) {
+		return pattern, nil
+	}
+
+	serialnumber, err := SessionID(properties)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(serialnumber, "/+#") {
+		return "", fmt.Errorf("%s %q is not a valid topic level", SessionKeyProperty, serialnumber)
+	}
+
+	return strings.Replace(pattern, mqttSerialLevel, serialnumber, 1), nil
+}
+
+// Checks if a topic matches a topic filter with + and # wildcards.
+func TopicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
+
+// Maps message properties onto user properties. Values are carried as strings.
+func toUserProperties(properties map[string]any) paho.UserProperties {
+	user := paho.UserProperties{}
+	for key, value := range properties {
+		switch v := value.(type) {
+		case string:
+			user.Add(key, v)
+		case time.Time:
+			user.Add(key, v.UTC().Format(time.RFC3339Nano))
+		default:
+			user.Add(key, fmt.Sprint(v))
+		}
+	}
+	return user
+}
+
+// Maps a received publish onto a message. The serial number is taken from the topic, the + level of the pattern.
+// CloudEvents attributes sent as plain user properties, as in the MQTT protocol binding, are mapped onto the
+// cloudEvents: prefixed properties. Messages without a message id get one derived from their topic and payload,
+// so a redelivered publish keeps its id.
+func fromPublish(pattern string, publish *paho.Publish) (*Message, error) {
+	message := &Message{
+		Properties:    map[string]any{},
+		Body:          publish.Payload,
+		EnqueuedTime:  time.Now().UTC(),
+		DeliveryCount: 1,
+	}
+	if publish.Duplicate() {
+		message.DeliveryCount = 2
+	}
+
+	if publish.Properties != nil {
+		message.ContentType = publish.Properties.ContentType
+		for _, property := range publish.Properties.User {
+			message.Properties[property.Key] = property.Value
+		}
+	}
+
+	if _, ok := message.Properties["specversion"]; ok {
+		for _, attribute := range mqttCloudEventsAttributes {
+			if value, ok := message.Properties[attribute]; ok {
+				delete(message.Properties, attribute)
+				message.Properties[cloudevents.BinaryPrefix+attribute] = value
+			}
+		}
+	}
+
+	patternLevels := strings.Split(pattern, "/")
+	topicLevels := strings.Split(publish.Topic, "/")
+	for i, level := range patternLevels {
+		if level == mqttSerialLevel && i < len(topicLevels) {
+			message.Properties[SessionKeyProperty] = topicLevels[i]
+			break
+		}
+	}
+	if _, ok := message.Properties[SessionKeyProperty]; !ok && strings.Contains(pattern, mqttSerialLevel) {
+		return nil, fmt.Errorf("%s not found in topic %s", SessionKeyProperty, publish.Topic)
+	}
+
+	if id, ok := message.Properties[mqttMessageIdProperty].(string); ok {
+		message.ID = id
+		delete(message.Properties, mqttMessageIdProperty)
+	} else if id, ok := message.Properties[cloudevents.BinaryPrefix+"id"].(string); ok {
+		message.ID = id
+	} else {
+		sum := sha256.Sum256(append([]byte(publish.Topic+"\n"), publish.Payload...))
+		message.ID = hex.EncodeToString(sum[:16])
+	}
+
+	return message, nil
+}
@@ -0,0 +1,226 @@
+package core_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/stretchr/testify/assert"
+)
+
+// Signals the id of the client each time the broker has taken a subscription, right before it sends the SUBACK.
+type subscribedHook struct {
+	mqtt.HookBase
+	subscribed chan string
+}
+
+func (h *subscribedHook) ID() string {
+	return "subscribed"
+}
+
+func (h *subscribedHook) Provides(b byte) bool {
+	return b == mqtt.OnSubscribed
+}
+
+func (h *subscribedHook) OnSubscribed(cl *mqtt.Client, pk packets.Packet, reasonCodes []byte) {
+	h.subscribed <- cl.ID
+}
+
+// Starts a broker, returning its URL and the ids of the clients whose subscriptions it takes.
+func startMqttBroker(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	broker := mqtt.New(&mqtt.Options{
+		Logger: slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})),
+	})
+	assert.NoError(t, broker.AddHook(new(auth.AllowHook), nil))
+	hook := &subscribedHook{subscribed: make(chan string, 10)}
+	assert.NoError(t, broker.AddHook(hook, nil))
+
+	listener := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	assert.NoError(t, broker.AddListener(listener))
+	assert.NoError(t, broker.Serve())
+	t.Cleanup(func() { broker.Close() })
+
+	return "mqtt://" + listener.Address(), hook.subscribed
+}
+
+func setupMqttTest(t *testing.T, url, clientId string) *core.MqttClient {
+	t.Helper()
+
+	client, err := core.NewMqttClient(
+		core.WithMqttServiceName("test"),
+		core.WithMqttURL(url),
+		core.WithMqttClientId(clientId),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close(context.Background()) })
+
+	return client
+}
+
+// Receives from topic in the background, passing each message to received until ctx is cancelled. Returns once the
+// broker has taken the subscription of the client.
+func receiveMqtt(ctx context.Context, t *testing.T, client *core.MqttClient, subscribed <-chan string, topic, subscription string, received chan<- *core.Message) *sync.WaitGroup {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, client.ReceiveMessage(ctx, topic, subscription, func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			received <- msg
+			return nil
+		}))
+	}()
+
+	select {
+	case <-subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not taken")
+	}
+	return &wg
+}
+
+func TestMqttClient(t *testing.T) {
+	frame := []byte(`[2, "uuid-1", "Heartbeat", {}]`)
+	url, subscribed := startMqttBroker(t)
+	ocpp := setupMqttTest(t, url, "ocpp")
+	gateway := setupMqttTest(t, url, "gateway")
+
+	t.Run("ReceiveFromGateway", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		received := make(chan *core.Message, 1)
+		wg := receiveMqtt(ctx, t, ocpp, subscribed, "ocpp/+/in", "ocpp", received)
+
+		properties := &paho.PublishProperties{}
+		properties.User.Add("source", "/gateway")
+		_, err := gateway.Connection.Publish(ctx, &paho.Publish{
+			Topic:      "ocpp/123456789/in",
+			QoS:        1,
+			Payload:    frame,
+			Properties: properties,
+		})
+		assert.NoError(t, err)
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, "123456789", msg.Properties[core.SessionKeyProperty])
+			assert.Equal(t, "/gateway", msg.Properties["source"])
+			assert.NotEmpty(t, msg.ID)
+
+			event, err := core.CloudEventFromMessage(msg)
+			assert.NoError(t, err)
+			assert.Equal(t, "123456789", event.Subject)
+			assert.Equal(t, cloudevents.TypeCall, event.Type)
+			assert.Equal(t, frame, event.Data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+
+		cancel()
+		wg.Wait()
+	})
+
+	t.Run("SendEvent_Reply", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		received := make(chan *core.Message, 1)
+		wg := receiveMqtt(ctx, t, gateway, subscribed, "ocpp/+/out", "", received)
+
+		event, err := cloudevents.New("/ocpp", "123456789", []byte(`[3, "uuid-1", {}]`))
+		assert.NoError(t, err)
+		assert.NoError(t, ocpp.SendEvent(ctx, "ocpp/+/out", event))
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, event.ID, msg.ID)
+			assert.Equal(t, "123456789", msg.Properties[core.SessionKeyProperty])
+
+			decoded, err := core.CloudEventFromMessage(msg)
+			assert.NoError(t, err)
+			assert.Equal(t, event.ID, decoded.ID)
+			assert.Equal(t, cloudevents.TypeCallResult, decoded.Type)
+			assert.Equal(t, event.Data, decoded.Data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+
+		cancel()
+		wg.Wait()
+	})
+
+	t.Run("CloudEventsUserProperties", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		received := make(chan *core.Message, 1)
+		wg := receiveMqtt(ctx, t, ocpp, subscribed, "ocpp/+/in", "ocpp", received)
+
+		properties := &paho.PublishProperties{ContentType: cloudevents.ContentTypeJSON}
+		properties.User.Add("specversion", "1.0")
+		properties.User.Add("id", "event-1")
+		properties.User.Add("source", "/gateway")
+		properties.User.Add("type", cloudevents.TypeCall)
+		_, err := gateway.Connection.Publish(ctx, &paho.Publish{
+			Topic:      "ocpp/987654321/in",
+			QoS:        1,
+			Payload:    frame,
+			Properties: properties,
+		})
+		assert.NoError(t, err)
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, "event-1", msg.ID)
+
+			event, err := core.CloudEventFromMessage(msg)
+			assert.NoError(t, err)
+			assert.Equal(t, "event-1", event.ID)
+			assert.Equal(t, "/gateway", event.Source)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+
+		cancel()
+		wg.Wait()
+	})
+}
+
+func TestMqttTopic(t *testing.T) {
+	t.Run("SerialInPattern", func(t *testing.T) {
+		topic, err := core.MqttTopic("ocpp/+/out", map[string]any{core.SessionKeyProperty: "123456789"})
+		assert.NoError(t, err)
+		assert.Equal(t, "ocpp/123456789/out", topic)
+	})
+
+	t.Run("InvalidSerial", func(t *testing.T) {
+		_, err := core.MqttTopic("ocpp/+/out", map[string]any{core.SessionKeyProperty: "123/456"})
+		assert.Error(t, err)
+	})
+
+	t.Run("MissingSerial", func(t *testing.T) {
+		_, err := core.MqttTopic("ocpp/+/out", map[string]any{})
+		assert.Error(t, err)
+	})
+
+	t.Run("TopicMatches", func(t *testing.T) {
+		assert.True(t, core.TopicMatches("ocpp/+/in", "ocpp/123/in"))
+		assert.True(t, core.TopicMatches("ocpp/#", "ocpp/123/in"))
+		assert.False(t, core.TopicMatches("ocpp/+/in", "ocpp/123/out"))
+		assert.False(t, core.TopicMatches("ocpp/+/in", "ocpp/123/in/extra"))
+	})
+}
@@ -0,0 +1,390 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+)
+
+const (
+	// Prefix of CloudEvents context attributes carried as NATS headers, replacing the "cloudEvents:" property prefix.
+	natsCloudEventsPrefix = "ce-"
+	natsContentTypeHeader = "Content-Type"
+)
+
+// Backoff of a nak'd message, by number of deliveries.
+var natsRedeliveryPolicy = retry.Policy{
+	InitialInterval: time.Second,
+	MaxInterval:     time.Minute,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// Represents a NATS JetStream transport.
+// A topic is a subject prefix per direction, e.g. ocpp.in, and messages are published per charge point on
+// <topic>.<serialnumber>. A subscription is a durable consumer filtered on <topic>.*.
+type NatsClient struct {
+	Conn            *nats.Conn
+	JetStream       jetstream.JetStream
+	ServiceName     string
+	url             string
+	stream          string
+	topics          []string
+	maxDeliver      int
+	ackWait         time.Duration
+	cloudEventsMode cloudevents.Mode
+	inflight        sync.WaitGroup
+}
+
+func (c *NatsClient) Validate() error {
+	if c.Conn == nil {
+		return fmt.Errorf("missing required dependency: %s", "Conn")
+	}
+	if c.ServiceName == "" {
+		return fmt.Errorf("missing required dependency: %s", "ServiceName")
+	}
+	if c.stream == "" {
+		return fmt.Errorf("missing required dependency: %s", "Stream")
+	}
+	if len(c.topics) == 0 {
+		return fmt.Errorf("missing required dependency: %s", "Topics")
+	}
+	if !c.cloudEventsMode.IsValid() {
+		return fmt.Errorf("invalid cloud events mode: %q", c.cloudEventsMode)
+	}
+	return nil
+}
+
+type NatsOption func(*NatsClient)
+
+func WithNatsServiceName(serviceName string) NatsOption {
+	return func(c *NatsClient) {
+		c.ServiceName = serviceName
+	}
+}
+
+func WithNatsURL(url string) NatsOption {
+	return func(c *NatsClient) {
+		if url != "" {
+			c.url = url
+		}
+	}
+}
+
+// Sets the stream messages are stored in and the topics it captures.
+// The stream is created, or updated to capture the topics, when the client is created.
+func WithNatsStream(name string, topics ...string) NatsOption {
+	return func(c *NatsClient) {
+		c.stream = name
+		for _, topic := range topics {
+			if topic != "" {
+				c.topics = append(c.topics, topic)
+			}
+		}
+	}
+}
+
+// Sets how often a message is delivered before the consumer gives up on it.
+func WithNatsMaxDeliver(maxDeliver int) NatsOption {
+	return func(c *NatsClient) {
+		if maxDeliver > 0 {
+			c.maxDeliver = maxDeliver
+		}
+	}
+}
+
+// Sets how long the server waits for a message to be acknowledged before redelivering it.
+func WithNatsAckWait(ackWait time.Duration) NatsOption {
+	return func(c *NatsClient) {
+		if ackWait > 0 {
+			c.ackWait = ackWait
+		}
+	}
+}
+
+// Sets how events sent with SendEvent are carried: binary (default) or structured.
+func WithNatsCloudEventsMode(mode cloudevents.Mode) NatsOption {
+	return func(c *NatsClient) {
+		if mode != "" {
+			c.cloudEventsMode = mode
+		}
+	}
+}
+
+func NewNatsClient(opts ...NatsOption) (*NatsClient, error) {
+	natsClient := &NatsClient{
+		url:             nats.DefaultURL,
+		maxDeliver:      5,
+		ackWait:         30 * time.Second,
+		cloudEventsMode: cloudevents.ModeBinary,
+	}
+
+	for _, opt := range opts {
+		opt(natsClient)
+	}
+
+	conn, err := nats.Connect(natsClient.url, nats.Name(natsClient.ServiceName))
+	if err != nil {
+		return nil, err
+	}
+	natsClient.Conn = conn
+
+	if err := natsClient.Validate(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to validate NatsClient: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	natsClient.JetStream = js
+
+	subjects := make([]string, len(natsClient.topics))
+	for i, topic := range natsClient.topics {
+		subjects[i] = topic + ".*"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     natsClient.stream,
+		Subjects: subjects,
+	}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create stream %s: %w", natsClient.stream, err)
+	}
+
+	return natsClient, nil
+}
+
+// Drains the connection, letting pending publishes and acknowledgements finish.
+func (c *NatsClient) Close(ctx context.Context) error {
+	return c.Conn.Drain()
+}
+
+// Publishes a message on <topic>.<serialnumber>. The message id is used for JetStream de-duplication.
+func (c *NatsClient) SendMessage(ctx context.Context, topic string, message *Message) error {
+	subject, err := Subject(topic, message.Properties)
+	if err != nil {
+		slog.Error("Failed to build subject for message", "error", err, "topic", topic)
+		return err
+	}
+
+	msg := &nats.Msg{
+		Subject: subject,
+		Header:  toNatsHeader(InjectTraceContext(ctx, CopyProperties(message.Properties))),
+		Data:    message.Body,
+	}
+	if message.ContentType != "" {
+		msg.Header.Set(natsContentTypeHeader, message.ContentType)
+	}
+
+	var opts []jetstream.PublishOpt
+	if message.ID != "" {
+		opts = append(opts, jetstream.WithMsgID(message.ID))
+	}
+
+	if _, err := c.JetStream.PublishMsg(ctx, msg, opts...); err != nil {
+		slog.Error("Failed to publish message to subject", "error", err, "subject", subject)
+		return err
+	}
+
+	return nil
+}
+
+// Sends a CloudEvent in the configured cloud events mode.
+func (c *NatsClient) SendEvent(ctx context.Context, topic string, event cloudevents.Event) error {
+	message, err := NewCloudEventMessage(event, c.cloudEventsMode)
+	if err != nil {
+		slog.Error("Failed to map cloud event to message", "error", err, "topic", topic)
+		return err
+	}
+
+	return c.SendMessage(ctx, topic, message)
+}
+
+// Consumes the messages of topic through the durable consumer named subscription until ctx is cancelled.
+// Messages are handled one at a time and settled with the handler outcome: acked on success,
+// nak'd with backoff on a transient error, and terminated on any other error.
+func (c *NatsClient) ReceiveMessage(
+	ctx context.Context,
+	topic, subscription string,
+	handler MessageHandler,
+) error {
+	consumer, err := c.JetStream.CreateOrUpdateConsumer(ctx, c.stream, jetstream.ConsumerConfig{
+		Durable:       subscription,
+		FilterSubject: topic + ".*",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.ackWait,
+		MaxDeliver:    c.maxDeliver,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		slog.Error("Failed to create nats consumer", "error", err, "topic", topic, "subscription", subscription)
+		return err
+	}
+
+	messages, err := consumer.Messages()
+	if err != nil {
+		slog.Error("Failed to consume messages", "error", err, "topic", topic, "subscription", subscription)
+		return err
+	}
+	defer messages.Stop()
+
+	stop := context.AfterFunc(ctx, messages.Stop)
+	defer stop()
+
+	for {
+		msg, err := messages.Next()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				slog.Info("Stopped receiving messages from topic", "topic", topic, "subscription", subscription)
+				return nil
+			}
+			slog.Error("Failed to receive messages", "error", err)
+			return err
+		}
+
+		c.handleMessage(ctx, topic, subscription, msg, handler)
+	}
+}
+
+// Handles a received message on a context that is not cancelled with ctx, so a message that has started
+// processing is finished and settled.
+func (c *NatsClient) handleMessage(
+	ctx context.Context,
+	topic, subscription string,
+	msg jetstream.Msg,
+	handler MessageHandler,
+) {
+	c.inflight.Add(1)
+	defer c.inflight.Done()
+
+	message := fromNatsMessage(msg)
+	msgCtx := ExtractTraceContext(context.WithoutCancel(ctx), message.Properties)
+
+	err := handler(msgCtx, topic, subscription, message)
+	switch {
+	case err == nil:
+		if err := msg.Ack(); err != nil {
+			slog.Error("Failed to ack message", "error", err, "id", message.ID)
+		}
+	case retry.IsTransient(err):
+		slog.Error("Nats Client, handler failed to handle message, redelivering", "error", err, "id", message.ID)
+		if err := msg.NakWithDelay(natsRedeliveryPolicy.Backoff(message.DeliveryCount)); err != nil {
+			slog.Error("Failed to nak message", "error", err, "id", message.ID)
+		}
+	default:
+		slog.Error("Nats Client, handler failed to handle message, terminating", "error", err, "id", message.ID)
+		if err := msg.TermWithReason(err.Error()); err != nil {
+			slog.Error("Failed to term message", "error", err, "id", message.ID)
+		}
+	}
+}
+
+// Returns how often a message is delivered at most.
+func (c *NatsClient) MaxDeliveries() int {
+	return c.maxDeliver
+}
+
+// Blocks until all in-flight handlers have finished or the context is done.
+func (c *NatsClient) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight messages did not finish: %w", ctx.Err())
+	}
+}
+
+// Returns the subject for a message on topic, <topic>.<serialnumber>.
+func Subject(topic string, properties map[string]any) (string, error) {
+	serialnumber, err := SessionID(properties)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(serialnumber, ".*> \t\r\n") {
+		return "", fmt.Errorf("%s %q is not a valid subject token", SessionKeyProperty, serialnumber)
+	}
+	return topic + "." + serialnumber, nil
+}
+
+// Maps message properties onto NATS headers. Values are carried as strings.
+func toNatsHeader(properties map[string]any) nats.Header {
+	header := nats.Header{}
+	for key, value := range properties {
+		if strings.HasPrefix(key, cloudevents.BinaryPrefix) {
+			key = natsCloudEventsPrefix + strings.TrimPrefix(key, cloudevents.BinaryPrefix)
+		}
+
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case []byte:
+			str = string(v)
+		case time.Time:
+			str = v.UTC().Format(time.RFC3339Nano)
+		default:
+			str = fmt.Sprint(v)
+		}
+		header[key] = []string{str}
+	}
+	return header
+}
+
+// Maps a received JetStream message onto a message.
+func fromNatsMessage(msg jetstream.Msg) *Message {
+	message := &Message{
+		Properties: map[string]any{},
+		Body:       msg.Data(),
+	}
+
+	for key, values := range msg.Headers() {
+		if len(values) == 0 {
+			continue
+		}
+		switch {
+		case key == jetstream.MsgIDHeader:
+			message.ID = values[0]
+		case key == natsContentTypeHeader:
+			message.ContentType = values[0]
+		case strings.HasPrefix(key, "Nats-"):
+			continue
+		case strings.HasPrefix(key, natsCloudEventsPrefix):
+			message.Properties[cloudevents.BinaryPrefix+strings.TrimPrefix(key, natsCloudEventsPrefix)] = values[0]
+		default:
+			message.Properties[key] = values[0]
+		}
+	}
+
+	if metadata, err := msg.Metadata(); err == nil {
+		message.DeliveryCount = int(metadata.NumDelivered)
+		message.EnqueuedTime = metadata.Timestamp
+		if message.ID == "" {
+			message.ID = strconv.FormatUint(metadata.Sequence.Stream, 10)
+		}
+	}
+
+	return message
+}
@@ -0,0 +1,200 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/stretchr/testify/assert"
+)
+
+func startNatsServer(t *testing.T) string {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	assert.NoError(t, err)
+
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	return ns.ClientURL()
+}
+
+func setupNatsTest(t *testing.T) *core.NatsClient {
+	t.Helper()
+
+	client, err := core.NewNatsClient(
+		core.WithNatsServiceName("test"),
+		core.WithNatsURL(startNatsServer(t)),
+		core.WithNatsStream("OCPP", "ocpp.in", "ocpp.out"),
+		core.WithNatsMaxDeliver(3),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close(context.Background()) })
+
+	return client
+}
+
+// Receives from topic in the background, passing each message to handle until ctx is cancelled.
+func receiveNats(ctx context.Context, t *testing.T, client *core.NatsClient, topic, subscription string, handle core.MessageHandler) *sync.WaitGroup {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, client.ReceiveMessage(ctx, topic, subscription, handle))
+	}()
+	return &wg
+}
+
+func TestNatsClient(t *testing.T) {
+	frame := []byte(`[2, "uuid-1", "Heartbeat", {}]`)
+
+	t.Run("SendEvent_Receive", func(t *testing.T) {
+		client := setupNatsTest(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		event, err := cloudevents.New("/test", "123456789", frame)
+		assert.NoError(t, err)
+		assert.NoError(t, client.SendEvent(ctx, "ocpp.in", event))
+
+		received := make(chan *core.Message, 1)
+		wg := receiveNats(ctx, t, client, "ocpp.in", "ocpp", func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			received <- msg
+			return nil
+		})
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, event.ID, msg.ID)
+			assert.Equal(t, "123456789", msg.Properties[core.SessionKeyProperty])
+			assert.Equal(t, 1, msg.DeliveryCount)
+
+			decoded, err := core.CloudEventFromMessage(msg)
+			assert.NoError(t, err)
+			assert.Equal(t, event.ID, decoded.ID)
+			assert.Equal(t, event.Type, decoded.Type)
+			assert.Equal(t, event.Subject, decoded.Subject)
+			assert.Equal(t, event.Action, decoded.Action)
+			assert.Equal(t, frame, decoded.Data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+
+		cancel()
+		wg.Wait()
+	})
+
+	t.Run("SubjectPerChargePoint", func(t *testing.T) {
+		client := setupNatsTest(t)
+		ctx := context.Background()
+
+		for _, serialnumber := range []string{"111", "222"} {
+			event, err := cloudevents.New("/test", serialnumber, frame)
+			assert.NoError(t, err)
+			assert.NoError(t, client.SendEvent(ctx, "ocpp.in", event))
+		}
+
+		stream, err := client.JetStream.Stream(ctx, "OCPP")
+		assert.NoError(t, err)
+		msg, err := stream.GetLastMsgForSubject(ctx, "ocpp.in.222")
+		assert.NoError(t, err)
+		assert.Equal(t, "ocpp.in.222", msg.Subject)
+	})
+
+	t.Run("InvalidSerialnumber", func(t *testing.T) {
+		client := setupNatsTest(t)
+
+		err := client.SendMessage(context.Background(), "ocpp.in", &core.Message{
+			Properties: map[string]any{core.SessionKeyProperty: "123.456"},
+			Body:       frame,
+		})
+		assert.Error(t, err)
+
+		err = client.SendMessage(context.Background(), "ocpp.in", &core.Message{Body: frame})
+		assert.Error(t, err)
+	})
+
+	t.Run("TransientError_Redelivered", func(t *testing.T) {
+		client := setupNatsTest(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		event, err := cloudevents.New("/test", "123456789", frame)
+		assert.NoError(t, err)
+		assert.NoError(t, client.SendEvent(ctx, "ocpp.in", event))
+
+		deliveries := make(chan int, 2)
+		wg := receiveNats(ctx, t, client, "ocpp.in", "ocpp", func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			deliveries <- msg.DeliveryCount
+			if msg.DeliveryCount == 1 {
+				return retry.Transient(fmt.Errorf("database is locked"))
+			}
+			return nil
+		})
+
+		for _, expected := range []int{1, 2} {
+			select {
+			case count := <-deliveries:
+				assert.Equal(t, expected, count)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("delivery %d not received", expected)
+			}
+		}
+
+		cancel()
+		wg.Wait()
+	})
+
+	t.Run("PermanentError_Terminated", func(t *testing.T) {
+		client := setupNatsTest(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		event, err := cloudevents.New("/test", "123456789", frame)
+		assert.NoError(t, err)
+		assert.NoError(t, client.SendEvent(ctx, "ocpp.in", event))
+
+		deliveries := make(chan int, 2)
+		wg := receiveNats(ctx, t, client, "ocpp.in", "ocpp", func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			deliveries <- msg.DeliveryCount
+			return fmt.Errorf("invalid payload")
+		})
+
+		select {
+		case <-deliveries:
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+		select {
+		case count := <-deliveries:
+			t.Fatalf("terminated message redelivered, delivery %d", count)
+		case <-time.After(1500 * time.Millisecond):
+		}
+
+		consumer, err := client.JetStream.Consumer(ctx, "OCPP", "ocpp")
+		assert.NoError(t, err)
+		info, err := consumer.Info(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, info.NumAckPending)
+
+		cancel()
+		wg.Wait()
+	})
+}
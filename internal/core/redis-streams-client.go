@@ -0,0 +1,464 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+)
+
+// Fields of a stream entry.
+const (
+	streamFieldId          = "id"
+	streamFieldContentType = "contenttype"
+	streamFieldProperties  = "properties"
+	streamFieldBody        = "body"
+
+	// Set on dead-lettered entries
+	streamFieldError      = "error"
+	streamFieldDeliveries = "deliveries"
+	streamFieldGroup      = "group"
+	streamFieldEntryId    = "entryid"
+)
+
+// Suffix of the dead-letter stream of a stream.
+const deadLetterSuffix = ":dead-letter"
+
+// Represents a Redis Streams transport.
+// A topic is a stream and a subscription a consumer group reading it. Entries are acknowledged when handled,
+// left pending for redelivery on a transient error, and moved to the dead-letter stream <topic>:dead-letter on any
+// other error or once they have been delivered more than maxDeliveries times. Entries left pending by consumers that
+// died are claimed once they have been idle for claimMinIdle.
+type RedisStreamsClient struct {
+	Client          redis.UniversalClient
+	ServiceName     string
+	addr            string
+	consumer        string
+	maxLen          int64
+	maxDeliveries   int
+	claimMinIdle    time.Duration
+	block           time.Duration
+	cloudEventsMode cloudevents.Mode
+	inflight        sync.WaitGroup
+}
+
+func (c *RedisStreamsClient) Validate() error {
+	if c.Client == nil {
+		return fmt.Errorf("missing required dependency: %s", "Client")
+	}
+	if c.ServiceName == "" {
+		return fmt.Errorf("missing required dependency: %s", "ServiceName")
+	}
+	if c.consumer == "" {
+		return fmt.Errorf("missing required dependency: %s", "Consumer")
+	}
+	if c.maxDeliveries < 1 {
+		return fmt.Errorf("max deliveries must be at least 1, got %d", c.maxDeliveries)
+	}
+	if !c.cloudEventsMode.IsValid() {
+		return fmt.Errorf("invalid cloud events mode: %q", c.cloudEventsMode)
+	}
+	return nil
+}
+
+type RedisStreamsOption func(*RedisStreamsClient)
+
+func WithRedisStreamsServiceName(serviceName string) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		c.ServiceName = serviceName
+	}
+}
+
+// Sets the address a client is created for, unless a client is given with WithRedisStreamsClient.
+func WithRedisStreamsAddr(addr string) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		if addr != "" {
+			c.addr = addr
+		}
+	}
+}
+
+func WithRedisStreamsClient(client redis.UniversalClient) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		c.Client = client
+	}
+}
+
+// Sets the consumer name within the consumer group. Defaults to <service name>-<hostname>.
+// Each running instance needs its own name.
+func WithRedisStreamsConsumer(consumer string) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		if consumer != "" {
+			c.consumer = consumer
+		}
+	}
+}
+
+// Sets the approximate number of entries a stream is trimmed to when entries are added, 0 disables trimming.
+func WithRedisStreamsMaxLen(maxLen int64) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		if maxLen >= 0 {
+			c.maxLen = maxLen
+		}
+	}
+}
+
+// Sets how often an entry is delivered before it is dead-lettered.
+func WithRedisStreamsMaxDeliveries(maxDeliveries int) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		if maxDeliveries > 0 {
+			c.maxDeliveries = maxDeliveries
+		}
+	}
+}
+
+// Sets how long an entry stays pending before another consumer may claim it.
+func WithRedisStreamsClaimMinIdle(minIdle time.Duration) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		if minIdle > 0 {
+			c.claimMinIdle = minIdle
+		}
+	}
+}
+
+// Sets how events sent with SendEvent are carried: binary (default) or structured.
+func WithRedisStreamsCloudEventsMode(mode cloudevents.Mode) RedisStreamsOption {
+	return func(c *RedisStreamsClient) {
+		if mode != "" {
+			c.cloudEventsMode = mode
+		}
+	}
+}
+
+func NewRedisStreamsClient(opts ...RedisStreamsOption) (*RedisStreamsClient, error) {
+	redisStreamsClient := &RedisStreamsClient{
+		addr:            "localhost:6379",
+		maxLen:          100000,
+		maxDeliveries:   5,
+		claimMinIdle:    30 * time.Second,
+		cloudEventsMode: cloudevents.ModeBinary,
+	}
+
+	for _, opt := range opts {
+		opt(redisStreamsClient)
+	}
+
+	if redisStreamsClient.Client == nil {
+		redisStreamsClient.Client = redis.NewClient(&redis.Options{Addr: redisStreamsClient.addr})
+	}
+	if redisStreamsClient.consumer == "" {
+		hostname, _ := os.Hostname()
+		redisStreamsClient.consumer = fmt.Sprintf("%s-%s", redisStreamsClient.ServiceName, hostname)
+	}
+	redisStreamsClient.block = min(2*time.Second, redisStreamsClient.claimMinIdle)
+
+	if err := redisStreamsClient.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate RedisStreamsClient: %w", err)
+	}
+
+	return redisStreamsClient, nil
+}
+
+func (c *RedisStreamsClient) Close(ctx context.Context) error {
+	return c.Client.Close()
+}
+
+// Adds a message to the stream, trimming the stream to about maxLen entries.
+func (c *RedisStreamsClient) SendMessage(ctx context.Context, topic string, message *Message) error {
+	values, err := toStreamValues(message, InjectTraceContext(ctx, CopyProperties(message.Properties)))
+	if err != nil {
+		slog.Error("Failed to map message to stream entry", "error", err, "topic", topic)
+		return err
+	}
+
+	if err := c.Client.XAdd(ctx, c.addArgs(topic, values)).Err(); err != nil {
+		slog.Error("Failed to add message to stream", "error", err, "topic", topic)
+		return err
+	}
+
+	return nil
+}
+
+// Sends a CloudEvent in the configured cloud events mode.
+func (c *RedisStreamsClient) SendEvent(ctx context.Context, topic string, event cloudevents.Event) error {
+	message, err := NewCloudEventMessage(event, c.cloudEventsMode)
+	if err != nil {
+		slog.Error("Failed to map cloud event to message", "error", err, "topic", topic)
+		return err
+	}
+
+	return c.SendMessage(ctx, topic, message)
+}
+
+// Reads the stream through the consumer group named subscription until ctx is cancelled, creating the group if needed.
+// Entries stuck with other consumers are claimed every claimMinIdle before new entries are read.
+func (c *RedisStreamsClient) ReceiveMessage(
+	ctx context.Context,
+	topic, subscription string,
+	handler MessageHandler,
+) error {
+	if err := c.Client.XGroupCreateMkStream(ctx, topic, subscription, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		if ctx.Err() != nil {
+			return nil
+		}
+		slog.Error("Failed to create consumer group", "error", err, "topic", topic, "subscription", subscription)
+		return err
+	}
+
+	var lastClaim time.Time
+	for {
+		if ctx.Err() != nil {
+			slog.Info("Stopped receiving messages from topic", "topic", topic, "subscription", subscription)
+			return nil
+		}
+
+		if time.Since(lastClaim) >= c.claimMinIdle {
+			if err := c.claimStuck(ctx, topic, subscription, handler); err != nil && ctx.Err() == nil {
+				slog.Error("Failed to claim stuck entries", "error", err, "topic", topic, "subscription", subscription)
+			}
+			lastClaim = time.Now()
+		}
+
+		streams, err := c.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    subscription,
+			Consumer: c.consumer,
+			Streams:  []string{topic, ">"},
+			Count:    10,
+			Block:    c.block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				slog.Info("Stopped receiving messages from topic", "topic", topic, "subscription", subscription)
+				return nil
+			}
+			slog.Error("Failed to receive messages", "error", err)
+			return err
+		}
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				c.handleEntry(ctx, topic, subscription, entry, 1, handler)
+			}
+		}
+	}
+}
+
+// Claims the entries that have been pending longer than claimMinIdle, dead-lettering those delivered
+// more than maxDeliveries times and handling the others.
+func (c *RedisStreamsClient) claimStuck(ctx context.Context, topic, subscription string, handler MessageHandler) error {
+	start := "0-0"
+	for {
+		entries, next, err := c.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   topic,
+			Group:    subscription,
+			Consumer: c.consumer,
+			MinIdle:  c.claimMinIdle,
+			Start:    start,
+			Count:    10,
+		}).Result()
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			deliveries, err := c.deliveries(ctx, topic, subscription, entry.ID)
+			if err != nil {
+				return err
+			}
+
+			if deliveries > c.maxDeliveries {
+				reason := fmt.Errorf("delivered %d times, more than the maximum of %d", deliveries, c.maxDeliveries)
+				c.deadLetter(context.WithoutCancel(ctx), topic, subscription, entry, deliveries, reason)
+				continue
+			}
+
+			slog.Info("Claimed stuck entry", "topic", topic, "subscription", subscription, "entryId", entry.ID, "deliveries", deliveries)
+			c.handleEntry(ctx, topic, subscription, entry, deliveries, handler)
+		}
+
+		if next == "0-0" || len(entries) == 0 {
+			return nil
+		}
+		start = next
+	}
+}
+
+// Returns how often a pending entry has been delivered.
+func (c *RedisStreamsClient) deliveries(ctx context.Context, topic, subscription, id string) (int, error) {
+	pending, err := c.Client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: topic,
+		Group:  subscription,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 1, nil
+	}
+	return int(pending[0].RetryCount), nil
+}
+
+// Handles an entry on a context that is not cancelled with ctx, so an entry that has started processing is finished
+// and settled: acknowledged on success, left pending on a transient error and dead-lettered on any other error.
+func (c *RedisStreamsClient) handleEntry(
+	ctx context.Context,
+	topic, subscription string,
+	entry redis.XMessage,
+	deliveries int,
+	handler MessageHandler,
+) {
+	c.inflight.Add(1)
+	defer c.inflight.Done()
+
+	handlerCtx := context.WithoutCancel(ctx)
+
+	message, err := fromStreamEntry(entry, deliveries)
+	if err != nil {
+		c.deadLetter(handlerCtx, topic, subscription, entry, deliveries, err)
+		return
+	}
+
+	msgCtx := ExtractTraceContext(handlerCtx, message.Properties)
+	err = handler(msgCtx, topic, subscription, message)
+	switch {
+	case err == nil:
+		if err := c.Client.XAck(handlerCtx, topic, subscription, entry.ID).Err(); err != nil {
+			slog.Error("Failed to ack entry", "error", err, "entryId", entry.ID)
+		}
+	case retry.IsTransient(err):
+		slog.Error("Redis Streams Client, handler failed to handle message, leaving it pending", "error", err, "id", message.ID)
+	default:
+		slog.Error("Redis Streams Client, handler failed to handle message, dead-lettering", "error", err, "id", message.ID)
+		c.deadLetter(handlerCtx, topic, subscription, entry, deliveries, err)
+	}
+}
+
+// Adds the entry to the dead-letter stream with the reason and acknowledges it, in one transaction.
+func (c *RedisStreamsClient) deadLetter(
+	ctx context.Context,
+	topic, subscription string,
+	entry redis.XMessage,
+	deliveries int,
+	reason error,
+) {
+	values := make(map[string]any, len(entry.Values)+4)
+	for key, value := range entry.Values {
+		values[key] = value
+	}
+	values[streamFieldError] = reason.Error()
+	values[streamFieldDeliveries] = deliveries
+	values[streamFieldGroup] = subscription
+	values[streamFieldEntryId] = entry.ID
+
+	pipe := c.Client.TxPipeline()
+	pipe.XAdd(ctx, c.addArgs(DeadLetterStream(topic), values))
+	pipe.XAck(ctx, topic, subscription, entry.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Failed to dead-letter entry", "error", err, "entryId", entry.ID, "topic", topic)
+		return
+	}
+
+	slog.Warn("Dead-lettered entry", "entryId", entry.ID, "topic", topic, "subscription", subscription, "deliveries", deliveries, "reason", reason)
+}
+
+func (c *RedisStreamsClient) addArgs(stream string, values map[string]any) *redis.XAddArgs {
+	args := &redis.XAddArgs{
+		Stream: stream,
+		Values: values,
+	}
+	if c.maxLen > 0 {
+		args.MaxLen = c.maxLen
+		args.Approx = true
+	}
+	return args
+}
+
+// Returns how often a message is delivered at most.
+func (c *RedisStreamsClient) MaxDeliveries() int {
+	return c.maxDeliveries
+}
+
+// Blocks until all in-flight handlers have finished or the context is done.
+func (c *RedisStreamsClient) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight messages did not finish: %w", ctx.Err())
+	}
+}
+
+// Returns the dead-letter stream of a stream.
+func DeadLetterStream(topic string) string {
+	return topic + deadLetterSuffix
+}
+
+// Maps a message onto the fields of a stream entry. Properties are stored as JSON.
+func toStreamValues(message *Message, properties map[string]any) (map[string]any, error) {
+	encoded, err := json.Marshal(properties)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal properties: %w", err)
+	}
+
+	return map[string]any{
+		streamFieldId:          message.ID,
+		streamFieldContentType: message.ContentType,
+		streamFieldProperties:  encoded,
+		streamFieldBody:        message.Body,
+	}, nil
+}
+
+// Maps a stream entry onto a message. Entries without an id use the entry id.
+func fromStreamEntry(entry redis.XMessage, deliveries int) (*Message, error) {
+	field := func(name string) string {
+		value, _ := entry.Values[name].(string)
+		return value
+	}
+
+	message := &Message{
+		ID:            field(streamFieldId),
+		ContentType:   field(streamFieldContentType),
+		Properties:    map[string]any{},
+		Body:          []byte(field(streamFieldBody)),
+		DeliveryCount: deliveries,
+	}
+	if message.ID == "" {
+		message.ID = entry.ID
+	}
+
+	if properties := field(streamFieldProperties); properties != "" {
+		if err := json.Unmarshal([]byte(properties), &message.Properties); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal properties of entry %s: %w", entry.ID, err)
+		}
+	}
+
+	if ms, _, ok := strings.Cut(entry.ID, "-"); ok {
+		if millis, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			message.EnqueuedTime = time.UnixMilli(millis).UTC()
+		}
+	}
+
+	return message, nil
+}
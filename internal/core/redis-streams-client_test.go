@@ -0,0 +1,198 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRedisStreamsTest(t *testing.T, opts ...core.RedisStreamsOption) (*core.RedisStreamsClient, *redis.Client) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client, err := core.NewRedisStreamsClient(append([]core.RedisStreamsOption{
+		core.WithRedisStreamsServiceName("test"),
+		core.WithRedisStreamsAddr(server.Addr()),
+		core.WithRedisStreamsClaimMinIdle(100 * time.Millisecond),
+	}, opts...)...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close(context.Background()) })
+
+	inspect := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { inspect.Close() })
+
+	return client, inspect
+}
+
+// Receives from topic in the background with handler until ctx is cancelled.
+func receiveRedisStreams(ctx context.Context, t *testing.T, client *core.RedisStreamsClient, topic string, handler core.MessageHandler) *sync.WaitGroup {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, client.ReceiveMessage(ctx, topic, "ocpp", handler))
+	}()
+	return &wg
+}
+
+func TestRedisStreamsClient(t *testing.T) {
+	frame := []byte(`[2, "uuid-1", "Heartbeat", {}]`)
+
+	t.Run("SendEvent_ReceiveAndAck", func(t *testing.T) {
+		client, inspect := setupRedisStreamsTest(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		event, err := cloudevents.New("/test", "123456789", frame)
+		assert.NoError(t, err)
+		assert.NoError(t, client.SendEvent(ctx, "ocpp:in", event))
+
+		received := make(chan *core.Message, 1)
+		wg := receiveRedisStreams(ctx, t, client, "ocpp:in", func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			received <- msg
+			return nil
+		})
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, event.ID, msg.ID)
+			assert.Equal(t, 1, msg.DeliveryCount)
+			assert.False(t, msg.EnqueuedTime.IsZero())
+
+			decoded, err := core.CloudEventFromMessage(msg)
+			assert.NoError(t, err)
+			assert.Equal(t, "123456789", decoded.Subject)
+			assert.Equal(t, frame, decoded.Data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+
+		cancel()
+		wg.Wait()
+
+		pending, err := inspect.XPending(context.Background(), "ocpp:in", "ocpp").Result()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), pending.Count)
+	})
+
+	t.Run("TransientError_ClaimedAndRedelivered", func(t *testing.T) {
+		client, _ := setupRedisStreamsTest(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		assert.NoError(t, client.SendMessage(ctx, "ocpp:in", &core.Message{ID: "msg-1", Body: frame}))
+
+		deliveries := make(chan int, 5)
+		wg := receiveRedisStreams(ctx, t, client, "ocpp:in", func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			deliveries <- msg.DeliveryCount
+			if msg.DeliveryCount == 1 {
+				return retry.Transient(errors.New("database is locked"))
+			}
+			return nil
+		})
+
+		for _, want := range []int{1, 2} {
+			select {
+			case got := <-deliveries:
+				assert.Equal(t, want, got)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("delivery %d not received", want)
+			}
+		}
+
+		cancel()
+		wg.Wait()
+	})
+
+	t.Run("PermanentError_DeadLettered", func(t *testing.T) {
+		client, inspect := setupRedisStreamsTest(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		assert.NoError(t, client.SendMessage(ctx, "ocpp:in", &core.Message{ID: "msg-1", Body: frame}))
+
+		handled := make(chan struct{}, 1)
+		wg := receiveRedisStreams(ctx, t, client, "ocpp:in", func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			handled <- struct{}{}
+			return errors.New("invalid payload")
+		})
+
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+
+		assert.Eventually(t, func() bool {
+			entries, err := inspect.XRange(context.Background(), core.DeadLetterStream("ocpp:in"), "-", "+").Result()
+			return err == nil && len(entries) == 1 &&
+				entries[0].Values["id"] == "msg-1" &&
+				entries[0].Values["error"] == "invalid payload"
+		}, 5*time.Second, 50*time.Millisecond)
+
+		cancel()
+		wg.Wait()
+
+		pending, err := inspect.XPending(context.Background(), "ocpp:in", "ocpp").Result()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), pending.Count)
+	})
+
+	t.Run("MaxDeliveriesExceeded_DeadLettered", func(t *testing.T) {
+		client, inspect := setupRedisStreamsTest(t, core.WithRedisStreamsMaxDeliveries(2))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		assert.NoError(t, client.SendMessage(ctx, "ocpp:in", &core.Message{ID: "msg-1", Body: frame}))
+
+		var mu sync.Mutex
+		var handled int
+		wg := receiveRedisStreams(ctx, t, client, "ocpp:in", func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			mu.Lock()
+			handled++
+			mu.Unlock()
+			return retry.Transient(errors.New("database is locked"))
+		})
+
+		assert.Eventually(t, func() bool {
+			entries, err := inspect.XRange(context.Background(), core.DeadLetterStream("ocpp:in"), "-", "+").Result()
+			return err == nil && len(entries) == 1 && entries[0].Values["deliveries"] == "3"
+		}, 5*time.Second, 50*time.Millisecond)
+
+		cancel()
+		wg.Wait()
+
+		mu.Lock()
+		assert.Equal(t, 2, handled)
+		mu.Unlock()
+	})
+
+	t.Run("MaxLen_TrimsStream", func(t *testing.T) {
+		client, inspect := setupRedisStreamsTest(t, core.WithRedisStreamsMaxLen(5))
+		ctx := context.Background()
+
+		for range 20 {
+			assert.NoError(t, client.SendMessage(ctx, "ocpp:in", &core.Message{Body: frame}))
+		}
+
+		length, err := inspect.XLen(ctx, "ocpp:in").Result()
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, length, int64(5))
+	})
+
+	t.Run("MaxDeliveries", func(t *testing.T) {
+		client, _ := setupRedisStreamsTest(t, core.WithRedisStreamsMaxDeliveries(7))
+		assert.Equal(t, 7, client.MaxDeliveries())
+	})
+}
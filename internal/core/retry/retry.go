@@ -0,0 +1,182 @@
+// Package retry separates transient errors from permanent ones and retries transient errors with exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Represents whether an error is worth retrying.
+type Class int
+
+const (
+	// The error will not go away by retrying, e.g. an invalid payload.
+	ClassPermanent Class = iota
+	// The error may go away by retrying, e.g. a dropped connection or a locked database.
+	ClassTransient
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassTransient:
+		return "transient"
+	default:
+		return "permanent"
+	}
+}
+
+// Classifies an error. Returns ok false if it does not recognise the error.
+type Classifier func(err error) (class Class, ok bool)
+
+type classifiedError struct {
+	class Class
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// Marks an error as transient.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: ClassTransient, err: err}
+}
+
+// Marks an error as permanent.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: ClassPermanent, err: err}
+}
+
+// Classifies an error. Errors marked with Transient or Permanent keep their mark,
+// otherwise the classifiers are asked in order, then the defaults: network errors,
+// unexpected EOFs, refused or reset connections and deadlines are transient.
+// Anything not recognised is permanent, so it is not retried blindly.
+func Classify(err error, classifiers ...Classifier) Class {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+
+	for _, classifier := range classifiers {
+		if class, ok := classifier(err); ok {
+			return class
+		}
+	}
+
+	if class, ok := defaultClassifier(err); ok {
+		return class
+	}
+
+	return ClassPermanent
+}
+
+// Checks if an error is transient.
+func IsTransient(err error, classifiers ...Classifier) bool {
+	return err != nil && Classify(err, classifiers...) == ClassTransient
+}
+
+func defaultClassifier(err error) (Class, bool) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ClassPermanent, false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.EOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.As(err, &netErr):
+		return ClassTransient, true
+	default:
+		return ClassPermanent, false
+	}
+}
+
+// Defines how often and how quickly a transient error is retried.
+type Policy struct {
+	// Total number of in-process attempts, including the first one.
+	MaxAttempts int
+	// Delay before the first retry.
+	InitialInterval time.Duration
+	// Upper bound of the delay between retries.
+	MaxInterval time.Duration
+	// Factor the delay grows by after each retry.
+	Multiplier float64
+	// Fraction of the delay that is randomised, between 0 and 1.
+	Jitter float64
+}
+
+// Returns the default policy: 3 attempts, starting at 100ms and doubling up to 5s with 20% jitter.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:     3,
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// Returns the delay before retry number attempt (starting at 1).
+// The delay grows exponentially up to MaxInterval and is randomised by up to ±Jitter of itself.
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay += delay * jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// Calls fn until it succeeds, fails with a permanent error, MaxAttempts is reached or ctx is done.
+// Returns the last error of fn.
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error, classifiers ...Classifier) error {
+	maxAttempts := max(policy.MaxAttempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || attempt >= maxAttempts || !IsTransient(err, classifiers...) {
+			return err
+		}
+
+		timer := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	t.Run("Unknown", func(t *testing.T) {
+		assert.Equal(t, retry.ClassPermanent, retry.Classify(errors.New("invalid payload")))
+	})
+
+	t.Run("Marked", func(t *testing.T) {
+		assert.Equal(t, retry.ClassTransient, retry.Classify(fmt.Errorf("wrapped: %w", retry.Transient(errors.New("busy")))))
+		assert.Equal(t, retry.ClassPermanent, retry.Classify(retry.Permanent(io.ErrUnexpectedEOF)))
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		assert.Equal(t, retry.ClassTransient, retry.Classify(fmt.Errorf("read: %w", io.ErrUnexpectedEOF)))
+		assert.Equal(t, retry.ClassTransient, retry.Classify(context.DeadlineExceeded))
+		assert.Equal(t, retry.ClassPermanent, retry.Classify(context.Canceled))
+	})
+
+	t.Run("Classifier", func(t *testing.T) {
+		locked := errors.New("database is locked")
+		classifier := func(err error) (retry.Class, bool) {
+			if errors.Is(err, locked) {
+				return retry.ClassTransient, true
+			}
+			return retry.ClassPermanent, false
+		}
+		assert.True(t, retry.IsTransient(fmt.Errorf("failed: %w", locked), classifier))
+		assert.False(t, retry.IsTransient(errors.New("other"), classifier))
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	policy := retry.Policy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+	}
+
+	t.Run("Exponential", func(t *testing.T) {
+		assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+		assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+		assert.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+		assert.Equal(t, time.Second, policy.Backoff(10))
+	})
+
+	t.Run("Jitter", func(t *testing.T) {
+		jittered := policy
+		jittered.Jitter = 0.5
+		for range 100 {
+			delay := jittered.Backoff(2)
+			assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+			assert.LessOrEqual(t, delay, 300*time.Millisecond)
+		}
+	})
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	policy := retry.Policy{MaxAttempts: 3, InitialInterval: time.Millisecond, Multiplier: 2}
+
+	t.Run("TransientThenSuccess", func(t *testing.T) {
+		calls := 0
+		err := retry.Do(ctx, policy, func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return retry.Transient(errors.New("busy"))
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("TransientExhausted", func(t *testing.T) {
+		calls := 0
+		err := retry.Do(ctx, policy, func(ctx context.Context) error {
+			calls++
+			return retry.Transient(errors.New("busy"))
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Permanent", func(t *testing.T) {
+		calls := 0
+		err := retry.Do(ctx, policy, func(ctx context.Context) error {
+			calls++
+			return errors.New("invalid payload")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("ContextDone", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		calls := 0
+		err := retry.Do(ctx, retry.Policy{MaxAttempts: 3, InitialInterval: time.Hour}, func(ctx context.Context) error {
+			calls++
+			return retry.Transient(errors.New("busy"))
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
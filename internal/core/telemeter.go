@@ -6,9 +6,11 @@ import (
 	"os"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
@@ -40,10 +42,32 @@ func (t *Telemeter) NewTracerProvider() *trace.TracerProvider {
 	)
 
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 	return tp
 }
 
+func (t *Telemeter) NewMeterProvider() *metric.MeterProvider {
+	ctx := context.Background()
+	exporter, err := otlpmetricgrpc.New(ctx,
+		otlpmetricgrpc.WithEndpoint(t.endpoint),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	mp := metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(exporter)),
+		metric.WithResource(getResource(t.serviceName, t.namespace)),
+	)
+
+	otel.SetMeterProvider(mp)
+	return mp
+}
+
 func NewTelemeter(serviceName, endpoint, namespace string) *Telemeter {
 	if endpoint == "" || serviceName == "" || namespace == "" {
 		panic(fmt.Sprintf("telemeter is not configured: %s, %s, %s", serviceName, endpoint, namespace))
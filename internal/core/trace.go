@@ -3,7 +3,9 @@ package core
 import (
 	"context"
 
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -30,3 +32,47 @@ func TraceCache(ctx context.Context, tracer trace.Tracer, operationName string)
 
 	return ctx, span
 }
+
+// Adapts message application properties to a propagation.TextMapCarrier,
+// so W3C traceparent/tracestate can travel as message properties.
+type MessagePropertiesCarrier map[string]any
+
+var _ propagation.TextMapCarrier = MessagePropertiesCarrier{}
+
+func (c MessagePropertiesCarrier) Get(key string) string {
+	value, ok := c[key].(string)
+	if !ok {
+		return ""
+	}
+	return value
+}
+
+func (c MessagePropertiesCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c MessagePropertiesCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Injects the trace context of ctx into the message properties using the global propagator.
+// Returns the properties, allocating them if nil.
+func InjectTraceContext(ctx context.Context, properties map[string]any) map[string]any {
+	if properties == nil {
+		properties = make(map[string]any)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, MessagePropertiesCarrier(properties))
+	return properties
+}
+
+// Extracts the trace context carried in the message properties into ctx using the global propagator.
+func ExtractTraceContext(ctx context.Context, properties map[string]any) context.Context {
+	if properties == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, MessagePropertiesCarrier(properties))
+}
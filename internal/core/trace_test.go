@@ -0,0 +1,55 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	state, _ := trace.ParseTraceState("vendor=value")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	t.Run("Inject_NilProperties", func(t *testing.T) {
+		properties := core.InjectTraceContext(ctx, nil)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", properties["traceparent"])
+		assert.Equal(t, "vendor=value", properties["tracestate"])
+	})
+
+	t.Run("Inject_KeepsProperties", func(t *testing.T) {
+		properties := core.InjectTraceContext(ctx, map[string]any{"serialnumber": "123456789"})
+		assert.Equal(t, "123456789", properties["serialnumber"])
+		assert.NotEmpty(t, properties["traceparent"])
+	})
+
+	t.Run("Extract", func(t *testing.T) {
+		properties := core.InjectTraceContext(ctx, nil)
+		extracted := trace.SpanContextFromContext(core.ExtractTraceContext(context.Background(), properties))
+		assert.True(t, extracted.IsRemote())
+		assert.Equal(t, sc.TraceID(), extracted.TraceID())
+		assert.Equal(t, sc.SpanID(), extracted.SpanID())
+		assert.Equal(t, "vendor=value", extracted.TraceState().String())
+	})
+
+	t.Run("Extract_InvalidTraceParent", func(t *testing.T) {
+		// a bare span id, as previously sent by the message service, is not a valid traceparent
+		properties := map[string]any{"traceparent": "00f067aa0ba902b7"}
+		extracted := trace.SpanContextFromContext(core.ExtractTraceContext(context.Background(), properties))
+		assert.False(t, extracted.IsValid())
+	})
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+)
+
+const (
+	TransportAzureServiceBus = "azure-service-bus"
+	TransportNats            = "nats"
+	TransportMqtt            = "mqtt"
+	TransportRedisStreams    = "redis-streams"
+)
+
+// Represents a message independent of the transport carrying it.
+type Message struct {
+	ID          string
+	ContentType string
+	Properties  map[string]any
+	Body        []byte
+
+	// Set on received messages
+	EnqueuedTime  time.Time
+	DeliveryCount int
+}
+
+type MessageHandler func(ctx context.Context, topic, subscription string, msg *Message) error
+
+// Represents a message transport, e.g. Azure Service Bus, NATS JetStream, MQTT or Redis Streams.
+// A topic is the destination messages are sent to, a subscription a durable receiver of a topic.
+type Transport interface {
+	SendMessage(ctx context.Context, topic string, message *Message) error
+	SendEvent(ctx context.Context, topic string, event cloudevents.Event) error
+	// Receives messages until the context is cancelled, settling each with the handler outcome.
+	ReceiveMessage(ctx context.Context, topic, subscription string, handler MessageHandler) error
+	// Blocks until all in-flight handlers have finished or the context is done.
+	Wait(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// Implemented by transports that can enqueue a message for later delivery.
+type Scheduler interface {
+	ScheduleMessage(ctx context.Context, topic string, message *Message, enqueueAt time.Time) error
+}
+
+// Implemented by transports that redeliver a message when the handler returns a transient error.
+type Redeliverer interface {
+	// Returns how often a message is delivered at most.
+	MaxDeliveries() int
+}
+
+// Implemented by transports that can keep the messages of a charge point in order. A message of an ordered transport
+// that is retried later has to be redelivered in its place, as a scheduled copy would come after the messages behind it.
+type Orderer interface {
+	// Reports whether the messages of a charge point are received in order.
+	Ordered() bool
+}
+
+// Application property keeping the id of the message a scheduled copy was made from.
+const OriginalIDProperty = "originalmessageid"
+
+// Returns the id of the message, or of the message it is a scheduled copy of.
+func OriginalMessageID(msg *Message) string {
+	if id, ok := msg.Properties[OriginalIDProperty].(string); ok && id != "" {
+		return id
+	}
+	return msg.ID
+}
+
+// Creates the transport selected by the configuration.
+func NewTransport(serviceName string, config utils.Configuration) (Transport, error) {
+	switch config.Transport {
+	case TransportAzureServiceBus, "":
+		return NewAzureServiceBusClient(
+			WithAzureServiceBusServiceName(serviceName),
+			WithAzureServiceBusConnectionString(config.AzureServiceBus.ConnectionString),
+			WithAzureServiceBusSessions(config.AzureServiceBus.Sessions.Enabled),
+			WithAzureServiceBusMaxConcurrentSessions(config.AzureServiceBus.Sessions.MaxConcurrent),
+			WithAzureServiceBusMaxDeliveryCount(config.AzureServiceBus.MaxDeliveryCount),
+			WithAzureServiceBusCloudEventsMode(cloudevents.Mode(config.AzureServiceBus.CloudEventsMode)),
+		)
+	case TransportNats:
+		return NewNatsClient(
+			WithNatsServiceName(serviceName),
+			WithNatsURL(config.Nats.URL),
+			WithNatsStream(config.Nats.Stream, config.Nats.TopicInbound.Name, config.Nats.TopicOutbound.Name),
+			WithNatsMaxDeliver(config.Nats.MaxDeliver),
+			WithNatsAckWait(config.Nats.AckWait),
+			WithNatsCloudEventsMode(cloudevents.Mode(config.Nats.CloudEventsMode)),
+		)
+	case TransportMqtt:
+		return NewMqttClient(
+			WithMqttServiceName(serviceName),
+			WithMqttURL(config.Mqtt.URL),
+			WithMqttClientId(config.Mqtt.ClientId),
+			WithMqttCredentials(config.Mqtt.Username, config.Mqtt.Password),
+			WithMqttSessionExpiry(config.Mqtt.SessionExpiry),
+			WithMqttCloudEventsMode(cloudevents.Mode(config.Mqtt.CloudEventsMode)),
+		)
+	case TransportRedisStreams:
+		return NewRedisStreamsClient(
+			WithRedisStreamsServiceName(serviceName),
+			WithRedisStreamsAddr(config.RedisStreams.Addr),
+			WithRedisStreamsConsumer(config.RedisStreams.Consumer),
+			WithRedisStreamsMaxLen(config.RedisStreams.MaxLen),
+			WithRedisStreamsMaxDeliveries(config.RedisStreams.MaxDeliveries),
+			WithRedisStreamsClaimMinIdle(config.RedisStreams.ClaimMinIdle),
+			WithRedisStreamsCloudEventsMode(cloudevents.Mode(config.RedisStreams.CloudEventsMode)),
+		)
+	default:
+		return nil, fmt.Errorf("unknown transport %q", config.Transport)
+	}
+}
+
+// Returns a copy of the properties of a message that can be changed without changing the message, empty when it has
+// none.
+func CopyProperties(properties map[string]any) map[string]any {
+	copied := make(map[string]any, len(properties))
+	for key, value := range properties {
+		copied[key] = value
+	}
+	return copied
+}
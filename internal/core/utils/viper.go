@@ -4,15 +4,31 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Configuration struct {
 	Telemetry       TelemetryConfiguration
+	Transport       string
 	AzureServiceBus AzureServiceBusConfiguration
+	Nats            NatsConfiguration
+	Mqtt            MqttConfiguration
+	RedisStreams    RedisStreamsConfiguration
 	HttpServer      HttpServer
 	Database        DatabaseConfiguration
+	Retry           RetryConfiguration
+	Webhook         WebhookConfiguration
+	Outbox          OutboxConfiguration
+	Journal         JournalConfiguration
+	Tariff          TariffConfiguration
+	Boot            BootConfiguration
+	Tenancy         TenancyConfiguration
+	Ocpi            OcpiConfiguration
+	RequestTimeout  RequestTimeoutConfiguration
+	Cache           CacheConfiguration
 }
 
 type Topic struct {
@@ -28,6 +44,59 @@ type AzureServiceBusConfiguration struct {
 	ConnectionString string
 	TopicInbound     Topic
 	TopicOutbound    Topic
+	Sessions         SessionConfiguration
+	MaxDeliveryCount int
+	CloudEventsMode  string
+}
+
+type NatsConfiguration struct {
+	URL             string
+	Stream          string
+	TopicInbound    Topic // Name is the subject prefix, e.g. ocpp.in; Subscription the durable consumer
+	TopicOutbound   Topic
+	MaxDeliver      int
+	AckWait         time.Duration
+	CloudEventsMode string
+}
+
+type MqttConfiguration struct {
+	URL             string
+	ClientId        string
+	Username        string
+	Password        string
+	TopicInbound    Topic // Name is the topic pattern, e.g. ocpp/+/in; Subscription the shared subscription group
+	TopicOutbound   Topic
+	SessionExpiry   time.Duration
+	CloudEventsMode string
+}
+
+type RedisStreamsConfiguration struct {
+	Addr            string
+	Consumer        string
+	TopicInbound    Topic // Name is the stream, e.g. ocpp:in; Subscription the consumer group
+	TopicOutbound   Topic
+	MaxLen          int64
+	MaxDeliveries   int
+	ClaimMinIdle    time.Duration
+	CloudEventsMode string
+}
+
+type SessionConfiguration struct {
+	Enabled       bool
+	MaxConcurrent int
+}
+
+// Returns the inbound and outbound topics of the configured transport.
+func (c Configuration) Topics() (inbound, outbound Topic) {
+	switch c.Transport {
+	case "nats":
+		return c.Nats.TopicInbound, c.Nats.TopicOutbound
+	case "mqtt":
+		return c.Mqtt.TopicInbound, c.Mqtt.TopicOutbound
+	case "redis-streams":
+		return c.RedisStreams.TopicInbound, c.RedisStreams.TopicOutbound
+	}
+	return c.AzureServiceBus.TopicInbound, c.AzureServiceBus.TopicOutbound
 }
 
 type HttpServer struct {
@@ -40,6 +109,190 @@ type DatabaseConfiguration struct {
 	Protocol string
 	Driver   string
 	PoolSize int
+	// Leaves the schema as it is on start, for deployments that run the migrate command instead.
+	SkipMigrations bool
+}
+
+type RetryConfiguration struct {
+	MaxAttempts        int
+	InitialInterval    time.Duration
+	MaxInterval        time.Duration
+	Multiplier         float64
+	Jitter             float64
+	MaxReschedules     int
+	RescheduleInterval time.Duration
+}
+
+type WebhookConfiguration struct {
+	Endpoints       []WebhookEndpointConfiguration
+	Timeout         time.Duration
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	QueueSize       int
+}
+
+type WebhookEndpointConfiguration struct {
+	URL    string   `mapstructure:"URL"`
+	Secret string   `mapstructure:"SECRET"`
+	Events []string `mapstructure:"EVENTS"` // Event types to post, e.g. ocpp.transaction.*; empty for all
+}
+
+type OutboxConfiguration struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Retention    time.Duration
+	MaxAttempts  int
+	Lease        time.Duration
+}
+
+type JournalConfiguration struct {
+	Enabled       bool
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+type TariffConfiguration struct {
+	Tariffs     []TariffDefinitionConfiguration
+	Groups      map[string][]string // idTags per group, keyed in lower case as viper reads them
+	Assignments []TariffAssignmentConfiguration
+}
+
+// Prices are decimal strings in the currency of the tariff.
+type TariffDefinitionConfiguration struct {
+	ID              string                    `mapstructure:"ID"`
+	Currency        string                    `mapstructure:"CURRENCY"`          // ISO 4217, e.g. GBP
+	StartFee        string                    `mapstructure:"START_FEE"`         // per session
+	EnergyPrice     string                    `mapstructure:"ENERGY_PRICE"`      // per kWh
+	TimePrice       string                    `mapstructure:"TIME_PRICE"`        // per hour charging
+	IdlePrice       string                    `mapstructure:"IDLE_PRICE"`        // per hour idle after the grace period
+	IdleGracePeriod time.Duration             `mapstructure:"IDLE_GRACE_PERIOD"` // idle time that is not billed
+	TimeZone        string                    `mapstructure:"TIME_ZONE"`         // IANA zone the bands are in; UTC when empty
+	Bands           []TariffBandConfiguration `mapstructure:"BANDS"`
+}
+
+// Start and End are HH:MM times of day; a band that ends before it starts runs past midnight.
+// Empty prices keep those of the tariff.
+type TariffBandConfiguration struct {
+	Start       string `mapstructure:"START"`
+	End         string `mapstructure:"END"`
+	EnergyPrice string `mapstructure:"ENERGY_PRICE"`
+	TimePrice   string `mapstructure:"TIME_PRICE"`
+}
+
+// Assigns a tariff to charge points, idTag groups or both; an assignment without either is the default.
+type TariffAssignmentConfiguration struct {
+	Tariff        string   `mapstructure:"TARIFF"`
+	Serialnumbers []string `mapstructure:"SERIALNUMBERS"`
+	Groups        []string `mapstructure:"GROUPS"`
+}
+
+// Answers the BootNotification of a charge point. Status is Accepted, Pending or Rejected, and Interval the heartbeat
+// interval when accepted or else when to boot again.
+type BootConfiguration struct {
+	Status   string        `mapstructure:"STATUS"`
+	Interval time.Duration `mapstructure:"INTERVAL"`
+}
+
+// Runs the service for several operators. A message belongs to the tenant of its tenantid property, or else to the
+// tenant its charge point is routed to, or else to the default tenant.
+type TenancyConfiguration struct {
+	Default string // tenant of messages neither carrying nor routed to one; empty is the default tenant
+	Tenants []TenantConfiguration
+}
+
+// Routes charge points to a tenant. Empty boot fields keep the boot policy of the service, and tariffs, when any are
+// listed, replace those of the service for the charge points of the tenant.
+type TenantConfiguration struct {
+	ID            string              `mapstructure:"ID"`
+	Serialnumbers []string            `mapstructure:"SERIALNUMBERS"`
+	Boot          BootConfiguration   `mapstructure:"BOOT"`
+	Tariff        TariffConfiguration `mapstructure:"TARIFF"`
+}
+
+type OcpiConfiguration struct {
+	Enabled     bool
+	Port        string   // e.g. :8090
+	BaseURL     string   // URL partners reach the module at, e.g. https://cpo.example.com; the request host when empty
+	CountryCode string   // ISO 3166-1 alpha-2 country code of the CPO
+	PartyId     string   // party id of the CPO, 3 characters
+	Currency    string   // ISO 4217, of sessions and CDRs no tariff applies to
+	Tenant      string   // tenant whose charge points are served; empty is the default tenant
+	Tokens      []string // credentials tokens partners authenticate with
+	PageLimit   int      // most objects returned per page
+	Locations   []OcpiLocationConfiguration
+}
+
+// Places charge points at a location. Each of their connectors is published as an EVSE with a single connector.
+type OcpiLocationConfiguration struct {
+	ID            string                     `mapstructure:"ID"`
+	Name          string                     `mapstructure:"NAME"`
+	Address       string                     `mapstructure:"ADDRESS"`
+	City          string                     `mapstructure:"CITY"`
+	PostalCode    string                     `mapstructure:"POSTAL_CODE"`
+	Country       string                     `mapstructure:"COUNTRY"` // ISO 3166-1 alpha-3, e.g. GBR
+	Latitude      string                     `mapstructure:"LATITUDE"`
+	Longitude     string                     `mapstructure:"LONGITUDE"`
+	TimeZone      string                     `mapstructure:"TIME_ZONE"` // IANA zone, e.g. Europe/London
+	Serialnumbers []string                   `mapstructure:"SERIALNUMBERS"`
+	Connector     OcpiConnectorConfiguration `mapstructure:"CONNECTOR"`
+}
+
+// Describes the connectors of the charge points at a location. Empty fields take the values of a 22 kW Type 2 socket.
+type OcpiConnectorConfiguration struct {
+	Standard         string `mapstructure:"STANDARD"`           // e.g. IEC_62196_T2
+	Format           string `mapstructure:"FORMAT"`             // SOCKET or CABLE
+	PowerType        string `mapstructure:"POWER_TYPE"`         // AC_1_PHASE, AC_2_PHASE, AC_3_PHASE or DC
+	MaxVoltage       int    `mapstructure:"MAX_VOLTAGE"`        // in V
+	MaxAmperage      int    `mapstructure:"MAX_AMPERAGE"`       // in A
+	MaxElectricPower int    `mapstructure:"MAX_ELECTRIC_POWER"` // in W
+}
+
+type CacheConfiguration struct {
+	Driver         string // "redis" or "memory"
+	MaxEntries     int    // completed claims the memory cache holds before it evicts the least recently used
+	MaxLiveEntries int    // in-progress claims and pending requests the memory cache holds before it refuses new ones
+
+	// Redis connectivity
+	Addrs            []string // one address, the seed nodes of a Cluster or the Sentinels
+	Username         string
+	Password         string
+	DB               int
+	MasterName       string // Sentinel master name; connects through the Sentinels in Addrs when set
+	SentinelUsername string
+	SentinelPassword string
+	Cluster          bool // Cluster mode, also with a single configuration endpoint in Addrs
+	TLS              CacheTLSConfiguration
+	PoolSize         int
+	MinIdleConns     int
+	PoolTimeout      time.Duration
+	DialTimeout      time.Duration
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+}
+
+type CacheTLSConfiguration struct {
+	Enabled            bool
+	ServerName         string // defaults to the host of the address
+	CAFile             string // PEM CA certificates; the system pool when empty
+	CertFile           string // PEM client certificate, for mutual TLS
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+type RequestTimeoutConfiguration struct {
+	Default       time.Duration
+	Actions       map[string]time.Duration // per OCPP action, keyed in lower case
+	SweepInterval time.Duration
+}
+
+// Returns how long a request of the action may wait for its confirmation.
+func (c RequestTimeoutConfiguration) Timeout(action string) time.Duration {
+	if timeout, ok := c.Actions[strings.ToLower(action)]; ok {
+		return timeout
+	}
+	return c.Default
 }
 
 func initiateConfigDefaults(configName string, configPath []string, configType string) *viper.Viper {
@@ -68,6 +321,48 @@ func initiateConfigDefaults(configName string, configPath []string, configType s
 	viperObj.SetConfigName(configName)
 	viperObj.SetConfigType(configType)
 	viperObj.SetDefault("port", 8000)
+	viperObj.SetDefault("TRANSPORT", "azure-service-bus")
+	viperObj.SetDefault("AZURE_SERVICE_BUS.MAX_DELIVERY_COUNT", 10)
+	viperObj.SetDefault("NATS.MAX_DELIVER", 5)
+	viperObj.SetDefault("NATS.ACK_WAIT", "30s")
+	viperObj.SetDefault("MQTT.SESSION_EXPIRY", "1h")
+	viperObj.SetDefault("REDIS_STREAMS.MAX_LEN", 100000)
+	viperObj.SetDefault("REDIS_STREAMS.MAX_DELIVERIES", 5)
+	viperObj.SetDefault("REDIS_STREAMS.CLAIM_MIN_IDLE", "30s")
+	viperObj.SetDefault("RETRY.MAX_ATTEMPTS", 3)
+	viperObj.SetDefault("RETRY.INITIAL_INTERVAL", "100ms")
+	viperObj.SetDefault("RETRY.MAX_INTERVAL", "5s")
+	viperObj.SetDefault("RETRY.MULTIPLIER", 2)
+	viperObj.SetDefault("RETRY.JITTER", 0.2)
+	viperObj.SetDefault("RETRY.MAX_RESCHEDULES", 3)
+	viperObj.SetDefault("RETRY.RESCHEDULE_INTERVAL", "30s")
+	viperObj.SetDefault("WEBHOOK.TIMEOUT", "10s")
+	viperObj.SetDefault("WEBHOOK.MAX_ATTEMPTS", 5)
+	viperObj.SetDefault("WEBHOOK.INITIAL_INTERVAL", "1s")
+	viperObj.SetDefault("WEBHOOK.MAX_INTERVAL", "1m")
+	viperObj.SetDefault("WEBHOOK.QUEUE_SIZE", 1000)
+	viperObj.SetDefault("OUTBOX.POLL_INTERVAL", "1s")
+	viperObj.SetDefault("OUTBOX.BATCH_SIZE", 100)
+	viperObj.SetDefault("OUTBOX.RETENTION", "24h")
+	viperObj.SetDefault("OUTBOX.MAX_ATTEMPTS", 10)
+	viperObj.SetDefault("OUTBOX.LEASE", "30s")
+	viperObj.SetDefault("JOURNAL.ENABLED", true)
+	viperObj.SetDefault("JOURNAL.QUEUE_SIZE", 10000)
+	viperObj.SetDefault("JOURNAL.BATCH_SIZE", 100)
+	viperObj.SetDefault("JOURNAL.FLUSH_INTERVAL", "1s")
+	viperObj.SetDefault("REQUEST_TIMEOUT.DEFAULT", "30s")
+	viperObj.SetDefault("REQUEST_TIMEOUT.SWEEP_INTERVAL", "5s")
+	viperObj.SetDefault("BOOT.STATUS", "Accepted")
+	viperObj.SetDefault("BOOT.INTERVAL", "30s")
+	viperObj.SetDefault("OCPI.PORT", ":8090")
+	viperObj.SetDefault("OCPI.PAGE_LIMIT", 100)
+	viperObj.SetDefault("CACHE.DRIVER", "redis")
+	viperObj.SetDefault("CACHE.MAX_ENTRIES", 100000)
+	viperObj.SetDefault("CACHE.MAX_LIVE_ENTRIES", 100000)
+	viperObj.SetDefault("CACHE.ADDRS", []string{"localhost:6379"})
+	viperObj.SetDefault("CACHE.DIAL_TIMEOUT", "5s")
+	viperObj.SetDefault("CACHE.READ_TIMEOUT", "3s")
+	viperObj.SetDefault("CACHE.WRITE_TIMEOUT", "3s")
 
 	return viperObj
 }
@@ -87,6 +382,7 @@ func GetConfig(path, name, extn string) Configuration {
 		Telemetry: TelemetryConfiguration{
 			ENDPOINT: viperObj.GetString("TELEMETRY.ENDPOINT"),
 		},
+		Transport: viperObj.GetString("TRANSPORT"),
 		AzureServiceBus: AzureServiceBusConfiguration{
 			ConnectionString: viperObj.GetString("AZURE_SERVICE_BUS.CONNECTION_STRING"),
 			TopicInbound: Topic{
@@ -97,16 +393,211 @@ func GetConfig(path, name, extn string) Configuration {
 				Name:         viperObj.GetString("AZURE_SERVICE_BUS.TOPIC_OUTBOUND.NAME"),
 				Subscription: viperObj.GetString("AZURE_SERVICE_BUS.TOPIC_OUTBOUND.SUBSCRIPTION"),
 			},
+			Sessions: SessionConfiguration{
+				Enabled:       viperObj.GetBool("AZURE_SERVICE_BUS.SESSIONS.ENABLED"),
+				MaxConcurrent: viperObj.GetInt("AZURE_SERVICE_BUS.SESSIONS.MAX_CONCURRENT"),
+			},
+			MaxDeliveryCount: viperObj.GetInt("AZURE_SERVICE_BUS.MAX_DELIVERY_COUNT"),
+			CloudEventsMode:  viperObj.GetString("AZURE_SERVICE_BUS.CLOUD_EVENTS_MODE"),
+		},
+		Nats: NatsConfiguration{
+			URL:    viperObj.GetString("NATS.URL"),
+			Stream: viperObj.GetString("NATS.STREAM"),
+			TopicInbound: Topic{
+				Name:         viperObj.GetString("NATS.TOPIC_INBOUND.NAME"),
+				Subscription: viperObj.GetString("NATS.TOPIC_INBOUND.SUBSCRIPTION"),
+			},
+			TopicOutbound: Topic{
+				Name:         viperObj.GetString("NATS.TOPIC_OUTBOUND.NAME"),
+				Subscription: viperObj.GetString("NATS.TOPIC_OUTBOUND.SUBSCRIPTION"),
+			},
+			MaxDeliver:      viperObj.GetInt("NATS.MAX_DELIVER"),
+			AckWait:         viperObj.GetDuration("NATS.ACK_WAIT"),
+			CloudEventsMode: viperObj.GetString("NATS.CLOUD_EVENTS_MODE"),
+		},
+		Mqtt: MqttConfiguration{
+			URL:      viperObj.GetString("MQTT.URL"),
+			ClientId: viperObj.GetString("MQTT.CLIENT_ID"),
+			Username: viperObj.GetString("MQTT.USERNAME"),
+			Password: viperObj.GetString("MQTT.PASSWORD"),
+			TopicInbound: Topic{
+				Name:         viperObj.GetString("MQTT.TOPIC_INBOUND.NAME"),
+				Subscription: viperObj.GetString("MQTT.TOPIC_INBOUND.SUBSCRIPTION"),
+			},
+			TopicOutbound: Topic{
+				Name:         viperObj.GetString("MQTT.TOPIC_OUTBOUND.NAME"),
+				Subscription: viperObj.GetString("MQTT.TOPIC_OUTBOUND.SUBSCRIPTION"),
+			},
+			SessionExpiry:   viperObj.GetDuration("MQTT.SESSION_EXPIRY"),
+			CloudEventsMode: viperObj.GetString("MQTT.CLOUD_EVENTS_MODE"),
+		},
+		RedisStreams: RedisStreamsConfiguration{
+			Addr:     viperObj.GetString("REDIS_STREAMS.ADDR"),
+			Consumer: viperObj.GetString("REDIS_STREAMS.CONSUMER"),
+			TopicInbound: Topic{
+				Name:         viperObj.GetString("REDIS_STREAMS.TOPIC_INBOUND.NAME"),
+				Subscription: viperObj.GetString("REDIS_STREAMS.TOPIC_INBOUND.SUBSCRIPTION"),
+			},
+			TopicOutbound: Topic{
+				Name:         viperObj.GetString("REDIS_STREAMS.TOPIC_OUTBOUND.NAME"),
+				Subscription: viperObj.GetString("REDIS_STREAMS.TOPIC_OUTBOUND.SUBSCRIPTION"),
+			},
+			MaxLen:          viperObj.GetInt64("REDIS_STREAMS.MAX_LEN"),
+			MaxDeliveries:   viperObj.GetInt("REDIS_STREAMS.MAX_DELIVERIES"),
+			ClaimMinIdle:    viperObj.GetDuration("REDIS_STREAMS.CLAIM_MIN_IDLE"),
+			CloudEventsMode: viperObj.GetString("REDIS_STREAMS.CLOUD_EVENTS_MODE"),
 		},
 		HttpServer: HttpServer{
 			Port: viperObj.GetString("HTTP_SERVER.PORT"),
 			Host: viperObj.GetString("HTTP_SERVER.HOST"),
 		},
 		Database: DatabaseConfiguration{
-			Address:  viperObj.GetString("DATABASE.ADDR"),
-			Protocol: viperObj.GetString("DATABASE.PROTOCOL"),
-			Driver:   viperObj.GetString("DATABASE.DRIVER"),
-			PoolSize: viperObj.GetInt("DATABASE.POOL_SIZE"),
+			Address:        viperObj.GetString("DATABASE.ADDR"),
+			Protocol:       viperObj.GetString("DATABASE.PROTOCOL"),
+			Driver:         viperObj.GetString("DATABASE.DRIVER"),
+			PoolSize:       viperObj.GetInt("DATABASE.POOL_SIZE"),
+			SkipMigrations: viperObj.GetBool("DATABASE.SKIP_MIGRATIONS"),
+		},
+		Retry: RetryConfiguration{
+			MaxAttempts:        viperObj.GetInt("RETRY.MAX_ATTEMPTS"),
+			InitialInterval:    viperObj.GetDuration("RETRY.INITIAL_INTERVAL"),
+			MaxInterval:        viperObj.GetDuration("RETRY.MAX_INTERVAL"),
+			Multiplier:         viperObj.GetFloat64("RETRY.MULTIPLIER"),
+			Jitter:             viperObj.GetFloat64("RETRY.JITTER"),
+			MaxReschedules:     viperObj.GetInt("RETRY.MAX_RESCHEDULES"),
+			RescheduleInterval: viperObj.GetDuration("RETRY.RESCHEDULE_INTERVAL"),
+		},
+		Webhook: WebhookConfiguration{
+			Endpoints:       webhookEndpoints(viperObj),
+			Timeout:         viperObj.GetDuration("WEBHOOK.TIMEOUT"),
+			MaxAttempts:     viperObj.GetInt("WEBHOOK.MAX_ATTEMPTS"),
+			InitialInterval: viperObj.GetDuration("WEBHOOK.INITIAL_INTERVAL"),
+			MaxInterval:     viperObj.GetDuration("WEBHOOK.MAX_INTERVAL"),
+			QueueSize:       viperObj.GetInt("WEBHOOK.QUEUE_SIZE"),
+		},
+		Outbox: OutboxConfiguration{
+			PollInterval: viperObj.GetDuration("OUTBOX.POLL_INTERVAL"),
+			BatchSize:    viperObj.GetInt("OUTBOX.BATCH_SIZE"),
+			Retention:    viperObj.GetDuration("OUTBOX.RETENTION"),
+			MaxAttempts:  viperObj.GetInt("OUTBOX.MAX_ATTEMPTS"),
+			Lease:        viperObj.GetDuration("OUTBOX.LEASE"),
+		},
+		Journal: JournalConfiguration{
+			Enabled:       viperObj.GetBool("JOURNAL.ENABLED"),
+			QueueSize:     viperObj.GetInt("JOURNAL.QUEUE_SIZE"),
+			BatchSize:     viperObj.GetInt("JOURNAL.BATCH_SIZE"),
+			FlushInterval: viperObj.GetDuration("JOURNAL.FLUSH_INTERVAL"),
+		},
+		Tariff: TariffConfiguration{
+			Tariffs:     tariffDefinitions(viperObj),
+			Groups:      viperObj.GetStringMapStringSlice("TARIFF.GROUPS"),
+			Assignments: tariffAssignments(viperObj),
 		},
+		Boot: BootConfiguration{
+			Status:   viperObj.GetString("BOOT.STATUS"),
+			Interval: viperObj.GetDuration("BOOT.INTERVAL"),
+		},
+		Tenancy: TenancyConfiguration{
+			Default: viperObj.GetString("TENANCY.DEFAULT"),
+			Tenants: tenants(viperObj),
+		},
+		Ocpi: OcpiConfiguration{
+			Enabled:     viperObj.GetBool("OCPI.ENABLED"),
+			Port:        viperObj.GetString("OCPI.PORT"),
+			BaseURL:     viperObj.GetString("OCPI.BASE_URL"),
+			CountryCode: viperObj.GetString("OCPI.COUNTRY_CODE"),
+			PartyId:     viperObj.GetString("OCPI.PARTY_ID"),
+			Currency:    viperObj.GetString("OCPI.CURRENCY"),
+			Tenant:      viperObj.GetString("OCPI.TENANT"),
+			Tokens:      viperObj.GetStringSlice("OCPI.TOKENS"),
+			PageLimit:   viperObj.GetInt("OCPI.PAGE_LIMIT"),
+			Locations:   ocpiLocations(viperObj),
+		},
+		RequestTimeout: RequestTimeoutConfiguration{
+			Default:       viperObj.GetDuration("REQUEST_TIMEOUT.DEFAULT"),
+			Actions:       actionTimeouts(viperObj),
+			SweepInterval: viperObj.GetDuration("REQUEST_TIMEOUT.SWEEP_INTERVAL"),
+		},
+		Cache: CacheConfiguration{
+			Driver:           viperObj.GetString("CACHE.DRIVER"),
+			MaxEntries:       viperObj.GetInt("CACHE.MAX_ENTRIES"),
+			MaxLiveEntries:   viperObj.GetInt("CACHE.MAX_LIVE_ENTRIES"),
+			Addrs:            viperObj.GetStringSlice("CACHE.ADDRS"),
+			Username:         viperObj.GetString("CACHE.USERNAME"),
+			Password:         viperObj.GetString("CACHE.PASSWORD"),
+			DB:               viperObj.GetInt("CACHE.DB"),
+			MasterName:       viperObj.GetString("CACHE.MASTER_NAME"),
+			SentinelUsername: viperObj.GetString("CACHE.SENTINEL_USERNAME"),
+			SentinelPassword: viperObj.GetString("CACHE.SENTINEL_PASSWORD"),
+			Cluster:          viperObj.GetBool("CACHE.CLUSTER"),
+			TLS: CacheTLSConfiguration{
+				Enabled:            viperObj.GetBool("CACHE.TLS.ENABLED"),
+				ServerName:         viperObj.GetString("CACHE.TLS.SERVER_NAME"),
+				CAFile:             viperObj.GetString("CACHE.TLS.CA_FILE"),
+				CertFile:           viperObj.GetString("CACHE.TLS.CERT_FILE"),
+				KeyFile:            viperObj.GetString("CACHE.TLS.KEY_FILE"),
+				InsecureSkipVerify: viperObj.GetBool("CACHE.TLS.INSECURE_SKIP_VERIFY"),
+			},
+			PoolSize:     viperObj.GetInt("CACHE.POOL_SIZE"),
+			MinIdleConns: viperObj.GetInt("CACHE.MIN_IDLE_CONNS"),
+			PoolTimeout:  viperObj.GetDuration("CACHE.POOL_TIMEOUT"),
+			DialTimeout:  viperObj.GetDuration("CACHE.DIAL_TIMEOUT"),
+			ReadTimeout:  viperObj.GetDuration("CACHE.READ_TIMEOUT"),
+			WriteTimeout: viperObj.GetDuration("CACHE.WRITE_TIMEOUT"),
+		},
+	}
+}
+
+// Returns the response timeouts listed per action under REQUEST_TIMEOUT.ACTIONS, keyed in lower case as viper reads them.
+func actionTimeouts(viperObj *viper.Viper) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for action := range viperObj.GetStringMap("REQUEST_TIMEOUT.ACTIONS") {
+		timeouts[strings.ToLower(action)] = viperObj.GetDuration("REQUEST_TIMEOUT.ACTIONS." + action)
+	}
+	return timeouts
+}
+
+// Returns the webhook endpoints listed under WEBHOOK.ENDPOINTS.
+func webhookEndpoints(viperObj *viper.Viper) []WebhookEndpointConfiguration {
+	var endpoints []WebhookEndpointConfiguration
+	if err := viperObj.UnmarshalKey("WEBHOOK.ENDPOINTS", &endpoints); err != nil {
+		slog.Error("Failed to read webhook endpoints", "error", err)
+	}
+	return endpoints
+}
+
+// Returns the tariffs listed under TARIFF.TARIFFS.
+func tariffDefinitions(viperObj *viper.Viper) []TariffDefinitionConfiguration {
+	var tariffs []TariffDefinitionConfiguration
+	if err := viperObj.UnmarshalKey("TARIFF.TARIFFS", &tariffs); err != nil {
+		slog.Error("Failed to read tariffs", "error", err)
+	}
+	return tariffs
+}
+
+// Returns the tariff assignments listed under TARIFF.ASSIGNMENTS.
+func tariffAssignments(viperObj *viper.Viper) []TariffAssignmentConfiguration {
+	var assignments []TariffAssignmentConfiguration
+	if err := viperObj.UnmarshalKey("TARIFF.ASSIGNMENTS", &assignments); err != nil {
+		slog.Error("Failed to read tariff assignments", "error", err)
+	}
+	return assignments
+}
+
+// Returns the OCPI locations listed under OCPI.LOCATIONS.
+func ocpiLocations(viperObj *viper.Viper) []OcpiLocationConfiguration {
+	var locations []OcpiLocationConfiguration
+	if err := viperObj.UnmarshalKey("OCPI.LOCATIONS", &locations); err != nil {
+		slog.Error("Failed to read OCPI locations", "error", err)
+	}
+	return locations
+}
+
+// Returns the tenants listed under TENANCY.TENANTS.
+func tenants(viperObj *viper.Viper) []TenantConfiguration {
+	var tenants []TenantConfiguration
+	if err := viperObj.UnmarshalKey("TENANCY.TENANTS", &tenants); err != nil {
+		slog.Error("Failed to read tenants", "error", err)
 	}
+	return tenants
 }
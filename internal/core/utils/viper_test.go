@@ -3,6 +3,7 @@ package utils_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/squishmeist/ocpp-go/internal/core/utils"
 	"github.com/squishmeist/ocpp-go/pkg/logging"
@@ -49,4 +50,307 @@ func TestGetConfig(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("Returns sessions config for valid azure-service-bus file", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString("AZURE_SERVICE_BUS:\n  SESSIONS:\n    ENABLED: true\n    MAX_CONCURRENT: 4\n  MAX_DELIVERY_COUNT: 3\n")
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+
+		// Assert
+		assert.True(t, config.AzureServiceBus.Sessions.Enabled)
+		assert.Equal(t, 4, config.AzureServiceBus.Sessions.MaxConcurrent)
+		assert.Equal(t, 3, config.AzureServiceBus.MaxDeliveryCount)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Returns nats config for valid nats file", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString("TRANSPORT: \"nats\"\nNATS:\n  URL: \"nats://localhost:4222\"\n  STREAM: \"OCPP\"\n  TOPIC_INBOUND:\n    NAME: \"ocpp.in\"\n    SUBSCRIPTION: \"ocpp\"\n  ACK_WAIT: \"10s\"\n")
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+		inbound, _ := config.Topics()
+
+		// Assert
+		assert.Equal(t, "nats", config.Transport)
+		assert.Equal(t, "nats://localhost:4222", config.Nats.URL)
+		assert.Equal(t, "ocpp.in", inbound.Name)
+		assert.Equal(t, "ocpp", inbound.Subscription)
+		assert.Equal(t, 10*time.Second, config.Nats.AckWait)
+		assert.Equal(t, 5, config.Nats.MaxDeliver)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Returns mqtt config for valid mqtt file", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString("TRANSPORT: \"mqtt\"\nMQTT:\n  URL: \"mqtt://localhost:1883\"\n  TOPIC_INBOUND:\n    NAME: \"ocpp/+/in\"\n    SUBSCRIPTION: \"ocpp\"\n  TOPIC_OUTBOUND:\n    NAME: \"ocpp/+/out\"\n")
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+		inbound, outbound := config.Topics()
+
+		// Assert
+		assert.Equal(t, "mqtt", config.Transport)
+		assert.Equal(t, "mqtt://localhost:1883", config.Mqtt.URL)
+		assert.Equal(t, "ocpp/+/in", inbound.Name)
+		assert.Equal(t, "ocpp/+/out", outbound.Name)
+		assert.Equal(t, time.Hour, config.Mqtt.SessionExpiry)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Returns redis streams config for valid redis streams file", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString("TRANSPORT: \"redis-streams\"\nREDIS_STREAMS:\n  ADDR: \"localhost:6379\"\n  TOPIC_INBOUND:\n    NAME: \"ocpp:in\"\n    SUBSCRIPTION: \"ocpp\"\n  TOPIC_OUTBOUND:\n    NAME: \"ocpp:out\"\n  MAX_DELIVERIES: 3\n")
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+		inbound, outbound := config.Topics()
+
+		// Assert
+		assert.Equal(t, "redis-streams", config.Transport)
+		assert.Equal(t, "localhost:6379", config.RedisStreams.Addr)
+		assert.Equal(t, "ocpp:in", inbound.Name)
+		assert.Equal(t, "ocpp", inbound.Subscription)
+		assert.Equal(t, "ocpp:out", outbound.Name)
+		assert.Equal(t, 3, config.RedisStreams.MaxDeliveries)
+		assert.Equal(t, int64(100000), config.RedisStreams.MaxLen)
+		assert.Equal(t, 30*time.Second, config.RedisStreams.ClaimMinIdle)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Returns webhook endpoints", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString("WEBHOOK:\n  ENDPOINTS:\n    - URL: \"https://billing.example.com/ocpp\"\n      SECRET: \"billing-secret\"\n      EVENTS: [\"ocpp.transaction.*\"]\n    - URL: \"https://crm.example.com/ocpp\"\n      SECRET: \"crm-secret\"\n")
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+
+		// Assert
+		assert.Equal(t, []utils.WebhookEndpointConfiguration{
+			{URL: "https://billing.example.com/ocpp", Secret: "billing-secret", Events: []string{"ocpp.transaction.*"}},
+			{URL: "https://crm.example.com/ocpp", Secret: "crm-secret"},
+		}, config.Webhook.Endpoints)
+		assert.Equal(t, 5, config.Webhook.MaxAttempts)
+		assert.Equal(t, 10*time.Second, config.Webhook.Timeout)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+	t.Run("Returns request timeouts per action", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString("REQUEST_TIMEOUT:\n  DEFAULT: \"10s\"\n  ACTIONS:\n    BootNotification: \"1m\"\n")
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+
+		// Assert
+		assert.Equal(t, time.Minute, config.RequestTimeout.Timeout("BootNotification"))
+		assert.Equal(t, 10*time.Second, config.RequestTimeout.Timeout("Heartbeat"))
+		assert.Equal(t, 5*time.Second, config.RequestTimeout.SweepInterval)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+	t.Run("Returns cache config", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString("CACHE:\n  ADDRS: [\"ocpp.redis.cache.windows.net:6380\"]\n  PASSWORD: \"access-key\"\n  TLS:\n    ENABLED: true\n  POOL_SIZE: 20\n")
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+
+		// Assert
+		assert.Equal(t, "redis", config.Cache.Driver)
+		assert.Equal(t, []string{"ocpp.redis.cache.windows.net:6380"}, config.Cache.Addrs)
+		assert.Equal(t, "access-key", config.Cache.Password)
+		assert.True(t, config.Cache.TLS.Enabled)
+		assert.Equal(t, 20, config.Cache.PoolSize)
+		assert.Equal(t, 5*time.Second, config.Cache.DialTimeout)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+	t.Run("Returns tariffs", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString(`TARIFF:
+  TARIFFS:
+    - ID: "standard"
+      CURRENCY: "GBP"
+      START_FEE: "0.50"
+      ENERGY_PRICE: 0.45
+      IDLE_PRICE: "6.00"
+      IDLE_GRACE_PERIOD: "15m"
+      TIME_ZONE: "Europe/London"
+      BANDS:
+        - START: "00:30"
+          END: "04:30"
+          ENERGY_PRICE: "0.20"
+  GROUPS:
+    Fleet: ["B4A63CDF"]
+  ASSIGNMENTS:
+    - TARIFF: "standard"
+    - TARIFF: "fleet"
+      GROUPS: ["fleet"]
+`)
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+
+		// Assert
+		assert.Equal(t, []utils.TariffDefinitionConfiguration{{
+			ID:              "standard",
+			Currency:        "GBP",
+			StartFee:        "0.50",
+			EnergyPrice:     "0.45",
+			IdlePrice:       "6.00",
+			IdleGracePeriod: 15 * time.Minute,
+			TimeZone:        "Europe/London",
+			Bands:           []utils.TariffBandConfiguration{{Start: "00:30", End: "04:30", EnergyPrice: "0.20"}},
+		}}, config.Tariff.Tariffs)
+		assert.Equal(t, map[string][]string{"fleet": {"B4A63CDF"}}, config.Tariff.Groups)
+		assert.Equal(t, []utils.TariffAssignmentConfiguration{
+			{Tariff: "standard"},
+			{Tariff: "fleet", Groups: []string{"fleet"}},
+		}, config.Tariff.Assignments)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+	t.Run("Returns tenants", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString(`BOOT:
+  INTERVAL: "5m"
+TENANCY:
+  DEFAULT: "operator-a"
+  TENANTS:
+    - ID: "operator-a"
+      SERIALNUMBERS: ["charger-1"]
+    - ID: "operator-b"
+      SERIALNUMBERS: ["charger-2"]
+      BOOT:
+        STATUS: "Pending"
+        INTERVAL: "1m"
+      TARIFF:
+        TARIFFS:
+          - ID: "night"
+            CURRENCY: "EUR"
+            ENERGY_PRICE: "0.30"
+        ASSIGNMENTS:
+          - TARIFF: "night"
+`)
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+
+		// Assert
+		assert.Equal(t, utils.BootConfiguration{Status: "Accepted", Interval: 5 * time.Minute}, config.Boot)
+		assert.Equal(t, "operator-a", config.Tenancy.Default)
+		assert.Equal(t, []utils.TenantConfiguration{
+			{ID: "operator-a", Serialnumbers: []string{"charger-1"}},
+			{
+				ID:            "operator-b",
+				Serialnumbers: []string{"charger-2"},
+				Boot:          utils.BootConfiguration{Status: "Pending", Interval: time.Minute},
+				Tariff: utils.TariffConfiguration{
+					Tariffs:     []utils.TariffDefinitionConfiguration{{ID: "night", Currency: "EUR", EnergyPrice: "0.30"}},
+					Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "night"}},
+				},
+			},
+		}, config.Tenancy.Tenants)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
+	t.Run("Returns OCPI locations", func(t *testing.T) {
+		file, err := os.Create("./example.yaml")
+		assert.NoError(t, err)
+
+		_, err = file.WriteString(`OCPI:
+  ENABLED: true
+  COUNTRY_CODE: "GB"
+  PARTY_ID: "SQM"
+  TOKENS: ["partner-token"]
+  LOCATIONS:
+    - ID: "depot"
+      ADDRESS: "1 Depot Road"
+      CITY: "London"
+      COUNTRY: "GBR"
+      LATITUDE: "51.5072"
+      LONGITUDE: "-0.1276"
+      TIME_ZONE: "Europe/London"
+      SERIALNUMBERS: ["charger-1"]
+      CONNECTOR:
+        POWER_TYPE: "DC"
+        MAX_AMPERAGE: 125
+`)
+		assert.NoError(t, err)
+
+		// Act
+		config := utils.GetConfig(".", "example", "yaml")
+
+		// Assert
+		assert.True(t, config.Ocpi.Enabled)
+		assert.Equal(t, ":8090", config.Ocpi.Port)
+		assert.Equal(t, 100, config.Ocpi.PageLimit)
+		assert.Equal(t, []string{"partner-token"}, config.Ocpi.Tokens)
+		assert.Equal(t, []utils.OcpiLocationConfiguration{{
+			ID:            "depot",
+			Address:       "1 Depot Road",
+			City:          "London",
+			Country:       "GBR",
+			Latitude:      "51.5072",
+			Longitude:     "-0.1276",
+			TimeZone:      "Europe/London",
+			Serialnumbers: []string{"charger-1"},
+			Connector:     utils.OcpiConnectorConfiguration{PowerType: "DC", MaxAmperage: 125},
+		}}, config.Ocpi.Locations)
+
+		// Cleanup
+		err = os.Remove("./example.yaml")
+		assert.NoError(t, err)
+	})
 }
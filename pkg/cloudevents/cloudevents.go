@@ -0,0 +1,312 @@
+// Package cloudevents maps OCPP frames to and from CloudEvents 1.0 envelopes.
+//
+// Events are carried either in binary mode, where the context attributes travel as
+// transport properties prefixed with "cloudEvents:" and the OCPP frame is the message body,
+// or in structured mode, where the whole event is a single JSON document.
+//
+// Event types:
+//
+//	ocpp.v16.call        an OCPP 1.6 CALL frame       [2, "<uuid>", "<action>", {...}]
+//	ocpp.v16.callresult  an OCPP 1.6 CALLRESULT frame [3, "<uuid>", {...}]
+//	ocpp.v16.callerror   an OCPP 1.6 CALLERROR frame  [4, "<uuid>", "<code>", "<description>", {...}]
+//
+// The subject of an event is the serial number of the charge point the frame belongs to, and its tenantid extension
+// the operator the charge point belongs to when the service runs for several.
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SpecVersion = "1.0"
+
+	TypeCall       = "ocpp.v16.call"
+	TypeCallResult = "ocpp.v16.callresult"
+	TypeCallError  = "ocpp.v16.callerror"
+
+	// Content type of a structured mode event.
+	ContentTypeStructured = "application/cloudevents+json"
+	// Content type of the data of an OCPP event.
+	ContentTypeJSON = "application/json"
+
+	// Prefix of context attributes carried as transport properties in binary mode.
+	BinaryPrefix = "cloudEvents:"
+)
+
+// Represents how an event is carried by a transport.
+type Mode string
+
+const (
+	ModeBinary     Mode = "binary"
+	ModeStructured Mode = "structured"
+)
+
+// Checks if the Mode is valid.
+func (m Mode) IsValid() bool {
+	return m == ModeBinary || m == ModeStructured
+}
+
+// Represents a CloudEvents 1.0 envelope around an OCPP frame.
+type Event struct {
+	// Required context attributes
+	ID          string
+	Source      string
+	SpecVersion string
+	Type        string
+
+	// Optional context attributes
+	DataContentType string
+	Subject         string // charge point serial number
+	Time            time.Time
+
+	// Extension attributes
+	Action string // "ocppaction", the OCPP action of a call, e.g. Heartbeat
+	Target string // "target", the intended recipient of the frame
+	Tenant string // "tenantid", the tenant the charge point belongs to
+
+	// The OCPP frame
+	Data []byte
+}
+
+// Creates a new event for an OCPP frame, deriving its type from the frame.
+func New(source, serialnumber string, frame []byte) (Event, error) {
+	eventType, action, err := parseFrame(frame)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:              uuid.NewString(),
+		Source:          source,
+		SpecVersion:     SpecVersion,
+		Type:            eventType,
+		DataContentType: ContentTypeJSON,
+		Subject:         serialnumber,
+		Time:            time.Now().UTC(),
+		Action:          action,
+		Data:            frame,
+	}, nil
+}
+
+// Returns the event type of an OCPP frame from its message type id.
+func TypeFromFrame(frame []byte) (string, error) {
+	eventType, _, err := parseFrame(frame)
+	return eventType, err
+}
+
+// Parses the event type, and the action for a call, from an OCPP frame.
+func parseFrame(frame []byte) (string, string, error) {
+	var arr []json.RawMessage
+	if err := json.Unmarshal(frame, &arr); err != nil {
+		return "", "", fmt.Errorf("failed to unmarshal frame: %w", err)
+	}
+	if len(arr) == 0 {
+		return "", "", fmt.Errorf("invalid frame: expected a message type id")
+	}
+
+	var typeId int
+	if err := json.Unmarshal(arr[0], &typeId); err != nil {
+		return "", "", fmt.Errorf("invalid frame message type id: %w", err)
+	}
+
+	switch typeId {
+	case 2:
+		var action string
+		if len(arr) > 2 {
+			_ = json.Unmarshal(arr[2], &action)
+		}
+		return TypeCall, action, nil
+	case 3:
+		return TypeCallResult, "", nil
+	case 4:
+		return TypeCallError, "", nil
+	default:
+		return "", "", fmt.Errorf("unknown frame message type id %d", typeId)
+	}
+}
+
+// Ensures the required context attributes are set.
+func (e Event) Validate() error {
+	if e.SpecVersion != SpecVersion {
+		return fmt.Errorf("unsupported specversion %q", e.SpecVersion)
+	}
+	if e.ID == "" {
+		return fmt.Errorf("id is not set")
+	}
+	if e.Source == "" {
+		return fmt.Errorf("source is not set")
+	}
+	if e.Type == "" {
+		return fmt.Errorf("type is not set")
+	}
+	return nil
+}
+
+// Returns the context attributes of the event as binary mode transport properties.
+// The data content type is not included, it is carried as the transport content type.
+func (e Event) BinaryProperties() map[string]any {
+	properties := map[string]any{
+		BinaryPrefix + "id":          e.ID,
+		BinaryPrefix + "source":      e.Source,
+		BinaryPrefix + "specversion": e.SpecVersion,
+		BinaryPrefix + "type":        e.Type,
+	}
+	if e.Subject != "" {
+		properties[BinaryPrefix+"subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		properties[BinaryPrefix+"time"] = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	if e.Action != "" {
+		properties[BinaryPrefix+"ocppaction"] = e.Action
+	}
+	if e.Target != "" {
+		properties[BinaryPrefix+"target"] = e.Target
+	}
+	if e.Tenant != "" {
+		properties[BinaryPrefix+"tenantid"] = e.Tenant
+	}
+	return properties
+}
+
+// Checks if the transport properties carry a binary mode event.
+func IsBinary(properties map[string]any) bool {
+	_, ok := properties[BinaryPrefix+"specversion"]
+	return ok
+}
+
+// Checks if the transport content type marks a structured mode event.
+func IsStructured(contentType string) bool {
+	return strings.HasPrefix(contentType, ContentTypeStructured)
+}
+
+// Creates an event from binary mode transport properties, content type and body.
+func FromBinary(properties map[string]any, contentType string, body []byte) (Event, error) {
+	get := func(name string) string {
+		value, _ := properties[BinaryPrefix+name].(string)
+		return value
+	}
+
+	event := Event{
+		ID:              get("id"),
+		Source:          get("source"),
+		SpecVersion:     get("specversion"),
+		Type:            get("type"),
+		DataContentType: contentType,
+		Subject:         get("subject"),
+		Action:          get("ocppaction"),
+		Target:          get("target"),
+		Tenant:          get("tenantid"),
+		Data:            body,
+	}
+
+	if value := get("time"); value != "" {
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return Event{}, fmt.Errorf("invalid time attribute: %w", err)
+		}
+		event.Time = t
+	}
+
+	if err := event.Validate(); err != nil {
+		return Event{}, fmt.Errorf("invalid binary event: %w", err)
+	}
+
+	return event, nil
+}
+
+// Represents the JSON format of a structured mode event.
+type structuredEvent struct {
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            *time.Time      `json:"time,omitempty"`
+	Action          string          `json:"ocppaction,omitempty"`
+	Target          string          `json:"target,omitempty"`
+	Tenant          string          `json:"tenantid,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// Encodes the event in the structured JSON format.
+// JSON data is embedded as is, any other data is base64 encoded.
+func (e Event) MarshalJSON() ([]byte, error) {
+	structured := structuredEvent{
+		ID:              e.ID,
+		Source:          e.Source,
+		SpecVersion:     e.SpecVersion,
+		Type:            e.Type,
+		DataContentType: e.DataContentType,
+		Subject:         e.Subject,
+		Action:          e.Action,
+		Target:          e.Target,
+		Tenant:          e.Tenant,
+	}
+	if !e.Time.IsZero() {
+		t := e.Time.UTC()
+		structured.Time = &t
+	}
+	if len(e.Data) > 0 {
+		if isJSONContentType(e.DataContentType) && json.Valid(e.Data) {
+			structured.Data = e.Data
+		} else {
+			structured.DataBase64 = e.Data
+		}
+	}
+
+	return json.Marshal(structured)
+}
+
+// Decodes an event from the structured JSON format.
+func (e *Event) UnmarshalJSON(input []byte) error {
+	var structured structuredEvent
+	if err := json.Unmarshal(input, &structured); err != nil {
+		return err
+	}
+
+	*e = Event{
+		ID:              structured.ID,
+		Source:          structured.Source,
+		SpecVersion:     structured.SpecVersion,
+		Type:            structured.Type,
+		DataContentType: structured.DataContentType,
+		Subject:         structured.Subject,
+		Action:          structured.Action,
+		Target:          structured.Target,
+		Tenant:          structured.Tenant,
+		Data:            []byte(structured.Data),
+	}
+	if structured.Time != nil {
+		e.Time = *structured.Time
+	}
+	if len(structured.DataBase64) > 0 {
+		e.Data = structured.DataBase64
+	}
+
+	return nil
+}
+
+// Creates an event from a structured mode body.
+func FromStructured(body []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Event{}, fmt.Errorf("failed to unmarshal structured event: %w", err)
+	}
+	if err := event.Validate(); err != nil {
+		return Event{}, fmt.Errorf("invalid structured event: %w", err)
+	}
+	return event, nil
+}
+
+func isJSONContentType(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, ContentTypeJSON) || strings.HasSuffix(contentType, "+json")
+}
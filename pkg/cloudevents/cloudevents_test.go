@@ -0,0 +1,133 @@
+package cloudevents_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypeFromFrame(t *testing.T) {
+	t.Run("Call", func(t *testing.T) {
+		eventType, err := cloudevents.TypeFromFrame([]byte(`[2, "uuid-1", "Heartbeat", {}]`))
+		assert.NoError(t, err)
+		assert.Equal(t, cloudevents.TypeCall, eventType)
+	})
+
+	t.Run("CallResult", func(t *testing.T) {
+		eventType, err := cloudevents.TypeFromFrame([]byte(`[3, "uuid-1", {}]`))
+		assert.NoError(t, err)
+		assert.Equal(t, cloudevents.TypeCallResult, eventType)
+	})
+
+	t.Run("CallError", func(t *testing.T) {
+		eventType, err := cloudevents.TypeFromFrame([]byte(`[4, "uuid-1", "InternalError", "", {}]`))
+		assert.NoError(t, err)
+		assert.Equal(t, cloudevents.TypeCallError, eventType)
+	})
+
+	t.Run("UnknownTypeId", func(t *testing.T) {
+		_, err := cloudevents.TypeFromFrame([]byte(`[9, "uuid-1", {}]`))
+		assert.Error(t, err)
+	})
+
+	t.Run("NotAFrame", func(t *testing.T) {
+		_, err := cloudevents.TypeFromFrame([]byte(`{}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestNew(t *testing.T) {
+	event, err := cloudevents.New("/test", "123456789", []byte(`[2, "uuid-1", "Heartbeat", {}]`))
+	assert.NoError(t, err)
+	assert.NoError(t, event.Validate())
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, cloudevents.SpecVersion, event.SpecVersion)
+	assert.Equal(t, cloudevents.TypeCall, event.Type)
+	assert.Equal(t, "123456789", event.Subject)
+	assert.Equal(t, "Heartbeat", event.Action)
+	assert.Equal(t, cloudevents.ContentTypeJSON, event.DataContentType)
+}
+
+func TestBinary(t *testing.T) {
+	event := testEvent()
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		properties := event.BinaryProperties()
+		assert.True(t, cloudevents.IsBinary(properties))
+		assert.Equal(t, "ocpp.v16.call", properties["cloudEvents:type"])
+		assert.Equal(t, "123456789", properties["cloudEvents:subject"])
+		assert.Equal(t, "Heartbeat", properties["cloudEvents:ocppaction"])
+		assert.Equal(t, "operator-a", properties["cloudEvents:tenantid"])
+
+		decoded, err := cloudevents.FromBinary(properties, event.DataContentType, event.Data)
+		assert.NoError(t, err)
+		assert.Equal(t, event, decoded)
+	})
+
+	t.Run("MissingRequiredAttribute", func(t *testing.T) {
+		properties := event.BinaryProperties()
+		delete(properties, "cloudEvents:source")
+		_, err := cloudevents.FromBinary(properties, event.DataContentType, event.Data)
+		assert.Error(t, err)
+	})
+}
+
+func TestStructured(t *testing.T) {
+	event := testEvent()
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		body, err := json.Marshal(event)
+		assert.NoError(t, err)
+
+		var raw map[string]any
+		assert.NoError(t, json.Unmarshal(body, &raw))
+		assert.Equal(t, "1.0", raw["specversion"])
+		assert.Equal(t, []any{2.0, "uuid-1", "Heartbeat", map[string]any{}}, raw["data"])
+
+		decoded, err := cloudevents.FromStructured(body)
+		assert.NoError(t, err)
+		assert.Equal(t, event.ID, decoded.ID)
+		assert.Equal(t, event.Type, decoded.Type)
+		assert.Equal(t, event.Subject, decoded.Subject)
+		assert.Equal(t, event.Tenant, decoded.Tenant)
+		assert.True(t, event.Time.Equal(decoded.Time))
+		assert.JSONEq(t, string(event.Data), string(decoded.Data))
+	})
+
+	t.Run("NonJSONData", func(t *testing.T) {
+		binary := testEvent()
+		binary.DataContentType = "application/octet-stream"
+		binary.Data = []byte{0x00, 0x01}
+
+		body, err := json.Marshal(binary)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"data_base64":"AAE="`)
+
+		decoded, err := cloudevents.FromStructured(body)
+		assert.NoError(t, err)
+		assert.Equal(t, binary.Data, decoded.Data)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := cloudevents.FromStructured([]byte(`{"specversion": "1.0"}`))
+		assert.Error(t, err)
+	})
+}
+
+func testEvent() cloudevents.Event {
+	return cloudevents.Event{
+		ID:              "event-1",
+		Source:          "/test",
+		SpecVersion:     cloudevents.SpecVersion,
+		Type:            cloudevents.TypeCall,
+		DataContentType: cloudevents.ContentTypeJSON,
+		Subject:         "123456789",
+		Time:            time.Date(2025, 7, 22, 11, 25, 25, 0, time.UTC),
+		Action:          "Heartbeat",
+		Tenant:          "operator-a",
+		Data:            []byte(`[2, "uuid-1", "Heartbeat", {}]`),
+	}
+}
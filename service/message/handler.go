@@ -5,15 +5,15 @@ import (
 	"fmt"
 	"log/slog"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
 	"github.com/squishmeist/ocpp-go/internal/core"
 	messagepb "github.com/squishmeist/ocpp-go/pkg/api/proto/message/v1"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type MessageService struct {
 	inboundName string
-	client      *core.AzureServiceBusClient
+	client      core.Transport
 }
 
 type MessageOption func(*MessageService)
@@ -35,7 +35,7 @@ func WithMessageInboundName(name string) MessageOption {
 	}
 }
 
-func WithMessageClient(client *core.AzureServiceBusClient) MessageOption {
+func WithMessageClient(client core.Transport) MessageOption {
 	return func(m *MessageService) {
 		m.client = client
 	}
@@ -56,45 +56,31 @@ func NewMessageService(opts ...MessageOption) *MessageService {
 	return service
 }
 
-type MetaData struct {
-	SerialNumber string `json:"serialnumber"`
-	Type         string `json:"type"`
-	Target       string `json:"target"`
-	Source       string `json:"source"`
-	TraceParent  string `json:"traceparent"`
-}
+const (
+	// Source of the CloudEvents sent by the message service.
+	eventSource = "/ocpp-go/message"
+	// Serial number of the simulated charge point.
+	serialnumber = "123456789"
+)
 
-func (s *MessageService) metaData(ctx context.Context) (MetaData, error) {
-	span := trace.SpanFromContext(ctx)
-	sc := span.SpanContext()
-	if !sc.IsValid() {
-		return MetaData{}, fmt.Errorf("invalid span context")
+// Wraps an OCPP frame in a CloudEvent from the simulated charge point and sends it to the inbound topic.
+// The trace context of ctx is injected as traceparent/tracestate by the client when the message is sent.
+func (s *MessageService) send(ctx context.Context, frame []byte) error {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return fmt.Errorf("invalid span context")
 	}
-	id := sc.SpanID().String()
-
-	return MetaData{
-		SerialNumber: "123456789",
-		Type:         "socket.message",
-		Target:       "<target>",
-		Source:       "<source>",
-		TraceParent:  id,
-	}, nil
-}
 
-func (s *MessageService) BootNotificationRequest(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
+	event, err := cloudevents.New(eventSource, serialnumber, frame)
 	if err != nil {
 		return err
 	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[2,"uuid-bootNotification", "BootNotification",{
+	event.Target = "ocpp"
+
+	return s.client.SendEvent(ctx, s.inboundName, event)
+}
+
+func (s *MessageService) BootNotificationRequest(ctx context.Context, payload *messagepb.Request) error {
+	return s.send(ctx, []byte(`[2,"uuid-bootNotification", "BootNotification",{
             "chargeBoxSerialNumber": "123456789",
             "chargePointModel": "Zappi",
             "chargePointSerialNumber": "123456789",
@@ -104,79 +90,27 @@ func (s *MessageService) BootNotificationRequest(ctx context.Context, payload *m
             "imsi": "",
             "meterType": "",
             "meterSerialNumber": "91234567"
-        }]`),
-	})
+        }]`))
 }
 
 func (s *MessageService) BootNotificationConfirmation(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[3,"uuid-bootNotification",{
+	return s.send(ctx, []byte(`[3,"uuid-bootNotification",{
             "currentTime": "2024-04-02T11:44:38Z",
             "interval": 30,
             "status": "Accepted"
-        }]`),
-	})
+        }]`))
 }
 
 func (s *MessageService) HeartbeatRequest(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[2, "uuid-heartbeat", "Heartbeat", {}]`),
-	})
+	return s.send(ctx, []byte(`[2, "uuid-heartbeat", "Heartbeat", {}]`))
 }
 
 func (s *MessageService) HeartbeatConfirmation(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[3, "uuid-heartbeat", { "currentTime": "2025-07-22T11:25:25.230Z" }]`),
-	})
+	return s.send(ctx, []byte(`[3, "uuid-heartbeat", { "currentTime": "2025-07-22T11:25:25.230Z" }]`))
 }
 
 func (s *MessageService) MeterValuesRequest(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[2,"uuid-meterValues", "MeterValues",{
+	return s.send(ctx, []byte(`[2,"uuid-meterValues", "MeterValues",{
 			"connectorId": 1,
 			"transactionId": 1,
 			"meterValue": [{
@@ -240,150 +174,58 @@ func (s *MessageService) MeterValuesRequest(ctx context.Context, payload *messag
 					}
 				]
 			}]
-		}]`),
-	})
+		}]`))
 }
 
 func (s *MessageService) MeterValuesConfirmation(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[3,"uuid-meterValues",{}]`),
-	})
+	return s.send(ctx, []byte(`[3,"uuid-meterValues",{}]`))
 }
 
 func (s *MessageService) StartTransactionRequest(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[2,"uuid-startTransaction", "StartTransaction",{
+	return s.send(ctx, []byte(`[2,"uuid-startTransaction", "StartTransaction",{
 			"connectorId": 1,
 			"idTag": "04222182626081",
 			"meterStart": 0,
 			"timestamp": "2022-06-12T09:13:09.819Z"
-        }]`),
-	})
+        }]`))
 }
 
 func (s *MessageService) StartTransactionConfirmation(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[3,"uuid-startTransaction",{
+	return s.send(ctx, []byte(`[3,"uuid-startTransaction",{
 			"idTagInfo": {
 				"status": "Accepted"
 			},
 			"transactionId": 1
-		}]`),
-	})
+		}]`))
 }
 
 func (s *MessageService) StatusNotificationRequest(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[2,"uuid-statusNotification", "StatusNotification",{
+	return s.send(ctx, []byte(`[2,"uuid-statusNotification", "StatusNotification",{
 			"connectorId": 1,
 			"errorCode": "NoError",
 			"status": "Preparing",
 			"timestamp": "2022-06-12T09:13:00.515Z"
-        }]`),
-	})
+        }]`))
 }
 
 func (s *MessageService) StatusNotificationConfirmation(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[3,"uuid-statusNotification",{}]`),
-	})
+	return s.send(ctx, []byte(`[3,"uuid-statusNotification",{}]`))
 }
 
 func (s *MessageService) StopTransactionRequest(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[2,"uuid-stopTransaction", "StopTransaction",{
+	return s.send(ctx, []byte(`[2,"uuid-stopTransaction", "StopTransaction",{
 			"reason": "Local",
 			"transactionId": 1,
 			"meterStop": 4329600,
 			"timestamp": "2022-09-08T10:31:26.127Z"
-        }]`),
-	})
+        }]`))
 }
 
 func (s *MessageService) StopTransactionConfirmation(ctx context.Context, payload *messagepb.Request) error {
-	meta, err := s.metaData(ctx)
-	if err != nil {
-		return err
-	}
-	return s.client.SendMessage(ctx, s.inboundName, &azservicebus.Message{
-		ApplicationProperties: map[string]any{
-			"serialnumber": meta.SerialNumber,
-			"type":         meta.Type,
-			"target":       meta.Target,
-			"source":       meta.Source,
-			"traceparent":  meta.TraceParent,
-		},
-		Body: []byte(`[3,"uuid-stopTransaction",{
+	return s.send(ctx, []byte(`[3,"uuid-stopTransaction",{
 			"idTagInfo":
 			{
 				"status": "Accepted"
 			}
-		}]`),
-	})
+		}]`))
 }
@@ -0,0 +1,414 @@
+package ocpi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+)
+
+// Id of the single connector of every EVSE, as each connector of a charge point is an EVSE of its own.
+const connectorId = "1"
+
+// Connector published for the charge points of a location that does not describe theirs: a 22 kW Type 2 socket.
+var defaultConnector = utils.OcpiConnectorConfiguration{
+	Standard:         "IEC_62196_T2",
+	Format:           "SOCKET",
+	PowerType:        "AC_3_PHASE",
+	MaxVoltage:       230,
+	MaxAmperage:      32,
+	MaxElectricPower: 22000,
+}
+
+var (
+	countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	partyIdPattern     = regexp.MustCompile(`^[A-Z0-9]{3}$`)
+	currencyPattern    = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// Maps the charge points, transactions and CDRs of ocpp to the OCPI objects the CPO publishes. Only charge points placed
+// at a configured location are published, along with their transactions and CDRs.
+type Mapper struct {
+	countryCode string
+	partyId     string
+	currency    string
+	locations   []utils.OcpiLocationConfiguration
+	located     map[string]int // index in locations by serial number
+}
+
+// Creates a Mapper for the configuration. Returns an error if the party or currency is not valid, a location misses
+// a detail OCPI requires, or a charge point is placed at more than one location.
+func NewMapper(config utils.OcpiConfiguration) (*Mapper, error) {
+	if !countryCodePattern.MatchString(config.CountryCode) {
+		return nil, fmt.Errorf("country code %q is not an ISO 3166-1 alpha-2 code", config.CountryCode)
+	}
+	if !partyIdPattern.MatchString(config.PartyId) {
+		return nil, fmt.Errorf("party id %q is not 3 upper-case letters or digits", config.PartyId)
+	}
+	if !currencyPattern.MatchString(config.Currency) {
+		return nil, fmt.Errorf("currency %q is not an ISO 4217 code", config.Currency)
+	}
+
+	mapper := &Mapper{
+		countryCode: config.CountryCode,
+		partyId:     config.PartyId,
+		currency:    config.Currency,
+		located:     make(map[string]int),
+	}
+	ids := make(map[string]bool)
+	for _, location := range config.Locations {
+		if location.ID == "" {
+			return nil, fmt.Errorf("location has no id")
+		}
+		if ids[location.ID] {
+			return nil, fmt.Errorf("location %s is defined twice", location.ID)
+		}
+		ids[location.ID] = true
+
+		for _, required := range []struct{ field, value string }{
+			{"address", location.Address},
+			{"city", location.City},
+			{"country", location.Country},
+			{"latitude", location.Latitude},
+			{"longitude", location.Longitude},
+			{"time zone", location.TimeZone},
+		} {
+			if required.value == "" {
+				return nil, fmt.Errorf("location %s has no %s", location.ID, required.field)
+			}
+		}
+		if _, err := time.LoadLocation(location.TimeZone); err != nil {
+			return nil, fmt.Errorf("location %s: %w", location.ID, err)
+		}
+
+		location.Connector = connectorOf(location.Connector)
+		for _, serialnumber := range location.Serialnumbers {
+			if other, ok := mapper.located[serialnumber]; ok {
+				return nil, fmt.Errorf("charge point %s is at locations %s and %s", serialnumber, mapper.locations[other].ID, location.ID)
+			}
+			mapper.located[serialnumber] = len(mapper.locations)
+		}
+		mapper.locations = append(mapper.locations, location)
+	}
+
+	return mapper, nil
+}
+
+// Returns the connector with the empty fields taken from the default connector.
+func connectorOf(connector utils.OcpiConnectorConfiguration) utils.OcpiConnectorConfiguration {
+	if connector.Standard == "" {
+		connector.Standard = defaultConnector.Standard
+	}
+	if connector.Format == "" {
+		connector.Format = defaultConnector.Format
+	}
+	if connector.PowerType == "" {
+		connector.PowerType = defaultConnector.PowerType
+	}
+	if connector.MaxVoltage == 0 {
+		connector.MaxVoltage = defaultConnector.MaxVoltage
+	}
+	if connector.MaxAmperage == 0 {
+		connector.MaxAmperage = defaultConnector.MaxAmperage
+	}
+	if connector.MaxElectricPower == 0 {
+		connector.MaxElectricPower = defaultConnector.MaxElectricPower
+	}
+	return connector
+}
+
+// Returns the configured locations, in the order they are configured.
+func (m *Mapper) Locations() []utils.OcpiLocationConfiguration {
+	return m.locations
+}
+
+// Returns the serial numbers of the charge points placed at a location. The list is empty, not nil, without any.
+func (m *Mapper) Serialnumbers() []string {
+	serialnumbers := []string{}
+	for _, location := range m.locations {
+		serialnumbers = append(serialnumbers, location.Serialnumbers...)
+	}
+	return serialnumbers
+}
+
+// Returns the location of a charge point, or false if it is not placed at one.
+func (m *Mapper) locationOf(serialnumber string) (utils.OcpiLocationConfiguration, bool) {
+	i, ok := m.located[serialnumber]
+	if !ok {
+		return utils.OcpiLocationConfiguration{}, false
+	}
+	return m.locations[i], true
+}
+
+// Returns the location with its charge points, given the ones that booted and the latest status of their connectors.
+// Each connector other than connector 0 is an EVSE; a charge point that is unavailable or faulted as a whole makes
+// all its EVSEs so. Returns false when none of its charge points booted, as there is nothing to publish yet.
+func (m *Mapper) Location(location utils.OcpiLocationConfiguration, chargepoints []ocpp.Chargepoint, statuses []ocpp.ConnectorStatus) (Location, bool) {
+	if len(chargepoints) == 0 {
+		return Location{}, false
+	}
+
+	mapped := Location{
+		CountryCode: m.countryCode,
+		PartyId:     m.partyId,
+		Id:          location.ID,
+		Publish:     true,
+		Name:        location.Name,
+		Address:     location.Address,
+		City:        location.City,
+		PostalCode:  location.PostalCode,
+		Country:     location.Country,
+		Coordinates: GeoLocation{Latitude: location.Latitude, Longitude: location.Longitude},
+		TimeZone:    location.TimeZone,
+	}
+	for _, chargepoint := range chargepoints {
+		mapped.LastUpdated = latest(mapped.LastUpdated, timestamp(chargepoint.LastBoot))
+	}
+
+	for _, serialnumber := range location.Serialnumbers {
+		var whole *ocpp.ConnectorStatus
+		for _, status := range statuses {
+			if status.Serialnumber == serialnumber && status.ConnectorId == 0 {
+				whole = &status
+			}
+		}
+		for _, status := range statuses {
+			if status.Serialnumber != serialnumber || status.ConnectorId == 0 {
+				continue
+			}
+			evse := m.evse(location, status)
+			if whole != nil && (whole.Status == core.ChargePointStatusUnavailable || whole.Status == core.ChargePointStatusFaulted) {
+				evse.Status = evseStatus(whole.Status)
+				evse.LastUpdated = latest(evse.LastUpdated, timestamp(whole.ReportedAt))
+				evse.Connectors[0].LastUpdated = evse.LastUpdated
+			}
+			mapped.Evses = append(mapped.Evses, evse)
+			mapped.LastUpdated = latest(mapped.LastUpdated, evse.LastUpdated)
+		}
+	}
+
+	return mapped, true
+}
+
+// Returns the EVSE of a connector with its latest status.
+func (m *Mapper) evse(location utils.OcpiLocationConfiguration, status ocpp.ConnectorStatus) Evse {
+	reportedAt := timestamp(status.ReportedAt)
+	return Evse{
+		Uid:    EvseUid(status.Serialnumber, status.ConnectorId),
+		EvseId: m.evseId(status.Serialnumber, status.ConnectorId),
+		Status: evseStatus(status.Status),
+		Connectors: []Connector{{
+			Id:               connectorId,
+			Standard:         location.Connector.Standard,
+			Format:           location.Connector.Format,
+			PowerType:        location.Connector.PowerType,
+			MaxVoltage:       location.Connector.MaxVoltage,
+			MaxAmperage:      location.Connector.MaxAmperage,
+			MaxElectricPower: location.Connector.MaxElectricPower,
+			LastUpdated:      reportedAt,
+		}},
+		LastUpdated: reportedAt,
+	}
+}
+
+// Returns the session of a transaction, given its register readings and its cost so far, nil when no tariff applies.
+// Returns false when its charge point is not placed at a location.
+func (m *Mapper) Session(transaction ocpp.Transaction, samples []ocpp.MeterSample, cost *ocpp.CostBreakdown) (Session, bool) {
+	location, ok := m.locationOf(transaction.Serialnumber)
+	if !ok {
+		return Session{}, false
+	}
+
+	session := Session{
+		CountryCode:   m.countryCode,
+		PartyId:       m.partyId,
+		Id:            strconv.Itoa(transaction.Id),
+		StartDateTime: timestamp(transaction.StartedAt),
+		CdrToken:      m.cdrToken(transaction.IdTag),
+		AuthMethod:    AuthMethodWhitelist,
+		LocationId:    location.ID,
+		EvseUid:       EvseUid(transaction.Serialnumber, transaction.ConnectorId),
+		ConnectorId:   connectorId,
+		Currency:      m.currency,
+		Status:        SessionStatusActive,
+		LastUpdated:   timestamp(ocpp.TransactionUpdatedAt(transaction, samples)),
+	}
+
+	// Energy so far is that of the latest reading, or all of it once the transaction stopped
+	meterStop := transaction.MeterStart
+	var readAt time.Time
+	for _, sample := range samples {
+		if !sample.SampledAt.Before(readAt) {
+			readAt, meterStop = sample.SampledAt, sample.RegisterWh
+		}
+	}
+	if transaction.StoppedAt != nil {
+		endedAt := timestamp(*transaction.StoppedAt)
+		session.EndDateTime = &endedAt
+		session.Status = SessionStatusCompleted
+		if transaction.MeterStop != nil {
+			meterStop = *transaction.MeterStop
+		}
+	}
+	session.Kwh = kwh(max(meterStop-transaction.MeterStart, 0))
+
+	if cost != nil {
+		session.Currency = cost.Currency
+		session.TotalCost = price(cost.Total)
+	}
+
+	return session, true
+}
+
+// Returns the OCPI CDR of a CDR, as a single charging period. Returns false when its charge point is not placed at
+// a location.
+func (m *Mapper) Cdr(cdr ocpp.ChargeDetailRecord) (Cdr, bool) {
+	location, ok := m.locationOf(cdr.Serialnumber)
+	if !ok {
+		return Cdr{}, false
+	}
+
+	id := strconv.Itoa(cdr.TransactionId)
+	mapped := Cdr{
+		CountryCode:   m.countryCode,
+		PartyId:       m.partyId,
+		Id:            id,
+		StartDateTime: timestamp(cdr.StartedAt),
+		EndDateTime:   timestamp(cdr.StoppedAt),
+		SessionId:     id,
+		CdrToken:      m.cdrToken(cdr.IdTag),
+		AuthMethod:    AuthMethodWhitelist,
+		CdrLocation: CdrLocation{
+			Id:                 location.ID,
+			Name:               location.Name,
+			Address:            location.Address,
+			City:               location.City,
+			PostalCode:         location.PostalCode,
+			Country:            location.Country,
+			Coordinates:        GeoLocation{Latitude: location.Latitude, Longitude: location.Longitude},
+			EvseUid:            EvseUid(cdr.Serialnumber, cdr.ConnectorId),
+			EvseId:             m.evseId(cdr.Serialnumber, cdr.ConnectorId),
+			ConnectorId:        connectorId,
+			ConnectorStandard:  location.Connector.Standard,
+			ConnectorFormat:    location.Connector.Format,
+			ConnectorPowerType: location.Connector.PowerType,
+		},
+		Currency:    m.currency,
+		TotalCost:   Price{ExclVat: Number{decimal.Zero}},
+		TotalEnergy: kwh(cdr.EnergyWh),
+		TotalTime:   hours(cdr.Duration),
+		LastUpdated: timestamp(cdr.CreatedAt),
+	}
+
+	period := ChargingPeriod{
+		StartDateTime: mapped.StartDateTime,
+		Dimensions: []CdrDimension{
+			{Type: CdrDimensionTypeEnergy, Volume: mapped.TotalEnergy},
+			{Type: CdrDimensionTypeTime, Volume: hours(cdr.ChargingTime)},
+		},
+	}
+	if cdr.IdleTime > 0 {
+		parking := hours(cdr.IdleTime)
+		mapped.TotalParkingTime = &parking
+		period.Dimensions = append(period.Dimensions, CdrDimension{Type: CdrDimensionTypeParkingTime, Volume: parking})
+	}
+
+	if cost := cdr.Cost; cost != nil {
+		period.TariffId = cost.TariffId
+		mapped.Currency = cost.Currency
+		mapped.TotalCost = *price(cost.Total)
+		mapped.TotalFixedCost = price(cost.StartFee)
+		mapped.TotalEnergyCost = price(cost.Energy)
+		mapped.TotalTimeCost = price(cost.Time)
+		if mapped.TotalParkingTime != nil {
+			mapped.TotalParkingCost = price(cost.Idle)
+		}
+	}
+	mapped.ChargingPeriods = []ChargingPeriod{period}
+
+	return mapped, true
+}
+
+// Returns the token of an idTag. Tokens are not issued by roaming partners, so they are published as RFID tokens
+// of the CPO with the idTag as contract id.
+func (m *Mapper) cdrToken(idTag string) CdrToken {
+	return CdrToken{
+		CountryCode: m.countryCode,
+		PartyId:     m.partyId,
+		Uid:         idTag,
+		Type:        TokenTypeRfid,
+		ContractId:  idTag,
+	}
+}
+
+// Returns the uid of the EVSE of a connector.
+func EvseUid(serialnumber string, connectorId int) string {
+	return fmt.Sprintf("%s-%d", serialnumber, connectorId)
+}
+
+// Returns the eMI3 EVSE id of a connector, e.g. GB*SQM*ECHARGER1*1. Characters of the serial number an EVSE id
+// cannot hold are left out.
+func (m *Mapper) evseId(serialnumber string, connectorId int) string {
+	serialnumber = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return -1
+	}, serialnumber)
+	return fmt.Sprintf("%s*%s*E%s*%d", m.countryCode, m.partyId, serialnumber, connectorId)
+}
+
+// Returns the EVSE status of a connector status.
+func evseStatus(status core.ChargePointStatus) Status {
+	switch status {
+	case core.ChargePointStatusAvailable:
+		return StatusAvailable
+	case core.ChargePointStatusPreparing, core.ChargePointStatusCharging, core.ChargePointStatusSuspendedEV,
+		core.ChargePointStatusSuspendedEVSE, core.ChargePointStatusFinishing:
+		return StatusCharging
+	case core.ChargePointStatusReserved:
+		return StatusReserved
+	case core.ChargePointStatusUnavailable:
+		return StatusInoperative
+	case core.ChargePointStatusFaulted:
+		return StatusOutOfOrder
+	}
+	return StatusUnknown
+}
+
+// Returns the energy in kWh.
+func kwh(wh int) Number {
+	return Number{decimal.New(int64(wh), -3)}
+}
+
+// Returns the duration in hours, to the 4 decimals OCPI numbers have.
+func hours(duration time.Duration) Number {
+	return Number{decimal.NewFromInt(int64(duration / time.Second)).Div(decimal.NewFromInt(3600)).Round(4)}
+}
+
+// Returns an amount without VAT, as tariffs do not tell it.
+func price(amount decimal.Decimal) *Price {
+	return &Price{ExclVat: Number{amount}}
+}
+
+// Returns the time in UTC to the second, as OCPI timestamps are.
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// Returns the later of two times.
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,294 @@
+package ocpi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() utils.OcpiConfiguration {
+	return utils.OcpiConfiguration{
+		Port:        ":8090",
+		CountryCode: "GB",
+		PartyId:     "SQM",
+		Currency:    "GBP",
+		Tokens:      []string{"partner-token"},
+		PageLimit:   2,
+		Locations: []utils.OcpiLocationConfiguration{{
+			ID:            "LOC1",
+			Name:          "Depot",
+			Address:       "1 High Street",
+			City:          "London",
+			PostalCode:    "E1 6AN",
+			Country:       "GBR",
+			Latitude:      "51.520000",
+			Longitude:     "-0.070000",
+			TimeZone:      "Europe/London",
+			Serialnumbers: []string{"charger-1", "charger-2"},
+		}},
+	}
+}
+
+func TestNewMapper(t *testing.T) {
+	t.Run("DefaultConnector", func(t *testing.T) {
+		config := testConfig()
+		config.Locations[0].Connector = utils.OcpiConnectorConfiguration{PowerType: "AC_1_PHASE", MaxElectricPower: 7400}
+
+		mapper, err := NewMapper(config)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"charger-1", "charger-2"}, mapper.Serialnumbers())
+		assert.Equal(t, utils.OcpiConnectorConfiguration{
+			Standard:         "IEC_62196_T2",
+			Format:           "SOCKET",
+			PowerType:        "AC_1_PHASE",
+			MaxVoltage:       230,
+			MaxAmperage:      32,
+			MaxElectricPower: 7400,
+		}, mapper.Locations()[0].Connector)
+	})
+
+	t.Run("NoLocations", func(t *testing.T) {
+		config := testConfig()
+		config.Locations = nil
+
+		mapper, err := NewMapper(config)
+		assert.NoError(t, err)
+		// No charge point is published rather than all of them
+		assert.NotNil(t, mapper.Serialnumbers())
+		assert.Empty(t, mapper.Serialnumbers())
+	})
+
+	for name, change := range map[string]func(*utils.OcpiConfiguration){
+		"CountryCode": func(c *utils.OcpiConfiguration) { c.CountryCode = "GBR" },
+		"PartyId":     func(c *utils.OcpiConfiguration) { c.PartyId = "sq" },
+		"Currency":    func(c *utils.OcpiConfiguration) { c.Currency = "£" },
+		"NoId":        func(c *utils.OcpiConfiguration) { c.Locations[0].ID = "" },
+		"NoAddress":   func(c *utils.OcpiConfiguration) { c.Locations[0].Address = "" },
+		"InvalidZone": func(c *utils.OcpiConfiguration) { c.Locations[0].TimeZone = "Mars/Olympus" },
+		"DuplicateId": func(c *utils.OcpiConfiguration) { c.Locations = append(c.Locations, c.Locations[0]) },
+		"TwoLocations": func(c *utils.OcpiConfiguration) {
+			other := c.Locations[0]
+			other.ID = "LOC2"
+			other.Serialnumbers = []string{"charger-2"}
+			c.Locations = append(c.Locations, other)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig()
+			change(&config)
+			_, err := NewMapper(config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMapperLocation(t *testing.T) {
+	mapper, err := NewMapper(testConfig())
+	assert.NoError(t, err)
+	location := mapper.Locations()[0]
+	bootedAt := time.Date(2025, 7, 22, 8, 0, 0, 0, time.UTC)
+	chargepoints := []ocpp.Chargepoint{{Serialnumber: "charger-1", LastBoot: bootedAt}}
+	status := func(connectorId int, status core.ChargePointStatus, minutes int) ocpp.ConnectorStatus {
+		return ocpp.ConnectorStatus{
+			Serialnumber: "charger-1",
+			ConnectorId:  connectorId,
+			Status:       status,
+			ReportedAt:   bootedAt.Add(time.Duration(minutes)*time.Minute + 300*time.Millisecond),
+		}
+	}
+
+	t.Run("NotBooted", func(t *testing.T) {
+		_, ok := mapper.Location(location, nil, nil)
+		assert.False(t, ok)
+	})
+
+	t.Run("Evses", func(t *testing.T) {
+		mapped, ok := mapper.Location(location, chargepoints, []ocpp.ConnectorStatus{
+			status(0, core.ChargePointStatusAvailable, 1),
+			status(1, core.ChargePointStatusCharging, 5),
+			status(2, core.ChargePointStatusAvailable, 2),
+		})
+		assert.True(t, ok)
+		assert.Equal(t, "LOC1", mapped.Id)
+		assert.Equal(t, "GB", mapped.CountryCode)
+		assert.Equal(t, "SQM", mapped.PartyId)
+		assert.True(t, mapped.Publish)
+		assert.Equal(t, bootedAt.Add(5*time.Minute), mapped.LastUpdated)
+		if assert.Len(t, mapped.Evses, 2) {
+			evse := mapped.Evses[0]
+			assert.Equal(t, "charger-1-1", evse.Uid)
+			assert.Equal(t, "GB*SQM*ECHARGER1*1", evse.EvseId)
+			assert.Equal(t, StatusCharging, evse.Status)
+			assert.Equal(t, bootedAt.Add(5*time.Minute), evse.LastUpdated)
+			if assert.Len(t, evse.Connectors, 1) {
+				assert.Equal(t, "1", evse.Connectors[0].Id)
+				assert.Equal(t, "IEC_62196_T2", evse.Connectors[0].Standard)
+				assert.Equal(t, 22000, evse.Connectors[0].MaxElectricPower)
+			}
+			assert.Equal(t, StatusAvailable, mapped.Evses[1].Status)
+		}
+	})
+
+	t.Run("Faulted", func(t *testing.T) {
+		mapped, ok := mapper.Location(location, chargepoints, []ocpp.ConnectorStatus{
+			status(0, core.ChargePointStatusFaulted, 10),
+			status(1, core.ChargePointStatusAvailable, 5),
+		})
+		assert.True(t, ok)
+		if assert.Len(t, mapped.Evses, 1) {
+			assert.Equal(t, StatusOutOfOrder, mapped.Evses[0].Status)
+			assert.Equal(t, bootedAt.Add(10*time.Minute), mapped.Evses[0].LastUpdated)
+		}
+	})
+}
+
+func TestMapperSession(t *testing.T) {
+	mapper, err := NewMapper(testConfig())
+	assert.NoError(t, err)
+	startedAt := time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC)
+	transaction := ocpp.Transaction{
+		Id:           7,
+		Serialnumber: "charger-1",
+		ConnectorId:  2,
+		IdTag:        "B4A63CDF",
+		MeterStart:   1000,
+		StartedAt:    startedAt,
+	}
+	samples := []ocpp.MeterSample{
+		{RegisterWh: 2500, SampledAt: startedAt.Add(10 * time.Minute)},
+		{RegisterWh: 4250, SampledAt: startedAt.Add(20 * time.Minute)},
+	}
+
+	t.Run("Active", func(t *testing.T) {
+		cost := ocpp.CostBreakdown{Currency: "EUR", Total: decimal.RequireFromString("1.35")}
+		session, ok := mapper.Session(transaction, samples, &cost)
+		assert.True(t, ok)
+		assert.Equal(t, "7", session.Id)
+		assert.Equal(t, SessionStatusActive, session.Status)
+		assert.Nil(t, session.EndDateTime)
+		assert.Equal(t, "3.25", session.Kwh.String())
+		assert.Equal(t, "LOC1", session.LocationId)
+		assert.Equal(t, "charger-1-2", session.EvseUid)
+		assert.Equal(t, "B4A63CDF", session.CdrToken.Uid)
+		assert.Equal(t, TokenTypeRfid, session.CdrToken.Type)
+		assert.Equal(t, "EUR", session.Currency)
+		if assert.NotNil(t, session.TotalCost) {
+			assert.Equal(t, "1.35", session.TotalCost.ExclVat.String())
+		}
+		assert.Equal(t, startedAt.Add(20*time.Minute), session.LastUpdated)
+	})
+
+	t.Run("Completed", func(t *testing.T) {
+		stoppedAt := startedAt.Add(30 * time.Minute)
+		meterStop := 5000
+		completed := transaction
+		completed.StoppedAt, completed.MeterStop = &stoppedAt, &meterStop
+
+		session, ok := mapper.Session(completed, samples, nil)
+		assert.True(t, ok)
+		assert.Equal(t, SessionStatusCompleted, session.Status)
+		if assert.NotNil(t, session.EndDateTime) {
+			assert.Equal(t, stoppedAt, *session.EndDateTime)
+		}
+		assert.Equal(t, "4", session.Kwh.String())
+		assert.Equal(t, "GBP", session.Currency)
+		assert.Nil(t, session.TotalCost)
+		assert.Equal(t, stoppedAt, session.LastUpdated)
+	})
+
+	t.Run("NotLocated", func(t *testing.T) {
+		elsewhere := transaction
+		elsewhere.Serialnumber = "charger-9"
+		_, ok := mapper.Session(elsewhere, nil, nil)
+		assert.False(t, ok)
+	})
+}
+
+func TestMapperCdr(t *testing.T) {
+	mapper, err := NewMapper(testConfig())
+	assert.NoError(t, err)
+	startedAt := time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC)
+	record := ocpp.ChargeDetailRecord{
+		Id:            1,
+		Serialnumber:  "charger-1",
+		TransactionId: 7,
+		ConnectorId:   1,
+		IdTag:         "B4A63CDF",
+		StartedAt:     startedAt,
+		StoppedAt:     startedAt.Add(90 * time.Minute),
+		Duration:      90 * time.Minute,
+		EnergyWh:      12345,
+		ChargingTime:  time.Hour,
+		IdleTime:      30 * time.Minute,
+		CreatedAt:     startedAt.Add(90*time.Minute + 200*time.Millisecond),
+	}
+
+	t.Run("Uncosted", func(t *testing.T) {
+		cdr, ok := mapper.Cdr(record)
+		assert.True(t, ok)
+		assert.Equal(t, "7", cdr.Id)
+		assert.Equal(t, "7", cdr.SessionId)
+		assert.Equal(t, "GBP", cdr.Currency)
+		assert.Equal(t, "0", cdr.TotalCost.ExclVat.String())
+		assert.Equal(t, "12.345", cdr.TotalEnergy.String())
+		assert.Equal(t, "1.5", cdr.TotalTime.String())
+		if assert.NotNil(t, cdr.TotalParkingTime) {
+			assert.Equal(t, "0.5", cdr.TotalParkingTime.String())
+		}
+		assert.Nil(t, cdr.TotalEnergyCost)
+		assert.Equal(t, "charger-1-1", cdr.CdrLocation.EvseUid)
+		assert.Equal(t, "IEC_62196_T2", cdr.CdrLocation.ConnectorStandard)
+		assert.Equal(t, startedAt.Add(90*time.Minute), cdr.LastUpdated)
+		if assert.Len(t, cdr.ChargingPeriods, 1) {
+			volumes := make(map[CdrDimensionType]string)
+			for _, dimension := range cdr.ChargingPeriods[0].Dimensions {
+				volumes[dimension.Type] = dimension.Volume.String()
+			}
+			assert.Equal(t, map[CdrDimensionType]string{
+				CdrDimensionTypeEnergy:      "12.345",
+				CdrDimensionTypeTime:        "1",
+				CdrDimensionTypeParkingTime: "0.5",
+			}, volumes)
+		}
+	})
+
+	t.Run("Costed", func(t *testing.T) {
+		costed := record
+		costed.Cost = &ocpp.CostBreakdown{
+			TariffId: "standard",
+			Currency: "EUR",
+			StartFee: decimal.RequireFromString("1.00"),
+			Energy:   decimal.RequireFromString("5.56"),
+			Time:     decimal.Zero,
+			Idle:     decimal.RequireFromString("2.50"),
+			Total:    decimal.RequireFromString("9.06"),
+		}
+
+		cdr, ok := mapper.Cdr(costed)
+		assert.True(t, ok)
+		assert.Equal(t, "EUR", cdr.Currency)
+		assert.Equal(t, "9.06", cdr.TotalCost.ExclVat.String())
+		assert.Equal(t, "standard", cdr.ChargingPeriods[0].TariffId)
+		if assert.NotNil(t, cdr.TotalParkingCost) {
+			assert.Equal(t, "2.5", cdr.TotalParkingCost.ExclVat.String())
+		}
+
+		// Amounts are JSON numbers, as OCPI has them
+		body, err := json.Marshal(cdr.TotalCost)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"excl_vat": 9.06}`, string(body))
+	})
+
+	t.Run("NotLocated", func(t *testing.T) {
+		elsewhere := record
+		elsewhere.Serialnumber = "charger-9"
+		_, ok := mapper.Cdr(elsewhere)
+		assert.False(t, ok)
+	})
+}
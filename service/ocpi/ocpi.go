@@ -0,0 +1,232 @@
+package ocpi
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Version of OCPI the module implements.
+const Version = "2.2.1"
+
+// Status codes of OCPI responses.
+const (
+	StatusSuccess           = 1000
+	StatusClientError       = 2000
+	StatusInvalidParameters = 2001
+	StatusUnknownLocation   = 2003
+	StatusServerError       = 3000
+)
+
+// Represents the envelope every OCPI response is wrapped in.
+type Response struct {
+	Data          any       `json:"data,omitempty"`
+	StatusCode    int       `json:"status_code"`
+	StatusMessage string    `json:"status_message,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// Represents a decimal number, written as a JSON number rather than a string.
+type Number struct {
+	decimal.Decimal
+}
+
+func (n Number) MarshalJSON() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// Represents a version of OCPI a party supports, and where its details are.
+type VersionInfo struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+}
+
+// Represents the modules of a version of OCPI a party implements.
+type VersionDetails struct {
+	Version   string     `json:"version"`
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+type Endpoint struct {
+	Identifier string `json:"identifier"`
+	Role       string `json:"role"`
+	URL        string `json:"url"`
+}
+
+type AuthMethod string
+
+const (
+	AuthMethodAuthRequest AuthMethod = "AUTH_REQUEST"
+	AuthMethodCommand     AuthMethod = "COMMAND"
+	AuthMethodWhitelist   AuthMethod = "WHITELIST"
+)
+
+type TokenType string
+
+const (
+	TokenTypeAdHocUser TokenType = "AD_HOC_USER"
+	TokenTypeAppUser   TokenType = "APP_USER"
+	TokenTypeOther     TokenType = "OTHER"
+	TokenTypeRfid      TokenType = "RFID"
+)
+
+type SessionStatus string
+
+const (
+	SessionStatusActive      SessionStatus = "ACTIVE"
+	SessionStatusCompleted   SessionStatus = "COMPLETED"
+	SessionStatusInvalid     SessionStatus = "INVALID"
+	SessionStatusPending     SessionStatus = "PENDING"
+	SessionStatusReservation SessionStatus = "RESERVATION"
+)
+
+// Status of an EVSE.
+type Status string
+
+const (
+	StatusAvailable   Status = "AVAILABLE"
+	StatusBlocked     Status = "BLOCKED"
+	StatusCharging    Status = "CHARGING"
+	StatusInoperative Status = "INOPERATIVE"
+	StatusOutOfOrder  Status = "OUTOFORDER"
+	StatusPlanned     Status = "PLANNED"
+	StatusRemoved     Status = "REMOVED"
+	StatusReserved    Status = "RESERVED"
+	StatusUnknown     Status = "UNKNOWN"
+)
+
+type CdrDimensionType string
+
+const (
+	CdrDimensionTypeEnergy      CdrDimensionType = "ENERGY"
+	CdrDimensionTypeFlat        CdrDimensionType = "FLAT"
+	CdrDimensionTypeParkingTime CdrDimensionType = "PARKING_TIME"
+	CdrDimensionTypeTime        CdrDimensionType = "TIME"
+)
+
+// Represents the token a session was authorised with.
+type CdrToken struct {
+	CountryCode string    `json:"country_code"`
+	PartyId     string    `json:"party_id"`
+	Uid         string    `json:"uid"`
+	Type        TokenType `json:"type"`
+	ContractId  string    `json:"contract_id"`
+}
+
+// Represents an amount of money. InclVat is nil when the VAT is not known.
+type Price struct {
+	ExclVat Number  `json:"excl_vat"`
+	InclVat *Number `json:"incl_vat,omitempty"`
+}
+
+type GeoLocation struct {
+	Latitude  string `json:"latitude"`
+	Longitude string `json:"longitude"`
+}
+
+// Represents a charging session, in progress or completed. EndDateTime and TotalCost are nil until they are known.
+type Session struct {
+	CountryCode   string        `json:"country_code"`
+	PartyId       string        `json:"party_id"`
+	Id            string        `json:"id"`
+	StartDateTime time.Time     `json:"start_date_time"`
+	EndDateTime   *time.Time    `json:"end_date_time,omitempty"`
+	Kwh           Number        `json:"kwh"`
+	CdrToken      CdrToken      `json:"cdr_token"`
+	AuthMethod    AuthMethod    `json:"auth_method"`
+	LocationId    string        `json:"location_id"`
+	EvseUid       string        `json:"evse_uid"`
+	ConnectorId   string        `json:"connector_id"`
+	Currency      string        `json:"currency"`
+	TotalCost     *Price        `json:"total_cost,omitempty"`
+	Status        SessionStatus `json:"status"`
+	LastUpdated   time.Time     `json:"last_updated"`
+}
+
+// Represents the charge detail record of a completed session. The costs per dimension are nil when no tariff applied.
+type Cdr struct {
+	CountryCode      string           `json:"country_code"`
+	PartyId          string           `json:"party_id"`
+	Id               string           `json:"id"`
+	StartDateTime    time.Time        `json:"start_date_time"`
+	EndDateTime      time.Time        `json:"end_date_time"`
+	SessionId        string           `json:"session_id,omitempty"`
+	CdrToken         CdrToken         `json:"cdr_token"`
+	AuthMethod       AuthMethod       `json:"auth_method"`
+	CdrLocation      CdrLocation      `json:"cdr_location"`
+	Currency         string           `json:"currency"`
+	ChargingPeriods  []ChargingPeriod `json:"charging_periods"`
+	TotalCost        Price            `json:"total_cost"`
+	TotalFixedCost   *Price           `json:"total_fixed_cost,omitempty"`
+	TotalEnergy      Number           `json:"total_energy"`
+	TotalEnergyCost  *Price           `json:"total_energy_cost,omitempty"`
+	TotalTime        Number           `json:"total_time"`
+	TotalTimeCost    *Price           `json:"total_time_cost,omitempty"`
+	TotalParkingTime *Number          `json:"total_parking_time,omitempty"`
+	TotalParkingCost *Price           `json:"total_parking_cost,omitempty"`
+	LastUpdated      time.Time        `json:"last_updated"`
+}
+
+// Represents where a CDR was charged, as it was at the time.
+type CdrLocation struct {
+	Id                 string      `json:"id"`
+	Name               string      `json:"name,omitempty"`
+	Address            string      `json:"address"`
+	City               string      `json:"city"`
+	PostalCode         string      `json:"postal_code,omitempty"`
+	Country            string      `json:"country"`
+	Coordinates        GeoLocation `json:"coordinates"`
+	EvseUid            string      `json:"evse_uid"`
+	EvseId             string      `json:"evse_id"`
+	ConnectorId        string      `json:"connector_id"`
+	ConnectorStandard  string      `json:"connector_standard"`
+	ConnectorFormat    string      `json:"connector_format"`
+	ConnectorPowerType string      `json:"connector_power_type"`
+}
+
+// Represents a period of a session from its start until the next period, and what was used in it.
+type ChargingPeriod struct {
+	StartDateTime time.Time      `json:"start_date_time"`
+	Dimensions    []CdrDimension `json:"dimensions"`
+	TariffId      string         `json:"tariff_id,omitempty"`
+}
+
+type CdrDimension struct {
+	Type   CdrDimensionType `json:"type"`
+	Volume Number           `json:"volume"`
+}
+
+type Location struct {
+	CountryCode string      `json:"country_code"`
+	PartyId     string      `json:"party_id"`
+	Id          string      `json:"id"`
+	Publish     bool        `json:"publish"`
+	Name        string      `json:"name,omitempty"`
+	Address     string      `json:"address"`
+	City        string      `json:"city"`
+	PostalCode  string      `json:"postal_code,omitempty"`
+	Country     string      `json:"country"`
+	Coordinates GeoLocation `json:"coordinates"`
+	Evses       []Evse      `json:"evses,omitempty"`
+	TimeZone    string      `json:"time_zone"`
+	LastUpdated time.Time   `json:"last_updated"`
+}
+
+type Evse struct {
+	Uid         string      `json:"uid"`
+	EvseId      string      `json:"evse_id,omitempty"`
+	Status      Status      `json:"status"`
+	Connectors  []Connector `json:"connectors"`
+	LastUpdated time.Time   `json:"last_updated"`
+}
+
+type Connector struct {
+	Id               string    `json:"id"`
+	Standard         string    `json:"standard"`
+	Format           string    `json:"format"`
+	PowerType        string    `json:"power_type"`
+	MaxVoltage       int       `json:"max_voltage"`
+	MaxAmperage      int       `json:"max_amperage"`
+	MaxElectricPower int       `json:"max_electric_power,omitempty"`
+	LastUpdated      time.Time `json:"last_updated"`
+}
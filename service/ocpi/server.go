@@ -0,0 +1,512 @@
+package ocpi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	iCore "github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Path the OCPI endpoints are served under.
+const basePath = "/ocpi"
+
+// Headers of a paginated response.
+const (
+	TotalCountHeader = "X-Total-Count"
+	LimitHeader      = "X-Limit"
+	LinkHeader       = "Link"
+)
+
+// Represents what the server reads from the ocpp store.
+type Store interface {
+	ocpp.StoreAdapter
+	ocpp.CdrAdapter
+}
+
+type ServerOption func(*Server)
+
+// Serves the sender interfaces of the OCPI 2.2.1 locations, sessions and cdrs modules to roaming partners, along with
+// the versions they are discovered through. Partners authenticate with a configured token, and lists are paginated
+// with the offset, limit, date_from and date_to parameters. Only the charge points of the configured tenant are served.
+type Server struct {
+	tracer  trace.Tracer
+	store   Store
+	tariffs *ocpp.Tariffs // nil when no tariffs are configured
+	config  utils.OcpiConfiguration
+	mapper  *Mapper
+	http    *iCore.HttpServer
+	now     func() time.Time
+}
+
+// Ensures all required fields are set in the Server.
+func (s *Server) Validate() error {
+	if s.tracer == nil {
+		return fmt.Errorf("tracer provider is not set")
+	}
+	if s.store == nil {
+		return fmt.Errorf("store is not set")
+	}
+	if reflect.DeepEqual(s.config, utils.OcpiConfiguration{}) {
+		return fmt.Errorf("configuration is not set")
+	}
+	if len(s.config.Tokens) == 0 {
+		return fmt.Errorf("no tokens are set")
+	}
+	if s.config.PageLimit <= 0 {
+		return fmt.Errorf("page limit is not set")
+	}
+	return nil
+}
+
+func WithTracerProvider(tp trace.TracerProvider) ServerOption {
+	return func(s *Server) {
+		s.tracer = tp.Tracer("ocpi")
+	}
+}
+
+func WithStore(store Store) ServerOption {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// Sets the tariffs the cost of sessions in progress is estimated with.
+func WithTariffs(tariffs *ocpp.Tariffs) ServerOption {
+	return func(s *Server) {
+		s.tariffs = tariffs
+	}
+}
+
+func WithConfig(config utils.OcpiConfiguration) ServerOption {
+	return func(s *Server) {
+		s.config = config
+	}
+}
+
+// Sets the clock responses are timestamped and costs estimated with, for tests.
+func WithClock(now func() time.Time) ServerOption {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// Creates a new Server with its routes.
+func NewServer(opts ...ServerOption) *Server {
+	server := &Server{
+		now:  time.Now,
+		http: iCore.NewHttpServer(iCore.WithHttpServiceName("ocpi")),
+	}
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	if err := server.Validate(); err != nil {
+		slog.Error("Failed to create OCPI server", "error", err)
+		panic(err)
+	}
+	mapper, err := NewMapper(server.config)
+	if err != nil {
+		slog.Error("Failed to read OCPI configuration", "error", err)
+		panic(err)
+	}
+	server.mapper = mapper
+
+	for _, route := range []struct {
+		path    string
+		handler echo.HandlerFunc
+	}{
+		{"/versions", server.versions},
+		{"/" + Version, server.versionDetails},
+		{"/" + Version + "/locations", server.listLocations},
+		{"/" + Version + "/locations/:location_id", server.getLocation},
+		{"/" + Version + "/locations/:location_id/:evse_uid", server.getEvse},
+		{"/" + Version + "/locations/:location_id/:evse_uid/:id", server.getConnector},
+		{"/" + Version + "/sessions", server.listSessions},
+		{"/" + Version + "/cdrs", server.listCdrs},
+	} {
+		server.http.AddRoute(http.MethodGet, basePath+route.path, server.authenticated(server.traced(route.handler)))
+	}
+
+	return server
+}
+
+// Serves the endpoints on the configured port until the server is shut down.
+func (s *Server) Start() {
+	s.http.Start(s.config.Port)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+// Serves a request, without listening on a port.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.http.ServeHTTP(w, r)
+}
+
+// Wraps a handler so it only serves partners with a configured token.
+func (s *Server) authenticated(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !s.authorized(c.Request().Header.Get(echo.HeaderAuthorization)) {
+			return s.respond(c, http.StatusUnauthorized, StatusClientError, "Invalid or missing token", nil)
+		}
+		return next(c)
+	}
+}
+
+// Checks if an Authorization header carries a configured token. The token is Base64 encoded as OCPI 2.2.1 has it,
+// or as it is for partners on earlier versions.
+func (s *Server) authorized(header string) bool {
+	token, ok := strings.CutPrefix(header, "Token ")
+	if !ok || token == "" {
+		return false
+	}
+	candidates := []string{token}
+	if decoded, err := base64.StdEncoding.DecodeString(token); err == nil {
+		candidates = append(candidates, string(decoded))
+	}
+
+	for _, configured := range s.config.Tokens {
+		for _, candidate := range candidates {
+			if subtle.ConstantTimeCompare([]byte(candidate), []byte(configured)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Wraps a handler in a span of the request, in the context of the configured tenant.
+func (s *Server) traced(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := ocpp.WithTenant(c.Request().Context(), s.config.Tenant)
+		ctx, span := s.tracer.Start(ctx, "ocpi "+c.Path(), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", c.Request().Method),
+			attribute.String("url.path", c.Request().URL.Path),
+			attribute.String("tenant", s.config.Tenant),
+		))
+		defer span.End()
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		err := next(c)
+		span.SetAttributes(attribute.Int("http.response.status_code", c.Response().Status))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// Writes an OCPI response.
+func (s *Server) respond(c echo.Context, httpStatus, statusCode int, message string, data any) error {
+	return c.JSON(httpStatus, Response{
+		Data:          data,
+		StatusCode:    statusCode,
+		StatusMessage: message,
+		Timestamp:     timestamp(s.now()),
+	})
+}
+
+// Writes the OCPI response of a request that failed on the server.
+func (s *Server) fail(c echo.Context, err error) error {
+	slog.Error("Failed to serve OCPI request", "error", err, "path", c.Request().URL.Path)
+	trace.SpanFromContext(c.Request().Context()).RecordError(err)
+	return s.respond(c, http.StatusInternalServerError, StatusServerError, "Generic server error", nil)
+}
+
+// Returns the URL the endpoints are reached at: the configured base URL, or the host of the request.
+func (s *Server) baseURL(c echo.Context) string {
+	if s.config.BaseURL != "" {
+		return strings.TrimSuffix(s.config.BaseURL, "/") + basePath
+	}
+	return c.Scheme() + "://" + c.Request().Host + basePath
+}
+
+func (s *Server) versions(c echo.Context) error {
+	return s.respond(c, http.StatusOK, StatusSuccess, "Success", []VersionInfo{
+		{Version: Version, URL: s.baseURL(c) + "/" + Version},
+	})
+}
+
+func (s *Server) versionDetails(c echo.Context) error {
+	base := s.baseURL(c) + "/" + Version
+	return s.respond(c, http.StatusOK, StatusSuccess, "Success", VersionDetails{
+		Version: Version,
+		Endpoints: []Endpoint{
+			{Identifier: "cdrs", Role: "SENDER", URL: base + "/cdrs"},
+			{Identifier: "locations", Role: "SENDER", URL: base + "/locations"},
+			{Identifier: "sessions", Role: "SENDER", URL: base + "/sessions"},
+		},
+	})
+}
+
+// Represents the page of objects a request asks for. Zero times do not bound it.
+type pageRequest struct {
+	from, to      time.Time
+	offset, limit int
+}
+
+// Returns the page a request asks for. The limit is at most the page limit, and the page limit when not given.
+func (s *Server) pageOf(c echo.Context) (pageRequest, error) {
+	page := pageRequest{limit: s.config.PageLimit}
+	var err error
+	for name, bound := range map[string]*time.Time{"date_from": &page.from, "date_to": &page.to} {
+		if value := c.QueryParam(name); value != "" {
+			if *bound, err = time.Parse(time.RFC3339, value); err != nil {
+				return pageRequest{}, fmt.Errorf("%s is not an RFC 3339 timestamp", name)
+			}
+		}
+	}
+	if value := c.QueryParam("offset"); value != "" {
+		if page.offset, err = strconv.Atoi(value); err != nil || page.offset < 0 {
+			return pageRequest{}, fmt.Errorf("offset is not a non-negative integer")
+		}
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		if page.limit, err = strconv.Atoi(value); err != nil || page.limit < 0 {
+			return pageRequest{}, fmt.Errorf("limit is not a non-negative integer")
+		}
+		page.limit = min(page.limit, s.config.PageLimit)
+	}
+	return page, nil
+}
+
+// Writes a page of objects out of total, with a link to the next page if there is one.
+func (s *Server) respondPage(c echo.Context, page pageRequest, total int, data any) error {
+	header := c.Response().Header()
+	header.Set(TotalCountHeader, strconv.Itoa(total))
+	header.Set(LimitHeader, strconv.Itoa(s.config.PageLimit))
+	if next := page.offset + page.limit; page.limit > 0 && next < total {
+		query := c.Request().URL.Query()
+		query.Set("offset", strconv.Itoa(next))
+		query.Set("limit", strconv.Itoa(page.limit))
+		link := url.URL{RawQuery: query.Encode()}
+		header.Set(LinkHeader, fmt.Sprintf(`<%s%s%s>; rel="next"`, s.baseURL(c), strings.TrimPrefix(c.Request().URL.Path, basePath), link.String()))
+	}
+	return s.respond(c, http.StatusOK, StatusSuccess, "Success", data)
+}
+
+func (s *Server) listLocations(c echo.Context) error {
+	page, err := s.pageOf(c)
+	if err != nil {
+		return s.respond(c, http.StatusBadRequest, StatusInvalidParameters, err.Error(), nil)
+	}
+
+	// Locations are few and configured, so they are filtered and paginated here
+	locations := []Location{}
+	for _, configured := range s.mapper.Locations() {
+		location, ok, err := s.location(c.Request().Context(), configured)
+		if err != nil {
+			return s.fail(c, err)
+		}
+		if ok && (page.from.IsZero() || !location.LastUpdated.Before(page.from)) && (page.to.IsZero() || location.LastUpdated.Before(page.to)) {
+			locations = append(locations, location)
+		}
+	}
+	total := len(locations)
+	locations = locations[min(page.offset, total):]
+	locations = locations[:min(page.limit, len(locations))]
+
+	return s.respondPage(c, page, total, locations)
+}
+
+func (s *Server) getLocation(c echo.Context) error {
+	location, ok, err := s.locationById(c)
+	if err != nil {
+		return s.fail(c, err)
+	}
+	if !ok {
+		return s.respond(c, http.StatusNotFound, StatusUnknownLocation, "Unknown location", nil)
+	}
+	return s.respond(c, http.StatusOK, StatusSuccess, "Success", location)
+}
+
+func (s *Server) getEvse(c echo.Context) error {
+	location, ok, err := s.locationById(c)
+	if err != nil {
+		return s.fail(c, err)
+	}
+	if ok {
+		for _, evse := range location.Evses {
+			if evse.Uid == c.Param("evse_uid") {
+				return s.respond(c, http.StatusOK, StatusSuccess, "Success", evse)
+			}
+		}
+	}
+	return s.respond(c, http.StatusNotFound, StatusUnknownLocation, "Unknown EVSE", nil)
+}
+
+func (s *Server) getConnector(c echo.Context) error {
+	location, ok, err := s.locationById(c)
+	if err != nil {
+		return s.fail(c, err)
+	}
+	if ok {
+		for _, evse := range location.Evses {
+			for _, connector := range evse.Connectors {
+				if evse.Uid == c.Param("evse_uid") && connector.Id == c.Param("id") {
+					return s.respond(c, http.StatusOK, StatusSuccess, "Success", connector)
+				}
+			}
+		}
+	}
+	return s.respond(c, http.StatusNotFound, StatusUnknownLocation, "Unknown connector", nil)
+}
+
+// Returns the location of the location_id parameter, or false if it is not configured or not published yet.
+func (s *Server) locationById(c echo.Context) (Location, bool, error) {
+	for _, configured := range s.mapper.Locations() {
+		if configured.ID == c.Param("location_id") {
+			return s.location(c.Request().Context(), configured)
+		}
+	}
+	return Location{}, false, nil
+}
+
+// Returns a configured location with the charge points at it that booted and the latest status of their connectors,
+// or false if none of them booted.
+func (s *Server) location(ctx context.Context, configured utils.OcpiLocationConfiguration) (Location, bool, error) {
+	var chargepoints []ocpp.Chargepoint
+	var statuses []ocpp.ConnectorStatus
+	for _, serialnumber := range configured.Serialnumbers {
+		chargepoint, err := s.store.GetChargepoint(ctx, serialnumber)
+		if errors.Is(err, ocpp.ErrChargepointNotFound) {
+			continue
+		}
+		if err != nil {
+			return Location{}, false, err
+		}
+		chargepoints = append(chargepoints, chargepoint)
+
+		latest, err := s.store.ListLatestConnectorStatuses(ctx, serialnumber)
+		if err != nil {
+			return Location{}, false, err
+		}
+		statuses = append(statuses, latest...)
+	}
+
+	location, ok := s.mapper.Location(configured, chargepoints, statuses)
+	return location, ok, nil
+}
+
+func (s *Server) listSessions(c echo.Context) error {
+	ctx := c.Request().Context()
+	page, err := s.pageOf(c)
+	if err != nil {
+		return s.respond(c, http.StatusBadRequest, StatusInvalidParameters, err.Error(), nil)
+	}
+
+	// Only the charge points placed at a location are listed, the ones that map to sessions, so the count and the pages
+	// are of what the partner is served
+	filter := ocpp.TransactionFilter{
+		Serialnumbers: s.mapper.Serialnumbers(),
+		UpdatedFrom:   page.from,
+		UpdatedTo:     page.to,
+		Offset:        page.offset,
+		Limit:         page.limit,
+	}
+	total, err := s.store.CountTransactions(ctx, filter)
+	if err != nil {
+		return s.fail(c, err)
+	}
+	transactions, err := s.store.ListTransactions(ctx, filter)
+	if err != nil {
+		return s.fail(c, err)
+	}
+
+	sessions := make([]Session, 0, len(transactions))
+	for _, transaction := range transactions {
+		session, ok, err := s.session(ctx, transaction)
+		if err != nil {
+			return s.fail(c, err)
+		}
+		if !ok {
+			return s.fail(c, fmt.Errorf("transaction %d of %s is not at a location", transaction.Id, transaction.Serialnumber))
+		}
+		sessions = append(sessions, session)
+	}
+
+	return s.respondPage(c, page, total, sessions)
+}
+
+// Returns the session of a transaction, with its cost so far if a tariff applies to it.
+func (s *Server) session(ctx context.Context, transaction ocpp.Transaction) (Session, bool, error) {
+	samples, err := s.store.ListMeterSamples(ctx, transaction.Serialnumber, transaction.Id)
+	if err != nil {
+		return Session{}, false, err
+	}
+
+	var cost *ocpp.CostBreakdown
+	if s.tariffs != nil {
+		now := s.now().UTC()
+		until := now
+		if transaction.StoppedAt != nil {
+			until = *transaction.StoppedAt
+		}
+		statuses, err := s.store.ListConnectorStatuses(ctx, transaction.Serialnumber, transaction.ConnectorId, transaction.StartedAt, until)
+		if err != nil {
+			return Session{}, false, err
+		}
+		if estimate, ok := s.tariffs.Estimate(transaction, samples, statuses, now); ok {
+			cost = &estimate.Cost
+		}
+	}
+
+	session, ok := s.mapper.Session(transaction, samples, cost)
+	return session, ok, nil
+}
+
+func (s *Server) listCdrs(c echo.Context) error {
+	ctx := c.Request().Context()
+	page, err := s.pageOf(c)
+	if err != nil {
+		return s.respond(c, http.StatusBadRequest, StatusInvalidParameters, err.Error(), nil)
+	}
+
+	// Only the charge points placed at a location are listed, the ones that map to CDRs, so the count and the pages are
+	// of what the partner is served
+	filter := ocpp.CdrFilter{
+		Serialnumbers: s.mapper.Serialnumbers(),
+		CreatedFrom:   page.from,
+		CreatedTo:     page.to,
+		Offset:        page.offset,
+		Limit:         page.limit,
+	}
+	total, err := s.store.CountCdrs(ctx, filter)
+	if err != nil {
+		return s.fail(c, err)
+	}
+	records, err := s.store.ListCdrs(ctx, filter)
+	if err != nil {
+		return s.fail(c, err)
+	}
+
+	cdrs := make([]Cdr, 0, len(records))
+	for _, record := range records {
+		cdr, ok := s.mapper.Cdr(record)
+		if !ok {
+			return s.fail(c, fmt.Errorf("CDR of transaction %d of %s is not at a location", record.TransactionId, record.Serialnumber))
+		}
+		cdrs = append(cdrs, cdr)
+	}
+
+	return s.respondPage(c, page, total, cdrs)
+}
@@ -0,0 +1,316 @@
+package ocpi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>; rel="next"`)
+
+// Stands in for a roaming partner pulling from the sender interfaces, as an eMSP would.
+type partner struct {
+	t     *testing.T
+	token string
+}
+
+// Returns the response of a GET with the data decoded into data, or the raw data when data is nil.
+func (p *partner) get(url string, data any) (*http.Response, Response) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(p.t, err)
+	if p.token != "" {
+		request.Header.Set("Authorization", "Token "+base64.StdEncoding.EncodeToString([]byte(p.token)))
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if !assert.NoError(p.t, err) {
+		p.t.FailNow()
+	}
+	defer response.Body.Close()
+
+	var envelope struct {
+		Response
+		Data json.RawMessage `json:"data"`
+	}
+	assert.NoError(p.t, json.NewDecoder(response.Body).Decode(&envelope))
+	if data != nil && len(envelope.Data) > 0 {
+		assert.NoError(p.t, json.Unmarshal(envelope.Data, data))
+	}
+	return response, envelope.Response
+}
+
+// Returns the endpoints of the version the partner and the server share, as found from the versions URL.
+func (p *partner) discover(versionsURL string) map[string]string {
+	var versions []VersionInfo
+	_, response := p.get(versionsURL, &versions)
+	assert.Equal(p.t, StatusSuccess, response.StatusCode)
+	for _, version := range versions {
+		if version.Version != Version {
+			continue
+		}
+		var details VersionDetails
+		p.get(version.URL, &details)
+		endpoints := make(map[string]string)
+		for _, endpoint := range details.Endpoints {
+			assert.Equal(p.t, "SENDER", endpoint.Role)
+			endpoints[endpoint.Identifier] = endpoint.URL
+		}
+		return endpoints
+	}
+	p.t.Fatalf("version %s is not offered", Version)
+	return nil
+}
+
+// Returns every object of a list, following the links to the next pages, and how many pages it took.
+func list[T any](p *partner, url string) ([]T, int) {
+	var all []T
+	pages := 0
+	for url != "" {
+		var page []T
+		response, envelope := p.get(url, &page)
+		assert.Equal(p.t, http.StatusOK, response.StatusCode)
+		assert.Equal(p.t, StatusSuccess, envelope.StatusCode)
+		all = append(all, page...)
+		pages++
+
+		url = ""
+		if match := nextLinkPattern.FindStringSubmatch(response.Header.Get(LinkHeader)); match != nil {
+			url = match[1]
+		}
+	}
+	return all, pages
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 7, 22, 12, 0, 0, 0, time.UTC)
+	startedAt := now.Add(-2 * time.Hour)
+	store := ocpp.NewMemoryStore(
+		ocpp.WithMemoryStoreTracerProvider(noop.NewTracerProvider()),
+		ocpp.WithMemoryStoreClock(func() time.Time { return startedAt.Add(-time.Hour) }),
+	)
+
+	// charger-9 is not placed at a location, so nothing of it is published
+	for _, serialnumber := range []string{"charger-1", "charger-2", "charger-9"} {
+		_, err := store.AddChargepoint(ctx, serialnumber, core.BootNotificationRequest{ChargePointModel: "Model", ChargePointVendor: "Vendor"})
+		assert.NoError(t, err)
+		for connectorId := range 3 {
+			assert.NoError(t, store.AddConnectorStatus(ctx, ocpp.ConnectorStatus{
+				Serialnumber: serialnumber,
+				ConnectorId:  connectorId,
+				Status:       core.ChargePointStatusAvailable,
+				ReportedAt:   startedAt.Add(-time.Minute),
+			}))
+		}
+	}
+	start := func(serialnumber string, connectorId int) int {
+		id, err := store.StartTransaction(ctx, serialnumber, core.StartTransactionRequest{
+			ConnectorId: connectorId,
+			IdTag:       "B4A63CDF",
+			MeterStart:  1000,
+			Timestamp:   types.NewDateTime(startedAt),
+		})
+		assert.NoError(t, err)
+		return id
+	}
+
+	// Sessions and CDRs of charge points not at a location come first, so paging after mapping would give short pages
+	unplaced := start("charger-9", 1)
+	stopped := start("charger-1", 1)
+	stoppedAt := startedAt.Add(time.Hour)
+	_, err := store.AddCdr(ctx, ocpp.ChargeDetailRecord{
+		Serialnumber:  "charger-9",
+		TransactionId: unplaced,
+		ConnectorId:   1,
+		StartedAt:     startedAt,
+		StoppedAt:     stoppedAt,
+		CreatedAt:     stoppedAt.Add(-time.Minute),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, store.StopTransaction(ctx, "charger-1", core.StopTransactionRequest{
+		TransactionId: stopped,
+		MeterStop:     11000,
+		Timestamp:     types.NewDateTime(stoppedAt),
+	}))
+	_, err = store.AddCdr(ctx, ocpp.ChargeDetailRecord{
+		Serialnumber:  "charger-1",
+		TransactionId: stopped,
+		ConnectorId:   1,
+		IdTag:         "B4A63CDF",
+		StartedAt:     startedAt,
+		StoppedAt:     stoppedAt,
+		Duration:      time.Hour,
+		MeterStart:    1000,
+		MeterStop:     11000,
+		EnergyWh:      10000,
+		ChargingTime:  time.Hour,
+		CreatedAt:     stoppedAt,
+	})
+	assert.NoError(t, err)
+
+	start("charger-1", 2)
+	active := start("charger-2", 1)
+	assert.NoError(t, store.AddMeterSamples(ctx, []ocpp.MeterSample{{
+		Serialnumber:  "charger-2",
+		TransactionId: active,
+		ConnectorId:   1,
+		RegisterWh:    5000,
+		SampledAt:     now.Add(-time.Minute),
+	}}))
+	assert.NoError(t, store.AddConnectorStatus(ctx, ocpp.ConnectorStatus{
+		Serialnumber: "charger-2",
+		ConnectorId:  1,
+		Status:       core.ChargePointStatusCharging,
+		ReportedAt:   startedAt,
+	}))
+
+	tariffs, err := ocpp.NewTariffs(utils.TariffConfiguration{
+		Tariffs:     []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", EnergyPrice: "0.50"}},
+		Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "standard", Serialnumbers: []string{"charger-2"}}},
+	})
+	assert.NoError(t, err)
+
+	server := NewServer(
+		WithTracerProvider(noop.NewTracerProvider()),
+		WithStore(store),
+		WithTariffs(tariffs),
+		WithConfig(testConfig()),
+		WithClock(func() time.Time { return now }),
+	)
+	partnerServer := httptest.NewServer(server)
+	defer partnerServer.Close()
+
+	p := &partner{t: t, token: "partner-token"}
+	endpoints := p.discover(partnerServer.URL + "/ocpi/versions")
+
+	t.Run("Locations", func(t *testing.T) {
+		locations, pages := list[Location](p, endpoints["locations"])
+		assert.Equal(t, 1, pages)
+		if assert.Len(t, locations, 1) {
+			assert.Equal(t, "LOC1", locations[0].Id)
+			assert.Len(t, locations[0].Evses, 4)
+		}
+
+		var evse Evse
+		response, _ := p.get(endpoints["locations"]+"/LOC1/charger-2-1", &evse)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, StatusCharging, evse.Status)
+
+		var connector Connector
+		response, _ = p.get(endpoints["locations"]+"/LOC1/charger-2-1/1", &connector)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "IEC_62196_T2", connector.Standard)
+
+		for _, path := range []string{"/LOC2", "/LOC1/charger-9-1", "/LOC1/charger-2-1/2"} {
+			response, envelope := p.get(endpoints["locations"]+path, nil)
+			assert.Equal(t, http.StatusNotFound, response.StatusCode, path)
+			assert.Equal(t, StatusUnknownLocation, envelope.StatusCode, path)
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		sessions, pages := list[Session](p, endpoints["sessions"])
+		assert.Equal(t, 2, pages)
+		if assert.Len(t, sessions, 3) {
+			assert.Equal(t, SessionStatusCompleted, sessions[0].Status)
+			assert.Equal(t, "10", sessions[0].Kwh.String())
+			assert.Nil(t, sessions[0].TotalCost)
+
+			active := sessions[2]
+			assert.Equal(t, "charger-2-1", active.EvseUid)
+			assert.Equal(t, SessionStatusActive, active.Status)
+			assert.Equal(t, "4", active.Kwh.String())
+			if assert.NotNil(t, active.TotalCost) {
+				assert.Equal(t, "2", active.TotalCost.ExclVat.String())
+			}
+		}
+
+		// Only the session updated since the transaction stopped
+		sessions, _ = list[Session](p, endpoints["sessions"]+"?date_from="+stoppedAt.Add(time.Second).Format(time.RFC3339))
+		if assert.Len(t, sessions, 1) {
+			assert.Equal(t, fmt.Sprint(active), sessions[0].Id)
+		}
+	})
+
+	t.Run("Cdrs", func(t *testing.T) {
+		cdrs, _ := list[Cdr](p, endpoints["cdrs"])
+		if assert.Len(t, cdrs, 1) {
+			assert.Equal(t, fmt.Sprint(stopped), cdrs[0].Id)
+			assert.Equal(t, "LOC1", cdrs[0].CdrLocation.Id)
+		}
+
+		cdrs, _ = list[Cdr](p, endpoints["cdrs"]+"?date_from="+now.Format(time.RFC3339))
+		assert.Empty(t, cdrs)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		response, _ := p.get(endpoints["sessions"]+"?limit=1&offset=1", nil)
+		assert.Equal(t, "3", response.Header.Get(TotalCountHeader))
+		assert.Equal(t, "2", response.Header.Get(LimitHeader))
+		match := nextLinkPattern.FindStringSubmatch(response.Header.Get(LinkHeader))
+		if assert.NotNil(t, match) {
+			assert.Equal(t, endpoints["sessions"]+"?limit=1&offset=2", match[1])
+		}
+
+		// Every page is full and the total counts only what is served
+		for _, endpoint := range []string{endpoints["sessions"], endpoints["cdrs"]} {
+			for offset := 0; ; offset++ {
+				var page []json.RawMessage
+				response, _ := p.get(fmt.Sprintf("%s?limit=1&offset=%d", endpoint, offset), &page)
+				total, err := strconv.Atoi(response.Header.Get(TotalCountHeader))
+				assert.NoError(t, err)
+				if offset >= total {
+					assert.Empty(t, page)
+					break
+				}
+				assert.Len(t, page, 1, "%s at offset %d", endpoint, offset)
+			}
+		}
+
+		response, envelope := p.get(endpoints["sessions"]+"?date_from=yesterday", nil)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.Equal(t, StatusInvalidParameters, envelope.StatusCode)
+	})
+
+	t.Run("Tenant", func(t *testing.T) {
+		config := testConfig()
+		config.Tenant = "operator-b"
+		tenantServer := httptest.NewServer(NewServer(
+			WithTracerProvider(noop.NewTracerProvider()),
+			WithStore(store),
+			WithConfig(config),
+			WithClock(func() time.Time { return now }),
+		))
+		defer tenantServer.Close()
+
+		// The charge points of the default tenant are not served to the partners of another
+		tenantEndpoints := p.discover(tenantServer.URL + "/ocpi/versions")
+		sessions, _ := list[Session](p, tenantEndpoints["sessions"])
+		assert.Empty(t, sessions)
+		cdrs, _ := list[Cdr](p, tenantEndpoints["cdrs"])
+		assert.Empty(t, cdrs)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		for _, token := range []string{"", "another-token"} {
+			stranger := &partner{t: t, token: token}
+			response, envelope := stranger.get(endpoints["sessions"], nil)
+			assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+			assert.Equal(t, StatusClientError, envelope.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package ocpp
+
+import (
+	"fmt"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Drivers of the cache.
+const (
+	CacheDriverRedis  = "redis"
+	CacheDriverMemory = "memory"
+)
+
+// Creates the cache of the configured driver.
+func NewCache(tp trace.TracerProvider, config utils.CacheConfiguration) (CacheAdapter, error) {
+	switch config.Driver {
+	case CacheDriverRedis, "":
+		client, err := NewRedisClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisCache(tp, client), nil
+	case CacheDriverMemory:
+		return NewMemoryCache(
+			WithMemoryCacheTracerProvider(tp),
+			WithMemoryCacheMaxEntries(config.MaxEntries),
+			WithMemoryCacheMaxLiveEntries(config.MaxLiveEntries),
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", config.Driver)
+	}
+}
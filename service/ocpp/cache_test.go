@@ -0,0 +1,276 @@
+package ocpp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Creates an empty cache for a conformance test, and a function that moves its clock forward.
+type cacheSetup func(t *testing.T) (CacheAdapter, func(time.Duration))
+
+func TestRedisCacheConformance(t *testing.T) {
+	testCacheAdapter(t, func(t *testing.T) (CacheAdapter, func(time.Duration)) {
+		server, cache := setupMiniredisTest(t)
+		return cache, server.FastForward
+	})
+}
+
+func TestMemoryCacheConformance(t *testing.T) {
+	testCacheAdapter(t, func(t *testing.T) (CacheAdapter, func(time.Duration)) {
+		clock := &testClock{now: time.Now()}
+		cache := NewMemoryCache(
+			WithMemoryCacheTracerProvider(noop.NewTracerProvider()),
+			WithMemoryCacheClock(clock.Now),
+		)
+		return cache, clock.Advance
+	})
+}
+
+// Runs the tests every CacheAdapter has to pass.
+func testCacheAdapter(t *testing.T, setup cacheSetup) {
+	t.Run("Requests", func(t *testing.T) { testCacheRequests(t, setup) })
+	t.Run("Claim", func(t *testing.T) { testCacheClaim(t, setup) })
+}
+
+func testCacheRequests(t *testing.T, setup cacheSetup) {
+	ctx := context.Background()
+	charger1 := v16.Meta{Serialnumber: "charger-1", Direction: v16.ChargePointToCentralSystem}
+	charger2 := v16.Meta{Serialnumber: "charger-2", Direction: v16.ChargePointToCentralSystem}
+	request := v16.RequestBody{Uuid: "uuid-heartbeat", Action: core.Heartbeat, Payload: []byte("{}")}
+
+	t.Run("ScopedBySerialnumber", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		assert.NoError(t, cache.AddRequest(ctx, charger1, request, 0))
+
+		_, err := cache.GetRequestFromUuid(ctx, charger2, "uuid-heartbeat")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+		assert.ErrorIs(t, cache.RemoveRequest(ctx, charger2, v16.ConfirmationBody{Uuid: "uuid-heartbeat"}), ErrRequestNotFound)
+
+		found, err := cache.GetRequestFromUuid(ctx, charger1, "uuid-heartbeat")
+		assert.NoError(t, err)
+		assert.Equal(t, request, found)
+	})
+
+	t.Run("ScopedByDirection", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		assert.NoError(t, cache.AddRequest(ctx, charger1, request, 0))
+
+		reversed := charger1
+		reversed.Direction = v16.CentralSystemToChargePoint
+		_, err := cache.GetRequestFromUuid(ctx, reversed, "uuid-heartbeat")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+	})
+
+	t.Run("SameUuid_PerCharger", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		assert.NoError(t, cache.AddRequest(ctx, charger1, request, 0))
+		assert.NoError(t, cache.AddRequest(ctx, charger2, request, 0))
+		assert.NoError(t, cache.RemoveRequest(ctx, charger1, v16.ConfirmationBody{Uuid: "uuid-heartbeat"}))
+
+		_, err := cache.GetRequestFromUuid(ctx, charger1, "uuid-heartbeat")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+		_, err = cache.GetRequestFromUuid(ctx, charger2, "uuid-heartbeat")
+		assert.NoError(t, err)
+	})
+
+	t.Run("ScopedByTenant", func(t *testing.T) {
+		cache, _ := setup(t)
+		operatorA := WithTenant(ctx, "operator-a")
+
+		assert.NoError(t, cache.AddRequest(operatorA, charger1, request, time.Second))
+
+		_, err := cache.GetRequestFromUuid(ctx, charger1, "uuid-heartbeat")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+		_, err = cache.GetRequestFromUuid(WithTenant(ctx, "operator-b"), charger1, "uuid-heartbeat")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+		found, err := cache.GetRequestFromUuid(operatorA, charger1, "uuid-heartbeat")
+		assert.NoError(t, err)
+		assert.Equal(t, request, found)
+
+		expired, err := cache.TakeExpiredRequests(ctx, time.Now().Add(time.Minute), 10)
+		assert.NoError(t, err)
+		assert.Len(t, expired, 1)
+		assert.Equal(t, "operator-a", expired[0].Tenant)
+	})
+
+	t.Run("MissingScope", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		assert.Error(t, cache.AddRequest(ctx, v16.Meta{Direction: v16.ChargePointToCentralSystem}, request, 0))
+		assert.Error(t, cache.AddRequest(ctx, v16.Meta{Serialnumber: "charger-1"}, request, 0))
+	})
+
+	t.Run("TakeExpiredRequests", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		meta := v16.Meta{Id: "message-1", Serialnumber: "charger-1", Direction: v16.CentralSystemToChargePoint}
+		assert.NoError(t, cache.AddRequest(ctx, meta, request, time.Second))
+		assert.NoError(t, cache.AddRequest(ctx, charger2, request, time.Hour))
+		assert.NoError(t, cache.AddRequest(ctx, charger1, request, 0))
+
+		expired, err := cache.TakeExpiredRequests(ctx, time.Now().Add(time.Minute), 10)
+		assert.NoError(t, err)
+		assert.Len(t, expired, 1)
+		assert.Equal(t, meta, expired[0].Meta)
+		assert.Equal(t, request, expired[0].Request)
+		assert.True(t, expired[0].Deadline.After(expired[0].AddedAt))
+
+		// Taken requests are removed and not returned again
+		_, err = cache.GetRequestFromUuid(ctx, meta, "uuid-heartbeat")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+		expired, err = cache.TakeExpiredRequests(ctx, time.Now().Add(time.Minute), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, expired)
+	})
+
+	t.Run("RemovedRequest_NotExpired", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		assert.NoError(t, cache.AddRequest(ctx, charger1, request, time.Second))
+		assert.NoError(t, cache.RemoveRequest(ctx, charger1, v16.ConfirmationBody{Uuid: "uuid-heartbeat"}))
+
+		expired, err := cache.TakeExpiredRequests(ctx, time.Now().Add(time.Minute), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, expired)
+	})
+}
+
+func testCacheClaim(t *testing.T, setup cacheSetup) {
+	ctx := context.Background()
+
+	t.Run("Acquired_ThenInProgress", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, claim.State)
+		assert.NotEmpty(t, claim.Token)
+
+		other, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimInProgress, other.State)
+		assert.Empty(t, other.Token)
+	})
+
+	t.Run("Completed_StoresReply", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.CompleteMessage(ctx, claim, []byte(`[3,"uuid-1",{}]`)))
+
+		duplicate, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimCompleted, duplicate.State)
+		assert.Equal(t, []byte(`[3,"uuid-1",{}]`), duplicate.Reply)
+	})
+
+	t.Run("Completed_WithoutReply", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.CompleteMessage(ctx, claim, nil))
+
+		duplicate, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimCompleted, duplicate.State)
+		assert.Nil(t, duplicate.Reply)
+	})
+
+	t.Run("Released_CanBeClaimedAgain", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.ReleaseMessage(ctx, claim))
+
+		again, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, again.State)
+	})
+
+	t.Run("LeaseExpired_ClaimLost", func(t *testing.T) {
+		cache, advance := setup(t)
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+
+		advance(2 * time.Minute)
+		other, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, other.State)
+
+		// The first holder can no longer complete or release the claim of the second
+		assert.ErrorIs(t, cache.CompleteMessage(ctx, claim, []byte("reply")), ErrClaimLost)
+		assert.ErrorIs(t, cache.ReleaseMessage(ctx, claim), ErrClaimLost)
+		assert.NoError(t, cache.CompleteMessage(ctx, other, []byte("reply")))
+	})
+
+	t.Run("ScopedByTenant", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		claim, err := cache.ClaimMessage(WithTenant(ctx, "operator-a"), "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.CompleteMessage(WithTenant(ctx, "operator-a"), claim, nil))
+
+		other, err := cache.ClaimMessage(WithTenant(ctx, "operator-b"), "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, other.State)
+		assert.ErrorIs(t, cache.ReleaseMessage(ctx, other), ErrClaimLost)
+	})
+
+	t.Run("Concurrent_SingleAcquired", func(t *testing.T) {
+		cache, _ := setup(t)
+
+		var wg sync.WaitGroup
+		states := make(chan ClaimState, 10)
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+				assert.NoError(t, err)
+				states <- claim.State
+			}()
+		}
+		wg.Wait()
+		close(states)
+
+		acquired := 0
+		for state := range states {
+			if state == ClaimAcquired {
+				acquired++
+			}
+		}
+		assert.Equal(t, 1, acquired)
+	})
+}
+
+// Represents a clock that only moves when advanced.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
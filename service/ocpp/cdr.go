@@ -0,0 +1,350 @@
+package ocpp
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
+)
+
+// Represents an Energy.Active.Import.Register reading taken during a transaction, in Wh.
+type MeterSample struct {
+	Serialnumber  string
+	TransactionId int
+	ConnectorId   int
+	Context       types.ReadingContext // empty when the charge point did not report it
+	RegisterWh    int
+	SampledAt     time.Time
+}
+
+// Represents a status a charge point reported for one of its connectors.
+type ConnectorStatus struct {
+	Serialnumber string
+	ConnectorId  int
+	Status       core.ChargePointStatus
+	ErrorCode    core.ChargePointErrorCode
+	Info         string
+	ReportedAt   time.Time
+}
+
+// Tells how the energy of a CDR compares to the register readings taken during its transaction.
+type EnergyCheck string
+
+const (
+	// The readings lie between the meter start and stop values.
+	EnergyCheckVerified EnergyCheck = "verified"
+	// No readings were taken, so the energy rests on the meter start and stop values alone.
+	EnergyCheckUnverified EnergyCheck = "unverified"
+	// A reading lies outside the meter start and stop values, the readings go down, or the meter stop value is below the
+	// meter start value.
+	EnergyCheckMismatch EnergyCheck = "mismatch"
+)
+
+// Represents the finalised charge detail record of a stopped transaction. A CDR is written once and never changed.
+// Durations are whole seconds; ChargingTime and IdleTime add up to Duration. SampledEnergyWh is the energy between
+// the first and last register reading, nil when there were none. Cost is the price under the tariff of the session,
+// nil when no tariff applied.
+type ChargeDetailRecord struct {
+	Id              int64
+	Serialnumber    string
+	TransactionId   int
+	ConnectorId     int
+	IdTag           string
+	StartedAt       time.Time
+	StoppedAt       time.Time
+	Duration        time.Duration
+	MeterStart      int
+	MeterStop       int
+	EnergyWh        int
+	SampledEnergyWh *int
+	EnergyCheck     EnergyCheck
+	StopReason      core.Reason
+	ChargingTime    time.Duration
+	IdleTime        time.Duration
+	Cost            *CostBreakdown
+	CreatedAt       time.Time
+	Tenant          string
+}
+
+// Returned when a transaction already has a CDR.
+var ErrCdrExists = errors.New("charge detail record already exists")
+
+// Returned when a transaction has no CDR.
+var ErrCdrNotFound = errors.New("charge detail record not found")
+
+// Represents what CDRs to list. Empty fields and zero times match everything, but a non-nil empty Serialnumbers matches
+// nothing; From and To bound when the transaction stopped, CreatedFrom and CreatedTo when its CDR was written.
+// Offset CDRs are skipped before Limit are listed.
+type CdrFilter struct {
+	Serialnumber  string
+	Serialnumbers []string
+	From          time.Time // inclusive
+	To            time.Time // exclusive
+	CreatedFrom   time.Time // inclusive
+	CreatedTo     time.Time // exclusive
+	Offset        int
+	Limit         int
+}
+
+// Checks if the CDR matches the filter.
+func (f CdrFilter) Matches(cdr ChargeDetailRecord) bool {
+	return (f.Serialnumber == "" || cdr.Serialnumber == f.Serialnumber) &&
+		(f.Serialnumbers == nil || slices.Contains(f.Serialnumbers, cdr.Serialnumber)) &&
+		(f.From.IsZero() || !cdr.StoppedAt.Before(f.From)) &&
+		(f.To.IsZero() || cdr.StoppedAt.Before(f.To)) &&
+		(f.CreatedFrom.IsZero() || !cdr.CreatedAt.Before(f.CreatedFrom)) &&
+		(f.CreatedTo.IsZero() || cdr.CreatedAt.Before(f.CreatedTo))
+}
+
+// Returns the Energy.Active.Import.Register readings among the meter values of a transaction. Values without a measurand
+// are register readings, as OCPP defaults them to; signed values and readings of a single phase are left out.
+func meterSamples(serialnumber string, transactionId, connectorId int, values []types.MeterValue) []MeterSample {
+	var samples []MeterSample
+	for _, value := range values {
+		if value.Timestamp == nil {
+			continue
+		}
+		for _, sampled := range value.SampledValue {
+			if sampled.Measurand != "" && sampled.Measurand != types.MeasurandEnergyActiveImportRegister {
+				continue
+			}
+			if sampled.Format == types.ValueFormatSignedData || sampled.Phase != "" {
+				continue
+			}
+			wh, err := strconv.ParseFloat(sampled.Value, 64)
+			if err != nil {
+				continue
+			}
+			if sampled.Unit == types.UnitOfMeasureKWh {
+				wh *= 1000
+			}
+			samples = append(samples, MeterSample{
+				Serialnumber:  serialnumber,
+				TransactionId: transactionId,
+				ConnectorId:   connectorId,
+				Context:       sampled.Context,
+				RegisterWh:    int(math.Round(wh)),
+				SampledAt:     value.Timestamp.Time,
+			})
+		}
+	}
+	return samples
+}
+
+// Creates the CDR of a stopped transaction. The energy is meterStop minus meterStart, checked against the register
+// readings of the transaction. A meterStop below meterStart, as after a meter reset or swap, gives no energy and a
+// mismatch, as the energy cannot be known from the meter values. The connector statuses split its duration into
+// charging time, while the connector was Charging, and idle time in any other status. Time before the first known
+// status counts as charging, so a charge point that does not report its status is never billed idle time.
+func NewChargeDetailRecord(transaction Transaction, samples []MeterSample, statuses []ConnectorStatus) (ChargeDetailRecord, error) {
+	if transaction.StoppedAt == nil || transaction.MeterStop == nil {
+		return ChargeDetailRecord{}, fmt.Errorf("transaction %d of %s has not stopped", transaction.Id, transaction.Serialnumber)
+	}
+
+	cdr := ChargeDetailRecord{
+		Serialnumber:  transaction.Serialnumber,
+		TransactionId: transaction.Id,
+		ConnectorId:   transaction.ConnectorId,
+		IdTag:         transaction.IdTag,
+		StartedAt:     transaction.StartedAt,
+		StoppedAt:     *transaction.StoppedAt,
+		Duration:      max(transaction.StoppedAt.Sub(transaction.StartedAt), 0).Truncate(time.Second),
+		MeterStart:    transaction.MeterStart,
+		MeterStop:     *transaction.MeterStop,
+		EnergyWh:      *transaction.MeterStop - transaction.MeterStart,
+		StopReason:    transaction.StopReason,
+		Tenant:        transaction.Tenant,
+	}
+	if cdr.StopReason == "" {
+		// OCPP assumes Local when a transaction ended normally without a reason
+		cdr.StopReason = core.ReasonLocal
+	}
+
+	cdr.SampledEnergyWh, cdr.EnergyCheck = checkEnergy(cdr.MeterStart, cdr.MeterStop, samples)
+	if cdr.EnergyWh < 0 {
+		cdr.EnergyWh = 0
+		cdr.EnergyCheck = EnergyCheckMismatch
+	}
+	cdr.ChargingTime = min(chargingTime(cdr.StartedAt, cdr.StoppedAt, statuses).Truncate(time.Second), cdr.Duration)
+	cdr.IdleTime = cdr.Duration - cdr.ChargingTime
+
+	return cdr, nil
+}
+
+// Checks the register readings against the meter start and stop values. A reading may be off by 1% of the energy, and
+// at least 100 Wh, which allows for registers reported in tenths of a kWh.
+func checkEnergy(meterStart, meterStop int, samples []MeterSample) (*int, EnergyCheck) {
+	if len(samples) == 0 {
+		return nil, EnergyCheckUnverified
+	}
+
+	samples = slices.Clone(samples)
+	slices.SortStableFunc(samples, func(a, b MeterSample) int {
+		return a.SampledAt.Compare(b.SampledAt)
+	})
+	sampled := samples[len(samples)-1].RegisterWh - samples[0].RegisterWh
+
+	tolerance := max(100, (meterStop-meterStart)/100)
+	check := EnergyCheckVerified
+	for i, sample := range samples {
+		if sample.RegisterWh < meterStart-tolerance || sample.RegisterWh > meterStop+tolerance {
+			check = EnergyCheckMismatch
+		}
+		if i > 0 && sample.RegisterWh < samples[i-1].RegisterWh-tolerance {
+			check = EnergyCheckMismatch
+		}
+	}
+	return &sampled, check
+}
+
+// Returns how long the connector was Charging between start and stop, from the statuses it reported.
+func chargingTime(start, stop time.Time, statuses []ConnectorStatus) time.Duration {
+	var total time.Duration
+	for _, period := range chargingPeriods(start, stop, statuses) {
+		total += period[1].Sub(period[0])
+	}
+	return total
+}
+
+// Returns the periods between start and stop in which the connector was Charging, from the statuses it reported.
+func chargingPeriods(start, stop time.Time, statuses []ConnectorStatus) [][2]time.Time {
+	statuses = slices.Clone(statuses)
+	slices.SortStableFunc(statuses, func(a, b ConnectorStatus) int {
+		return a.ReportedAt.Compare(b.ReportedAt)
+	})
+
+	charging := true
+	var periods [][2]time.Time
+	from := start
+	for _, status := range statuses {
+		if status.ReportedAt.After(from) {
+			until := status.ReportedAt
+			if until.After(stop) {
+				until = stop
+			}
+			if charging && until.After(from) {
+				periods = append(periods, [2]time.Time{from, until})
+			}
+			from = until
+		}
+		charging = status.Status == core.ChargePointStatusCharging
+	}
+	if charging && stop.After(from) {
+		periods = append(periods, [2]time.Time{from, stop})
+	}
+	return periods
+}
+
+// Represents a CDR as it is exported, with durations in seconds.
+type cdrExport struct {
+	Id              int64          `json:"id"`
+	Serialnumber    string         `json:"serialnumber"`
+	TransactionId   int            `json:"transactionId"`
+	ConnectorId     int            `json:"connectorId"`
+	IdTag           string         `json:"idTag"`
+	StartedAt       time.Time      `json:"startedAt"`
+	StoppedAt       time.Time      `json:"stoppedAt"`
+	DurationSeconds int64          `json:"durationSeconds"`
+	MeterStart      int            `json:"meterStart"`
+	MeterStop       int            `json:"meterStop"`
+	EnergyWh        int            `json:"energyWh"`
+	SampledEnergyWh *int           `json:"sampledEnergyWh,omitempty"`
+	EnergyCheck     EnergyCheck    `json:"energyCheck"`
+	StopReason      core.Reason    `json:"stopReason"`
+	ChargingSeconds int64          `json:"chargingSeconds"`
+	IdleSeconds     int64          `json:"idleSeconds"`
+	Cost            *CostBreakdown `json:"cost,omitempty"`
+	CreatedAt       time.Time      `json:"createdAt"`
+}
+
+// Returns the CDR as it is exported, with durations in whole seconds.
+func (c ChargeDetailRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cdrExport{
+		Id:              c.Id,
+		Serialnumber:    c.Serialnumber,
+		TransactionId:   c.TransactionId,
+		ConnectorId:     c.ConnectorId,
+		IdTag:           c.IdTag,
+		StartedAt:       c.StartedAt,
+		StoppedAt:       c.StoppedAt,
+		DurationSeconds: int64(c.Duration / time.Second),
+		MeterStart:      c.MeterStart,
+		MeterStop:       c.MeterStop,
+		EnergyWh:        c.EnergyWh,
+		SampledEnergyWh: c.SampledEnergyWh,
+		EnergyCheck:     c.EnergyCheck,
+		StopReason:      c.StopReason,
+		ChargingSeconds: int64(c.ChargingTime / time.Second),
+		IdleSeconds:     int64(c.IdleTime / time.Second),
+		Cost:            c.Cost,
+		CreatedAt:       c.CreatedAt,
+	})
+}
+
+// Header of the CSV export of CDRs.
+var cdrCSVHeader = []string{
+	"id", "serialnumber", "transaction_id", "connector_id", "id_tag", "started_at", "stopped_at", "duration_s",
+	"meter_start", "meter_stop", "energy_wh", "sampled_energy_wh", "energy_check", "stop_reason", "charging_s", "idle_s",
+	"tariff_id", "currency", "start_fee", "energy_cost", "time_cost", "idle_cost", "total_cost", "created_at",
+}
+
+// Writes the CDRs as CSV with a header row. Times are RFC 3339 in UTC and durations whole seconds. The cost columns
+// are empty for a CDR without a tariff.
+func WriteCdrsCSV(w io.Writer, cdrs []ChargeDetailRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(cdrCSVHeader); err != nil {
+		return err
+	}
+
+	for _, cdr := range cdrs {
+		sampled := ""
+		if cdr.SampledEnergyWh != nil {
+			sampled = strconv.Itoa(*cdr.SampledEnergyWh)
+		}
+		cost := make([]string, 7)
+		if cdr.Cost != nil {
+			cost = []string{
+				cdr.Cost.TariffId,
+				cdr.Cost.Currency,
+				cdr.Cost.StartFee.StringFixed(2),
+				cdr.Cost.Energy.StringFixed(2),
+				cdr.Cost.Time.StringFixed(2),
+				cdr.Cost.Idle.StringFixed(2),
+				cdr.Cost.Total.StringFixed(2),
+			}
+		}
+		if err := writer.Write(slices.Concat([]string{
+			strconv.FormatInt(cdr.Id, 10),
+			cdr.Serialnumber,
+			strconv.Itoa(cdr.TransactionId),
+			strconv.Itoa(cdr.ConnectorId),
+			cdr.IdTag,
+			cdr.StartedAt.UTC().Format(time.RFC3339),
+			cdr.StoppedAt.UTC().Format(time.RFC3339),
+			strconv.FormatInt(int64(cdr.Duration/time.Second), 10),
+			strconv.Itoa(cdr.MeterStart),
+			strconv.Itoa(cdr.MeterStop),
+			strconv.Itoa(cdr.EnergyWh),
+			sampled,
+			string(cdr.EnergyCheck),
+			string(cdr.StopReason),
+			strconv.FormatInt(int64(cdr.ChargingTime/time.Second), 10),
+			strconv.FormatInt(int64(cdr.IdleTime/time.Second), 10),
+		}, cost, []string{
+			cdr.CreatedAt.UTC().Format(time.RFC3339),
+		})); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
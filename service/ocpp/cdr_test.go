@@ -0,0 +1,222 @@
+package ocpp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewChargeDetailRecord(t *testing.T) {
+	startedAt := time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC)
+	stoppedAt := startedAt.Add(time.Hour + 500*time.Millisecond)
+	meterStop := 6000
+	transaction := Transaction{
+		Id:           1,
+		Serialnumber: "charger-1",
+		ConnectorId:  1,
+		IdTag:        "B4A63CDF",
+		MeterStart:   1000,
+		StartedAt:    startedAt,
+		MeterStop:    &meterStop,
+		StoppedAt:    &stoppedAt,
+		StopReason:   core.ReasonEVDisconnected,
+	}
+	sample := func(minutes, wh int) MeterSample {
+		return MeterSample{RegisterWh: wh, SampledAt: startedAt.Add(time.Duration(minutes) * time.Minute)}
+	}
+	status := func(minutes int, status core.ChargePointStatus) ConnectorStatus {
+		return ConnectorStatus{Status: status, ReportedAt: startedAt.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	t.Run("Unverified", func(t *testing.T) {
+		cdr, err := NewChargeDetailRecord(transaction, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "B4A63CDF", cdr.IdTag)
+		assert.Equal(t, time.Hour, cdr.Duration)
+		assert.Equal(t, 5000, cdr.EnergyWh)
+		assert.Nil(t, cdr.SampledEnergyWh)
+		assert.Equal(t, EnergyCheckUnverified, cdr.EnergyCheck)
+		assert.Equal(t, core.ReasonEVDisconnected, cdr.StopReason)
+		assert.Equal(t, time.Hour, cdr.ChargingTime)
+		assert.Zero(t, cdr.IdleTime)
+	})
+
+	t.Run("Verified", func(t *testing.T) {
+		cdr, err := NewChargeDetailRecord(transaction, []MeterSample{sample(60, 6040), sample(0, 1000), sample(30, 3500)}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 5040, *cdr.SampledEnergyWh)
+		assert.Equal(t, EnergyCheckVerified, cdr.EnergyCheck)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		cdr, err := NewChargeDetailRecord(transaction, []MeterSample{sample(0, 1000), sample(30, 8000)}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, EnergyCheckMismatch, cdr.EnergyCheck)
+
+		// Readings may not go down
+		cdr, err = NewChargeDetailRecord(transaction, []MeterSample{sample(0, 1000), sample(20, 4000), sample(30, 2000)}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, EnergyCheckMismatch, cdr.EnergyCheck)
+	})
+
+	t.Run("MeterStopBelowMeterStart", func(t *testing.T) {
+		reset := transaction
+		meterStop := 400
+		reset.MeterStop = &meterStop
+
+		cdr, err := NewChargeDetailRecord(reset, nil, nil)
+		assert.NoError(t, err)
+		assert.Zero(t, cdr.EnergyWh)
+		assert.Nil(t, cdr.SampledEnergyWh)
+		assert.Equal(t, EnergyCheckMismatch, cdr.EnergyCheck)
+
+		cdr, err = NewChargeDetailRecord(reset, []MeterSample{sample(0, 1000), sample(30, 2000), sample(60, 400)}, nil)
+		assert.NoError(t, err)
+		assert.Zero(t, cdr.EnergyWh)
+		assert.Equal(t, EnergyCheckMismatch, cdr.EnergyCheck)
+	})
+
+	t.Run("ChargingTime", func(t *testing.T) {
+		cdr, err := NewChargeDetailRecord(transaction, nil, []ConnectorStatus{
+			status(-1, core.ChargePointStatusPreparing),
+			status(5, core.ChargePointStatusCharging),
+			status(20, core.ChargePointStatusSuspendedEV),
+			status(30, core.ChargePointStatusCharging),
+			status(50, core.ChargePointStatusFinishing),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 35*time.Minute, cdr.ChargingTime)
+		assert.Equal(t, 25*time.Minute, cdr.IdleTime)
+	})
+
+	t.Run("DefaultReason", func(t *testing.T) {
+		stopped := transaction
+		stopped.StopReason = ""
+		cdr, err := NewChargeDetailRecord(stopped, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, core.ReasonLocal, cdr.StopReason)
+	})
+
+	t.Run("NotStopped", func(t *testing.T) {
+		started := transaction
+		started.MeterStop, started.StoppedAt = nil, nil
+		_, err := NewChargeDetailRecord(started, nil, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestMeterSamples(t *testing.T) {
+	timestamp := types.NewDateTime(time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC))
+	samples := meterSamples("charger-1", 1, 2, []types.MeterValue{
+		{Timestamp: timestamp, SampledValue: []types.SampledValue{
+			{Value: "1500"},
+			{Value: "2.5", Unit: types.UnitOfMeasureKWh, Measurand: types.MeasurandEnergyActiveImportRegister, Context: types.ReadingContextSamplePeriodic},
+			{Value: "7200", Unit: types.UnitOfMeasureW, Measurand: types.MeasurandPowerActiveImport},
+			{Value: "800", Measurand: types.MeasurandEnergyActiveImportRegister, Phase: types.PhaseL1},
+			{Value: "ABCDEF", Format: types.ValueFormatSignedData},
+			{Value: "not a number"},
+		}},
+		{SampledValue: []types.SampledValue{{Value: "3000"}}},
+	})
+
+	if assert.Len(t, samples, 2) {
+		assert.Equal(t, MeterSample{
+			Serialnumber:  "charger-1",
+			TransactionId: 1,
+			ConnectorId:   2,
+			RegisterWh:    1500,
+			SampledAt:     timestamp.Time,
+		}, samples[0])
+		assert.Equal(t, 2500, samples[1].RegisterWh)
+		assert.Equal(t, types.ReadingContextSamplePeriodic, samples[1].Context)
+	}
+}
+
+func TestCdrExport(t *testing.T) {
+	sampled := 4900
+	cdr := ChargeDetailRecord{
+		Id:              7,
+		Serialnumber:    "charger-1",
+		TransactionId:   1,
+		ConnectorId:     1,
+		IdTag:           "B4A63CDF",
+		StartedAt:       time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC),
+		StoppedAt:       time.Date(2025, 7, 22, 11, 0, 0, 0, time.UTC),
+		Duration:        time.Hour,
+		MeterStart:      1000,
+		MeterStop:       6000,
+		EnergyWh:        5000,
+		SampledEnergyWh: &sampled,
+		EnergyCheck:     EnergyCheckVerified,
+		StopReason:      core.ReasonLocal,
+		ChargingTime:    45 * time.Minute,
+		IdleTime:        15 * time.Minute,
+		Cost: &CostBreakdown{
+			TariffId: "standard",
+			Currency: "GBP",
+			StartFee: decimal.RequireFromString("0.5"),
+			Energy:   decimal.RequireFromString("2.25"),
+			Time:     decimal.Zero,
+			Idle:     decimal.RequireFromString("1"),
+			Total:    decimal.RequireFromString("3.75"),
+		},
+		CreatedAt: time.Date(2025, 7, 22, 11, 0, 1, 0, time.UTC),
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		body, err := json.Marshal(cdr)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{
+			"id": 7,
+			"serialnumber": "charger-1",
+			"transactionId": 1,
+			"connectorId": 1,
+			"idTag": "B4A63CDF",
+			"startedAt": "2025-07-22T10:00:00Z",
+			"stoppedAt": "2025-07-22T11:00:00Z",
+			"durationSeconds": 3600,
+			"meterStart": 1000,
+			"meterStop": 6000,
+			"energyWh": 5000,
+			"sampledEnergyWh": 4900,
+			"energyCheck": "verified",
+			"stopReason": "Local",
+			"chargingSeconds": 2700,
+			"idleSeconds": 900,
+			"cost": {
+				"tariffId": "standard",
+				"currency": "GBP",
+				"startFee": "0.5",
+				"energy": "2.25",
+				"time": "0",
+				"idle": "1",
+				"total": "3.75"
+			},
+			"createdAt": "2025-07-22T11:00:01Z"
+		}`, string(body))
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		unverified := cdr
+		unverified.SampledEnergyWh = nil
+		unverified.EnergyCheck = EnergyCheckUnverified
+		unverified.Cost = nil
+
+		var buf bytes.Buffer
+		assert.NoError(t, WriteCdrsCSV(&buf, []ChargeDetailRecord{cdr, unverified}))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 3) {
+			assert.Equal(t, strings.Join(cdrCSVHeader, ","), lines[0])
+			assert.Equal(t, "7,charger-1,1,1,B4A63CDF,2025-07-22T10:00:00Z,2025-07-22T11:00:00Z,3600,1000,6000,5000,4900,verified,Local,2700,900,standard,GBP,0.50,2.25,0.00,1.00,3.75,2025-07-22T11:00:01Z", lines[1])
+			assert.Contains(t, lines[2], ",5000,,unverified,")
+			assert.Contains(t, lines[2], ",900,,,,,,,,2025-07-22T11:00:01Z")
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Represents a store kept in a database. Closing it closes its connections.
+type Store interface {
+	StoreAdapter
+	QuarantineAdapter
+	WebhookLogAdapter
+	DataQualityAdapter
+	JournalAdapter
+	CdrAdapter
+	OutboxAdapter
+	io.Closer
+}
+
+// Connects the store of the configured driver, applying pending migrations unless they are skipped.
+func NewStore(ctx context.Context, tp trace.TracerProvider, config utils.DatabaseConfiguration) (Store, error) {
+	switch config.Driver {
+	case db.DriverSQLite, db.DriverLibsql:
+		queries, database, err := db.Connect(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewDbStore(tp, queries, database), nil
+	case db.DriverPostgres:
+		queries, pool, err := db.ConnectPostgres(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return NewPgStore(tp, queries, pool), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", config.Driver)
+	}
+}
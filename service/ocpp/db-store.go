@@ -1,11 +1,17 @@
 package ocpp
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/shopspring/decimal"
 	iCore "github.com/squishmeist/ocpp-go/internal/core"
 	"github.com/squishmeist/ocpp-go/service/ocpp/db/schemas"
 	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
@@ -16,56 +22,1147 @@ import (
 
 type DbStore struct {
 	Tracer  trace.Tracer
+	db      *sql.DB
 	queries *schemas.Queries
 }
 
-func NewDbStore(tp trace.TracerProvider, queries *schemas.Queries) *DbStore {
+func NewDbStore(tp trace.TracerProvider, queries *schemas.Queries, db *sql.DB) *DbStore {
 	return &DbStore{
 		Tracer:  tp.Tracer("store"),
+		db:      db,
 		queries: queries,
 	}
 }
 
-func (s *DbStore) AddChargepoint(ctx context.Context, payload core.BootNotificationRequest) error {
+// Context key of the transaction started by InTx.
+type txKey struct{}
+
+// Returns the queries bound to the transaction of ctx, if InTx started one.
+func (s *DbStore) q(ctx context.Context) *schemas.Queries {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return s.queries.WithTx(tx)
+	}
+	return s.queries
+}
+
+// Runs fn in a transaction, committing it if fn succeeds and rolling it back otherwise.
+// Store calls made with the context passed to fn take part in the transaction. Nested calls join the outer transaction.
+func (s *DbStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.InTx")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return handleDBError(ctx, "to begin transaction", err)
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			slog.Error("failed to roll back transaction", "error", rollbackErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return handleDBError(ctx, "to commit transaction", err)
+	}
+
+	return nil
+}
+
+// Closes the database.
+func (s *DbStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *DbStore) AddChargepoint(ctx context.Context, serialnumber string, payload core.BootNotificationRequest) (ChargepointBoot, error) {
 	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddChargepoint")
 	defer span.End()
 
-	_, err := s.queries.InsertChargepoint(ctx, schemas.InsertChargepointParams{
-		SerialNumber:      payload.ChargeBoxSerialNumber,
-		Model:             payload.ChargePointModel,
-		Vendor:            payload.ChargePointVendor,
-		FirmwareVersion:   payload.FirmwareVersion,
-		Iicid:             sql.NullString{String: payload.Iccid, Valid: payload.Iccid != ""},
-		Imsi:              sql.NullString{String: payload.Imsi, Valid: payload.Imsi != ""},
-		MeterSerialNumber: sql.NullString{String: payload.MeterSerialNumber, Valid: payload.MeterSerialNumber != ""},
-		MeterType:         sql.NullString{String: payload.MeterType, Valid: payload.MeterType != ""},
-		LastBoot:          types.Now().Time,
+	boot := ChargepointBoot{
+		Serialnumber:    serialnumber,
+		FirmwareVersion: payload.FirmwareVersion,
+		BootedAt:        types.Now().Time,
+	}
+
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		previous, err := s.q(ctx).GetChargepoint(ctx, schemas.GetChargepointParams{
+			TenantID:     TenantOf(ctx),
+			SerialNumber: boot.Serialnumber,
+		})
+		switch {
+		case err == nil:
+			boot.PreviousFirmwareVersion = previous.FirmwareVersion
+		case !errors.Is(err, sql.ErrNoRows):
+			return handleDBError(ctx, "to get chargepoint", err)
+		}
+
+		_, err = s.q(ctx).UpsertChargepoint(ctx, schemas.UpsertChargepointParams{
+			TenantID:                TenantOf(ctx),
+			SerialNumber:            boot.Serialnumber,
+			Model:                   payload.ChargePointModel,
+			Vendor:                  payload.ChargePointVendor,
+			FirmwareVersion:         payload.FirmwareVersion,
+			Iicid:                   sql.NullString{String: payload.Iccid, Valid: payload.Iccid != ""},
+			Imsi:                    sql.NullString{String: payload.Imsi, Valid: payload.Imsi != ""},
+			MeterSerialNumber:       sql.NullString{String: payload.MeterSerialNumber, Valid: payload.MeterSerialNumber != ""},
+			MeterType:               sql.NullString{String: payload.MeterType, Valid: payload.MeterType != ""},
+			LastBoot:                boot.BootedAt,
+			ChargeBoxSerialNumber:   sql.NullString{String: payload.ChargeBoxSerialNumber, Valid: payload.ChargeBoxSerialNumber != ""},
+			ChargePointSerialNumber: sql.NullString{String: payload.ChargePointSerialNumber, Valid: payload.ChargePointSerialNumber != ""},
+		})
+		if err != nil {
+			return handleDBError(ctx, "to add chargepoint", err)
+		}
+
+		_, err = s.q(ctx).InsertBootHistory(ctx, schemas.InsertBootHistoryParams{
+			TenantID:                TenantOf(ctx),
+			SerialNumber:            boot.Serialnumber,
+			Model:                   payload.ChargePointModel,
+			Vendor:                  payload.ChargePointVendor,
+			FirmwareVersion:         payload.FirmwareVersion,
+			PreviousFirmwareVersion: sql.NullString{String: boot.PreviousFirmwareVersion, Valid: boot.PreviousFirmwareVersion != ""},
+			BootedAt:                boot.BootedAt,
+		})
+		if err != nil {
+			return handleDBError(ctx, "to add boot history", err)
+		}
+
+		reported := []struct{ field, value string }{
+			{"chargeBoxSerialNumber", payload.ChargeBoxSerialNumber},
+			{"chargePointSerialNumber", payload.ChargePointSerialNumber},
+		}
+		for _, serial := range reported {
+			if serial.value == "" || serial.value == serialnumber {
+				continue
+			}
+			slog.Warn("Chargepoint reported a different serial number",
+				"serialnumber", serialnumber,
+				"field", serial.field,
+				"value", serial.value,
+			)
+			err := s.q(ctx).UpsertDataQualityFinding(ctx, schemas.UpsertDataQualityFindingParams{
+				TenantID:     TenantOf(ctx),
+				SerialNumber: serialnumber,
+				Kind:         FindingSerialNumberMismatch,
+				Field:        serial.field,
+				Value:        serial.value,
+				FirstSeenAt:  boot.BootedAt,
+				LastSeenAt:   boot.BootedAt,
+			})
+			if err != nil {
+				return handleDBError(ctx, "to add data quality finding", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ChargepointBoot{}, err
+	}
+
+	return boot, nil
+}
+
+func (s *DbStore) GetChargepoint(ctx context.Context, serialnumber string) (Chargepoint, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetChargepoint")
+	defer span.End()
+
+	row, err := s.q(ctx).GetChargepoint(ctx, schemas.GetChargepointParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
 	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chargepoint{}, fmt.Errorf("serial number %s: %w", serialnumber, ErrChargepointNotFound)
+	}
 	if err != nil {
-		return handleDBError(ctx, "to add chargepoint", err)
+		return Chargepoint{}, handleDBError(ctx, "to get chargepoint", err)
 	}
 
-	return nil
+	chargepoint := Chargepoint{
+		Serialnumber:            row.SerialNumber,
+		Model:                   row.Model,
+		Vendor:                  row.Vendor,
+		FirmwareVersion:         row.FirmwareVersion,
+		Iccid:                   row.Iicid.String,
+		Imsi:                    row.Imsi.String,
+		MeterSerialNumber:       row.MeterSerialNumber.String,
+		MeterType:               row.MeterType.String,
+		ChargeBoxSerialNumber:   row.ChargeBoxSerialNumber.String,
+		ChargePointSerialNumber: row.ChargePointSerialNumber.String,
+		LastBoot:                row.LastBoot,
+		Tenant:                  row.TenantID,
+	}
+	if row.LastHeartbeat.Valid {
+		chargepoint.LastHeartbeat = &row.LastHeartbeat.Time
+	}
+
+	return chargepoint, nil
 }
 
 func (s *DbStore) UpdateLastHeartbeat(ctx context.Context, serialnumber string, payload core.HeartbeatConfirmation) error {
 	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.UpdateLastHeartbeat")
 	defer span.End()
 
-	result, err := s.queries.UpdateChargepointLastHeartbeat(ctx, schemas.UpdateChargepointLastHeartbeatParams{
+	result, err := s.q(ctx).UpdateChargepointLastHeartbeat(ctx, schemas.UpdateChargepointLastHeartbeatParams{
+		TenantID:      TenantOf(ctx),
 		SerialNumber:  serialnumber,
 		LastHeartbeat: sql.NullTime{Time: payload.CurrentTime.Time, Valid: true},
 	})
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && result == "") {
+		return fmt.Errorf("serial number %s: %w", serialnumber, ErrChargepointNotFound)
+	}
 	if err != nil {
 		return handleDBError(ctx, "to update last heartbeat", err)
 	}
-	if result == "" {
-		return fmt.Errorf("serial number %s not found", serialnumber)
+
+	return nil
+}
+
+func (s *DbStore) StartTransaction(ctx context.Context, serialnumber string, payload core.StartTransactionRequest) (int, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.StartTransaction")
+	defer span.End()
+
+	id, err := s.q(ctx).InsertTransaction(ctx, schemas.InsertTransactionParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
+		ConnectorID:  int64(payload.ConnectorId),
+		IdTag:        payload.IdTag,
+		MeterStart:   int64(payload.MeterStart),
+		StartedAt:    payload.Timestamp.UTC(),
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to start transaction", err)
+	}
+
+	return int(id), nil
+}
+
+func (s *DbStore) StopTransaction(ctx context.Context, serialnumber string, payload core.StopTransactionRequest) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.StopTransaction")
+	defer span.End()
+
+	_, err := s.q(ctx).StopTransaction(ctx, schemas.StopTransactionParams{
+		TenantID:     TenantOf(ctx),
+		MeterStop:    sql.NullInt64{Int64: int64(payload.MeterStop), Valid: true},
+		StoppedAt:    sql.NullTime{Time: payload.Timestamp.UTC(), Valid: true},
+		StopReason:   sql.NullString{String: string(payload.Reason), Valid: payload.Reason != ""},
+		ID:           int64(payload.TransactionId),
+		SerialNumber: serialnumber,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either the transaction is not known or it has already stopped
+		if _, err := s.GetTransaction(ctx, serialnumber, payload.TransactionId); err != nil {
+			return err
+		}
+		return fmt.Errorf("transaction %d of %s: %w", payload.TransactionId, serialnumber, ErrTransactionStopped)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to stop transaction", err)
+	}
+
+	return nil
+}
+
+func (s *DbStore) GetTransaction(ctx context.Context, serialnumber string, transactionId int) (Transaction, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetTransaction")
+	defer span.End()
+
+	row, err := s.q(ctx).GetTransaction(ctx, schemas.GetTransactionParams{
+		TenantID:     TenantOf(ctx),
+		ID:           int64(transactionId),
+		SerialNumber: serialnumber,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transaction{}, fmt.Errorf("transaction %d of %s: %w", transactionId, serialnumber, ErrTransactionNotFound)
+	}
+	if err != nil {
+		return Transaction{}, handleDBError(ctx, "to get transaction", err)
+	}
+
+	return dbTransaction(row), nil
+}
+
+func (s *DbStore) ListTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListTransactions")
+	defer span.End()
+
+	serialnumbers, err := dbSerialnumbers(filter.Serialnumbers)
+	if err != nil {
+		return nil, handleDBError(ctx, "to list transactions", err)
+	}
+	rows, err := s.q(ctx).ListTransactions(ctx, schemas.ListTransactionsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumbers: serialnumbers,
+		UpdatedFrom:   sql.NullTime{Time: filter.UpdatedFrom.UTC(), Valid: !filter.UpdatedFrom.IsZero()},
+		UpdatedTo:     sql.NullTime{Time: filter.UpdatedTo.UTC(), Valid: !filter.UpdatedTo.IsZero()},
+		Limit:         int64(filter.Limit),
+		Offset:        int64(filter.Offset),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list transactions", err)
+	}
+
+	transactions := make([]Transaction, 0, len(rows))
+	for _, row := range rows {
+		transactions = append(transactions, dbTransaction(row))
+	}
+
+	return transactions, nil
+}
+
+func (s *DbStore) CountTransactions(ctx context.Context, filter TransactionFilter) (int, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.CountTransactions")
+	defer span.End()
+
+	serialnumbers, err := dbSerialnumbers(filter.Serialnumbers)
+	if err != nil {
+		return 0, handleDBError(ctx, "to count transactions", err)
+	}
+	count, err := s.q(ctx).CountTransactions(ctx, schemas.CountTransactionsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumbers: serialnumbers,
+		UpdatedFrom:   sql.NullTime{Time: filter.UpdatedFrom.UTC(), Valid: !filter.UpdatedFrom.IsZero()},
+		UpdatedTo:     sql.NullTime{Time: filter.UpdatedTo.UTC(), Valid: !filter.UpdatedTo.IsZero()},
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to count transactions", err)
+	}
+
+	return int(count), nil
+}
+
+// Returns the transaction stored in a charge_transaction row.
+func dbTransaction(row schemas.ChargeTransaction) Transaction {
+	transaction := Transaction{
+		Id:           int(row.ID),
+		Serialnumber: row.SerialNumber,
+		ConnectorId:  int(row.ConnectorID),
+		IdTag:        row.IdTag,
+		MeterStart:   int(row.MeterStart),
+		StartedAt:    row.StartedAt,
+		StopReason:   core.Reason(row.StopReason.String),
+		Tenant:       row.TenantID,
+	}
+	if row.MeterStop.Valid {
+		meterStop := int(row.MeterStop.Int64)
+		transaction.MeterStop = &meterStop
+	}
+	if row.StoppedAt.Valid {
+		transaction.StoppedAt = &row.StoppedAt.Time
+	}
+	return transaction
+}
+
+// Returns serial numbers as the JSON array the queries read with json_each, or nil to match every charge point.
+func dbSerialnumbers(serialnumbers []string) (any, error) {
+	if serialnumbers == nil {
+		return nil, nil
+	}
+	list, err := json.Marshal(serialnumbers)
+	if err != nil {
+		return nil, err
+	}
+	return string(list), nil
+}
+
+func (s *DbStore) Quarantine(ctx context.Context, msg QuarantinedMessage) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.Quarantine")
+	defer span.End()
+
+	properties, err := json.Marshal(msg.Properties)
+	if err != nil {
+		return 0, handleDBError(ctx, "to marshal quarantined message properties", err)
+	}
+
+	quarantinedAt := msg.QuarantinedAt
+	if quarantinedAt.IsZero() {
+		quarantinedAt = time.Now()
+	}
+
+	id, err := s.q(ctx).InsertQuarantinedMessage(ctx, schemas.InsertQuarantinedMessageParams{
+		MessageID:     msg.MessageId,
+		SerialNumber:  sql.NullString{String: msg.Serialnumber, Valid: msg.Serialnumber != ""},
+		Topic:         msg.Topic,
+		Subscription:  msg.Subscription,
+		ContentType:   sql.NullString{String: msg.ContentType, Valid: msg.ContentType != ""},
+		Properties:    string(properties),
+		Body:          msg.Body,
+		Error:         msg.Error,
+		ErrorClass:    msg.ErrorClass,
+		Attempts:      int64(msg.Attempts),
+		QuarantinedAt: quarantinedAt,
+		TenantID:      TenantOf(ctx),
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to quarantine message", err)
+	}
+
+	return id, nil
+}
+
+func (s *DbStore) GetQuarantined(ctx context.Context, id int64) (QuarantinedMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetQuarantined")
+	defer span.End()
+
+	row, err := s.q(ctx).GetQuarantinedMessage(ctx, schemas.GetQuarantinedMessageParams{
+		TenantID: TenantOf(ctx),
+		ID:       id,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return QuarantinedMessage{}, fmt.Errorf("quarantined message %d not found", id)
+	}
+	if err != nil {
+		return QuarantinedMessage{}, handleDBError(ctx, "to get quarantined message", err)
+	}
+
+	return toQuarantinedMessage(row)
+}
+
+func (s *DbStore) ListQuarantined(ctx context.Context, limit int) ([]QuarantinedMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListQuarantined")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListQuarantinedMessages(ctx, schemas.ListQuarantinedMessagesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int64(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list quarantined messages", err)
+	}
+
+	messages := make([]QuarantinedMessage, 0, len(rows))
+	for _, row := range rows {
+		msg, err := toQuarantinedMessage(row)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (s *DbStore) MarkRedriven(ctx context.Context, id int64) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkRedriven")
+	defer span.End()
+
+	_, err := s.q(ctx).MarkQuarantinedMessageRedriven(ctx, schemas.MarkQuarantinedMessageRedrivenParams{
+		RedrivenAt: sql.NullTime{Time: time.Now(), Valid: true},
+		TenantID:   TenantOf(ctx),
+		ID:         id,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("quarantined message %d not found or already redriven", id)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to mark quarantined message redriven", err)
+	}
+
+	return nil
+}
+
+func (s *DbStore) RecordWebhookDelivery(ctx context.Context, delivery WebhookDelivery) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.RecordWebhookDelivery")
+	defer span.End()
+
+	createdAt := delivery.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	params := schemas.InsertWebhookDeliveryParams{
+		EventID:    delivery.EventId,
+		EventType:  delivery.EventType,
+		Url:        delivery.URL,
+		StatusCode: sql.NullInt64{Int64: int64(delivery.StatusCode), Valid: delivery.StatusCode != 0},
+		Attempts:   int64(delivery.Attempts),
+		Error:      sql.NullString{String: delivery.Error, Valid: delivery.Error != ""},
+		CreatedAt:  createdAt,
+		TenantID:   TenantOf(ctx),
+	}
+	if delivery.DeliveredAt != nil {
+		params.DeliveredAt = sql.NullTime{Time: *delivery.DeliveredAt, Valid: true}
+	}
+
+	id, err := s.q(ctx).InsertWebhookDelivery(ctx, params)
+	if err != nil {
+		return 0, handleDBError(ctx, "to record webhook delivery", err)
+	}
+
+	return id, nil
+}
+
+func (s *DbStore) ListWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListWebhookDeliveries")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListWebhookDeliveries(ctx, schemas.ListWebhookDeliveriesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int64(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list webhook deliveries", err)
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		delivery := WebhookDelivery{
+			Id:         row.ID,
+			EventId:    row.EventID,
+			EventType:  row.EventType,
+			URL:        row.Url,
+			StatusCode: int(row.StatusCode.Int64),
+			Attempts:   int(row.Attempts),
+			Error:      row.Error.String,
+			CreatedAt:  row.CreatedAt,
+			Tenant:     row.TenantID,
+		}
+		if row.DeliveredAt.Valid {
+			delivery.DeliveredAt = &row.DeliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (s *DbStore) ListDataQualityFindings(ctx context.Context, limit int) ([]DataQualityFinding, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListDataQualityFindings")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListDataQualityFindings(ctx, schemas.ListDataQualityFindingsParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int64(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list data quality findings", err)
+	}
+
+	findings := make([]DataQualityFinding, 0, len(rows))
+	for _, row := range rows {
+		findings = append(findings, DataQualityFinding{
+			Id:           row.ID,
+			Serialnumber: row.SerialNumber,
+			Kind:         row.Kind,
+			Field:        row.Field,
+			Value:        row.Value,
+			FirstSeenAt:  row.FirstSeenAt,
+			LastSeenAt:   row.LastSeenAt,
+			Occurrences:  int(row.Occurrences),
+		})
+	}
+
+	return findings, nil
+}
+
+func (s *DbStore) AppendJournal(ctx context.Context, entries []JournalEntry) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AppendJournal")
+	defer span.End()
+
+	return s.InTx(ctx, func(ctx context.Context) error {
+		for _, entry := range entries {
+			err := s.q(ctx).InsertJournalEntry(ctx, schemas.InsertJournalEntryParams{
+				Direction:    string(entry.Direction),
+				SerialNumber: entry.Serialnumber,
+				MessageID:    sql.NullString{String: entry.MessageId, Valid: entry.MessageId != ""},
+				Action:       sql.NullString{String: entry.Action, Valid: entry.Action != ""},
+				TypeID:       sql.NullInt64{Int64: int64(entry.TypeId), Valid: entry.TypeId != 0},
+				Body:         entry.Body,
+				TraceID:      sql.NullString{String: entry.TraceId, Valid: entry.TraceId != ""},
+				Outcome:      entry.Outcome,
+				Error:        sql.NullString{String: entry.Error, Valid: entry.Error != ""},
+				LatencyUs:    entry.Latency.Microseconds(),
+				RecordedAt:   entry.RecordedAt.UTC(),
+				TenantID:     TenantOf(ctx),
+			})
+			if err != nil {
+				return handleDBError(ctx, "to append journal entry", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DbStore) ListJournal(ctx context.Context, filter JournalFilter) ([]JournalEntry, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListJournal")
+	defer span.End()
+
+	// Times are stored in UTC, so they compare in order as text
+	rows, err := s.q(ctx).ListJournalEntries(ctx, schemas.ListJournalEntriesParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: sql.NullString{String: filter.Serialnumber, Valid: filter.Serialnumber != ""},
+		Action:       sql.NullString{String: filter.Action, Valid: filter.Action != ""},
+		RecordedFrom: sql.NullTime{Time: filter.From.UTC(), Valid: !filter.From.IsZero()},
+		RecordedTo:   sql.NullTime{Time: filter.To.UTC(), Valid: !filter.To.IsZero()},
+		Limit:        int64(filter.Limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list journal entries", err)
+	}
+
+	entries := make([]JournalEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, JournalEntry{
+			Id:           row.ID,
+			Direction:    JournalDirection(row.Direction),
+			Serialnumber: row.SerialNumber,
+			MessageId:    row.MessageID.String,
+			Action:       row.Action.String,
+			TypeId:       int(row.TypeID.Int64),
+			Body:         row.Body,
+			TraceId:      row.TraceID.String,
+			Outcome:      row.Outcome,
+			Error:        row.Error.String,
+			Latency:      time.Duration(row.LatencyUs) * time.Microsecond,
+			RecordedAt:   row.RecordedAt,
+			Tenant:       row.TenantID,
+		})
+	}
+
+	return entries, nil
+}
+
+func (s *DbStore) AddMeterSamples(ctx context.Context, samples []MeterSample) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddMeterSamples")
+	defer span.End()
+
+	return s.InTx(ctx, func(ctx context.Context) error {
+		for _, sample := range samples {
+			err := s.q(ctx).InsertMeterSample(ctx, schemas.InsertMeterSampleParams{
+				TenantID:      TenantOf(ctx),
+				SerialNumber:  sample.Serialnumber,
+				TransactionID: int64(sample.TransactionId),
+				ConnectorID:   int64(sample.ConnectorId),
+				Context:       sql.NullString{String: string(sample.Context), Valid: sample.Context != ""},
+				RegisterWh:    int64(sample.RegisterWh),
+				SampledAt:     sample.SampledAt.UTC(),
+			})
+			if err != nil {
+				return handleDBError(ctx, "to add meter sample", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DbStore) ListMeterSamples(ctx context.Context, serialnumber string, transactionId int) ([]MeterSample, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListMeterSamples")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListMeterSamples(ctx, schemas.ListMeterSamplesParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  serialnumber,
+		TransactionID: int64(transactionId),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list meter samples", err)
+	}
+
+	samples := make([]MeterSample, 0, len(rows))
+	for _, row := range rows {
+		samples = append(samples, MeterSample{
+			Serialnumber:  row.SerialNumber,
+			TransactionId: int(row.TransactionID),
+			ConnectorId:   int(row.ConnectorID),
+			Context:       types.ReadingContext(row.Context.String),
+			RegisterWh:    int(row.RegisterWh),
+			SampledAt:     row.SampledAt,
+		})
+	}
+
+	return samples, nil
+}
+
+func (s *DbStore) AddConnectorStatus(ctx context.Context, status ConnectorStatus) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddConnectorStatus")
+	defer span.End()
+
+	err := s.q(ctx).InsertConnectorStatus(ctx, schemas.InsertConnectorStatusParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: status.Serialnumber,
+		ConnectorID:  int64(status.ConnectorId),
+		Status:       string(status.Status),
+		ErrorCode:    string(status.ErrorCode),
+		Info:         sql.NullString{String: status.Info, Valid: status.Info != ""},
+		ReportedAt:   status.ReportedAt.UTC(),
+	})
+	if err != nil {
+		return handleDBError(ctx, "to add connector status", err)
+	}
+
+	return nil
+}
+
+func (s *DbStore) ListConnectorStatuses(ctx context.Context, serialnumber string, connectorId int, from, to time.Time) ([]ConnectorStatus, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListConnectorStatuses")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListConnectorStatuses(ctx, schemas.ListConnectorStatusesParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
+		ConnectorID:  int64(connectorId),
+		ReportedTo:   to.UTC(),
+		ReportedFrom: from.UTC(),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list connector statuses", err)
+	}
+
+	statuses := make([]ConnectorStatus, 0, len(rows))
+	for _, row := range rows {
+		statuses = append(statuses, dbConnectorStatus(row))
+	}
+
+	return statuses, nil
+}
+
+func (s *DbStore) ListLatestConnectorStatuses(ctx context.Context, serialnumber string) ([]ConnectorStatus, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListLatestConnectorStatuses")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListLatestConnectorStatuses(ctx, schemas.ListLatestConnectorStatusesParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list latest connector statuses", err)
+	}
+
+	statuses := make([]ConnectorStatus, 0, len(rows))
+	for _, row := range rows {
+		statuses = append(statuses, dbConnectorStatus(row))
+	}
+
+	return statuses, nil
+}
+
+// Returns the status stored in a connector_status row.
+func dbConnectorStatus(row schemas.ConnectorStatus) ConnectorStatus {
+	return ConnectorStatus{
+		Serialnumber: row.SerialNumber,
+		ConnectorId:  int(row.ConnectorID),
+		Status:       core.ChargePointStatus(row.Status),
+		ErrorCode:    core.ChargePointErrorCode(row.ErrorCode),
+		Info:         row.Info.String,
+		ReportedAt:   row.ReportedAt,
+	}
+}
+
+func (s *DbStore) AddCdr(ctx context.Context, cdr ChargeDetailRecord) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddCdr")
+	defer span.End()
+
+	params := schemas.InsertChargeDetailRecordParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  cdr.Serialnumber,
+		TransactionID: int64(cdr.TransactionId),
+		ConnectorID:   int64(cdr.ConnectorId),
+		IdTag:         cdr.IdTag,
+		StartedAt:     cdr.StartedAt.UTC(),
+		StoppedAt:     cdr.StoppedAt.UTC(),
+		DurationS:     int64(cdr.Duration / time.Second),
+		MeterStart:    int64(cdr.MeterStart),
+		MeterStop:     int64(cdr.MeterStop),
+		EnergyWh:      int64(cdr.EnergyWh),
+		EnergyCheck:   string(cdr.EnergyCheck),
+		StopReason:    string(cdr.StopReason),
+		ChargingS:     int64(cdr.ChargingTime / time.Second),
+		IdleS:         int64(cdr.IdleTime / time.Second),
+		CreatedAt:     cdr.CreatedAt.UTC(),
+	}
+	if cdr.SampledEnergyWh != nil {
+		params.SampledEnergyWh = sql.NullInt64{Int64: int64(*cdr.SampledEnergyWh), Valid: true}
+	}
+	if cdr.Cost != nil {
+		params.TariffID = sql.NullString{String: cdr.Cost.TariffId, Valid: true}
+		params.Currency = sql.NullString{String: cdr.Cost.Currency, Valid: true}
+		params.StartFee = sql.NullString{String: cdr.Cost.StartFee.String(), Valid: true}
+		params.EnergyCost = sql.NullString{String: cdr.Cost.Energy.String(), Valid: true}
+		params.TimeCost = sql.NullString{String: cdr.Cost.Time.String(), Valid: true}
+		params.IdleCost = sql.NullString{String: cdr.Cost.Idle.String(), Valid: true}
+		params.TotalCost = sql.NullString{String: cdr.Cost.Total.String(), Valid: true}
+	}
+
+	id, err := s.q(ctx).InsertChargeDetailRecord(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("transaction %d of %s: %w", cdr.TransactionId, cdr.Serialnumber, ErrCdrExists)
+	}
+	if err != nil {
+		return 0, handleDBError(ctx, "to add charge detail record", err)
+	}
+
+	return id, nil
+}
+
+func (s *DbStore) GetCdr(ctx context.Context, serialnumber string, transactionId int) (ChargeDetailRecord, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetCdr")
+	defer span.End()
+
+	row, err := s.q(ctx).GetChargeDetailRecord(ctx, schemas.GetChargeDetailRecordParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  serialnumber,
+		TransactionID: int64(transactionId),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChargeDetailRecord{}, fmt.Errorf("transaction %d of %s: %w", transactionId, serialnumber, ErrCdrNotFound)
+	}
+	if err != nil {
+		return ChargeDetailRecord{}, handleDBError(ctx, "to get charge detail record", err)
+	}
+
+	cdr, err := dbChargeDetailRecord(row)
+	if err != nil {
+		return ChargeDetailRecord{}, handleDBError(ctx, "to read charge detail record", err)
+	}
+	return cdr, nil
+}
+
+func (s *DbStore) ListCdrs(ctx context.Context, filter CdrFilter) ([]ChargeDetailRecord, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListCdrs")
+	defer span.End()
+
+	serialnumbers, err := dbSerialnumbers(filter.Serialnumbers)
+	if err != nil {
+		return nil, handleDBError(ctx, "to list charge detail records", err)
+	}
+	rows, err := s.q(ctx).ListChargeDetailRecords(ctx, schemas.ListChargeDetailRecordsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  sql.NullString{String: filter.Serialnumber, Valid: filter.Serialnumber != ""},
+		SerialNumbers: serialnumbers,
+		StoppedFrom:   sql.NullTime{Time: filter.From.UTC(), Valid: !filter.From.IsZero()},
+		StoppedTo:     sql.NullTime{Time: filter.To.UTC(), Valid: !filter.To.IsZero()},
+		CreatedFrom:   sql.NullTime{Time: filter.CreatedFrom.UTC(), Valid: !filter.CreatedFrom.IsZero()},
+		CreatedTo:     sql.NullTime{Time: filter.CreatedTo.UTC(), Valid: !filter.CreatedTo.IsZero()},
+		Limit:         int64(filter.Limit),
+		Offset:        int64(filter.Offset),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list charge detail records", err)
+	}
+
+	cdrs := make([]ChargeDetailRecord, 0, len(rows))
+	for _, row := range rows {
+		cdr, err := dbChargeDetailRecord(row)
+		if err != nil {
+			return nil, handleDBError(ctx, "to read charge detail record", err)
+		}
+		cdrs = append(cdrs, cdr)
+	}
+
+	return cdrs, nil
+}
+
+func (s *DbStore) CountCdrs(ctx context.Context, filter CdrFilter) (int, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.CountCdrs")
+	defer span.End()
+
+	serialnumbers, err := dbSerialnumbers(filter.Serialnumbers)
+	if err != nil {
+		return 0, handleDBError(ctx, "to count charge detail records", err)
+	}
+	count, err := s.q(ctx).CountChargeDetailRecords(ctx, schemas.CountChargeDetailRecordsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  sql.NullString{String: filter.Serialnumber, Valid: filter.Serialnumber != ""},
+		SerialNumbers: serialnumbers,
+		StoppedFrom:   sql.NullTime{Time: filter.From.UTC(), Valid: !filter.From.IsZero()},
+		StoppedTo:     sql.NullTime{Time: filter.To.UTC(), Valid: !filter.To.IsZero()},
+		CreatedFrom:   sql.NullTime{Time: filter.CreatedFrom.UTC(), Valid: !filter.CreatedFrom.IsZero()},
+		CreatedTo:     sql.NullTime{Time: filter.CreatedTo.UTC(), Valid: !filter.CreatedTo.IsZero()},
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to count charge detail records", err)
+	}
+
+	return int(count), nil
+}
+
+// Returns the CDR stored in a charge_detail_record row. Returns an error if its cost cannot be read.
+func dbChargeDetailRecord(row schemas.ChargeDetailRecord) (ChargeDetailRecord, error) {
+	cdr := ChargeDetailRecord{
+		Id:            row.ID,
+		Serialnumber:  row.SerialNumber,
+		TransactionId: int(row.TransactionID),
+		ConnectorId:   int(row.ConnectorID),
+		IdTag:         row.IdTag,
+		StartedAt:     row.StartedAt,
+		StoppedAt:     row.StoppedAt,
+		Duration:      time.Duration(row.DurationS) * time.Second,
+		MeterStart:    int(row.MeterStart),
+		MeterStop:     int(row.MeterStop),
+		EnergyWh:      int(row.EnergyWh),
+		EnergyCheck:   EnergyCheck(row.EnergyCheck),
+		StopReason:    core.Reason(row.StopReason),
+		ChargingTime:  time.Duration(row.ChargingS) * time.Second,
+		IdleTime:      time.Duration(row.IdleS) * time.Second,
+		CreatedAt:     row.CreatedAt,
+		Tenant:        row.TenantID,
+	}
+	if row.SampledEnergyWh.Valid {
+		sampled := int(row.SampledEnergyWh.Int64)
+		cdr.SampledEnergyWh = &sampled
+	}
+	if row.TariffID.Valid {
+		cost := CostBreakdown{TariffId: row.TariffID.String, Currency: row.Currency.String}
+		for _, amount := range []struct {
+			value  sql.NullString
+			amount *decimal.Decimal
+		}{
+			{row.StartFee, &cost.StartFee},
+			{row.EnergyCost, &cost.Energy},
+			{row.TimeCost, &cost.Time},
+			{row.IdleCost, &cost.Idle},
+			{row.TotalCost, &cost.Total},
+		} {
+			parsed, err := decimal.NewFromString(amount.value.String)
+			if err != nil {
+				return ChargeDetailRecord{}, err
+			}
+			*amount.amount = parsed
+		}
+		cdr.Cost = &cost
+	}
+	return cdr, nil
+}
+
+func (s *DbStore) MarkProcessed(ctx context.Context, messageId string) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkProcessed")
+	defer span.End()
+
+	_, err := s.q(ctx).InsertProcessedMessage(ctx, schemas.InsertProcessedMessageParams{
+		MessageID:   messageId,
+		ProcessedAt: time.Now(),
+		TenantID:    TenantOf(ctx),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("message %s: %w", messageId, ErrAlreadyProcessed)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to mark message processed", err)
+	}
+
+	return nil
+}
+
+func (s *DbStore) AddOutbox(ctx context.Context, msg OutboxMessage) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddOutbox")
+	defer span.End()
+
+	properties, err := json.Marshal(msg.Properties)
+	if err != nil {
+		return 0, handleDBError(ctx, "to marshal outbox message properties", err)
+	}
+
+	createdAt := msg.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	id, err := s.q(ctx).InsertOutboxMessage(ctx, schemas.InsertOutboxMessageParams{
+		Kind:         string(msg.Kind),
+		Destination:  msg.Destination,
+		Payload:      msg.Payload,
+		Properties:   string(properties),
+		CreatedAt:    createdAt,
+		TenantID:     TenantOf(ctx),
+		SerialNumber: msg.Serialnumber,
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to add outbox message", err)
+	}
+
+	return id, nil
+}
+
+func (s *DbStore) ListUnsentOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListUnsentOutbox")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListUnsentOutboxMessages(ctx, schemas.ListUnsentOutboxMessagesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int64(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list unsent outbox messages", err)
+	}
+
+	return toOutboxMessages(rows)
+}
+
+func (s *DbStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ClaimOutbox")
+	defer span.End()
+
+	now := time.Now()
+	rows, err := s.q(ctx).ClaimOutboxMessages(ctx, schemas.ClaimOutboxMessagesParams{
+		ClaimedUntil: sql.NullTime{Time: now.Add(lease), Valid: true},
+		Now:          sql.NullTime{Time: now, Valid: true},
+		Limit:        int64(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to claim outbox messages", err)
+	}
+
+	messages, err := toOutboxMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING does not keep the order of the subquery
+	slices.SortFunc(messages, func(a, b OutboxMessage) int { return cmp.Compare(a.Id, b.Id) })
+	return messages, nil
+}
+
+func (s *DbStore) MarkOutboxSent(ctx context.Context, id int64) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkOutboxSent")
+	defer span.End()
+
+	if err := s.q(ctx).MarkOutboxMessageSent(ctx, schemas.MarkOutboxMessageSentParams{
+		SentAt: sql.NullTime{Time: time.Now(), Valid: true},
+		ID:     id,
+	}); err != nil {
+		return handleDBError(ctx, "to mark outbox message sent", err)
+	}
+
+	return nil
+}
+
+func (s *DbStore) MarkOutboxFailed(ctx context.Context, id int64, reason string) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkOutboxFailed")
+	defer span.End()
+
+	if err := s.q(ctx).MarkOutboxMessageFailed(ctx, schemas.MarkOutboxMessageFailedParams{
+		LastError: sql.NullString{String: reason, Valid: reason != ""},
+		ID:        id,
+	}); err != nil {
+		return handleDBError(ctx, "to mark outbox message failed", err)
+	}
+
+	return nil
+}
+
+func (s *DbStore) ParkOutbox(ctx context.Context, id int64, reason string) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ParkOutbox")
+	defer span.End()
+
+	if err := s.q(ctx).ParkOutboxMessage(ctx, schemas.ParkOutboxMessageParams{
+		LastError: sql.NullString{String: reason, Valid: reason != ""},
+		ParkedAt:  sql.NullTime{Time: time.Now(), Valid: true},
+		ID:        id,
+	}); err != nil {
+		return handleDBError(ctx, "to park outbox message", err)
+	}
+
+	return nil
+}
+
+func (s *DbStore) ListParkedOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListParkedOutbox")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListParkedOutboxMessages(ctx, schemas.ListParkedOutboxMessagesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int64(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list parked outbox messages", err)
+	}
+
+	return toOutboxMessages(rows)
+}
+
+func (s *DbStore) UnparkOutbox(ctx context.Context, id int64) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.UnparkOutbox")
+	defer span.End()
+
+	_, err := s.q(ctx).UnparkOutboxMessage(ctx, schemas.UnparkOutboxMessageParams{
+		TenantID: TenantOf(ctx),
+		ID:       id,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("outbox message %d: %w", id, ErrOutboxNotParked)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to unpark outbox message", err)
 	}
 
 	return nil
 }
 
+func (s *DbStore) DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.DeleteSentOutbox")
+	defer span.End()
+
+	deleted, err := s.q(ctx).DeleteSentOutboxMessages(ctx, sql.NullTime{Time: before, Valid: true})
+	if err != nil {
+		return 0, handleDBError(ctx, "to delete sent outbox messages", err)
+	}
+
+	return deleted, nil
+}
+
+func toOutboxMessages(rows []schemas.Outbox) ([]OutboxMessage, error) {
+	messages := make([]OutboxMessage, 0, len(rows))
+	for _, row := range rows {
+		var properties map[string]any
+		if err := json.Unmarshal([]byte(row.Properties), &properties); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal outbox message properties: %w", err)
+		}
+
+		msg := OutboxMessage{
+			Id:           row.ID,
+			Kind:         OutboxKind(row.Kind),
+			Destination:  row.Destination,
+			Payload:      row.Payload,
+			Properties:   properties,
+			CreatedAt:    row.CreatedAt,
+			Attempts:     int(row.Attempts),
+			LastError:    row.LastError.String,
+			Serialnumber: row.SerialNumber,
+			Tenant:       row.TenantID,
+		}
+		if row.SentAt.Valid {
+			msg.SentAt = &row.SentAt.Time
+		}
+		if row.ParkedAt.Valid {
+			msg.ParkedAt = &row.ParkedAt.Time
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func toQuarantinedMessage(row schemas.Quarantine) (QuarantinedMessage, error) {
+	var properties map[string]any
+	if err := json.Unmarshal([]byte(row.Properties), &properties); err != nil {
+		return QuarantinedMessage{}, fmt.Errorf("failed to unmarshal quarantined message properties: %w", err)
+	}
+
+	msg := QuarantinedMessage{
+		Id:            row.ID,
+		MessageId:     row.MessageID,
+		Serialnumber:  row.SerialNumber.String,
+		Topic:         row.Topic,
+		Subscription:  row.Subscription,
+		ContentType:   row.ContentType.String,
+		Properties:    properties,
+		Body:          row.Body,
+		Error:         row.Error,
+		ErrorClass:    row.ErrorClass,
+		Attempts:      int(row.Attempts),
+		QuarantinedAt: row.QuarantinedAt,
+		Tenant:        row.TenantID,
+	}
+	if row.RedrivenAt.Valid {
+		msg.RedrivenAt = &row.RedrivenAt.Time
+	}
+
+	return msg, nil
+}
+
 func handleDBError(ctx context.Context, operation string, err error) error {
 	slog.Error("failed "+operation, "error", err)
 	span := trace.SpanFromContext(ctx)
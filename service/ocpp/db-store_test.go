@@ -0,0 +1,53 @@
+package ocpp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/squishmeist/ocpp-go/service/ocpp/db/schemas"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbStoreBootHistory(t *testing.T) {
+	ctx := context.Background()
+	store := setupOutboxTest(t)
+	request := core.BootNotificationRequest{
+		ChargePointModel:  "Zappi",
+		ChargePointVendor: "Myenergi",
+		FirmwareVersion:   "5540",
+	}
+
+	_, err := store.AddChargepoint(ctx, "charger-1", request)
+	assert.NoError(t, err)
+	request.FirmwareVersion = "5541"
+	_, err = store.AddChargepoint(ctx, "charger-1", request)
+	assert.NoError(t, err)
+
+	history, err := store.queries.ListBootHistory(ctx, schemas.ListBootHistoryParams{SerialNumber: "charger-1", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "5541", history[0].FirmwareVersion)
+	assert.Equal(t, "5540", history[0].PreviousFirmwareVersion.String)
+	assert.Equal(t, "5540", history[1].FirmwareVersion)
+	assert.False(t, history[1].PreviousFirmwareVersion.Valid)
+}
+
+func TestDbStoreCdrImmutable(t *testing.T) {
+	ctx := context.Background()
+	store := setupOutboxTest(t)
+
+	_, err := store.AddCdr(ctx, ChargeDetailRecord{Serialnumber: "charger-1", TransactionId: 1, EnergyCheck: EnergyCheckUnverified})
+	assert.NoError(t, err)
+
+	_, err = store.db.ExecContext(ctx, `UPDATE charge_detail_record SET energy_wh = 1`)
+	assert.ErrorContains(t, err, "immutable")
+	_, err = store.db.ExecContext(ctx, `DELETE FROM charge_detail_record`)
+	assert.ErrorContains(t, err, "immutable")
+}
+
+func TestDbStoreTenants(t *testing.T) {
+	testDurableStoreTenants(t, func(t *testing.T) durableStore {
+		return setupOutboxTest(t)
+	})
+}
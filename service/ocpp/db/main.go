@@ -5,59 +5,114 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
-	"os"
-
-	_ "embed"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db/pgschemas"
 	"github.com/squishmeist/ocpp-go/service/ocpp/db/schemas"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 )
 
-//go:embed schema.sql
-var ddl string
-
 var GlobalSQLCtx = context.Background()
 
-func Init(dbInfo utils.DatabaseConfiguration) (string, error) {
+// Drivers of the database.
+const (
+	DriverSQLite   = "sqlite3"
+	DriverLibsql   = "libsql"
+	DriverPostgres = "postgres"
+)
+
+// Returns the dialect of the driver.
+func DialectOf(driver string) Dialect {
+	if driver == DriverPostgres {
+		return Postgres
+	}
+	return SQLite
+}
+
+// Opens the database without changing its schema.
+func Open(dbInfo utils.DatabaseConfiguration) (*sql.DB, error) {
+	driver := dbInfo.Driver
 	address := dbInfo.Address
-	// if the driver is sqlite3 and .db exists in /tmp/ then delete it.
-	if dbInfo.Driver == "sqlite3" {
-		os.Remove(dbInfo.Address)
-		slog.Debug("Sqlite3", "Removing existing database file", dbInfo.Address)
+	switch driver {
+	case DriverSQLite:
 		address = fmt.Sprintf("%s:%s", dbInfo.Protocol, dbInfo.Address)
+	case DriverPostgres:
+		// The pgx driver registers itself as pgx
+		driver = "pgx"
 	}
 
-	db, err := sql.Open(dbInfo.Driver, address)
+	db, err := sql.Open(driver, address)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if dbInfo.PoolSize > 0 {
+		db.SetMaxOpenConns(dbInfo.PoolSize)
+	}
+
+	return db, nil
+}
+
+// Opens the database and, unless disabled, applies pending migrations before returning the queries.
+func Connect(dbInfo utils.DatabaseConfiguration) (*schemas.Queries, *sql.DB, error) {
+	if dbInfo.Driver == DriverPostgres {
+		return nil, nil, fmt.Errorf("the %s driver is connected with ConnectPostgres", dbInfo.Driver)
 	}
 
-	defer db.Close()
+	db, err := Open(dbInfo)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if _, err := db.ExecContext(GlobalSQLCtx, ddl); err != nil {
-		fmt.Println("failed to exec content", "error", err)
-		slog.Error("failed to exec content", "error", err)
+	if !dbInfo.SkipMigrations {
+		applied, err := Migrate(GlobalSQLCtx, db, SQLite)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		slog.Info("Database migrated", "applied", applied)
 	}
 
-	slog.Info("Database initialised successfully.")
+	queries := schemas.New(db)
 
-	return address, nil
+	return queries, db, nil
 }
 
-func Connect(dbInfo utils.DatabaseConfiguration) (*schemas.Queries, *sql.DB, error) {
-	addr, err := Init(dbInfo)
+// Opens a pool of PostgreSQL connections, holding at most PoolSize of them when it is set, and unless disabled applies
+// pending migrations before returning the queries. The address is a PostgreSQL connection string or URL.
+func ConnectPostgres(ctx context.Context, dbInfo utils.DatabaseConfiguration) (*pgschemas.Queries, *pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dbInfo.Address)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("failed to parse postgres address: %w", err)
+	}
+	if dbInfo.PoolSize > 0 {
+		config.MaxConns = int32(dbInfo.PoolSize)
 	}
 
-	db, err := sql.Open(dbInfo.Driver, addr)
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, nil, fmt.Errorf("failed to reach postgres: %w", err)
+	}
 
-	queries := schemas.New(db)
+	if !dbInfo.SkipMigrations {
+		// Closing the database does not close the pool it was opened from
+		db := stdlib.OpenDBFromPool(pool)
+		applied, err := Migrate(ctx, db, Postgres)
+		db.Close()
+		if err != nil {
+			pool.Close()
+			return nil, nil, err
+		}
+		slog.Info("Database migrated", "applied", applied)
+	}
 
-	return queries, db, nil
+	queries := pgschemas.New(pool)
+
+	return queries, pool, nil
 }
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numbered migrations, named <version>_<name>.up.sql and <version>_<name>.down.sql, per dialect.
+//
+//go:embed migrations/*.sql postgres/migrations/*.sql
+var migrationFiles embed.FS
+
+// Represents the SQL dialect of a database: its migrations and how they are recorded in schema_migrations.
+type Dialect struct {
+	Name string
+	dir  string
+
+	createTable   string
+	insertVersion string
+	deleteVersion string
+	// Run on the migrating connection before and after migrating, so instances starting together migrate one at a time.
+	lock, unlock string
+}
+
+// Dialects of the supported drivers.
+var (
+	// Used by the sqlite3 and libsql drivers.
+	SQLite = Dialect{
+		Name: "sqlite",
+		dir:  "migrations",
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`,
+		insertVersion: "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		deleteVersion: "DELETE FROM schema_migrations WHERE version = ?",
+	}
+	// Used by the postgres driver.
+	Postgres = Dialect{
+		Name: "postgres",
+		dir:  "postgres/migrations",
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL
+)`,
+		insertVersion: "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+		deleteVersion: "DELETE FROM schema_migrations WHERE version = $1",
+		lock:          "SELECT pg_advisory_lock(hashtext('schema_migrations'))",
+		unlock:        "SELECT pg_advisory_unlock(hashtext('schema_migrations'))",
+	}
+)
+
+// Represents a schema migration and the SQL that applies and reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Represents a migration and when it was applied, if it was.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Returns the embedded migrations of the dialect ordered by version.
+func (d Dialect) Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, d.dir)
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		filename := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(filename, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s", filename)
+		}
+		number, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %s", filename)
+		}
+		version, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", filename)
+		}
+
+		content, err := fs.ReadFile(fsys, dir+"/"+filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", filename, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has files named %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return int(a.Version - b.Version)
+	})
+
+	return migrations, nil
+}
+
+// Runs fn on a single connection, holding the dialect's migration lock if it has one.
+func withMigrationConn(ctx context.Context, db *sql.DB, dialect Dialect, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, dialect.lock); err != nil {
+			return fmt.Errorf("failed to lock schema_migrations: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(context.WithoutCancel(ctx), dialect.unlock); err != nil {
+				slog.Error("Failed to unlock schema_migrations", "error", err)
+			}
+		}()
+	}
+
+	return fn(conn)
+}
+
+// Returns the versions recorded in schema_migrations and when they were applied, creating the table if needed.
+func appliedMigrations(ctx context.Context, conn *sql.Conn, dialect Dialect) (map[int64]time.Time, error) {
+	if _, err := conn.ExecContext(ctx, dialect.createTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Runs the migration's SQL and records or removes its version in one transaction, so a failed migration leaves no trace.
+func runMigration(ctx context.Context, conn *sql.Conn, dialect Dialect, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, dialect.insertVersion, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, dialect.deleteVersion, migration.Version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Applies every migration of the dialect that has not been applied yet, in version order, and returns how many were applied.
+func Migrate(ctx context.Context, db *sql.DB, dialect Dialect) (int, error) {
+	migrations, err := dialect.Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationConn(ctx, db, dialect, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn, dialect)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, dialect, migration, true); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			slog.Info("Applied migration", "version", migration.Version, "name", migration.Name, "dialect", dialect.Name)
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Reverts the latest steps applied migrations of the dialect, newest first, and returns how many were reverted.
+func MigrateDown(ctx context.Context, db *sql.DB, dialect Dialect, steps int) (int, error) {
+	migrations, err := dialect.Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationConn(ctx, db, dialect, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn, dialect)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range slices.Backward(migrations) {
+			if count >= steps {
+				break
+			}
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, dialect, migration, false); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			slog.Info("Reverted migration", "version", migration.Version, "name", migration.Name, "dialect", dialect.Name)
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Returns every embedded migration of the dialect with when it was applied, or a nil AppliedAt if it is pending.
+func Status(ctx context.Context, db *sql.DB, dialect Dialect) ([]MigrationStatus, error) {
+	migrations, err := dialect.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	err = withMigrationConn(ctx, db, dialect, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn, dialect)
+		if err != nil {
+			return err
+		}
+
+		status = make([]MigrationStatus, 0, len(migrations))
+		for _, migration := range migrations {
+			entry := MigrationStatus{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				entry.AppliedAt = &appliedAt
+			}
+			status = append(status, entry)
+		}
+		return nil
+	})
+
+	return status, err
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db/pgschemas"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db/schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	dbInfo := utils.DatabaseConfiguration{
+		Driver:   "sqlite3",
+		Protocol: "file",
+		Address:  t.TempDir() + "/ocpp.db",
+	}
+	migrations, err := SQLite.Migrations()
+	assert.NoError(t, err)
+
+	t.Run("Connect_Applies Pending Migrations", func(t *testing.T) {
+		queries, database, err := Connect(dbInfo)
+		assert.NoError(t, err)
+		defer database.Close()
+
+		_, err = database.ExecContext(ctx, `INSERT INTO chargepoint (serial_number, model, vendor, firmware_version) VALUES ('charger-1', 'model', 'vendor', '1.0')`)
+		assert.NoError(t, err)
+		_, err = queries.ListQuarantinedMessages(ctx, schemas.ListQuarantinedMessagesParams{Limit: 10})
+		assert.NoError(t, err)
+
+		status, err := Status(ctx, database, SQLite)
+		assert.NoError(t, err)
+		assert.Len(t, status, len(migrations))
+		for _, migration := range status {
+			assert.NotNil(t, migration.AppliedAt, "expected migration %d to be applied", migration.Version)
+		}
+	})
+
+	t.Run("Connect_Keeps Data", func(t *testing.T) {
+		_, database, err := Connect(dbInfo)
+		assert.NoError(t, err)
+		defer database.Close()
+
+		var count int
+		assert.NoError(t, database.QueryRowContext(ctx, "SELECT COUNT(*) FROM chargepoint").Scan(&count))
+		assert.Equal(t, 1, count)
+
+		applied, err := Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, applied)
+	})
+
+	t.Run("MigrateDown_Reverts Latest", func(t *testing.T) {
+		database, err := Open(dbInfo)
+		assert.NoError(t, err)
+		defer database.Close()
+
+		reverted, err := MigrateDown(ctx, database, SQLite, len(migrations))
+		assert.NoError(t, err)
+		assert.Equal(t, len(migrations), reverted)
+
+		_, err = database.ExecContext(ctx, "SELECT COUNT(*) FROM chargepoint")
+		assert.Error(t, err, "expected chargepoint table to be dropped")
+
+		status, err := Status(ctx, database, SQLite)
+		assert.NoError(t, err)
+		for _, migration := range status {
+			assert.Nil(t, migration.AppliedAt, "expected migration %d to be pending", migration.Version)
+		}
+
+		applied, err := Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+		assert.Equal(t, len(migrations), applied)
+	})
+
+	t.Run("Migrate_Keeps Legacy Serial Number", func(t *testing.T) {
+		database, err := Open(utils.DatabaseConfiguration{Driver: "sqlite3", Protocol: "file", Address: t.TempDir() + "/ocpp.db"})
+		assert.NoError(t, err)
+		defer database.Close()
+
+		_, err = Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+		steps := 0
+		for _, migration := range migrations {
+			if migration.Version >= 3 {
+				steps++
+			}
+		}
+		_, err = MigrateDown(ctx, database, SQLite, steps)
+		assert.NoError(t, err)
+
+		// Before 0003 chargepoints were keyed on chargeBoxSerialNumber
+		_, err = database.ExecContext(ctx, `INSERT INTO chargepoint (serial_number, model, vendor, firmware_version) VALUES ('charger-1', 'model', 'vendor', '1.0')`)
+		assert.NoError(t, err)
+		_, err = Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+
+		var chargeBoxSerialNumber string
+		assert.NoError(t, database.QueryRowContext(ctx, "SELECT charge_box_serial_number FROM chargepoint WHERE serial_number = 'charger-1'").Scan(&chargeBoxSerialNumber))
+		assert.Equal(t, "charger-1", chargeBoxSerialNumber)
+	})
+
+	t.Run("Migrate_Keeps Chargepoints In Default Tenant", func(t *testing.T) {
+		database, err := Open(utils.DatabaseConfiguration{Driver: "sqlite3", Protocol: "file", Address: t.TempDir() + "/ocpp.db"})
+		assert.NoError(t, err)
+		defer database.Close()
+
+		_, err = Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+		steps := 0
+		for _, migration := range migrations {
+			if migration.Version >= 7 {
+				steps++
+			}
+		}
+		_, err = MigrateDown(ctx, database, SQLite, steps)
+		assert.NoError(t, err)
+
+		// Before 0007 chargepoints had no tenant
+		_, err = database.ExecContext(ctx, `INSERT INTO chargepoint (serial_number, model, vendor, firmware_version) VALUES ('charger-1', 'model', 'vendor', '1.0')`)
+		assert.NoError(t, err)
+		_, err = Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+
+		var tenantId string
+		assert.NoError(t, database.QueryRowContext(ctx, "SELECT tenant_id FROM chargepoint WHERE serial_number = 'charger-1'").Scan(&tenantId))
+		assert.Equal(t, "", tenantId)
+
+		// Another tenant can use the same serial number
+		_, err = database.ExecContext(ctx, `INSERT INTO chargepoint (serial_number, model, vendor, firmware_version, tenant_id) VALUES ('charger-1', 'model', 'vendor', '1.0', 'operator-b')`)
+		assert.NoError(t, err)
+
+		_, err = MigrateDown(ctx, database, SQLite, steps)
+		assert.NoError(t, err)
+		var count int
+		assert.NoError(t, database.QueryRowContext(ctx, "SELECT COUNT(*) FROM chargepoint").Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Migrate_Keeps Processed Messages In Default Tenant", func(t *testing.T) {
+		database, err := Open(utils.DatabaseConfiguration{Driver: "sqlite3", Protocol: "file", Address: t.TempDir() + "/ocpp.db"})
+		assert.NoError(t, err)
+		defer database.Close()
+
+		_, err = Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+		steps := 0
+		for _, migration := range migrations {
+			if migration.Version >= 11 {
+				steps++
+			}
+		}
+		_, err = MigrateDown(ctx, database, SQLite, steps)
+		assert.NoError(t, err)
+
+		// Before 0011 processed messages had no tenant
+		_, err = database.ExecContext(ctx, `INSERT INTO processed_message (message_id, processed_at) VALUES ('message-1', CURRENT_TIMESTAMP)`)
+		assert.NoError(t, err)
+		_, err = Migrate(ctx, database, SQLite)
+		assert.NoError(t, err)
+
+		var tenantId string
+		assert.NoError(t, database.QueryRowContext(ctx, "SELECT tenant_id FROM processed_message WHERE message_id = 'message-1'").Scan(&tenantId))
+		assert.Equal(t, "", tenantId)
+
+		// Another tenant can process a message with the same id
+		_, err = database.ExecContext(ctx, `INSERT INTO processed_message (message_id, processed_at, tenant_id) VALUES ('message-1', CURRENT_TIMESTAMP, 'operator-b')`)
+		assert.NoError(t, err)
+
+		_, err = MigrateDown(ctx, database, SQLite, steps)
+		assert.NoError(t, err)
+		var count int
+		assert.NoError(t, database.QueryRowContext(ctx, "SELECT COUNT(*) FROM processed_message").Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Migrate_Rolls Back Failed Migration", func(t *testing.T) {
+		database, err := Open(utils.DatabaseConfiguration{Driver: "sqlite3", Protocol: "file", Address: t.TempDir() + "/ocpp.db"})
+		assert.NoError(t, err)
+		defer database.Close()
+
+		conn, err := database.Conn(ctx)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		_, err = appliedMigrations(ctx, conn, SQLite)
+		assert.NoError(t, err)
+		err = runMigration(ctx, conn, SQLite, Migration{Version: 1, Name: "broken", Up: "CREATE TABLE a (id INTEGER); CREATE TABLE"}, true)
+		assert.Error(t, err)
+
+		_, err = conn.ExecContext(ctx, "SELECT COUNT(*) FROM a")
+		assert.Error(t, err, "expected table from failed migration to be rolled back")
+		applied, err := appliedMigrations(ctx, conn, SQLite)
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+}
+
+func TestMigratePostgres(t *testing.T) {
+	dsn := os.Getenv("OCPP_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("OCPP_TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+	dbInfo := utils.DatabaseConfiguration{Driver: DriverPostgres, Address: dsn}
+	migrations, err := Postgres.Migrations()
+	assert.NoError(t, err)
+
+	database, err := Open(dbInfo)
+	assert.NoError(t, err)
+	defer database.Close()
+
+	_, err = MigrateDown(ctx, database, Postgres, len(migrations))
+	assert.NoError(t, err)
+	applied, err := Migrate(ctx, database, Postgres)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), applied)
+
+	queries, pool, err := ConnectPostgres(ctx, dbInfo)
+	assert.NoError(t, err)
+	defer pool.Close()
+	_, err = queries.ListQuarantinedMessages(ctx, pgschemas.ListQuarantinedMessagesParams{Limit: 10})
+	assert.NoError(t, err)
+
+	status, err := Status(ctx, database, Postgres)
+	assert.NoError(t, err)
+	for _, migration := range status {
+		assert.NotNil(t, migration.AppliedAt, "expected migration %d to be applied", migration.Version)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("Embedded", func(t *testing.T) {
+		for _, dialect := range []Dialect{SQLite, Postgres} {
+			migrations, err := dialect.Migrations()
+			assert.NoError(t, err, "expected the %s migrations to load", dialect.Name)
+			assert.NotEmpty(t, migrations)
+		}
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		migrations, err := loadMigrations(fstest.MapFS{
+			"migrations/0002_second.up.sql":   {Data: []byte("up 2")},
+			"migrations/0002_second.down.sql": {Data: []byte("down 2")},
+			"migrations/0001_first.up.sql":    {Data: []byte("up 1")},
+			"migrations/0001_first.down.sql":  {Data: []byte("down 1")},
+		}, "migrations")
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+			{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+		}, migrations)
+	})
+
+	t.Run("Missing Down", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"migrations/0001_first.up.sql": {Data: []byte("up 1")},
+		}, "migrations")
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid Name", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"migrations/first.up.sql":   {Data: []byte("up 1")},
+			"migrations/first.down.sql": {Data: []byte("down 1")},
+		}, "migrations")
+		assert.Error(t, err)
+	})
+}
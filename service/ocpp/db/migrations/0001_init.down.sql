@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS outbox_unsent;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS processed_message;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS charge_transaction;
+DROP TABLE IF EXISTS quarantine;
+DROP TABLE IF EXISTS chargepoint;
@@ -0,0 +1,85 @@
+-- Initial schema. Tables are created only if missing, so databases created before migrations are adopted as they are.
+
+-- Chargepoint Table
+CREATE TABLE IF NOT EXISTS chargepoint (
+    serial_number TEXT PRIMARY KEY NOT NULL,
+    model TEXT NOT NULL,
+    vendor TEXT NOT NULL,
+    firmware_version TEXT NOT NULL,
+    iicid TEXT,
+    imsi TEXT,
+    meter_serial_number TEXT,
+    meter_type TEXT,
+    last_boot TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    last_heartbeat TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_connected TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Quarantine Table
+-- Messages that failed permanently or ran out of retries, kept with their full context so they can be inspected and redriven.
+CREATE TABLE IF NOT EXISTS quarantine (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id TEXT NOT NULL,
+    serial_number TEXT,
+    topic TEXT NOT NULL,
+    subscription TEXT NOT NULL,
+    content_type TEXT,
+    properties TEXT NOT NULL,
+    body BLOB NOT NULL,
+    error TEXT NOT NULL,
+    error_class TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    redriven_at TIMESTAMP
+);
+
+-- Transaction Table
+-- Charging transactions started and stopped by charge points. The id is the transactionId returned to the charge point.
+CREATE TABLE IF NOT EXISTS charge_transaction (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    connector_id INTEGER NOT NULL,
+    id_tag TEXT NOT NULL,
+    meter_start INTEGER NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    meter_stop INTEGER,
+    stopped_at TIMESTAMP,
+    stop_reason TEXT
+);
+
+-- Webhook Delivery Table
+-- One row per domain event posted to a webhook endpoint, successful or not.
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    url TEXT NOT NULL,
+    status_code INTEGER,
+    attempts INTEGER NOT NULL,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP
+);
+
+-- Processed Message Table
+-- Ids of processed inbound messages, written in the transaction that applies the message, so it is applied once.
+CREATE TABLE IF NOT EXISTS processed_message (
+    message_id TEXT PRIMARY KEY NOT NULL,
+    processed_at TIMESTAMP NOT NULL
+);
+
+-- Outbox Table
+-- Replies and domain events written in the transaction of the message that produced them, sent by the outbox relay.
+CREATE TABLE IF NOT EXISTS outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    destination TEXT NOT NULL,
+    payload BLOB NOT NULL,
+    properties TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
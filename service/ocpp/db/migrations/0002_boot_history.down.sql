@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS boot_history_serial_number;
+DROP TABLE IF EXISTS boot_history;
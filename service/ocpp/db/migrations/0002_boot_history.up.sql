@@ -0,0 +1,13 @@
+-- Boot History Table
+-- One row per BootNotification, with the firmware version the charge point reported on its previous boot.
+CREATE TABLE boot_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    model TEXT NOT NULL,
+    vendor TEXT NOT NULL,
+    firmware_version TEXT NOT NULL,
+    previous_firmware_version TEXT,
+    booted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX boot_history_serial_number ON boot_history (serial_number, booted_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS data_quality_finding;
+ALTER TABLE chargepoint DROP COLUMN charge_point_serial_number;
+ALTER TABLE chargepoint DROP COLUMN charge_box_serial_number;
@@ -0,0 +1,21 @@
+-- Chargepoints are keyed on the charge point identity of the transport. The serial numbers reported in a
+-- BootNotification are kept in their own columns.
+ALTER TABLE chargepoint ADD COLUMN charge_box_serial_number TEXT;
+ALTER TABLE chargepoint ADD COLUMN charge_point_serial_number TEXT;
+
+-- Until now chargepoints were keyed on chargeBoxSerialNumber
+UPDATE chargepoint SET charge_box_serial_number = serial_number;
+
+-- Data Quality Finding Table
+-- Problems found in what charge points report, one row per distinct problem with how often it was seen.
+CREATE TABLE data_quality_finding (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    field TEXT NOT NULL,
+    value TEXT NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    UNIQUE (serial_number, kind, field, value)
+);
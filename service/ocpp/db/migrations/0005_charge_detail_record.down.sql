@@ -0,0 +1,3 @@
+DROP TABLE charge_detail_record;
+DROP TABLE connector_status;
+DROP TABLE meter_sample;
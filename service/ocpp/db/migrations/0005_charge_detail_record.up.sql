@@ -0,0 +1,62 @@
+-- Meter Sample Table
+-- Energy.Active.Import.Register readings of a transaction, from MeterValues and the transaction data of StopTransaction.
+CREATE TABLE meter_sample (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    transaction_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL,
+    context TEXT,
+    register_wh INTEGER NOT NULL,
+    sampled_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX meter_sample_transaction ON meter_sample (serial_number, transaction_id, sampled_at);
+
+-- Connector Status Table
+-- Every status a charge point reported for a connector in a StatusNotification.
+CREATE TABLE connector_status (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    connector_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    error_code TEXT NOT NULL,
+    info TEXT,
+    reported_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX connector_status_connector ON connector_status (serial_number, connector_id, reported_at);
+
+-- Charge Detail Record Table
+-- The finalised record of a stopped transaction. Rows are written once and never changed or deleted.
+CREATE TABLE charge_detail_record (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    transaction_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL,
+    id_tag TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    stopped_at TIMESTAMP NOT NULL,
+    duration_s INTEGER NOT NULL,
+    meter_start INTEGER NOT NULL,
+    meter_stop INTEGER NOT NULL,
+    energy_wh INTEGER NOT NULL,
+    sampled_energy_wh INTEGER,
+    energy_check TEXT NOT NULL,
+    stop_reason TEXT NOT NULL,
+    charging_s INTEGER NOT NULL,
+    idle_s INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (serial_number, transaction_id)
+);
+
+CREATE INDEX charge_detail_record_stopped_at ON charge_detail_record (stopped_at);
+
+CREATE TRIGGER charge_detail_record_no_update BEFORE UPDATE ON charge_detail_record
+BEGIN
+    SELECT RAISE(ABORT, 'charge detail records are immutable');
+END;
+
+CREATE TRIGGER charge_detail_record_no_delete BEFORE DELETE ON charge_detail_record
+BEGIN
+    SELECT RAISE(ABORT, 'charge detail records are immutable');
+END;
@@ -0,0 +1,7 @@
+ALTER TABLE charge_detail_record DROP COLUMN total_cost;
+ALTER TABLE charge_detail_record DROP COLUMN idle_cost;
+ALTER TABLE charge_detail_record DROP COLUMN time_cost;
+ALTER TABLE charge_detail_record DROP COLUMN energy_cost;
+ALTER TABLE charge_detail_record DROP COLUMN start_fee;
+ALTER TABLE charge_detail_record DROP COLUMN currency;
+ALTER TABLE charge_detail_record DROP COLUMN tariff_id;
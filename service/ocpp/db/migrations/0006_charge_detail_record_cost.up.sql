@@ -0,0 +1,8 @@
+-- The price of a CDR under the tariff of its session, when one applies. Amounts are decimal strings in its currency.
+ALTER TABLE charge_detail_record ADD COLUMN tariff_id TEXT;
+ALTER TABLE charge_detail_record ADD COLUMN currency TEXT;
+ALTER TABLE charge_detail_record ADD COLUMN start_fee TEXT;
+ALTER TABLE charge_detail_record ADD COLUMN energy_cost TEXT;
+ALTER TABLE charge_detail_record ADD COLUMN time_cost TEXT;
+ALTER TABLE charge_detail_record ADD COLUMN idle_cost TEXT;
+ALTER TABLE charge_detail_record ADD COLUMN total_cost TEXT;
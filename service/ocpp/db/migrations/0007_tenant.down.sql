@@ -0,0 +1,63 @@
+-- A serial number used by several tenants keeps the chargepoint and findings of the tenant whose id sorts first, the
+-- default tenant when it has one.
+DROP INDEX charge_transaction_tenant;
+DROP INDEX connector_status_connector;
+CREATE INDEX connector_status_connector ON connector_status (serial_number, connector_id, reported_at);
+DROP INDEX meter_sample_transaction;
+CREATE INDEX meter_sample_transaction ON meter_sample (serial_number, transaction_id, sampled_at);
+DROP INDEX boot_history_serial_number;
+CREATE INDEX boot_history_serial_number ON boot_history (serial_number, booted_at);
+
+CREATE TABLE data_quality_finding_legacy (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    field TEXT NOT NULL,
+    value TEXT NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    UNIQUE (serial_number, kind, field, value)
+);
+
+INSERT OR IGNORE INTO data_quality_finding_legacy (id, serial_number, kind, field, value, first_seen_at, last_seen_at, occurrences)
+SELECT id, serial_number, kind, field, value, first_seen_at, last_seen_at, occurrences FROM data_quality_finding
+ORDER BY tenant_id, id;
+
+DROP TABLE data_quality_finding;
+ALTER TABLE data_quality_finding_legacy RENAME TO data_quality_finding;
+
+CREATE TABLE chargepoint_legacy (
+    serial_number TEXT PRIMARY KEY NOT NULL,
+    model TEXT NOT NULL,
+    vendor TEXT NOT NULL,
+    firmware_version TEXT NOT NULL,
+    iicid TEXT,
+    imsi TEXT,
+    meter_serial_number TEXT,
+    meter_type TEXT,
+    last_boot TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    last_heartbeat TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_connected TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    charge_box_serial_number TEXT,
+    charge_point_serial_number TEXT
+);
+
+INSERT OR IGNORE INTO chargepoint_legacy (
+    serial_number, model, vendor, firmware_version, iicid, imsi, meter_serial_number, meter_type, last_boot,
+    last_heartbeat, last_connected, charge_box_serial_number, charge_point_serial_number
+)
+SELECT
+    serial_number, model, vendor, firmware_version, iicid, imsi, meter_serial_number, meter_type, last_boot,
+    last_heartbeat, last_connected, charge_box_serial_number, charge_point_serial_number
+FROM chargepoint
+ORDER BY tenant_id;
+
+DROP TABLE chargepoint;
+ALTER TABLE chargepoint_legacy RENAME TO chargepoint;
+
+ALTER TABLE charge_detail_record DROP COLUMN tenant_id;
+ALTER TABLE connector_status DROP COLUMN tenant_id;
+ALTER TABLE meter_sample DROP COLUMN tenant_id;
+ALTER TABLE charge_transaction DROP COLUMN tenant_id;
+ALTER TABLE boot_history DROP COLUMN tenant_id;
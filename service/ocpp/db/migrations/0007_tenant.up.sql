@@ -0,0 +1,65 @@
+-- Chargepoints, transactions and what they report belong to the tenant of the operator running them. Rows written
+-- before tenants were introduced belong to the default tenant, the empty tenant id.
+ALTER TABLE boot_history ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE charge_transaction ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE meter_sample ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE connector_status ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE charge_detail_record ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+
+-- A serial number is unique per tenant, so chargepoints and findings are rebuilt to key on both
+CREATE TABLE chargepoint_tenant (
+    serial_number TEXT NOT NULL,
+    model TEXT NOT NULL,
+    vendor TEXT NOT NULL,
+    firmware_version TEXT NOT NULL,
+    iicid TEXT,
+    imsi TEXT,
+    meter_serial_number TEXT,
+    meter_type TEXT,
+    last_boot TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    last_heartbeat TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_connected TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    charge_box_serial_number TEXT,
+    charge_point_serial_number TEXT,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (tenant_id, serial_number)
+);
+
+INSERT INTO chargepoint_tenant (
+    serial_number, model, vendor, firmware_version, iicid, imsi, meter_serial_number, meter_type, last_boot,
+    last_heartbeat, last_connected, charge_box_serial_number, charge_point_serial_number
+)
+SELECT
+    serial_number, model, vendor, firmware_version, iicid, imsi, meter_serial_number, meter_type, last_boot,
+    last_heartbeat, last_connected, charge_box_serial_number, charge_point_serial_number
+FROM chargepoint;
+
+DROP TABLE chargepoint;
+ALTER TABLE chargepoint_tenant RENAME TO chargepoint;
+
+CREATE TABLE data_quality_finding_tenant (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial_number TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    field TEXT NOT NULL,
+    value TEXT NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    UNIQUE (tenant_id, serial_number, kind, field, value)
+);
+
+INSERT INTO data_quality_finding_tenant (id, serial_number, kind, field, value, first_seen_at, last_seen_at, occurrences)
+SELECT id, serial_number, kind, field, value, first_seen_at, last_seen_at, occurrences FROM data_quality_finding;
+
+DROP TABLE data_quality_finding;
+ALTER TABLE data_quality_finding_tenant RENAME TO data_quality_finding;
+
+DROP INDEX boot_history_serial_number;
+CREATE INDEX boot_history_serial_number ON boot_history (tenant_id, serial_number, booted_at);
+DROP INDEX meter_sample_transaction;
+CREATE INDEX meter_sample_transaction ON meter_sample (tenant_id, serial_number, transaction_id, sampled_at);
+DROP INDEX connector_status_connector;
+CREATE INDEX connector_status_connector ON connector_status (tenant_id, serial_number, connector_id, reported_at);
+CREATE INDEX charge_transaction_tenant ON charge_transaction (tenant_id, id);
@@ -0,0 +1,8 @@
+-- Journal entries belong to the tenant of the charge point the frame was received from or sent to. Entries journaled
+-- before tenants were introduced belong to the default tenant, the empty tenant id.
+ALTER TABLE message_journal ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+
+DROP INDEX message_journal_serial_number;
+CREATE INDEX message_journal_serial_number ON message_journal (tenant_id, serial_number, recorded_at);
+DROP INDEX message_journal_recorded_at;
+CREATE INDEX message_journal_recorded_at ON message_journal (tenant_id, recorded_at);
@@ -0,0 +1,20 @@
+-- A message id processed in several tenants keeps the row of the tenant whose id sorts first, the default tenant when
+-- it has one.
+DROP INDEX webhook_delivery_tenant;
+DROP INDEX quarantine_tenant;
+
+CREATE TABLE processed_message_legacy (
+    message_id TEXT PRIMARY KEY NOT NULL,
+    processed_at TIMESTAMP NOT NULL
+);
+
+INSERT OR IGNORE INTO processed_message_legacy (message_id, processed_at)
+SELECT message_id, processed_at FROM processed_message
+ORDER BY tenant_id;
+
+DROP TABLE processed_message;
+ALTER TABLE processed_message_legacy RENAME TO processed_message;
+
+ALTER TABLE outbox DROP COLUMN tenant_id;
+ALTER TABLE webhook_delivery DROP COLUMN tenant_id;
+ALTER TABLE quarantine DROP COLUMN tenant_id;
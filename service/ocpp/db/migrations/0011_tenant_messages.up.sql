@@ -0,0 +1,22 @@
+-- Quarantined messages, webhook deliveries and outbox messages belong to the tenant of the message or event they come
+-- from. Rows written before tenants were introduced belong to the default tenant, the empty tenant id.
+ALTER TABLE quarantine ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE webhook_delivery ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+
+-- A message id is unique per tenant, so processed messages are rebuilt to key on both
+CREATE TABLE processed_message_tenant (
+    message_id TEXT NOT NULL,
+    processed_at TIMESTAMP NOT NULL,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (tenant_id, message_id)
+);
+
+INSERT INTO processed_message_tenant (message_id, processed_at)
+SELECT message_id, processed_at FROM processed_message;
+
+DROP TABLE processed_message;
+ALTER TABLE processed_message_tenant RENAME TO processed_message;
+
+CREATE INDEX quarantine_tenant ON quarantine (tenant_id, quarantined_at);
+CREATE INDEX webhook_delivery_tenant ON webhook_delivery (tenant_id, id);
@@ -0,0 +1,2 @@
+DROP INDEX outbox_serial_number;
+ALTER TABLE outbox DROP COLUMN serial_number;
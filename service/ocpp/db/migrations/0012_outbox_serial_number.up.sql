@@ -0,0 +1,5 @@
+-- The messages of a charge point are sent in order, so outbox messages record the charge point they are for. Rows
+-- written before belong to no charge point and are sent in order with each other.
+ALTER TABLE outbox ADD COLUMN serial_number TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX outbox_serial_number ON outbox (tenant_id, serial_number, id) WHERE sent_at IS NULL AND parked_at IS NULL;
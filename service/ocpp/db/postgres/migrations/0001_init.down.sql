@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS data_quality_finding;
+DROP INDEX IF EXISTS outbox_unsent;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS processed_message;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS charge_transaction;
+DROP TABLE IF EXISTS quarantine;
+DROP INDEX IF EXISTS boot_history_serial_number;
+DROP TABLE IF EXISTS boot_history;
+DROP TABLE IF EXISTS chargepoint;
@@ -0,0 +1,117 @@
+-- Initial PostgreSQL schema, matching the SQLite schema as of its migration 0003.
+
+-- Chargepoint Table
+-- Keyed on the charge point identity of the transport. The serial numbers reported in a BootNotification are kept in
+-- their own columns.
+CREATE TABLE chargepoint (
+    serial_number TEXT PRIMARY KEY NOT NULL,
+    model TEXT NOT NULL,
+    vendor TEXT NOT NULL,
+    firmware_version TEXT NOT NULL,
+    iicid TEXT,
+    imsi TEXT,
+    meter_serial_number TEXT,
+    meter_type TEXT,
+    last_boot TIMESTAMPTZ DEFAULT now() NOT NULL,
+    last_heartbeat TIMESTAMPTZ DEFAULT now(),
+    last_connected TIMESTAMPTZ DEFAULT now(),
+    charge_box_serial_number TEXT,
+    charge_point_serial_number TEXT
+);
+
+-- Boot History Table
+-- One row per BootNotification, with the firmware version the charge point reported on its previous boot.
+CREATE TABLE boot_history (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    serial_number TEXT NOT NULL,
+    model TEXT NOT NULL,
+    vendor TEXT NOT NULL,
+    firmware_version TEXT NOT NULL,
+    previous_firmware_version TEXT,
+    booted_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX boot_history_serial_number ON boot_history (serial_number, booted_at);
+
+-- Quarantine Table
+-- Messages that failed permanently or ran out of retries, kept with their full context so they can be inspected and redriven.
+CREATE TABLE quarantine (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    message_id TEXT NOT NULL,
+    serial_number TEXT,
+    topic TEXT NOT NULL,
+    subscription TEXT NOT NULL,
+    content_type TEXT,
+    properties TEXT NOT NULL,
+    body BYTEA NOT NULL,
+    error TEXT NOT NULL,
+    error_class TEXT NOT NULL,
+    attempts BIGINT NOT NULL,
+    quarantined_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    redriven_at TIMESTAMPTZ
+);
+
+-- Transaction Table
+-- Charging transactions started and stopped by charge points. The id is the transactionId returned to the charge point.
+CREATE TABLE charge_transaction (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    serial_number TEXT NOT NULL,
+    connector_id BIGINT NOT NULL,
+    id_tag TEXT NOT NULL,
+    meter_start BIGINT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    meter_stop BIGINT,
+    stopped_at TIMESTAMPTZ,
+    stop_reason TEXT
+);
+
+-- Webhook Delivery Table
+-- One row per domain event posted to a webhook endpoint, successful or not.
+CREATE TABLE webhook_delivery (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    url TEXT NOT NULL,
+    status_code BIGINT,
+    attempts BIGINT NOT NULL,
+    error TEXT,
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    delivered_at TIMESTAMPTZ
+);
+
+-- Processed Message Table
+-- Ids of processed inbound messages, written in the transaction that applies the message, so it is applied once.
+CREATE TABLE processed_message (
+    message_id TEXT PRIMARY KEY NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL
+);
+
+-- Outbox Table
+-- Replies and domain events written in the transaction of the message that produced them, sent by the outbox relay.
+CREATE TABLE outbox (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    kind TEXT NOT NULL,
+    destination TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    properties TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at TIMESTAMPTZ,
+    attempts BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
+
+-- Data Quality Finding Table
+-- Problems found in what charge points report, one row per distinct problem with how often it was seen.
+CREATE TABLE data_quality_finding (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    serial_number TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    field TEXT NOT NULL,
+    value TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    occurrences BIGINT NOT NULL DEFAULT 1,
+    UNIQUE (serial_number, kind, field, value)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS message_journal_recorded_at;
+DROP INDEX IF EXISTS message_journal_serial_number;
+DROP TABLE IF EXISTS message_journal;
@@ -0,0 +1,19 @@
+-- Message Journal Table
+-- Every OCPP frame received from or sent to a charge point, with how it was processed. Rows are only ever appended.
+CREATE TABLE message_journal (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    direction TEXT NOT NULL,
+    serial_number TEXT NOT NULL,
+    message_id TEXT,
+    action TEXT,
+    type_id BIGINT,
+    body BYTEA NOT NULL,
+    trace_id TEXT,
+    outcome TEXT NOT NULL,
+    error TEXT,
+    latency_us BIGINT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX message_journal_serial_number ON message_journal (serial_number, recorded_at);
+CREATE INDEX message_journal_recorded_at ON message_journal (recorded_at);
@@ -0,0 +1,4 @@
+DROP TABLE charge_detail_record;
+DROP FUNCTION charge_detail_record_immutable;
+DROP TABLE connector_status;
+DROP TABLE meter_sample;
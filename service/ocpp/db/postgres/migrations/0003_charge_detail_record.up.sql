@@ -0,0 +1,61 @@
+-- Meter Sample Table
+-- Energy.Active.Import.Register readings of a transaction, from MeterValues and the transaction data of StopTransaction.
+CREATE TABLE meter_sample (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    serial_number TEXT NOT NULL,
+    transaction_id BIGINT NOT NULL,
+    connector_id BIGINT NOT NULL,
+    context TEXT,
+    register_wh BIGINT NOT NULL,
+    sampled_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX meter_sample_transaction ON meter_sample (serial_number, transaction_id, sampled_at);
+
+-- Connector Status Table
+-- Every status a charge point reported for a connector in a StatusNotification.
+CREATE TABLE connector_status (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    serial_number TEXT NOT NULL,
+    connector_id BIGINT NOT NULL,
+    status TEXT NOT NULL,
+    error_code TEXT NOT NULL,
+    info TEXT,
+    reported_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX connector_status_connector ON connector_status (serial_number, connector_id, reported_at);
+
+-- Charge Detail Record Table
+-- The finalised record of a stopped transaction. Rows are written once and never changed or deleted.
+CREATE TABLE charge_detail_record (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    serial_number TEXT NOT NULL,
+    transaction_id BIGINT NOT NULL,
+    connector_id BIGINT NOT NULL,
+    id_tag TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    stopped_at TIMESTAMPTZ NOT NULL,
+    duration_s BIGINT NOT NULL,
+    meter_start BIGINT NOT NULL,
+    meter_stop BIGINT NOT NULL,
+    energy_wh BIGINT NOT NULL,
+    sampled_energy_wh BIGINT,
+    energy_check TEXT NOT NULL,
+    stop_reason TEXT NOT NULL,
+    charging_s BIGINT NOT NULL,
+    idle_s BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (serial_number, transaction_id)
+);
+
+CREATE INDEX charge_detail_record_stopped_at ON charge_detail_record (stopped_at);
+
+CREATE FUNCTION charge_detail_record_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'charge detail records are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER charge_detail_record_immutable BEFORE UPDATE OR DELETE ON charge_detail_record
+FOR EACH ROW EXECUTE FUNCTION charge_detail_record_immutable();
@@ -0,0 +1,8 @@
+ALTER TABLE charge_detail_record
+    DROP COLUMN total_cost,
+    DROP COLUMN idle_cost,
+    DROP COLUMN time_cost,
+    DROP COLUMN energy_cost,
+    DROP COLUMN start_fee,
+    DROP COLUMN currency,
+    DROP COLUMN tariff_id;
@@ -0,0 +1,9 @@
+-- The price of a CDR under the tariff of its session, when one applies, in its currency.
+ALTER TABLE charge_detail_record
+    ADD COLUMN tariff_id TEXT,
+    ADD COLUMN currency TEXT,
+    ADD COLUMN start_fee NUMERIC,
+    ADD COLUMN energy_cost NUMERIC,
+    ADD COLUMN time_cost NUMERIC,
+    ADD COLUMN idle_cost NUMERIC,
+    ADD COLUMN total_cost NUMERIC;
@@ -0,0 +1,28 @@
+-- A serial number used by several tenants keeps the chargepoint and findings of the tenant whose id sorts first, the
+-- default tenant when it has one.
+DROP INDEX charge_transaction_tenant;
+DROP INDEX connector_status_connector;
+CREATE INDEX connector_status_connector ON connector_status (serial_number, connector_id, reported_at);
+DROP INDEX meter_sample_transaction;
+CREATE INDEX meter_sample_transaction ON meter_sample (serial_number, transaction_id, sampled_at);
+DROP INDEX boot_history_serial_number;
+CREATE INDEX boot_history_serial_number ON boot_history (serial_number, booted_at);
+
+DELETE FROM data_quality_finding AS finding USING data_quality_finding AS kept
+WHERE finding.serial_number = kept.serial_number AND finding.kind = kept.kind AND finding.field = kept.field
+AND finding.value = kept.value AND finding.tenant_id > kept.tenant_id;
+ALTER TABLE data_quality_finding DROP CONSTRAINT data_quality_finding_tenant_key;
+ALTER TABLE data_quality_finding ADD CONSTRAINT data_quality_finding_serial_number_kind_field_value_key UNIQUE (serial_number, kind, field, value);
+
+DELETE FROM chargepoint USING chargepoint AS kept
+WHERE chargepoint.serial_number = kept.serial_number AND chargepoint.tenant_id > kept.tenant_id;
+ALTER TABLE chargepoint DROP CONSTRAINT chargepoint_pkey;
+ALTER TABLE chargepoint ADD PRIMARY KEY (serial_number);
+
+ALTER TABLE charge_detail_record DROP COLUMN tenant_id;
+ALTER TABLE connector_status DROP COLUMN tenant_id;
+ALTER TABLE meter_sample DROP COLUMN tenant_id;
+ALTER TABLE data_quality_finding DROP COLUMN tenant_id;
+ALTER TABLE charge_transaction DROP COLUMN tenant_id;
+ALTER TABLE boot_history DROP COLUMN tenant_id;
+ALTER TABLE chargepoint DROP COLUMN tenant_id;
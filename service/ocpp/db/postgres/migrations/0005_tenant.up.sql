@@ -0,0 +1,23 @@
+-- Chargepoints, transactions and what they report belong to the tenant of the operator running them. Rows written
+-- before tenants were introduced belong to the default tenant, the empty tenant id.
+ALTER TABLE chargepoint ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE boot_history ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE charge_transaction ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE data_quality_finding ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE meter_sample ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE connector_status ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE charge_detail_record ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+
+-- A serial number is unique per tenant
+ALTER TABLE chargepoint DROP CONSTRAINT chargepoint_pkey;
+ALTER TABLE chargepoint ADD PRIMARY KEY (tenant_id, serial_number);
+ALTER TABLE data_quality_finding DROP CONSTRAINT data_quality_finding_serial_number_kind_field_value_key;
+ALTER TABLE data_quality_finding ADD CONSTRAINT data_quality_finding_tenant_key UNIQUE (tenant_id, serial_number, kind, field, value);
+
+DROP INDEX boot_history_serial_number;
+CREATE INDEX boot_history_serial_number ON boot_history (tenant_id, serial_number, booted_at);
+DROP INDEX meter_sample_transaction;
+CREATE INDEX meter_sample_transaction ON meter_sample (tenant_id, serial_number, transaction_id, sampled_at);
+DROP INDEX connector_status_connector;
+CREATE INDEX connector_status_connector ON connector_status (tenant_id, serial_number, connector_id, reported_at);
+CREATE INDEX charge_transaction_tenant ON charge_transaction (tenant_id, id);
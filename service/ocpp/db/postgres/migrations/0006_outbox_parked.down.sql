@@ -0,0 +1,4 @@
+DROP INDEX outbox_unsent;
+CREATE INDEX outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
+
+ALTER TABLE outbox DROP COLUMN parked_at;
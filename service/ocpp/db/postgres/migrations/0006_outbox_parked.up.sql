@@ -0,0 +1,5 @@
+-- Outbox messages that failed to send too many times are parked: no longer sent, but kept so they can be retried.
+ALTER TABLE outbox ADD COLUMN parked_at TIMESTAMPTZ;
+
+DROP INDEX outbox_unsent;
+CREATE INDEX outbox_unsent ON outbox (id) WHERE sent_at IS NULL AND parked_at IS NULL;
@@ -0,0 +1,2 @@
+-- Outbox messages are leased to the relay sending them, so with several instances each message is sent by one of them.
+ALTER TABLE outbox ADD COLUMN claimed_until TIMESTAMPTZ;
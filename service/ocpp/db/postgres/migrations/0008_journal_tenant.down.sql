@@ -0,0 +1,6 @@
+DROP INDEX message_journal_recorded_at;
+CREATE INDEX message_journal_recorded_at ON message_journal (recorded_at);
+DROP INDEX message_journal_serial_number;
+CREATE INDEX message_journal_serial_number ON message_journal (serial_number, recorded_at);
+
+ALTER TABLE message_journal DROP COLUMN tenant_id;
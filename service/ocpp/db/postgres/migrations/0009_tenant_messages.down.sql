@@ -0,0 +1,14 @@
+-- A message id processed in several tenants keeps the row of the tenant whose id sorts first, the default tenant when
+-- it has one.
+DROP INDEX webhook_delivery_tenant;
+DROP INDEX quarantine_tenant;
+
+DELETE FROM processed_message USING processed_message AS kept
+WHERE processed_message.message_id = kept.message_id AND processed_message.tenant_id > kept.tenant_id;
+ALTER TABLE processed_message DROP CONSTRAINT processed_message_pkey;
+ALTER TABLE processed_message ADD PRIMARY KEY (message_id);
+
+ALTER TABLE processed_message DROP COLUMN tenant_id;
+ALTER TABLE outbox DROP COLUMN tenant_id;
+ALTER TABLE webhook_delivery DROP COLUMN tenant_id;
+ALTER TABLE quarantine DROP COLUMN tenant_id;
@@ -0,0 +1,13 @@
+-- Quarantined messages, webhook deliveries and outbox messages belong to the tenant of the message or event they come
+-- from. Rows written before tenants were introduced belong to the default tenant, the empty tenant id.
+ALTER TABLE quarantine ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE webhook_delivery ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE processed_message ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+
+-- A message id is unique per tenant
+ALTER TABLE processed_message DROP CONSTRAINT processed_message_pkey;
+ALTER TABLE processed_message ADD PRIMARY KEY (tenant_id, message_id);
+
+CREATE INDEX quarantine_tenant ON quarantine (tenant_id, quarantined_at);
+CREATE INDEX webhook_delivery_tenant ON webhook_delivery (tenant_id, id);
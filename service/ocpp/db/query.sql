@@ -1,4 +1,8 @@
--- name: InsertChargepoint :one
+-- name: GetChargepoint :one
+SELECT * FROM chargepoint
+WHERE tenant_id = ? AND serial_number = ?;
+
+-- name: UpsertChargepoint :one
 INSERT INTO chargepoint (
     serial_number,
     model,
@@ -10,12 +14,374 @@ INSERT INTO chargepoint (
     meter_type,
     last_boot,
     last_heartbeat,
-    last_connected
-) VALUES (?,?,?,?,?,?,?,?,?,?,?)
+    last_connected,
+    charge_box_serial_number,
+    charge_point_serial_number,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+ON CONFLICT (tenant_id, serial_number) DO UPDATE SET
+    model = excluded.model,
+    vendor = excluded.vendor,
+    firmware_version = excluded.firmware_version,
+    iicid = excluded.iicid,
+    imsi = excluded.imsi,
+    meter_serial_number = excluded.meter_serial_number,
+    meter_type = excluded.meter_type,
+    last_boot = excluded.last_boot,
+    charge_box_serial_number = excluded.charge_box_serial_number,
+    charge_point_serial_number = excluded.charge_point_serial_number
 RETURNING *;
 
+-- name: InsertBootHistory :one
+INSERT INTO boot_history (
+    serial_number,
+    model,
+    vendor,
+    firmware_version,
+    previous_firmware_version,
+    booted_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?)
+RETURNING id;
+
+-- name: ListBootHistory :many
+SELECT * FROM boot_history
+WHERE tenant_id = ? AND serial_number = ?
+ORDER BY booted_at DESC, id DESC
+LIMIT ?;
+
 -- name: UpdateChargepointLastHeartbeat :one
 UPDATE chargepoint 
 SET last_heartbeat = ?
-WHERE serial_number = ?
+WHERE tenant_id = ? AND serial_number = ?
 RETURNING serial_number;
+
+-- name: InsertQuarantinedMessage :one
+INSERT INTO quarantine (
+    message_id,
+    serial_number,
+    topic,
+    subscription,
+    content_type,
+    properties,
+    body,
+    error,
+    error_class,
+    attempts,
+    quarantined_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+RETURNING id;
+
+-- name: GetQuarantinedMessage :one
+SELECT * FROM quarantine
+WHERE tenant_id = ? AND id = ?;
+
+-- name: ListQuarantinedMessages :many
+SELECT * FROM quarantine
+WHERE tenant_id = ? AND redriven_at IS NULL
+ORDER BY quarantined_at
+LIMIT ?;
+
+-- name: MarkQuarantinedMessageRedriven :one
+UPDATE quarantine
+SET redriven_at = ?
+WHERE tenant_id = ? AND id = ? AND redriven_at IS NULL
+RETURNING id;
+
+-- name: InsertTransaction :one
+INSERT INTO charge_transaction (
+    serial_number,
+    connector_id,
+    id_tag,
+    meter_start,
+    started_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?)
+RETURNING id;
+
+-- name: GetTransaction :one
+SELECT * FROM charge_transaction
+WHERE tenant_id = ? AND id = ? AND serial_number = ?;
+
+-- name: StopTransaction :one
+UPDATE charge_transaction
+SET meter_stop = ?, stopped_at = ?, stop_reason = ?
+WHERE tenant_id = ? AND id = ? AND serial_number = ? AND stopped_at IS NULL
+RETURNING id;
+
+-- name: ListTransactions :many
+-- A transaction is updated when it stops, or while in progress when its latest meter reading is taken, or else when it starts.
+SELECT * FROM charge_transaction
+WHERE tenant_id = sqlc.arg(tenant_id)
+AND (sqlc.narg(serial_numbers) IS NULL OR serial_number IN (SELECT value FROM json_each(sqlc.narg(serial_numbers))))
+AND (sqlc.narg(updated_from) IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) >= sqlc.narg(updated_from))
+AND (sqlc.narg(updated_to) IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) < sqlc.narg(updated_to))
+ORDER BY id
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountTransactions :one
+SELECT COUNT(*) FROM charge_transaction
+WHERE tenant_id = sqlc.arg(tenant_id)
+AND (sqlc.narg(serial_numbers) IS NULL OR serial_number IN (SELECT value FROM json_each(sqlc.narg(serial_numbers))))
+AND (sqlc.narg(updated_from) IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) >= sqlc.narg(updated_from))
+AND (sqlc.narg(updated_to) IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) < sqlc.narg(updated_to));
+
+-- name: InsertWebhookDelivery :one
+INSERT INTO webhook_delivery (
+    event_id,
+    event_type,
+    url,
+    status_code,
+    attempts,
+    error,
+    created_at,
+    delivered_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?)
+RETURNING id;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_delivery
+WHERE tenant_id = ?
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: InsertProcessedMessage :one
+INSERT INTO processed_message (
+    message_id,
+    processed_at,
+    tenant_id
+) VALUES (?,?,?)
+ON CONFLICT (tenant_id, message_id) DO NOTHING
+RETURNING message_id;
+
+-- name: InsertOutboxMessage :one
+INSERT INTO outbox (
+    kind,
+    destination,
+    payload,
+    properties,
+    created_at,
+    tenant_id,
+    serial_number
+) VALUES (?,?,?,?,?,?,?)
+RETURNING id;
+
+-- name: ListUnsentOutboxMessages :many
+SELECT * FROM outbox
+WHERE tenant_id = ? AND sent_at IS NULL AND parked_at IS NULL
+ORDER BY id
+LIMIT ?;
+
+-- name: ClaimOutboxMessages :many
+-- Leases the oldest unsent messages whose lease, if any, ran out. Only the oldest unsent message of a charge point is
+-- leased, so its messages are sent one at a time in order.
+UPDATE outbox
+SET claimed_until = sqlc.arg(claimed_until)
+WHERE id IN (
+    SELECT id FROM outbox pending
+    WHERE sent_at IS NULL AND parked_at IS NULL AND (claimed_until IS NULL OR claimed_until < sqlc.arg(now))
+    AND NOT EXISTS (
+        SELECT 1 FROM outbox earlier
+        WHERE earlier.tenant_id = pending.tenant_id AND earlier.serial_number = pending.serial_number
+        AND earlier.id < pending.id AND earlier.sent_at IS NULL AND earlier.parked_at IS NULL
+    )
+    ORDER BY id
+    LIMIT sqlc.arg(limit)
+)
+RETURNING *;
+
+-- name: MarkOutboxMessageSent :exec
+UPDATE outbox
+SET sent_at = ?, attempts = attempts + 1, last_error = NULL
+WHERE id = ?;
+
+-- name: MarkOutboxMessageFailed :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = ?, claimed_until = NULL
+WHERE id = ?;
+
+-- name: ParkOutboxMessage :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = ?, parked_at = ?
+WHERE id = ?;
+
+-- name: ListParkedOutboxMessages :many
+SELECT * FROM outbox
+WHERE tenant_id = ? AND sent_at IS NULL AND parked_at IS NOT NULL
+ORDER BY parked_at, id
+LIMIT ?;
+
+-- name: UnparkOutboxMessage :one
+UPDATE outbox
+SET parked_at = NULL, attempts = 0, claimed_until = NULL
+WHERE tenant_id = ? AND id = ? AND sent_at IS NULL AND parked_at IS NOT NULL
+RETURNING id;
+
+-- name: DeleteSentOutboxMessages :execrows
+DELETE FROM outbox
+WHERE sent_at IS NOT NULL AND sent_at < ?;
+
+-- name: UpsertDataQualityFinding :exec
+INSERT INTO data_quality_finding (
+    serial_number,
+    kind,
+    field,
+    value,
+    first_seen_at,
+    last_seen_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?)
+ON CONFLICT (tenant_id, serial_number, kind, field, value) DO UPDATE SET
+    last_seen_at = excluded.last_seen_at,
+    occurrences = occurrences + 1;
+
+-- name: ListDataQualityFindings :many
+SELECT * FROM data_quality_finding
+WHERE tenant_id = ?
+ORDER BY last_seen_at DESC, id DESC
+LIMIT ?;
+
+-- name: InsertJournalEntry :exec
+INSERT INTO message_journal (
+    direction,
+    serial_number,
+    message_id,
+    action,
+    type_id,
+    body,
+    trace_id,
+    outcome,
+    error,
+    latency_us,
+    recorded_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?);
+
+-- name: ListJournalEntries :many
+SELECT * FROM message_journal
+WHERE tenant_id = sqlc.arg(tenant_id)
+AND (sqlc.narg(serial_number) IS NULL OR serial_number = sqlc.narg(serial_number))
+AND (sqlc.narg(action) IS NULL OR action = sqlc.narg(action))
+AND (sqlc.narg(recorded_from) IS NULL OR recorded_at >= sqlc.narg(recorded_from))
+AND (sqlc.narg(recorded_to) IS NULL OR recorded_at < sqlc.narg(recorded_to))
+ORDER BY recorded_at, id
+LIMIT sqlc.arg(limit);
+
+-- name: InsertMeterSample :exec
+INSERT INTO meter_sample (
+    serial_number,
+    transaction_id,
+    connector_id,
+    context,
+    register_wh,
+    sampled_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?);
+
+-- name: ListMeterSamples :many
+SELECT * FROM meter_sample
+WHERE tenant_id = ? AND serial_number = ? AND transaction_id = ?
+ORDER BY sampled_at, id;
+
+-- name: InsertConnectorStatus :exec
+INSERT INTO connector_status (
+    serial_number,
+    connector_id,
+    status,
+    error_code,
+    info,
+    reported_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?);
+
+-- name: ListConnectorStatuses :many
+-- The status a connector had at reported_from, followed by the statuses it reported until reported_to.
+SELECT * FROM connector_status
+WHERE tenant_id = sqlc.arg(tenant_id) AND serial_number = sqlc.arg(serial_number) AND connector_id = sqlc.arg(connector_id)
+AND reported_at < sqlc.arg(reported_to)
+AND reported_at >= COALESCE((
+    SELECT MAX(reported_at) FROM connector_status AS previous
+    WHERE previous.tenant_id = sqlc.arg(tenant_id) AND previous.serial_number = sqlc.arg(serial_number) AND previous.connector_id = sqlc.arg(connector_id) AND previous.reported_at <= sqlc.arg(reported_from)
+), sqlc.arg(reported_from))
+ORDER BY reported_at, id;
+
+-- name: ListLatestConnectorStatuses :many
+-- The last status reported for each connector of a charge point.
+SELECT * FROM connector_status AS latest
+WHERE tenant_id = sqlc.arg(tenant_id) AND serial_number = sqlc.arg(serial_number) AND id = (
+    SELECT id FROM connector_status AS previous
+    WHERE previous.tenant_id = latest.tenant_id AND previous.serial_number = latest.serial_number AND previous.connector_id = latest.connector_id
+    ORDER BY reported_at DESC, id DESC
+    LIMIT 1
+)
+ORDER BY connector_id;
+
+-- name: InsertChargeDetailRecord :one
+INSERT INTO charge_detail_record (
+    serial_number,
+    transaction_id,
+    connector_id,
+    id_tag,
+    started_at,
+    stopped_at,
+    duration_s,
+    meter_start,
+    meter_stop,
+    energy_wh,
+    sampled_energy_wh,
+    energy_check,
+    stop_reason,
+    charging_s,
+    idle_s,
+    created_at,
+    tariff_id,
+    currency,
+    start_fee,
+    energy_cost,
+    time_cost,
+    idle_cost,
+    total_cost,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+ON CONFLICT (serial_number, transaction_id) DO NOTHING
+RETURNING id;
+
+-- name: GetChargeDetailRecord :one
+SELECT * FROM charge_detail_record
+WHERE tenant_id = ? AND serial_number = ? AND transaction_id = ?;
+
+-- name: ListChargeDetailRecords :many
+SELECT * FROM charge_detail_record
+WHERE tenant_id = sqlc.arg(tenant_id)
+AND (sqlc.narg(serial_number) IS NULL OR serial_number = sqlc.narg(serial_number))
+AND (sqlc.narg(serial_numbers) IS NULL OR serial_number IN (SELECT value FROM json_each(sqlc.narg(serial_numbers))))
+AND (sqlc.narg(stopped_from) IS NULL OR stopped_at >= sqlc.narg(stopped_from))
+AND (sqlc.narg(stopped_to) IS NULL OR stopped_at < sqlc.narg(stopped_to))
+AND (sqlc.narg(created_from) IS NULL OR created_at >= sqlc.narg(created_from))
+AND (sqlc.narg(created_to) IS NULL OR created_at < sqlc.narg(created_to))
+ORDER BY stopped_at, id
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountChargeDetailRecords :one
+SELECT COUNT(*) FROM charge_detail_record
+WHERE tenant_id = sqlc.arg(tenant_id)
+AND (sqlc.narg(serial_number) IS NULL OR serial_number = sqlc.narg(serial_number))
+AND (sqlc.narg(serial_numbers) IS NULL OR serial_number IN (SELECT value FROM json_each(sqlc.narg(serial_numbers))))
+AND (sqlc.narg(stopped_from) IS NULL OR stopped_at >= sqlc.narg(stopped_from))
+AND (sqlc.narg(stopped_to) IS NULL OR stopped_at < sqlc.narg(stopped_to))
+AND (sqlc.narg(created_from) IS NULL OR created_at >= sqlc.narg(created_from))
+AND (sqlc.narg(created_to) IS NULL OR created_at < sqlc.narg(created_to));
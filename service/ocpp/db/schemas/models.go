@@ -9,16 +9,173 @@ import (
 	"time"
 )
 
+type BootHistory struct {
+	ID                      int64
+	SerialNumber            string
+	Model                   string
+	Vendor                  string
+	FirmwareVersion         string
+	PreviousFirmwareVersion sql.NullString
+	BootedAt                time.Time
+	TenantID                string
+}
+
+type ChargeDetailRecord struct {
+	ID              int64
+	SerialNumber    string
+	TransactionID   int64
+	ConnectorID     int64
+	IdTag           string
+	StartedAt       time.Time
+	StoppedAt       time.Time
+	DurationS       int64
+	MeterStart      int64
+	MeterStop       int64
+	EnergyWh        int64
+	SampledEnergyWh sql.NullInt64
+	EnergyCheck     string
+	StopReason      string
+	ChargingS       int64
+	IdleS           int64
+	CreatedAt       time.Time
+	TariffID        sql.NullString
+	Currency        sql.NullString
+	StartFee        sql.NullString
+	EnergyCost      sql.NullString
+	TimeCost        sql.NullString
+	IdleCost        sql.NullString
+	TotalCost       sql.NullString
+	TenantID        string
+}
+
+type ChargeTransaction struct {
+	ID           int64
+	SerialNumber string
+	ConnectorID  int64
+	IdTag        string
+	MeterStart   int64
+	StartedAt    time.Time
+	MeterStop    sql.NullInt64
+	StoppedAt    sql.NullTime
+	StopReason   sql.NullString
+	TenantID     string
+}
+
 type Chargepoint struct {
-	SerialNumber      string
-	Model             string
-	Vendor            string
-	FirmwareVersion   string
-	Iicid             sql.NullString
-	Imsi              sql.NullString
-	MeterSerialNumber sql.NullString
-	MeterType         sql.NullString
-	LastBoot          time.Time
-	LastHeartbeat     sql.NullTime
-	LastConnected     sql.NullTime
+	SerialNumber            string
+	Model                   string
+	Vendor                  string
+	FirmwareVersion         string
+	Iicid                   sql.NullString
+	Imsi                    sql.NullString
+	MeterSerialNumber       sql.NullString
+	MeterType               sql.NullString
+	LastBoot                time.Time
+	LastHeartbeat           sql.NullTime
+	LastConnected           sql.NullTime
+	ChargeBoxSerialNumber   sql.NullString
+	ChargePointSerialNumber sql.NullString
+	TenantID                string
+}
+
+type ConnectorStatus struct {
+	ID           int64
+	SerialNumber string
+	ConnectorID  int64
+	Status       string
+	ErrorCode    string
+	Info         sql.NullString
+	ReportedAt   time.Time
+	TenantID     string
+}
+
+type DataQualityFinding struct {
+	ID           int64
+	SerialNumber string
+	Kind         string
+	Field        string
+	Value        string
+	FirstSeenAt  time.Time
+	LastSeenAt   time.Time
+	Occurrences  int64
+	TenantID     string
+}
+
+type MessageJournal struct {
+	ID           int64
+	Direction    string
+	SerialNumber string
+	MessageID    sql.NullString
+	Action       sql.NullString
+	TypeID       sql.NullInt64
+	Body         []byte
+	TraceID      sql.NullString
+	Outcome      string
+	Error        sql.NullString
+	LatencyUs    int64
+	RecordedAt   time.Time
+	TenantID     string
+}
+
+type MeterSample struct {
+	ID            int64
+	SerialNumber  string
+	TransactionID int64
+	ConnectorID   int64
+	Context       sql.NullString
+	RegisterWh    int64
+	SampledAt     time.Time
+	TenantID      string
+}
+
+type Outbox struct {
+	ID           int64
+	Kind         string
+	Destination  string
+	Payload      []byte
+	Properties   string
+	CreatedAt    time.Time
+	SentAt       sql.NullTime
+	Attempts     int64
+	LastError    sql.NullString
+	ParkedAt     sql.NullTime
+	ClaimedUntil sql.NullTime
+	TenantID     string
+	SerialNumber string
+}
+
+type ProcessedMessage struct {
+	MessageID   string
+	ProcessedAt time.Time
+	TenantID    string
+}
+
+type Quarantine struct {
+	ID            int64
+	MessageID     string
+	SerialNumber  sql.NullString
+	Topic         string
+	Subscription  string
+	ContentType   sql.NullString
+	Properties    string
+	Body          []byte
+	Error         string
+	ErrorClass    string
+	Attempts      int64
+	QuarantinedAt time.Time
+	RedrivenAt    sql.NullTime
+	TenantID      string
+}
+
+type WebhookDelivery struct {
+	ID          int64
+	EventID     string
+	EventType   string
+	Url         string
+	StatusCode  sql.NullInt64
+	Attempts    int64
+	Error       sql.NullString
+	CreatedAt   time.Time
+	DeliveredAt sql.NullTime
+	TenantID    string
 }
@@ -11,7 +11,1558 @@ import (
 	"time"
 )
 
-const insertChargepoint = `-- name: InsertChargepoint :one
+const claimOutboxMessages = `-- name: ClaimOutboxMessages :many
+UPDATE outbox
+SET claimed_until = ?
+WHERE id IN (
+    SELECT id FROM outbox pending
+    WHERE sent_at IS NULL AND parked_at IS NULL AND (claimed_until IS NULL OR claimed_until < ?)
+    AND NOT EXISTS (
+        SELECT 1 FROM outbox earlier
+        WHERE earlier.tenant_id = pending.tenant_id AND earlier.serial_number = pending.serial_number
+        AND earlier.id < pending.id AND earlier.sent_at IS NULL AND earlier.parked_at IS NULL
+    )
+    ORDER BY id
+    LIMIT ?
+)
+RETURNING id, kind, destination, payload, properties, created_at, sent_at, attempts, last_error, parked_at, claimed_until, tenant_id, serial_number
+`
+
+type ClaimOutboxMessagesParams struct {
+	ClaimedUntil sql.NullTime
+	Now          sql.NullTime
+	Limit        int64
+}
+
+func (q *Queries) ClaimOutboxMessages(ctx context.Context, arg ClaimOutboxMessagesParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, claimOutboxMessages, arg.ClaimedUntil, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kind,
+			&i.Destination,
+			&i.Payload,
+			&i.Properties,
+			&i.CreatedAt,
+			&i.SentAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.ParkedAt,
+			&i.ClaimedUntil,
+			&i.TenantID,
+			&i.SerialNumber,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countChargeDetailRecords = `-- name: CountChargeDetailRecords :one
+SELECT COUNT(*) FROM charge_detail_record
+WHERE tenant_id = ?
+AND (? IS NULL OR serial_number = ?)
+AND (? IS NULL OR serial_number IN (SELECT value FROM json_each(?)))
+AND (? IS NULL OR stopped_at >= ?)
+AND (? IS NULL OR stopped_at < ?)
+AND (? IS NULL OR created_at >= ?)
+AND (? IS NULL OR created_at < ?)
+`
+
+type CountChargeDetailRecordsParams struct {
+	TenantID      string
+	SerialNumber  sql.NullString
+	SerialNumbers interface{}
+	StoppedFrom   sql.NullTime
+	StoppedTo     sql.NullTime
+	CreatedFrom   sql.NullTime
+	CreatedTo     sql.NullTime
+}
+
+func (q *Queries) CountChargeDetailRecords(ctx context.Context, arg CountChargeDetailRecordsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChargeDetailRecords,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.SerialNumber,
+		arg.SerialNumbers,
+		arg.SerialNumbers,
+		arg.StoppedFrom,
+		arg.StoppedFrom,
+		arg.StoppedTo,
+		arg.StoppedTo,
+		arg.CreatedFrom,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.CreatedTo,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countTransactions = `-- name: CountTransactions :one
+SELECT COUNT(*) FROM charge_transaction
+WHERE tenant_id = ?
+AND (? IS NULL OR serial_number IN (SELECT value FROM json_each(?)))
+AND (? IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) >= ?)
+AND (? IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) < ?)
+`
+
+type CountTransactionsParams struct {
+	TenantID      string
+	SerialNumbers interface{}
+	UpdatedFrom   interface{}
+	UpdatedTo     interface{}
+}
+
+func (q *Queries) CountTransactions(ctx context.Context, arg CountTransactionsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTransactions,
+		arg.TenantID,
+		arg.SerialNumbers,
+		arg.SerialNumbers,
+		arg.UpdatedFrom,
+		arg.UpdatedFrom,
+		arg.UpdatedTo,
+		arg.UpdatedTo,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteSentOutboxMessages = `-- name: DeleteSentOutboxMessages :execrows
+DELETE FROM outbox
+WHERE sent_at IS NOT NULL AND sent_at < ?
+`
+
+func (q *Queries) DeleteSentOutboxMessages(ctx context.Context, sentAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteSentOutboxMessages, sentAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChargeDetailRecord = `-- name: GetChargeDetailRecord :one
+SELECT id, serial_number, transaction_id, connector_id, id_tag, started_at, stopped_at, duration_s, meter_start, meter_stop, energy_wh, sampled_energy_wh, energy_check, stop_reason, charging_s, idle_s, created_at, tariff_id, currency, start_fee, energy_cost, time_cost, idle_cost, total_cost, tenant_id FROM charge_detail_record
+WHERE tenant_id = ? AND serial_number = ? AND transaction_id = ?
+`
+
+type GetChargeDetailRecordParams struct {
+	TenantID      string
+	SerialNumber  string
+	TransactionID int64
+}
+
+func (q *Queries) GetChargeDetailRecord(ctx context.Context, arg GetChargeDetailRecordParams) (ChargeDetailRecord, error) {
+	row := q.db.QueryRowContext(ctx, getChargeDetailRecord,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.TransactionID,
+	)
+	var i ChargeDetailRecord
+	err := row.Scan(
+		&i.ID,
+		&i.SerialNumber,
+		&i.TransactionID,
+		&i.ConnectorID,
+		&i.IdTag,
+		&i.StartedAt,
+		&i.StoppedAt,
+		&i.DurationS,
+		&i.MeterStart,
+		&i.MeterStop,
+		&i.EnergyWh,
+		&i.SampledEnergyWh,
+		&i.EnergyCheck,
+		&i.StopReason,
+		&i.ChargingS,
+		&i.IdleS,
+		&i.CreatedAt,
+		&i.TariffID,
+		&i.Currency,
+		&i.StartFee,
+		&i.EnergyCost,
+		&i.TimeCost,
+		&i.IdleCost,
+		&i.TotalCost,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getChargepoint = `-- name: GetChargepoint :one
+SELECT serial_number, model, vendor, firmware_version, iicid, imsi, meter_serial_number, meter_type, last_boot, last_heartbeat, last_connected, charge_box_serial_number, charge_point_serial_number, tenant_id FROM chargepoint
+WHERE tenant_id = ? AND serial_number = ?
+`
+
+type GetChargepointParams struct {
+	TenantID     string
+	SerialNumber string
+}
+
+func (q *Queries) GetChargepoint(ctx context.Context, arg GetChargepointParams) (Chargepoint, error) {
+	row := q.db.QueryRowContext(ctx, getChargepoint, arg.TenantID, arg.SerialNumber)
+	var i Chargepoint
+	err := row.Scan(
+		&i.SerialNumber,
+		&i.Model,
+		&i.Vendor,
+		&i.FirmwareVersion,
+		&i.Iicid,
+		&i.Imsi,
+		&i.MeterSerialNumber,
+		&i.MeterType,
+		&i.LastBoot,
+		&i.LastHeartbeat,
+		&i.LastConnected,
+		&i.ChargeBoxSerialNumber,
+		&i.ChargePointSerialNumber,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getQuarantinedMessage = `-- name: GetQuarantinedMessage :one
+SELECT id, message_id, serial_number, topic, subscription, content_type, properties, body, error, error_class, attempts, quarantined_at, redriven_at, tenant_id FROM quarantine
+WHERE tenant_id = ? AND id = ?
+`
+
+type GetQuarantinedMessageParams struct {
+	TenantID string
+	ID       int64
+}
+
+func (q *Queries) GetQuarantinedMessage(ctx context.Context, arg GetQuarantinedMessageParams) (Quarantine, error) {
+	row := q.db.QueryRowContext(ctx, getQuarantinedMessage, arg.TenantID, arg.ID)
+	var i Quarantine
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.SerialNumber,
+		&i.Topic,
+		&i.Subscription,
+		&i.ContentType,
+		&i.Properties,
+		&i.Body,
+		&i.Error,
+		&i.ErrorClass,
+		&i.Attempts,
+		&i.QuarantinedAt,
+		&i.RedrivenAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getTransaction = `-- name: GetTransaction :one
+SELECT id, serial_number, connector_id, id_tag, meter_start, started_at, meter_stop, stopped_at, stop_reason, tenant_id FROM charge_transaction
+WHERE tenant_id = ? AND id = ? AND serial_number = ?
+`
+
+type GetTransactionParams struct {
+	TenantID     string
+	ID           int64
+	SerialNumber string
+}
+
+func (q *Queries) GetTransaction(ctx context.Context, arg GetTransactionParams) (ChargeTransaction, error) {
+	row := q.db.QueryRowContext(ctx, getTransaction,
+		arg.TenantID,
+		arg.ID,
+		arg.SerialNumber,
+	)
+	var i ChargeTransaction
+	err := row.Scan(
+		&i.ID,
+		&i.SerialNumber,
+		&i.ConnectorID,
+		&i.IdTag,
+		&i.MeterStart,
+		&i.StartedAt,
+		&i.MeterStop,
+		&i.StoppedAt,
+		&i.StopReason,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const insertBootHistory = `-- name: InsertBootHistory :one
+INSERT INTO boot_history (
+    serial_number,
+    model,
+    vendor,
+    firmware_version,
+    previous_firmware_version,
+    booted_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?)
+RETURNING id
+`
+
+type InsertBootHistoryParams struct {
+	SerialNumber            string
+	Model                   string
+	Vendor                  string
+	FirmwareVersion         string
+	PreviousFirmwareVersion sql.NullString
+	BootedAt                time.Time
+	TenantID                string
+}
+
+func (q *Queries) InsertBootHistory(ctx context.Context, arg InsertBootHistoryParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, insertBootHistory,
+		arg.SerialNumber,
+		arg.Model,
+		arg.Vendor,
+		arg.FirmwareVersion,
+		arg.PreviousFirmwareVersion,
+		arg.BootedAt,
+		arg.TenantID,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertChargeDetailRecord = `-- name: InsertChargeDetailRecord :one
+INSERT INTO charge_detail_record (
+    serial_number,
+    transaction_id,
+    connector_id,
+    id_tag,
+    started_at,
+    stopped_at,
+    duration_s,
+    meter_start,
+    meter_stop,
+    energy_wh,
+    sampled_energy_wh,
+    energy_check,
+    stop_reason,
+    charging_s,
+    idle_s,
+    created_at,
+    tariff_id,
+    currency,
+    start_fee,
+    energy_cost,
+    time_cost,
+    idle_cost,
+    total_cost,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+ON CONFLICT (serial_number, transaction_id) DO NOTHING
+RETURNING id
+`
+
+type InsertChargeDetailRecordParams struct {
+	SerialNumber    string
+	TransactionID   int64
+	ConnectorID     int64
+	IdTag           string
+	StartedAt       time.Time
+	StoppedAt       time.Time
+	DurationS       int64
+	MeterStart      int64
+	MeterStop       int64
+	EnergyWh        int64
+	SampledEnergyWh sql.NullInt64
+	EnergyCheck     string
+	StopReason      string
+	ChargingS       int64
+	IdleS           int64
+	CreatedAt       time.Time
+	TariffID        sql.NullString
+	Currency        sql.NullString
+	StartFee        sql.NullString
+	EnergyCost      sql.NullString
+	TimeCost        sql.NullString
+	IdleCost        sql.NullString
+	TotalCost       sql.NullString
+	TenantID        string
+}
+
+func (q *Queries) InsertChargeDetailRecord(ctx context.Context, arg InsertChargeDetailRecordParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, insertChargeDetailRecord,
+		arg.SerialNumber,
+		arg.TransactionID,
+		arg.ConnectorID,
+		arg.IdTag,
+		arg.StartedAt,
+		arg.StoppedAt,
+		arg.DurationS,
+		arg.MeterStart,
+		arg.MeterStop,
+		arg.EnergyWh,
+		arg.SampledEnergyWh,
+		arg.EnergyCheck,
+		arg.StopReason,
+		arg.ChargingS,
+		arg.IdleS,
+		arg.CreatedAt,
+		arg.TariffID,
+		arg.Currency,
+		arg.StartFee,
+		arg.EnergyCost,
+		arg.TimeCost,
+		arg.IdleCost,
+		arg.TotalCost,
+		arg.TenantID,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertConnectorStatus = `-- name: InsertConnectorStatus :exec
+INSERT INTO connector_status (
+    serial_number,
+    connector_id,
+    status,
+    error_code,
+    info,
+    reported_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?)
+`
+
+type InsertConnectorStatusParams struct {
+	SerialNumber string
+	ConnectorID  int64
+	Status       string
+	ErrorCode    string
+	Info         sql.NullString
+	ReportedAt   time.Time
+	TenantID     string
+}
+
+func (q *Queries) InsertConnectorStatus(ctx context.Context, arg InsertConnectorStatusParams) error {
+	_, err := q.db.ExecContext(ctx, insertConnectorStatus,
+		arg.SerialNumber,
+		arg.ConnectorID,
+		arg.Status,
+		arg.ErrorCode,
+		arg.Info,
+		arg.ReportedAt,
+		arg.TenantID,
+	)
+	return err
+}
+
+const insertJournalEntry = `-- name: InsertJournalEntry :exec
+INSERT INTO message_journal (
+    direction,
+    serial_number,
+    message_id,
+    action,
+    type_id,
+    body,
+    trace_id,
+    outcome,
+    error,
+    latency_us,
+    recorded_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+`
+
+type InsertJournalEntryParams struct {
+	Direction    string
+	SerialNumber string
+	MessageID    sql.NullString
+	Action       sql.NullString
+	TypeID       sql.NullInt64
+	Body         []byte
+	TraceID      sql.NullString
+	Outcome      string
+	Error        sql.NullString
+	LatencyUs    int64
+	RecordedAt   time.Time
+	TenantID     string
+}
+
+func (q *Queries) InsertJournalEntry(ctx context.Context, arg InsertJournalEntryParams) error {
+	_, err := q.db.ExecContext(ctx, insertJournalEntry,
+		arg.Direction,
+		arg.SerialNumber,
+		arg.MessageID,
+		arg.Action,
+		arg.TypeID,
+		arg.Body,
+		arg.TraceID,
+		arg.Outcome,
+		arg.Error,
+		arg.LatencyUs,
+		arg.RecordedAt,
+		arg.TenantID,
+	)
+	return err
+}
+
+const insertMeterSample = `-- name: InsertMeterSample :exec
+INSERT INTO meter_sample (
+    serial_number,
+    transaction_id,
+    connector_id,
+    context,
+    register_wh,
+    sampled_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?)
+`
+
+type InsertMeterSampleParams struct {
+	SerialNumber  string
+	TransactionID int64
+	ConnectorID   int64
+	Context       sql.NullString
+	RegisterWh    int64
+	SampledAt     time.Time
+	TenantID      string
+}
+
+func (q *Queries) InsertMeterSample(ctx context.Context, arg InsertMeterSampleParams) error {
+	_, err := q.db.ExecContext(ctx, insertMeterSample,
+		arg.SerialNumber,
+		arg.TransactionID,
+		arg.ConnectorID,
+		arg.Context,
+		arg.RegisterWh,
+		arg.SampledAt,
+		arg.TenantID,
+	)
+	return err
+}
+
+const insertOutboxMessage = `-- name: InsertOutboxMessage :one
+INSERT INTO outbox (
+    kind,
+    destination,
+    payload,
+    properties,
+    created_at,
+    tenant_id,
+    serial_number
+) VALUES (?,?,?,?,?,?,?)
+RETURNING id
+`
+
+type InsertOutboxMessageParams struct {
+	Kind         string
+	Destination  string
+	Payload      []byte
+	Properties   string
+	CreatedAt    time.Time
+	TenantID     string
+	SerialNumber string
+}
+
+func (q *Queries) InsertOutboxMessage(ctx context.Context, arg InsertOutboxMessageParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, insertOutboxMessage,
+		arg.Kind,
+		arg.Destination,
+		arg.Payload,
+		arg.Properties,
+		arg.CreatedAt,
+		arg.TenantID,
+		arg.SerialNumber,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertProcessedMessage = `-- name: InsertProcessedMessage :one
+INSERT INTO processed_message (
+    message_id,
+    processed_at,
+    tenant_id
+) VALUES (?,?,?)
+ON CONFLICT (tenant_id, message_id) DO NOTHING
+RETURNING message_id
+`
+
+type InsertProcessedMessageParams struct {
+	MessageID   string
+	ProcessedAt time.Time
+	TenantID    string
+}
+
+func (q *Queries) InsertProcessedMessage(ctx context.Context, arg InsertProcessedMessageParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, insertProcessedMessage, arg.MessageID, arg.ProcessedAt, arg.TenantID)
+	var message_id string
+	err := row.Scan(&message_id)
+	return message_id, err
+}
+
+const insertQuarantinedMessage = `-- name: InsertQuarantinedMessage :one
+INSERT INTO quarantine (
+    message_id,
+    serial_number,
+    topic,
+    subscription,
+    content_type,
+    properties,
+    body,
+    error,
+    error_class,
+    attempts,
+    quarantined_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+RETURNING id
+`
+
+type InsertQuarantinedMessageParams struct {
+	MessageID     string
+	SerialNumber  sql.NullString
+	Topic         string
+	Subscription  string
+	ContentType   sql.NullString
+	Properties    string
+	Body          []byte
+	Error         string
+	ErrorClass    string
+	Attempts      int64
+	QuarantinedAt time.Time
+	TenantID      string
+}
+
+func (q *Queries) InsertQuarantinedMessage(ctx context.Context, arg InsertQuarantinedMessageParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, insertQuarantinedMessage,
+		arg.MessageID,
+		arg.SerialNumber,
+		arg.Topic,
+		arg.Subscription,
+		arg.ContentType,
+		arg.Properties,
+		arg.Body,
+		arg.Error,
+		arg.ErrorClass,
+		arg.Attempts,
+		arg.QuarantinedAt,
+		arg.TenantID,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertTransaction = `-- name: InsertTransaction :one
+INSERT INTO charge_transaction (
+    serial_number,
+    connector_id,
+    id_tag,
+    meter_start,
+    started_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?)
+RETURNING id
+`
+
+type InsertTransactionParams struct {
+	SerialNumber string
+	ConnectorID  int64
+	IdTag        string
+	MeterStart   int64
+	StartedAt    time.Time
+	TenantID     string
+}
+
+func (q *Queries) InsertTransaction(ctx context.Context, arg InsertTransactionParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, insertTransaction,
+		arg.SerialNumber,
+		arg.ConnectorID,
+		arg.IdTag,
+		arg.MeterStart,
+		arg.StartedAt,
+		arg.TenantID,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertWebhookDelivery = `-- name: InsertWebhookDelivery :one
+INSERT INTO webhook_delivery (
+    event_id,
+    event_type,
+    url,
+    status_code,
+    attempts,
+    error,
+    created_at,
+    delivered_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?)
+RETURNING id
+`
+
+type InsertWebhookDeliveryParams struct {
+	EventID     string
+	EventType   string
+	Url         string
+	StatusCode  sql.NullInt64
+	Attempts    int64
+	Error       sql.NullString
+	CreatedAt   time.Time
+	DeliveredAt sql.NullTime
+	TenantID    string
+}
+
+func (q *Queries) InsertWebhookDelivery(ctx context.Context, arg InsertWebhookDeliveryParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, insertWebhookDelivery,
+		arg.EventID,
+		arg.EventType,
+		arg.Url,
+		arg.StatusCode,
+		arg.Attempts,
+		arg.Error,
+		arg.CreatedAt,
+		arg.DeliveredAt,
+		arg.TenantID,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const listBootHistory = `-- name: ListBootHistory :many
+SELECT id, serial_number, model, vendor, firmware_version, previous_firmware_version, booted_at, tenant_id FROM boot_history
+WHERE tenant_id = ? AND serial_number = ?
+ORDER BY booted_at DESC, id DESC
+LIMIT ?
+`
+
+type ListBootHistoryParams struct {
+	TenantID     string
+	SerialNumber string
+	Limit        int64
+}
+
+func (q *Queries) ListBootHistory(ctx context.Context, arg ListBootHistoryParams) ([]BootHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listBootHistory,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BootHistory
+	for rows.Next() {
+		var i BootHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.SerialNumber,
+			&i.Model,
+			&i.Vendor,
+			&i.FirmwareVersion,
+			&i.PreviousFirmwareVersion,
+			&i.BootedAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChargeDetailRecords = `-- name: ListChargeDetailRecords :many
+SELECT id, serial_number, transaction_id, connector_id, id_tag, started_at, stopped_at, duration_s, meter_start, meter_stop, energy_wh, sampled_energy_wh, energy_check, stop_reason, charging_s, idle_s, created_at, tariff_id, currency, start_fee, energy_cost, time_cost, idle_cost, total_cost, tenant_id FROM charge_detail_record
+WHERE tenant_id = ?
+AND (? IS NULL OR serial_number = ?)
+AND (? IS NULL OR serial_number IN (SELECT value FROM json_each(?)))
+AND (? IS NULL OR stopped_at >= ?)
+AND (? IS NULL OR stopped_at < ?)
+AND (? IS NULL OR created_at >= ?)
+AND (? IS NULL OR created_at < ?)
+ORDER BY stopped_at, id
+LIMIT ? OFFSET ?
+`
+
+type ListChargeDetailRecordsParams struct {
+	TenantID      string
+	SerialNumber  sql.NullString
+	SerialNumbers interface{}
+	StoppedFrom   sql.NullTime
+	StoppedTo     sql.NullTime
+	CreatedFrom   sql.NullTime
+	CreatedTo     sql.NullTime
+	Limit         int64
+	Offset        int64
+}
+
+func (q *Queries) ListChargeDetailRecords(ctx context.Context, arg ListChargeDetailRecordsParams) ([]ChargeDetailRecord, error) {
+	rows, err := q.db.QueryContext(ctx, listChargeDetailRecords,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.SerialNumber,
+		arg.SerialNumbers,
+		arg.SerialNumbers,
+		arg.StoppedFrom,
+		arg.StoppedFrom,
+		arg.StoppedTo,
+		arg.StoppedTo,
+		arg.CreatedFrom,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.CreatedTo,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChargeDetailRecord
+	for rows.Next() {
+		var i ChargeDetailRecord
+		if err := rows.Scan(
+			&i.ID,
+			&i.SerialNumber,
+			&i.TransactionID,
+			&i.ConnectorID,
+			&i.IdTag,
+			&i.StartedAt,
+			&i.StoppedAt,
+			&i.DurationS,
+			&i.MeterStart,
+			&i.MeterStop,
+			&i.EnergyWh,
+			&i.SampledEnergyWh,
+			&i.EnergyCheck,
+			&i.StopReason,
+			&i.ChargingS,
+			&i.IdleS,
+			&i.CreatedAt,
+			&i.TariffID,
+			&i.Currency,
+			&i.StartFee,
+			&i.EnergyCost,
+			&i.TimeCost,
+			&i.IdleCost,
+			&i.TotalCost,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConnectorStatuses = `-- name: ListConnectorStatuses :many
+SELECT id, serial_number, connector_id, status, error_code, info, reported_at, tenant_id FROM connector_status
+WHERE tenant_id = ? AND serial_number = ? AND connector_id = ?
+AND reported_at < ?
+AND reported_at >= COALESCE((
+    SELECT MAX(reported_at) FROM connector_status AS previous
+    WHERE previous.tenant_id = ? AND previous.serial_number = ? AND previous.connector_id = ? AND previous.reported_at <= ?
+), ?)
+ORDER BY reported_at, id
+`
+
+type ListConnectorStatusesParams struct {
+	TenantID     string
+	SerialNumber string
+	ConnectorID  int64
+	ReportedTo   time.Time
+	ReportedFrom time.Time
+}
+
+func (q *Queries) ListConnectorStatuses(ctx context.Context, arg ListConnectorStatusesParams) ([]ConnectorStatus, error) {
+	rows, err := q.db.QueryContext(ctx, listConnectorStatuses,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.ConnectorID,
+		arg.ReportedTo,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.ConnectorID,
+		arg.ReportedFrom,
+		arg.ReportedFrom,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ConnectorStatus
+	for rows.Next() {
+		var i ConnectorStatus
+		if err := rows.Scan(
+			&i.ID,
+			&i.SerialNumber,
+			&i.ConnectorID,
+			&i.Status,
+			&i.ErrorCode,
+			&i.Info,
+			&i.ReportedAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDataQualityFindings = `-- name: ListDataQualityFindings :many
+SELECT id, serial_number, kind, field, value, first_seen_at, last_seen_at, occurrences, tenant_id FROM data_quality_finding
+WHERE tenant_id = ?
+ORDER BY last_seen_at DESC, id DESC
+LIMIT ?
+`
+
+type ListDataQualityFindingsParams struct {
+	TenantID string
+	Limit    int64
+}
+
+func (q *Queries) ListDataQualityFindings(ctx context.Context, arg ListDataQualityFindingsParams) ([]DataQualityFinding, error) {
+	rows, err := q.db.QueryContext(ctx, listDataQualityFindings, arg.TenantID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DataQualityFinding
+	for rows.Next() {
+		var i DataQualityFinding
+		if err := rows.Scan(
+			&i.ID,
+			&i.SerialNumber,
+			&i.Kind,
+			&i.Field,
+			&i.Value,
+			&i.FirstSeenAt,
+			&i.LastSeenAt,
+			&i.Occurrences,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listJournalEntries = `-- name: ListJournalEntries :many
+SELECT id, direction, serial_number, message_id, action, type_id, body, trace_id, outcome, error, latency_us, recorded_at, tenant_id FROM message_journal
+WHERE tenant_id = ?
+AND (? IS NULL OR serial_number = ?)
+AND (? IS NULL OR action = ?)
+AND (? IS NULL OR recorded_at >= ?)
+AND (? IS NULL OR recorded_at < ?)
+ORDER BY recorded_at, id
+LIMIT ?
+`
+
+type ListJournalEntriesParams struct {
+	TenantID     string
+	SerialNumber sql.NullString
+	Action       sql.NullString
+	RecordedFrom sql.NullTime
+	RecordedTo   sql.NullTime
+	Limit        int64
+}
+
+func (q *Queries) ListJournalEntries(ctx context.Context, arg ListJournalEntriesParams) ([]MessageJournal, error) {
+	rows, err := q.db.QueryContext(ctx, listJournalEntries,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.SerialNumber,
+		arg.Action,
+		arg.Action,
+		arg.RecordedFrom,
+		arg.RecordedFrom,
+		arg.RecordedTo,
+		arg.RecordedTo,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MessageJournal
+	for rows.Next() {
+		var i MessageJournal
+		if err := rows.Scan(
+			&i.ID,
+			&i.Direction,
+			&i.SerialNumber,
+			&i.MessageID,
+			&i.Action,
+			&i.TypeID,
+			&i.Body,
+			&i.TraceID,
+			&i.Outcome,
+			&i.Error,
+			&i.LatencyUs,
+			&i.RecordedAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLatestConnectorStatuses = `-- name: ListLatestConnectorStatuses :many
+SELECT id, serial_number, connector_id, status, error_code, info, reported_at, tenant_id FROM connector_status AS latest
+WHERE tenant_id = ? AND serial_number = ? AND id = (
+    SELECT id FROM connector_status AS previous
+    WHERE previous.tenant_id = latest.tenant_id AND previous.serial_number = latest.serial_number AND previous.connector_id = latest.connector_id
+    ORDER BY reported_at DESC, id DESC
+    LIMIT 1
+)
+ORDER BY connector_id
+`
+
+type ListLatestConnectorStatusesParams struct {
+	TenantID     string
+	SerialNumber string
+}
+
+func (q *Queries) ListLatestConnectorStatuses(ctx context.Context, arg ListLatestConnectorStatusesParams) ([]ConnectorStatus, error) {
+	rows, err := q.db.QueryContext(ctx, listLatestConnectorStatuses, arg.TenantID, arg.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ConnectorStatus
+	for rows.Next() {
+		var i ConnectorStatus
+		if err := rows.Scan(
+			&i.ID,
+			&i.SerialNumber,
+			&i.ConnectorID,
+			&i.Status,
+			&i.ErrorCode,
+			&i.Info,
+			&i.ReportedAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMeterSamples = `-- name: ListMeterSamples :many
+SELECT id, serial_number, transaction_id, connector_id, context, register_wh, sampled_at, tenant_id FROM meter_sample
+WHERE tenant_id = ? AND serial_number = ? AND transaction_id = ?
+ORDER BY sampled_at, id
+`
+
+type ListMeterSamplesParams struct {
+	TenantID      string
+	SerialNumber  string
+	TransactionID int64
+}
+
+func (q *Queries) ListMeterSamples(ctx context.Context, arg ListMeterSamplesParams) ([]MeterSample, error) {
+	rows, err := q.db.QueryContext(ctx, listMeterSamples,
+		arg.TenantID,
+		arg.SerialNumber,
+		arg.TransactionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MeterSample
+	for rows.Next() {
+		var i MeterSample
+		if err := rows.Scan(
+			&i.ID,
+			&i.SerialNumber,
+			&i.TransactionID,
+			&i.ConnectorID,
+			&i.Context,
+			&i.RegisterWh,
+			&i.SampledAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listParkedOutboxMessages = `-- name: ListParkedOutboxMessages :many
+SELECT id, kind, destination, payload, properties, created_at, sent_at, attempts, last_error, parked_at, claimed_until, tenant_id, serial_number FROM outbox
+WHERE tenant_id = ? AND sent_at IS NULL AND parked_at IS NOT NULL
+ORDER BY parked_at, id
+LIMIT ?
+`
+
+type ListParkedOutboxMessagesParams struct {
+	TenantID string
+	Limit    int64
+}
+
+func (q *Queries) ListParkedOutboxMessages(ctx context.Context, arg ListParkedOutboxMessagesParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, listParkedOutboxMessages, arg.TenantID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kind,
+			&i.Destination,
+			&i.Payload,
+			&i.Properties,
+			&i.CreatedAt,
+			&i.SentAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.ParkedAt,
+			&i.ClaimedUntil,
+			&i.TenantID,
+			&i.SerialNumber,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listQuarantinedMessages = `-- name: ListQuarantinedMessages :many
+SELECT id, message_id, serial_number, topic, subscription, content_type, properties, body, error, error_class, attempts, quarantined_at, redriven_at, tenant_id FROM quarantine
+WHERE tenant_id = ? AND redriven_at IS NULL
+ORDER BY quarantined_at
+LIMIT ?
+`
+
+type ListQuarantinedMessagesParams struct {
+	TenantID string
+	Limit    int64
+}
+
+func (q *Queries) ListQuarantinedMessages(ctx context.Context, arg ListQuarantinedMessagesParams) ([]Quarantine, error) {
+	rows, err := q.db.QueryContext(ctx, listQuarantinedMessages, arg.TenantID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Quarantine
+	for rows.Next() {
+		var i Quarantine
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.SerialNumber,
+			&i.Topic,
+			&i.Subscription,
+			&i.ContentType,
+			&i.Properties,
+			&i.Body,
+			&i.Error,
+			&i.ErrorClass,
+			&i.Attempts,
+			&i.QuarantinedAt,
+			&i.RedrivenAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTransactions = `-- name: ListTransactions :many
+SELECT id, serial_number, connector_id, id_tag, meter_start, started_at, meter_stop, stopped_at, stop_reason, tenant_id FROM charge_transaction
+WHERE tenant_id = ?
+AND (? IS NULL OR serial_number IN (SELECT value FROM json_each(?)))
+AND (? IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) >= ?)
+AND (? IS NULL OR COALESCE(stopped_at, (
+    SELECT MAX(sampled_at) FROM meter_sample
+    WHERE meter_sample.serial_number = charge_transaction.serial_number AND meter_sample.transaction_id = charge_transaction.id
+), started_at) < ?)
+ORDER BY id
+LIMIT ? OFFSET ?
+`
+
+type ListTransactionsParams struct {
+	TenantID      string
+	SerialNumbers interface{}
+	UpdatedFrom   interface{}
+	UpdatedTo     interface{}
+	Limit         int64
+	Offset        int64
+}
+
+func (q *Queries) ListTransactions(ctx context.Context, arg ListTransactionsParams) ([]ChargeTransaction, error) {
+	rows, err := q.db.QueryContext(ctx, listTransactions,
+		arg.TenantID,
+		arg.SerialNumbers,
+		arg.SerialNumbers,
+		arg.UpdatedFrom,
+		arg.UpdatedFrom,
+		arg.UpdatedTo,
+		arg.UpdatedTo,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChargeTransaction
+	for rows.Next() {
+		var i ChargeTransaction
+		if err := rows.Scan(
+			&i.ID,
+			&i.SerialNumber,
+			&i.ConnectorID,
+			&i.IdTag,
+			&i.MeterStart,
+			&i.StartedAt,
+			&i.MeterStop,
+			&i.StoppedAt,
+			&i.StopReason,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnsentOutboxMessages = `-- name: ListUnsentOutboxMessages :many
+SELECT id, kind, destination, payload, properties, created_at, sent_at, attempts, last_error, parked_at, claimed_until, tenant_id, serial_number FROM outbox
+WHERE tenant_id = ? AND sent_at IS NULL AND parked_at IS NULL
+ORDER BY id
+LIMIT ?
+`
+
+type ListUnsentOutboxMessagesParams struct {
+	TenantID string
+	Limit    int64
+}
+
+func (q *Queries) ListUnsentOutboxMessages(ctx context.Context, arg ListUnsentOutboxMessagesParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, listUnsentOutboxMessages, arg.TenantID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kind,
+			&i.Destination,
+			&i.Payload,
+			&i.Properties,
+			&i.CreatedAt,
+			&i.SentAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.ParkedAt,
+			&i.ClaimedUntil,
+			&i.TenantID,
+			&i.SerialNumber,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, event_id, event_type, url, status_code, attempts, error, created_at, delivered_at, tenant_id FROM webhook_delivery
+WHERE tenant_id = ?
+ORDER BY id DESC
+LIMIT ?
+`
+
+type ListWebhookDeliveriesParams struct {
+	TenantID string
+	Limit    int64
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries, arg.TenantID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventID,
+			&i.EventType,
+			&i.Url,
+			&i.StatusCode,
+			&i.Attempts,
+			&i.Error,
+			&i.CreatedAt,
+			&i.DeliveredAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markOutboxMessageFailed = `-- name: MarkOutboxMessageFailed :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = ?, claimed_until = NULL
+WHERE id = ?
+`
+
+type MarkOutboxMessageFailedParams struct {
+	LastError sql.NullString
+	ID        int64
+}
+
+func (q *Queries) MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markOutboxMessageFailed, arg.LastError, arg.ID)
+	return err
+}
+
+const markOutboxMessageSent = `-- name: MarkOutboxMessageSent :exec
+UPDATE outbox
+SET sent_at = ?, attempts = attempts + 1, last_error = NULL
+WHERE id = ?
+`
+
+type MarkOutboxMessageSentParams struct {
+	SentAt sql.NullTime
+	ID     int64
+}
+
+func (q *Queries) MarkOutboxMessageSent(ctx context.Context, arg MarkOutboxMessageSentParams) error {
+	_, err := q.db.ExecContext(ctx, markOutboxMessageSent, arg.SentAt, arg.ID)
+	return err
+}
+
+const markQuarantinedMessageRedriven = `-- name: MarkQuarantinedMessageRedriven :one
+UPDATE quarantine
+SET redriven_at = ?
+WHERE tenant_id = ? AND id = ? AND redriven_at IS NULL
+RETURNING id
+`
+
+type MarkQuarantinedMessageRedrivenParams struct {
+	RedrivenAt sql.NullTime
+	TenantID   string
+	ID         int64
+}
+
+func (q *Queries) MarkQuarantinedMessageRedriven(ctx context.Context, arg MarkQuarantinedMessageRedrivenParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, markQuarantinedMessageRedriven, arg.RedrivenAt, arg.TenantID, arg.ID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const parkOutboxMessage = `-- name: ParkOutboxMessage :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = ?, parked_at = ?
+WHERE id = ?
+`
+
+type ParkOutboxMessageParams struct {
+	LastError sql.NullString
+	ParkedAt  sql.NullTime
+	ID        int64
+}
+
+func (q *Queries) ParkOutboxMessage(ctx context.Context, arg ParkOutboxMessageParams) error {
+	_, err := q.db.ExecContext(ctx, parkOutboxMessage, arg.LastError, arg.ParkedAt, arg.ID)
+	return err
+}
+
+const stopTransaction = `-- name: StopTransaction :one
+UPDATE charge_transaction
+SET meter_stop = ?, stopped_at = ?, stop_reason = ?
+WHERE tenant_id = ? AND id = ? AND serial_number = ? AND stopped_at IS NULL
+RETURNING id
+`
+
+type StopTransactionParams struct {
+	MeterStop    sql.NullInt64
+	StoppedAt    sql.NullTime
+	StopReason   sql.NullString
+	TenantID     string
+	ID           int64
+	SerialNumber string
+}
+
+func (q *Queries) StopTransaction(ctx context.Context, arg StopTransactionParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, stopTransaction,
+		arg.MeterStop,
+		arg.StoppedAt,
+		arg.StopReason,
+		arg.TenantID,
+		arg.ID,
+		arg.SerialNumber,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const unparkOutboxMessage = `-- name: UnparkOutboxMessage :one
+UPDATE outbox
+SET parked_at = NULL, attempts = 0, claimed_until = NULL
+WHERE tenant_id = ? AND id = ? AND sent_at IS NULL AND parked_at IS NOT NULL
+RETURNING id
+`
+
+type UnparkOutboxMessageParams struct {
+	TenantID string
+	ID       int64
+}
+
+func (q *Queries) UnparkOutboxMessage(ctx context.Context, arg UnparkOutboxMessageParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, unparkOutboxMessage, arg.TenantID, arg.ID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const updateChargepointLastHeartbeat = `-- name: UpdateChargepointLastHeartbeat :one
+UPDATE chargepoint 
+SET last_heartbeat = ?
+WHERE tenant_id = ? AND serial_number = ?
+RETURNING serial_number
+`
+
+type UpdateChargepointLastHeartbeatParams struct {
+	LastHeartbeat sql.NullTime
+	TenantID      string
+	SerialNumber  string
+}
+
+func (q *Queries) UpdateChargepointLastHeartbeat(ctx context.Context, arg UpdateChargepointLastHeartbeatParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, updateChargepointLastHeartbeat,
+		arg.LastHeartbeat,
+		arg.TenantID,
+		arg.SerialNumber,
+	)
+	var serial_number string
+	err := row.Scan(&serial_number)
+	return serial_number, err
+}
+
+const upsertChargepoint = `-- name: UpsertChargepoint :one
 INSERT INTO chargepoint (
     serial_number,
     model,
@@ -23,27 +1574,44 @@ INSERT INTO chargepoint (
     meter_type,
     last_boot,
     last_heartbeat,
-    last_connected
-) VALUES (?,?,?,?,?,?,?,?,?,?,?)
-RETURNING serial_number, model, vendor, firmware_version, iicid, imsi, meter_serial_number, meter_type, last_boot, last_heartbeat, last_connected
+    last_connected,
+    charge_box_serial_number,
+    charge_point_serial_number,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+ON CONFLICT (tenant_id, serial_number) DO UPDATE SET
+    model = excluded.model,
+    vendor = excluded.vendor,
+    firmware_version = excluded.firmware_version,
+    iicid = excluded.iicid,
+    imsi = excluded.imsi,
+    meter_serial_number = excluded.meter_serial_number,
+    meter_type = excluded.meter_type,
+    last_boot = excluded.last_boot,
+    charge_box_serial_number = excluded.charge_box_serial_number,
+    charge_point_serial_number = excluded.charge_point_serial_number
+RETURNING serial_number, model, vendor, firmware_version, iicid, imsi, meter_serial_number, meter_type, last_boot, last_heartbeat, last_connected, charge_box_serial_number, charge_point_serial_number, tenant_id
 `
 
-type InsertChargepointParams struct {
-	SerialNumber      string
-	Model             string
-	Vendor            string
-	FirmwareVersion   string
-	Iicid             sql.NullString
-	Imsi              sql.NullString
-	MeterSerialNumber sql.NullString
-	MeterType         sql.NullString
-	LastBoot          time.Time
-	LastHeartbeat     sql.NullTime
-	LastConnected     sql.NullTime
+type UpsertChargepointParams struct {
+	SerialNumber            string
+	Model                   string
+	Vendor                  string
+	FirmwareVersion         string
+	Iicid                   sql.NullString
+	Imsi                    sql.NullString
+	MeterSerialNumber       sql.NullString
+	MeterType               sql.NullString
+	LastBoot                time.Time
+	LastHeartbeat           sql.NullTime
+	LastConnected           sql.NullTime
+	ChargeBoxSerialNumber   sql.NullString
+	ChargePointSerialNumber sql.NullString
+	TenantID                string
 }
 
-func (q *Queries) InsertChargepoint(ctx context.Context, arg InsertChargepointParams) (Chargepoint, error) {
-	row := q.db.QueryRowContext(ctx, insertChargepoint,
+func (q *Queries) UpsertChargepoint(ctx context.Context, arg UpsertChargepointParams) (Chargepoint, error) {
+	row := q.db.QueryRowContext(ctx, upsertChargepoint,
 		arg.SerialNumber,
 		arg.Model,
 		arg.Vendor,
@@ -55,6 +1623,9 @@ func (q *Queries) InsertChargepoint(ctx context.Context, arg InsertChargepointPa
 		arg.LastBoot,
 		arg.LastHeartbeat,
 		arg.LastConnected,
+		arg.ChargeBoxSerialNumber,
+		arg.ChargePointSerialNumber,
+		arg.TenantID,
 	)
 	var i Chargepoint
 	err := row.Scan(
@@ -69,25 +1640,47 @@ func (q *Queries) InsertChargepoint(ctx context.Context, arg InsertChargepointPa
 		&i.LastBoot,
 		&i.LastHeartbeat,
 		&i.LastConnected,
+		&i.ChargeBoxSerialNumber,
+		&i.ChargePointSerialNumber,
+		&i.TenantID,
 	)
 	return i, err
 }
 
-const updateChargepointLastHeartbeat = `-- name: UpdateChargepointLastHeartbeat :one
-UPDATE chargepoint 
-SET last_heartbeat = ?
-WHERE serial_number = ?
-RETURNING serial_number
+const upsertDataQualityFinding = `-- name: UpsertDataQualityFinding :exec
+INSERT INTO data_quality_finding (
+    serial_number,
+    kind,
+    field,
+    value,
+    first_seen_at,
+    last_seen_at,
+    tenant_id
+) VALUES (?,?,?,?,?,?,?)
+ON CONFLICT (tenant_id, serial_number, kind, field, value) DO UPDATE SET
+    last_seen_at = excluded.last_seen_at,
+    occurrences = occurrences + 1
 `
 
-type UpdateChargepointLastHeartbeatParams struct {
-	LastHeartbeat sql.NullTime
-	SerialNumber  string
+type UpsertDataQualityFindingParams struct {
+	SerialNumber string
+	Kind         string
+	Field        string
+	Value        string
+	FirstSeenAt  time.Time
+	LastSeenAt   time.Time
+	TenantID     string
 }
 
-func (q *Queries) UpdateChargepointLastHeartbeat(ctx context.Context, arg UpdateChargepointLastHeartbeatParams) (string, error) {
-	row := q.db.QueryRowContext(ctx, updateChargepointLastHeartbeat, arg.LastHeartbeat, arg.SerialNumber)
-	var serial_number string
-	err := row.Scan(&serial_number)
-	return serial_number, err
+func (q *Queries) UpsertDataQualityFinding(ctx context.Context, arg UpsertDataQualityFindingParams) error {
+	_, err := q.db.ExecContext(ctx, upsertDataQualityFinding,
+		arg.SerialNumber,
+		arg.Kind,
+		arg.Field,
+		arg.Value,
+		arg.FirstSeenAt,
+		arg.LastSeenAt,
+		arg.TenantID,
+	)
+	return err
 }
@@ -0,0 +1,88 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+)
+
+// Types of the domain events published once an OCPP message has been processed, or a request went unanswered.
+const (
+	EventChargepointBooted  = "ocpp.chargepoint.booted"
+	EventFirmwareChanged    = "ocpp.chargepoint.firmware_changed"
+	EventTransactionStarted = "ocpp.transaction.started"
+	EventTransactionStopped = "ocpp.transaction.stopped"
+	EventStatusChanged      = "ocpp.connector.status_changed"
+	EventRequestTimedOut    = "ocpp.request.timed_out"
+	EventCdrCreated         = "ocpp.cdr.created"
+	EventCostEstimated      = "ocpp.transaction.cost_estimated"
+)
+
+// Represents something that happened to a charge point, derived from a processed OCPP message.
+type DomainEvent struct {
+	// Derived from the message id and the event type, so a redelivered message yields the same id.
+	Id           string
+	Type         string
+	Serialnumber string
+	OccurredAt   time.Time
+	Data         any
+	Tenant       string
+}
+
+// Publishes domain events to interested parties, e.g. webhooks.
+type EventPublisher interface {
+	Publish(ctx context.Context, event DomainEvent) error
+}
+
+// Represents the data of an EventChargepointBooted event.
+type ChargepointBooted struct {
+	Vendor          string `json:"vendor"`
+	Model           string `json:"model"`
+	FirmwareVersion string `json:"firmwareVersion"`
+}
+
+// Represents the data of an EventFirmwareChanged event, published when a charge point boots with a different firmware
+// version than on its previous boot.
+type FirmwareChanged struct {
+	PreviousFirmwareVersion string `json:"previousFirmwareVersion"`
+	FirmwareVersion         string `json:"firmwareVersion"`
+}
+
+// Represents the data of an EventTransactionStarted event.
+type TransactionStarted struct {
+	TransactionId int       `json:"transactionId"`
+	ConnectorId   int       `json:"connectorId"`
+	IdTag         string    `json:"idTag"`
+	MeterStart    int       `json:"meterStart"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// Represents the data of an EventTransactionStopped event.
+type TransactionStopped struct {
+	TransactionId int         `json:"transactionId"`
+	IdTag         string      `json:"idTag,omitempty"`
+	MeterStop     int         `json:"meterStop"`
+	Reason        core.Reason `json:"reason,omitempty"`
+	Timestamp     time.Time   `json:"timestamp"`
+}
+
+// Represents the data of an EventStatusChanged event.
+type StatusChanged struct {
+	ConnectorId int                       `json:"connectorId"`
+	Status      core.ChargePointStatus    `json:"status"`
+	ErrorCode   core.ChargePointErrorCode `json:"errorCode"`
+	Info        string                    `json:"info,omitempty"`
+	Timestamp   time.Time                 `json:"timestamp"`
+}
+
+// Represents the data of an EventRequestTimedOut event. Direction tells who did not answer: for cp-cs the Central System,
+// for cs-cp the Charge Point.
+type RequestTimedOut struct {
+	Uuid      string         `json:"uuid"`
+	Action    v16.ActionKind `json:"action"`
+	Direction v16.Direction  `json:"direction"`
+	SentAt    time.Time      `json:"sentAt"`
+	Deadline  time.Time      `json:"deadline"`
+}
@@ -0,0 +1,245 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type JournalOption func(*Journal)
+
+// Writes journal entries to the store in the background, so recording a frame does not wait for the database.
+// Entries are queued and appended in batches, once a batch is full or the flush interval passes. When the queue is
+// full, new entries are dropped rather than holding up the messages they belong to.
+type Journal struct {
+	tracer        trace.Tracer
+	store         JournalAdapter
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+
+	queue  chan JournalEntry
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// Ensures all required fields are set in the Journal.
+func (j *Journal) Validate() error {
+	if j.tracer == nil {
+		return fmt.Errorf("tracer provider is not set")
+	}
+	if j.store == nil {
+		return fmt.Errorf("journal store is not set")
+	}
+	return nil
+}
+
+func WithJournalTracerProvider(tp trace.TracerProvider) JournalOption {
+	return func(j *Journal) {
+		j.tracer = tp.Tracer("journal")
+	}
+}
+
+// Sets the store entries are appended to.
+func WithJournalStore(store JournalAdapter) JournalOption {
+	return func(j *Journal) {
+		j.store = store
+	}
+}
+
+// Sets how many entries may wait before new entries are dropped.
+func WithJournalQueueSize(size int) JournalOption {
+	return func(j *Journal) {
+		if size > 0 {
+			j.queueSize = size
+		}
+	}
+}
+
+// Sets how many entries are appended at once.
+func WithJournalBatchSize(size int) JournalOption {
+	return func(j *Journal) {
+		if size > 0 {
+			j.batchSize = size
+		}
+	}
+}
+
+// Sets how long entries may wait for their batch to fill before they are appended.
+func WithJournalFlushInterval(interval time.Duration) JournalOption {
+	return func(j *Journal) {
+		if interval > 0 {
+			j.flushInterval = interval
+		}
+	}
+}
+
+// Returns the options for the journal configuration.
+func JournalOptions(config utils.JournalConfiguration) []JournalOption {
+	return []JournalOption{
+		WithJournalQueueSize(config.QueueSize),
+		WithJournalBatchSize(config.BatchSize),
+		WithJournalFlushInterval(config.FlushInterval),
+	}
+}
+
+// Creates a new Journal and starts its writer.
+func NewJournal(opts ...JournalOption) *Journal {
+	journal := &Journal{
+		queueSize:     10000,
+		batchSize:     100,
+		flushInterval: time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(journal)
+	}
+
+	if err := journal.Validate(); err != nil {
+		slog.Error("Failed to create Journal", "error", err)
+		panic(err)
+	}
+
+	journal.queue = make(chan JournalEntry, journal.queueSize)
+	journal.done = make(chan struct{})
+	go journal.run()
+
+	return journal
+}
+
+// Queues the entry to be appended, setting when it was recorded if it is not set. Returns false if the journal is
+// closed or its queue is full, and the entry was dropped.
+func (j *Journal) Record(entry JournalEntry) bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if j.closed {
+		return false
+	}
+	if entry.RecordedAt.IsZero() {
+		entry.RecordedAt = time.Now()
+	}
+
+	select {
+	case j.queue <- entry:
+		return true
+	default:
+		slog.Warn("Journal queue is full, dropping entry",
+			"serialnumber", entry.Serialnumber,
+			"direction", entry.Direction,
+			"messageId", entry.MessageId,
+		)
+		return false
+	}
+}
+
+// Stops accepting entries and waits for the queued entries to be appended.
+func (j *Journal) Close(ctx context.Context) error {
+	j.mu.Lock()
+	if !j.closed {
+		j.closed = true
+		close(j.queue)
+	}
+	j.mu.Unlock()
+
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("queued journal entries were not appended: %w", ctx.Err())
+	}
+}
+
+// Collects queued entries into batches and appends them until the queue is closed and drained.
+func (j *Journal) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]JournalEntry, 0, j.batchSize)
+	for {
+		select {
+		case entry, ok := <-j.queue:
+			if !ok {
+				j.append(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= j.batchSize {
+				j.append(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			j.append(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// Appends a batch of entries, those of each tenant in the context of that tenant. Entries that fail are logged and
+// dropped, the journal does not hold up new entries for them.
+func (j *Journal) append(batch []JournalEntry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, span := j.tracer.Start(context.Background(), "Journal.Append", trace.WithAttributes(
+		attribute.Int("entries", len(batch)),
+	))
+	defer span.End()
+
+	var tenants []string
+	byTenant := make(map[string][]JournalEntry)
+	for _, entry := range batch {
+		if _, ok := byTenant[entry.Tenant]; !ok {
+			tenants = append(tenants, entry.Tenant)
+		}
+		byTenant[entry.Tenant] = append(byTenant[entry.Tenant], entry)
+	}
+
+	var failed error
+	for _, tenant := range tenants {
+		entries := byTenant[tenant]
+		if err := j.store.AppendJournal(WithTenant(ctx, tenant), entries); err != nil {
+			slog.Error("Failed to append journal entries", "error", err, "tenant", tenant, "entries", len(entries))
+			span.RecordError(err)
+			failed = err
+		}
+	}
+	if failed != nil {
+		span.SetStatus(codes.Error, failed.Error())
+		return
+	}
+	span.SetStatus(codes.Ok, "Journal entries appended")
+}
+
+// Returns a journal entry for an OCPP frame, with the message type id, message id and action read from it.
+// A frame that cannot be read is still journaled, with those fields left empty.
+func journalEntry(direction JournalDirection, serialnumber string, frame []byte) JournalEntry {
+	entry := JournalEntry{
+		Direction:    direction,
+		Serialnumber: serialnumber,
+		Body:         frame,
+	}
+
+	var arr []json.RawMessage
+	if err := json.Unmarshal(frame, &arr); err != nil || len(arr) < 2 {
+		return entry
+	}
+	_ = json.Unmarshal(arr[0], &entry.TypeId)
+	_ = json.Unmarshal(arr[1], &entry.MessageId)
+	if entry.TypeId == 2 && len(arr) > 2 {
+		_ = json.Unmarshal(arr[2], &entry.Action)
+	}
+	return entry
+}
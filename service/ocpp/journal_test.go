@@ -0,0 +1,173 @@
+package ocpp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Records the batches appended to the journal, blocking appends until unblock is closed when it is set.
+type batchingJournalStore struct {
+	mu      sync.Mutex
+	batches [][]JournalEntry
+	unblock chan struct{}
+}
+
+func (s *batchingJournalStore) AppendJournal(ctx context.Context, entries []JournalEntry) error {
+	if s.unblock != nil {
+		<-s.unblock
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]JournalEntry(nil), entries...))
+	return nil
+}
+
+func (s *batchingJournalStore) ListJournal(ctx context.Context, filter JournalFilter) ([]JournalEntry, error) {
+	return nil, nil
+}
+
+func (s *batchingJournalStore) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sizes := make([]int, len(s.batches))
+	for i, batch := range s.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	frame := []byte(`[2,"msg-1","Heartbeat",{}]`)
+
+	t.Run("AppendsOnClose", func(t *testing.T) {
+		store := NewMemoryStore(WithMemoryStoreTracerProvider(noop.NewTracerProvider()))
+		journal := NewJournal(
+			WithJournalTracerProvider(noop.NewTracerProvider()),
+			WithJournalStore(store),
+			WithJournalFlushInterval(time.Hour),
+		)
+
+		assert.True(t, journal.Record(journalEntry(JournalInbound, "charger-1", frame)))
+		assert.NoError(t, journal.Close(ctx))
+		assert.False(t, journal.Record(journalEntry(JournalInbound, "charger-1", frame)))
+
+		entries, err := store.ListJournal(ctx, JournalFilter{Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, "msg-1", entries[0].MessageId)
+			assert.False(t, entries[0].RecordedAt.IsZero())
+		}
+	})
+
+	t.Run("AppendsForTenant", func(t *testing.T) {
+		store := NewMemoryStore(WithMemoryStoreTracerProvider(noop.NewTracerProvider()))
+		journal := NewJournal(
+			WithJournalTracerProvider(noop.NewTracerProvider()),
+			WithJournalStore(store),
+			WithJournalFlushInterval(time.Hour),
+		)
+
+		for _, tenant := range []string{"operator-a", "", "operator-a"} {
+			entry := journalEntry(JournalInbound, "charger-1", frame)
+			entry.Tenant = tenant
+			assert.True(t, journal.Record(entry))
+		}
+		assert.NoError(t, journal.Close(ctx))
+
+		entries, err := store.ListJournal(WithTenant(ctx, "operator-a"), JournalFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		entries, err = store.ListJournal(ctx, JournalFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("Batches", func(t *testing.T) {
+		store := &batchingJournalStore{}
+		journal := NewJournal(
+			WithJournalTracerProvider(noop.NewTracerProvider()),
+			WithJournalStore(store),
+			WithJournalBatchSize(2),
+			WithJournalFlushInterval(time.Hour),
+		)
+
+		for range 5 {
+			assert.True(t, journal.Record(journalEntry(JournalInbound, "charger-1", frame)))
+		}
+		assert.NoError(t, journal.Close(ctx))
+		assert.Equal(t, []int{2, 2, 1}, store.sizes())
+	})
+
+	t.Run("FlushInterval", func(t *testing.T) {
+		store := &batchingJournalStore{}
+		journal := NewJournal(
+			WithJournalTracerProvider(noop.NewTracerProvider()),
+			WithJournalStore(store),
+			WithJournalFlushInterval(10*time.Millisecond),
+		)
+		defer journal.Close(ctx)
+
+		assert.True(t, journal.Record(journalEntry(JournalInbound, "charger-1", frame)))
+		assert.Eventually(t, func() bool {
+			return len(store.sizes()) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("DropsWhenFull", func(t *testing.T) {
+		store := &batchingJournalStore{unblock: make(chan struct{})}
+		journal := NewJournal(
+			WithJournalTracerProvider(noop.NewTracerProvider()),
+			WithJournalStore(store),
+			WithJournalQueueSize(1),
+			WithJournalBatchSize(1),
+		)
+
+		// The writer holds the first entry while its append is blocked, and the second fills the queue
+		assert.True(t, journal.Record(journalEntry(JournalInbound, "charger-1", frame)))
+		assert.Eventually(t, func() bool {
+			return journal.Record(journalEntry(JournalInbound, "charger-1", frame))
+		}, time.Second, time.Millisecond)
+		assert.False(t, journal.Record(journalEntry(JournalInbound, "charger-1", frame)))
+
+		close(store.unblock)
+		assert.NoError(t, journal.Close(ctx))
+		assert.Equal(t, []int{1, 1}, store.sizes())
+	})
+}
+
+func TestJournalEntry(t *testing.T) {
+	t.Run("Call", func(t *testing.T) {
+		entry := journalEntry(JournalInbound, "charger-1", []byte(`[2,"msg-1","BootNotification",{"chargePointModel":"Zappi"}]`))
+		assert.Equal(t, 2, entry.TypeId)
+		assert.Equal(t, "msg-1", entry.MessageId)
+		assert.Equal(t, "BootNotification", entry.Action)
+	})
+
+	t.Run("CallResult", func(t *testing.T) {
+		entry := journalEntry(JournalOutbound, "charger-1", []byte(`[3,"msg-1",{"status":"Accepted"}]`))
+		assert.Equal(t, 3, entry.TypeId)
+		assert.Equal(t, "msg-1", entry.MessageId)
+		assert.Empty(t, entry.Action)
+	})
+
+	t.Run("CallError", func(t *testing.T) {
+		entry := journalEntry(JournalOutbound, "charger-1", []byte(`[4,"msg-1","FormationViolation","",{}]`))
+		assert.Equal(t, 4, entry.TypeId)
+		assert.Equal(t, "msg-1", entry.MessageId)
+		assert.Empty(t, entry.Action)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		entry := journalEntry(JournalInbound, "charger-1", []byte(`not a frame`))
+		assert.Equal(t, "charger-1", entry.Serialnumber)
+		assert.Equal(t, []byte(`not a frame`), entry.Body)
+		assert.Zero(t, entry.TypeId)
+		assert.Empty(t, entry.MessageId)
+	})
+}
@@ -3,9 +3,13 @@ package ocpp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
 	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
 	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
 	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
@@ -22,7 +26,12 @@ type OcppMachine struct {
 	// Servicebus     ServiceBus
 	TracerProvider trace.TracerProvider
 	store          StoreAdapter
+	cdrs           CdrAdapter
+	tariffs        *Tariffs
+	tenants        *Tenants
 	cache          CacheAdapter
+	publisher      EventPublisher
+	timeouts       utils.RequestTimeoutConfiguration
 }
 
 // Ensures all required fields are set in the OcppMachine.
@@ -53,6 +62,28 @@ func WithStore(store StoreAdapter) OcppMachineOption {
 	}
 }
 
+// Sets the store meter values, connector statuses and CDRs are kept in. Without one no CDRs are written.
+func WithCdrStore(cdrs CdrAdapter) OcppMachineOption {
+	return func(m *OcppMachine) {
+		m.cdrs = cdrs
+	}
+}
+
+// Sets the tariffs CDRs are priced with. Without them CDRs have no cost and no estimates are published.
+func WithTariffs(tariffs *Tariffs) OcppMachineOption {
+	return func(m *OcppMachine) {
+		m.tariffs = tariffs
+	}
+}
+
+// Sets the tenants whose boot policies BootNotifications are answered with. Without them every boot is accepted with
+// a heartbeat interval of 30 seconds.
+func WithTenants(tenants *Tenants) OcppMachineOption {
+	return func(m *OcppMachine) {
+		m.tenants = tenants
+	}
+}
+
 // Sets the cache for the OcppMachine.
 func WithCache(cache CacheAdapter) OcppMachineOption {
 	return func(m *OcppMachine) {
@@ -60,6 +91,20 @@ func WithCache(cache CacheAdapter) OcppMachineOption {
 	}
 }
 
+// Sets the publisher domain events are published to. Without one no events are published.
+func WithPublisher(publisher EventPublisher) OcppMachineOption {
+	return func(m *OcppMachine) {
+		m.publisher = publisher
+	}
+}
+
+// Sets how long pending requests wait for their confirmation. Without it pending requests never time out.
+func WithRequestTimeouts(timeouts utils.RequestTimeoutConfiguration) OcppMachineOption {
+	return func(m *OcppMachine) {
+		m.timeouts = timeouts
+	}
+}
+
 // Creates a new OcppMachine with the provided options.
 func NewOcppMachine(opts ...OcppMachineOption) *OcppMachine {
 	machine := &OcppMachine{}
@@ -76,25 +121,11 @@ func NewOcppMachine(opts ...OcppMachineOption) *OcppMachine {
 	return machine
 }
 
-// Handles an incoming OCPP message.
+// Handles an incoming OCPP message. Duplicates are filtered out by the caller, through the message claim.
 func (o *OcppMachine) HandleMessage(ctx context.Context, meta v16.Meta, msg []byte) ([]byte, error) {
 	ctx, span := o.TracerProvider.Tracer("ocpp").Start(ctx, "HandleMessage")
 	defer span.End()
 
-	processed, err := o.cache.HasProcessed(ctx, meta.Id)
-	if err != nil {
-		err := fmt.Errorf("failed to process message: %v", err)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return nil, err
-	}
-
-	if processed {
-		slog.Info("Message already processed", "id", meta.Id)
-		span.SetStatus(codes.Ok, "Message already processed")
-		return nil, nil
-	}
-
 	select {
 	case <-ctx.Done():
 		// TODO: handle context shutdown
@@ -250,9 +281,17 @@ func (o *OcppMachine) handleRequest(ctx context.Context, proxyMode bool, meta v1
 
 		switch *msg.action {
 		case v16.ActionKind(core.BootNotification):
-			confirmation, err = o.handleBootNotificationRequest(ctx, proxyMode, msg.payload)
+			confirmation, err = o.handleBootNotificationRequest(ctx, proxyMode, meta, msg.payload)
 		case v16.ActionKind(core.Heartbeat):
 			confirmation, err = o.handleHeartbeatRequest(ctx, proxyMode, meta.Serialnumber, msg.payload)
+		case v16.ActionKind(core.StartTransaction):
+			confirmation, err = o.handleStartTransactionRequest(ctx, proxyMode, meta, msg.payload)
+		case v16.ActionKind(core.StopTransaction):
+			confirmation, err = o.handleStopTransactionRequest(ctx, proxyMode, meta, msg.payload)
+		case v16.ActionKind(core.StatusNotification):
+			confirmation, err = o.handleStatusNotificationRequest(ctx, proxyMode, meta, msg.payload)
+		case v16.ActionKind(core.MeterValues):
+			confirmation, err = o.handleMeterValuesRequest(ctx, proxyMode, meta, msg.payload)
 		default:
 			return nil, fmt.Errorf("unknown request action")
 		}
@@ -276,11 +315,14 @@ func (o *OcppMachine) handleRequest(ctx context.Context, proxyMode bool, meta v1
 		}
 
 		// stores request in cache
+		if meta.Direction == "" {
+			meta.Direction = msg.action.Direction()
+		}
 		if err := o.cache.AddRequest(ctx, meta, v16.RequestBody{
 			Uuid:    msg.uuid,
 			Action:  *msg.action,
 			Payload: msg.payload,
-		}); err != nil {
+		}, o.timeouts.Timeout(string(*msg.action))); err != nil {
 			return nil, err
 		}
 
@@ -288,31 +330,70 @@ func (o *OcppMachine) handleRequest(ctx context.Context, proxyMode bool, meta v1
 	}
 }
 
-// Processes a OCPP confirmation message. The confirmation is matched with a request in the cache.
+// Processes a OCPP confirmation message. The confirmation is matched with a request of the same charge point,
+// sent in the opposite direction, in the cache. The request is removed once the confirmation is processed.
 func (o *OcppMachine) handleConfirmation(ctx context.Context, proxyMode bool, meta v16.Meta, msg parsedMessage) error {
-	request, err := o.cache.GetRequestFromUuid(ctx, msg.uuid)
+	requestMeta := meta
+	if meta.Direction == "" {
+		requestMeta.Direction = v16.ChargePointToCentralSystem
+	} else {
+		requestMeta.Direction = meta.Direction.Reverse()
+	}
+
+	request, err := o.cache.GetRequestFromUuid(ctx, requestMeta, msg.uuid)
 	if err != nil {
 		return err
 	}
 
 	switch request.Action {
 	case v16.ActionKind(core.BootNotification):
-		return o.handleBootNotificationConfirmation(ctx, request, msg.payload)
+		err = o.handleBootNotificationConfirmation(ctx, meta, request, msg.payload)
 	case v16.ActionKind(core.Heartbeat):
-		return o.handleHeartbeatConfirmation(ctx, meta.Serialnumber, msg.payload)
+		err = o.handleHeartbeatConfirmation(ctx, meta.Serialnumber, msg.payload)
 	default:
 		return fmt.Errorf("unknown confirmation action")
 	}
+	if err != nil {
+		return err
+	}
+
+	return o.cache.RemoveRequest(ctx, requestMeta, v16.ConfirmationBody{Uuid: msg.uuid, Payload: msg.payload})
 }
 
-// Handles a complete BootNotification. AddChargepoint is called to store the Charge Point in the store.
-func (o *OcppMachine) onBootNotification(ctx context.Context, request core.BootNotificationRequest) error {
-	return o.store.AddChargepoint(ctx, request)
+// Handles a complete BootNotification. AddChargepoint is called to store the Charge Point in the store, and
+// EventFirmwareChanged is published as well if it booted before with a different firmware version.
+func (o *OcppMachine) onBootNotification(ctx context.Context, meta v16.Meta, request core.BootNotificationRequest) error {
+	boot, err := o.store.AddChargepoint(ctx, meta.Serialnumber, request)
+	if err != nil {
+		return err
+	}
+
+	if err := o.publish(ctx, meta, EventChargepointBooted, ChargepointBooted{
+		Vendor:          request.ChargePointVendor,
+		Model:           request.ChargePointModel,
+		FirmwareVersion: request.FirmwareVersion,
+	}); err != nil {
+		return err
+	}
+
+	if !boot.FirmwareChanged() {
+		return nil
+	}
+	slog.Info("Chargepoint firmware changed",
+		"serialnumber", meta.Serialnumber,
+		"tenant", TenantOf(ctx),
+		"previous", boot.PreviousFirmwareVersion,
+		"firmware", boot.FirmwareVersion,
+	)
+	return o.publish(ctx, meta, EventFirmwareChanged, FirmwareChanged{
+		PreviousFirmwareVersion: boot.PreviousFirmwareVersion,
+		FirmwareVersion:         boot.FirmwareVersion,
+	})
 }
 
 // Handles an incoming BootNotification request from a Charge Point.
 // Validates the request, processes it via onBootNotification, and returns a confirmation to send if it is in proxy mode.
-func (o *OcppMachine) handleBootNotificationRequest(ctx context.Context, proxyMode bool, payload []byte) (core.BootNotificationConfirmation, error) {
+func (o *OcppMachine) handleBootNotificationRequest(ctx context.Context, proxyMode bool, meta v16.Meta, payload []byte) (core.BootNotificationConfirmation, error) {
 	var request core.BootNotificationRequest
 	if err := json.Unmarshal(payload, &request); err != nil {
 		return core.BootNotificationConfirmation{}, err
@@ -322,13 +403,21 @@ func (o *OcppMachine) handleBootNotificationRequest(ctx context.Context, proxyMo
 	}
 
 	if proxyMode {
-		if err := o.onBootNotification(ctx, request); err != nil {
+		policy := BootPolicy{Status: core.RegistrationStatusAccepted, Interval: 30 * time.Second}
+		if o.tenants != nil {
+			policy = o.tenants.BootPolicy(TenantOf(ctx))
+		}
+
+		// A rejected charge point is not registered, it boots again after the interval
+		if policy.Status == core.RegistrationStatusRejected {
+			slog.Info("Rejected chargepoint boot", "serialnumber", meta.Serialnumber, "tenant", TenantOf(ctx))
+		} else if err := o.onBootNotification(ctx, meta, request); err != nil {
 			return core.BootNotificationConfirmation{}, err
 		}
 
 		return core.BootNotificationConfirmation{
-			Status:      core.RegistrationStatusAccepted,
-			Interval:    30,
+			Status:      policy.Status,
+			Interval:    int(policy.Interval / time.Second),
 			CurrentTime: types.Now(),
 		}, nil
 	}
@@ -339,7 +428,7 @@ func (o *OcppMachine) handleBootNotificationRequest(ctx context.Context, proxyMo
 
 // Handles an incoming BootNotification confirmation from the Central System.
 // Validates the confirmation, matches it with the request in cache, and processes via onBootNotification.
-func (o *OcppMachine) handleBootNotificationConfirmation(ctx context.Context, request v16.RequestBody, payload []byte) error {
+func (o *OcppMachine) handleBootNotificationConfirmation(ctx context.Context, meta v16.Meta, request v16.RequestBody, payload []byte) error {
 	var confirmation core.BootNotificationConfirmation
 	if err := json.Unmarshal(payload, &confirmation); err != nil {
 		return err
@@ -360,7 +449,11 @@ func (o *OcppMachine) handleBootNotificationConfirmation(ctx context.Context, re
 		return err
 	}
 
-	return o.onBootNotification(ctx, parsedRequest)
+	if confirmation.Status == core.RegistrationStatusRejected {
+		slog.Info("Rejected chargepoint boot", "serialnumber", meta.Serialnumber, "tenant", TenantOf(ctx))
+		return nil
+	}
+	return o.onBootNotification(ctx, meta, parsedRequest)
 }
 
 // Handles a complete Heartbeat. Updates the last heartbeat time in the store.
@@ -411,3 +504,280 @@ func (o *OcppMachine) handleHeartbeatConfirmation(ctx context.Context, serialnum
 
 	return o.onHeartbeatRequest(ctx, serialnumber, confirmation)
 }
+
+// Handles an incoming StartTransaction request from a Charge Point.
+// Validates the request, stores the transaction, and returns a confirmation with its transaction id if it is in proxy mode.
+func (o *OcppMachine) handleStartTransactionRequest(ctx context.Context, proxyMode bool, meta v16.Meta, payload []byte) (core.StartTransactionConfirmation, error) {
+	var request core.StartTransactionRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return core.StartTransactionConfirmation{}, err
+	}
+	if err := types.Validate.Struct(request); err != nil {
+		return core.StartTransactionConfirmation{}, err
+	}
+
+	if proxyMode {
+		transactionId, err := o.store.StartTransaction(ctx, meta.Serialnumber, request)
+		if err != nil {
+			return core.StartTransactionConfirmation{}, err
+		}
+
+		if err := o.publish(ctx, meta, EventTransactionStarted, TransactionStarted{
+			TransactionId: transactionId,
+			ConnectorId:   request.ConnectorId,
+			IdTag:         request.IdTag,
+			MeterStart:    request.MeterStart,
+			Timestamp:     request.Timestamp.Time,
+		}); err != nil {
+			return core.StartTransactionConfirmation{}, err
+		}
+
+		return core.StartTransactionConfirmation{
+			IdTagInfo:     types.NewIdTagInfo(types.AuthorizationStatusAccepted),
+			TransactionId: transactionId,
+		}, nil
+	}
+
+	return core.StartTransactionConfirmation{}, nil
+}
+
+// Handles an incoming StopTransaction request from a Charge Point.
+// Validates the request, stops the transaction in the store, writes its CDR, and returns a confirmation if it is in proxy mode.
+// An unknown transaction is still confirmed, as the Charge Point would otherwise keep resending it. A transaction that
+// has already stopped is confirmed again without changing it or its CDR, and without publishing EventTransactionStopped.
+func (o *OcppMachine) handleStopTransactionRequest(ctx context.Context, proxyMode bool, meta v16.Meta, payload []byte) (core.StopTransactionConfirmation, error) {
+	var request core.StopTransactionRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return core.StopTransactionConfirmation{}, err
+	}
+	if err := types.Validate.Struct(request); err != nil {
+		return core.StopTransactionConfirmation{}, err
+	}
+
+	if proxyMode {
+		confirmation := core.StopTransactionConfirmation{}
+		if request.IdTag != "" {
+			confirmation.IdTagInfo = types.NewIdTagInfo(types.AuthorizationStatusAccepted)
+		}
+
+		err := o.store.StopTransaction(ctx, meta.Serialnumber, request)
+		stopped := err == nil
+		if errors.Is(err, ErrTransactionStopped) {
+			slog.Warn("Transaction already stopped", "serialnumber", meta.Serialnumber, "tenant", TenantOf(ctx), "transactionId", request.TransactionId)
+			return confirmation, nil
+		} else if errors.Is(err, ErrTransactionNotFound) {
+			slog.Warn("Stopped unknown transaction", "serialnumber", meta.Serialnumber, "tenant", TenantOf(ctx), "transactionId", request.TransactionId)
+		} else if err != nil {
+			return core.StopTransactionConfirmation{}, err
+		}
+
+		if err := o.publish(ctx, meta, EventTransactionStopped, TransactionStopped{
+			TransactionId: request.TransactionId,
+			IdTag:         request.IdTag,
+			MeterStop:     request.MeterStop,
+			Reason:        request.Reason,
+			Timestamp:     request.Timestamp.Time,
+		}); err != nil {
+			return core.StopTransactionConfirmation{}, err
+		}
+		if stopped {
+			if err := o.addCdr(ctx, meta, request); err != nil {
+				return core.StopTransactionConfirmation{}, err
+			}
+		}
+		return confirmation, nil
+	}
+
+	return core.StopTransactionConfirmation{}, nil
+}
+
+// Adds the CDR of a stopped transaction, with the register readings in its transaction data, and publishes
+// EventCdrCreated. A transaction that has a CDR keeps it.
+func (o *OcppMachine) addCdr(ctx context.Context, meta v16.Meta, request core.StopTransactionRequest) error {
+	if o.cdrs == nil {
+		return nil
+	}
+
+	transaction, err := o.store.GetTransaction(ctx, meta.Serialnumber, request.TransactionId)
+	if err != nil {
+		return err
+	}
+
+	if samples := meterSamples(meta.Serialnumber, transaction.Id, transaction.ConnectorId, request.TransactionData); len(samples) > 0 {
+		if err := o.cdrs.AddMeterSamples(ctx, samples); err != nil {
+			return err
+		}
+	}
+	samples, statuses, err := transactionUsage(ctx, o.cdrs, transaction, *transaction.StoppedAt)
+	if err != nil {
+		return err
+	}
+
+	cdr, err := NewChargeDetailRecord(transaction, samples, statuses)
+	if err != nil {
+		return err
+	}
+	if o.tariffs != nil {
+		cdr.Cost = o.tariffs.Price(cdr, samples, statuses)
+	}
+	cdr.CreatedAt = time.Now().UTC()
+
+	cdr.Id, err = o.cdrs.AddCdr(ctx, cdr)
+	if errors.Is(err, ErrCdrExists) {
+		slog.Warn("Transaction already has a charge detail record", "serialnumber", meta.Serialnumber, "tenant", TenantOf(ctx), "transactionId", transaction.Id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if cdr.EnergyCheck == EnergyCheckMismatch {
+		slog.Warn("Energy of transaction does not match its meter values",
+			"serialnumber", meta.Serialnumber,
+			"tenant", TenantOf(ctx),
+			"transactionId", transaction.Id,
+			"energyWh", cdr.EnergyWh,
+		)
+	}
+
+	return o.publish(ctx, meta, EventCdrCreated, cdr)
+}
+
+// Handles an incoming MeterValues request from a Charge Point.
+// Validates the request, stores the energy register readings of its transaction, and returns a confirmation if it is in proxy mode.
+// Values taken outside a transaction are not stored.
+func (o *OcppMachine) handleMeterValuesRequest(ctx context.Context, proxyMode bool, meta v16.Meta, payload []byte) (core.MeterValuesConfirmation, error) {
+	var request core.MeterValuesRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return core.MeterValuesConfirmation{}, err
+	}
+	if err := types.Validate.Struct(request); err != nil {
+		return core.MeterValuesConfirmation{}, err
+	}
+
+	if proxyMode && request.TransactionId != nil && o.cdrs != nil {
+		samples := meterSamples(meta.Serialnumber, *request.TransactionId, request.ConnectorId, request.MeterValue)
+		if len(samples) > 0 {
+			if err := o.cdrs.AddMeterSamples(ctx, samples); err != nil {
+				return core.MeterValuesConfirmation{}, err
+			}
+			latest := slices.MaxFunc(samples, func(a, b MeterSample) int { return a.SampledAt.Compare(b.SampledAt) })
+			if err := o.estimateCost(ctx, meta, *request.TransactionId, latest.SampledAt); err != nil {
+				return core.MeterValuesConfirmation{}, err
+			}
+		}
+	}
+
+	return core.MeterValuesConfirmation{}, nil
+}
+
+// Publishes EventCostEstimated with the cost of a transaction in progress at the time of its latest meter values.
+// Nothing is published without tariffs, for an unknown transaction, or when no tariff applies.
+func (o *OcppMachine) estimateCost(ctx context.Context, meta v16.Meta, transactionId int, at time.Time) error {
+	if o.tariffs == nil {
+		return nil
+	}
+
+	transaction, err := o.store.GetTransaction(ctx, meta.Serialnumber, transactionId)
+	if errors.Is(err, ErrTransactionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if transaction.StoppedAt != nil {
+		return nil
+	}
+
+	samples, statuses, err := transactionUsage(ctx, o.cdrs, transaction, at)
+	if err != nil {
+		return err
+	}
+	estimate, ok := o.tariffs.Estimate(transaction, samples, statuses, at)
+	if !ok {
+		return nil
+	}
+	return o.publish(ctx, meta, EventCostEstimated, estimate)
+}
+
+// Returns the register readings of a transaction, and the statuses of its connector from its start until the time.
+func transactionUsage(ctx context.Context, cdrs CdrAdapter, transaction Transaction, until time.Time) ([]MeterSample, []ConnectorStatus, error) {
+	samples, err := cdrs.ListMeterSamples(ctx, transaction.Serialnumber, transaction.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	statuses, err := cdrs.ListConnectorStatuses(ctx, transaction.Serialnumber, transaction.ConnectorId, transaction.StartedAt, until)
+	if err != nil {
+		return nil, nil, err
+	}
+	return samples, statuses, nil
+}
+
+// Handles an incoming StatusNotification request from a Charge Point.
+// Validates the request, records the status, publishes the status change, and returns a confirmation if it is in proxy mode.
+func (o *OcppMachine) handleStatusNotificationRequest(ctx context.Context, proxyMode bool, meta v16.Meta, payload []byte) (core.StatusNotificationConfirmation, error) {
+	var request core.StatusNotificationRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return core.StatusNotificationConfirmation{}, err
+	}
+	if err := types.Validate.Struct(request); err != nil {
+		return core.StatusNotificationConfirmation{}, err
+	}
+
+	if proxyMode {
+		timestamp := time.Now().UTC()
+		if request.Timestamp != nil {
+			timestamp = request.Timestamp.Time
+		}
+
+		if o.cdrs != nil {
+			if err := o.cdrs.AddConnectorStatus(ctx, ConnectorStatus{
+				Serialnumber: meta.Serialnumber,
+				ConnectorId:  request.ConnectorId,
+				Status:       request.Status,
+				ErrorCode:    request.ErrorCode,
+				Info:         request.Info,
+				ReportedAt:   timestamp,
+			}); err != nil {
+				return core.StatusNotificationConfirmation{}, err
+			}
+		}
+
+		if err := o.publish(ctx, meta, EventStatusChanged, StatusChanged{
+			ConnectorId: request.ConnectorId,
+			Status:      request.Status,
+			ErrorCode:   request.ErrorCode,
+			Info:        request.Info,
+			Timestamp:   timestamp,
+		}); err != nil {
+			return core.StatusNotificationConfirmation{}, err
+		}
+	}
+
+	return core.StatusNotificationConfirmation{}, nil
+}
+
+// Publishes a domain event for the message being processed.
+// The publisher adds the event to the outbox in the transaction of the message, so failing to publish fails the message.
+func (o *OcppMachine) publish(ctx context.Context, meta v16.Meta, eventType string, data any) error {
+	if o.publisher == nil {
+		return nil
+	}
+
+	event := DomainEvent{
+		Id:           meta.Id + ":" + eventType,
+		Type:         eventType,
+		Serialnumber: meta.Serialnumber,
+		OccurredAt:   time.Now().UTC(),
+		Data:         data,
+		Tenant:       TenantOf(ctx),
+	}
+	if err := o.publisher.Publish(ctx, event); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", eventType, err)
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("published domain event", trace.WithAttributes(
+		attribute.String("type", eventType),
+		attribute.String("id", event.Id),
+	))
+	return nil
+}
@@ -3,12 +3,13 @@ package ocpp
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"slices"
 	"testing"
+	"time"
 
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
 	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
 	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/otel/trace/noop"
 )
@@ -16,7 +17,11 @@ import (
 func TestHandleMessage(t *testing.T) {
 	ctx, meta, machine := setupMachineTest(t)
 
-	err := machine.cache.AddRequest(ctx, meta, v16.RequestBody{
+	err := machine.cache.AddRequest(ctx, v16.Meta{
+		Id:           meta.Id,
+		Serialnumber: meta.Serialnumber,
+		Direction:    v16.ChargePointToCentralSystem,
+	}, v16.RequestBody{
 		Uuid:   "uuid-456",
 		Action: core.BootNotification,
 		Payload: []byte(`{
@@ -30,7 +35,7 @@ func TestHandleMessage(t *testing.T) {
 			"meterType": "",
 			"meterSerialNumber": "91234567"
 		}`),
-	})
+	}, 0)
 	assert.NoError(t, err)
 
 	t.Run("InvalidKind", func(t *testing.T) {
@@ -318,6 +323,44 @@ func TestHandleRequest(t *testing.T) {
 // 	})
 // }
 
+func TestHandleConfirmation(t *testing.T) {
+	ctx, meta, machine := setupMachineTest(t)
+	request := v16.RequestBody{Uuid: "uuid-heartbeat", Action: core.Heartbeat, Payload: []byte("{}")}
+	confirmation := parsedMessage{
+		kind:    v16.Confirmation,
+		uuid:    "uuid-heartbeat",
+		payload: []byte(`{"currentTime": "2025-07-22T11:25:25.230Z"}`),
+	}
+
+	t.Run("OtherCharger_NotPaired", func(t *testing.T) {
+		assert.NoError(t, machine.cache.AddRequest(ctx, v16.Meta{Serialnumber: "other-serial", Direction: v16.ChargePointToCentralSystem}, request, 0))
+
+		err := machine.handleConfirmation(ctx, true, meta, confirmation)
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+	})
+
+	t.Run("OtherDirection_NotPaired", func(t *testing.T) {
+		assert.NoError(t, machine.cache.AddRequest(ctx, v16.Meta{Serialnumber: meta.Serialnumber, Direction: v16.CentralSystemToChargePoint}, request, 0))
+
+		err := machine.handleConfirmation(ctx, true, meta, confirmation)
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+	})
+
+	t.Run("Paired_RequestRemoved", func(t *testing.T) {
+		requestMeta := v16.Meta{Serialnumber: meta.Serialnumber, Direction: v16.ChargePointToCentralSystem}
+		assert.NoError(t, machine.cache.AddRequest(ctx, requestMeta, request, 0))
+		_, err := machine.store.AddChargepoint(ctx, meta.Serialnumber, core.BootNotificationRequest{ChargePointModel: "Zappi", ChargePointVendor: "Myenergi"})
+		assert.NoError(t, err)
+
+		assert.NoError(t, machine.handleConfirmation(ctx, true, meta, confirmation))
+
+		_, err = machine.cache.GetRequestFromUuid(ctx, requestMeta, "uuid-heartbeat")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+		_, err = machine.cache.GetRequestFromUuid(ctx, v16.Meta{Serialnumber: "other-serial", Direction: v16.ChargePointToCentralSystem}, "uuid-heartbeat")
+		assert.NoError(t, err)
+	})
+}
+
 func TestHandleHeartbeatRequest(t *testing.T) {
 	ctx, meta, machine := setupMachineTest(t)
 
@@ -329,15 +372,15 @@ func TestHandleHeartbeatRequest(t *testing.T) {
 }
 
 func TestHandleBootNotificationRequest(t *testing.T) {
-	ctx, _, machine := setupMachineTest(t)
+	ctx, meta, machine := setupMachineTest(t)
 
 	t.Run("InvalidPayload", func(t *testing.T) {
-		_, err := machine.handleBootNotificationRequest(ctx, true, []byte(`{}`))
+		_, err := machine.handleBootNotificationRequest(ctx, true, meta, []byte(`{}`))
 		assert.Error(t, err)
 	})
 
 	t.Run("ValidPayload", func(t *testing.T) {
-		body, err := machine.handleBootNotificationRequest(ctx, true, []byte(`{
+		body, err := machine.handleBootNotificationRequest(ctx, true, meta, []byte(`{
 			"chargeBoxSerialNumber": "91234567",
 			"chargePointModel": "Zappi",
 			"chargePointSerialNumber": "91234567",
@@ -353,60 +396,280 @@ func TestHandleBootNotificationRequest(t *testing.T) {
 	})
 }
 
+func TestBootPolicies(t *testing.T) {
+	ctx, meta, machine := setupMachineTest(t)
+	publisher := &mockPublisher{}
+	machine.publisher = publisher
+	tenants, err := NewTenants(utils.TenancyConfiguration{
+		Tenants: []utils.TenantConfiguration{
+			{ID: "operator-a", Boot: utils.BootConfiguration{Interval: 5 * time.Minute}},
+			{ID: "operator-b", Boot: utils.BootConfiguration{Status: "Rejected"}},
+		},
+	}, utils.BootConfiguration{Status: "Pending", Interval: time.Minute})
+	assert.NoError(t, err)
+	machine.tenants = tenants
+	payload := []byte(`{"chargePointModel": "Zappi", "chargePointVendor": "Myenergi", "firmwareVersion": "5540"}`)
+
+	t.Run("Default", func(t *testing.T) {
+		confirmation, err := machine.handleBootNotificationRequest(ctx, true, meta, payload)
+		assert.NoError(t, err)
+		assert.Equal(t, core.RegistrationStatusPending, confirmation.Status)
+		assert.Equal(t, 60, confirmation.Interval)
+	})
+
+	t.Run("Tenant", func(t *testing.T) {
+		confirmation, err := machine.handleBootNotificationRequest(WithTenant(ctx, "operator-a"), true, meta, payload)
+		assert.NoError(t, err)
+		assert.Equal(t, core.RegistrationStatusPending, confirmation.Status)
+		assert.Equal(t, 300, confirmation.Interval)
+
+		chargepoint, err := machine.store.GetChargepoint(WithTenant(ctx, "operator-a"), meta.Serialnumber)
+		assert.NoError(t, err)
+		assert.Equal(t, "operator-a", chargepoint.Tenant)
+		assert.Equal(t, "operator-a", publisher.last().Tenant)
+	})
+
+	t.Run("Rejected_NotStored", func(t *testing.T) {
+		count := len(publisher.events)
+		confirmation, err := machine.handleBootNotificationRequest(WithTenant(ctx, "operator-b"), true, meta, payload)
+		assert.NoError(t, err)
+		assert.Equal(t, core.RegistrationStatusRejected, confirmation.Status)
+		assert.Equal(t, 60, confirmation.Interval)
+
+		_, err = machine.store.GetChargepoint(WithTenant(ctx, "operator-b"), meta.Serialnumber)
+		assert.ErrorIs(t, err, ErrChargepointNotFound)
+		assert.Len(t, publisher.events, count)
+	})
+}
+
+func TestDomainEvents(t *testing.T) {
+	ctx, meta, machine := setupMachineTest(t)
+	publisher := &mockPublisher{}
+	machine.publisher = publisher
+
+	t.Run("BootNotification", func(t *testing.T) {
+		_, err := machine.handleBootNotificationRequest(ctx, true, meta, []byte(`{
+			"chargePointModel": "Zappi",
+			"chargePointVendor": "Myenergi",
+			"firmwareVersion": "5540"
+		}`))
+		assert.NoError(t, err)
+
+		event := publisher.last()
+		assert.Equal(t, EventChargepointBooted, event.Type)
+		assert.Equal(t, meta.Id+":"+EventChargepointBooted, event.Id)
+		assert.Equal(t, meta.Serialnumber, event.Serialnumber)
+		assert.Equal(t, ChargepointBooted{Vendor: "Myenergi", Model: "Zappi", FirmwareVersion: "5540"}, event.Data)
+	})
+
+	t.Run("BootNotification_FirmwareChanged", func(t *testing.T) {
+		count := len(publisher.events)
+		_, err := machine.handleBootNotificationRequest(ctx, true, meta, []byte(`{
+			"chargePointModel": "Zappi",
+			"chargePointVendor": "Myenergi",
+			"firmwareVersion": "5541"
+		}`))
+		assert.NoError(t, err)
+
+		assert.Len(t, publisher.events, count+2)
+		event := publisher.last()
+		assert.Equal(t, EventFirmwareChanged, event.Type)
+		assert.Equal(t, meta.Id+":"+EventFirmwareChanged, event.Id)
+		assert.Equal(t, FirmwareChanged{PreviousFirmwareVersion: "5540", FirmwareVersion: "5541"}, event.Data)
+
+		count = len(publisher.events)
+		_, err = machine.handleBootNotificationRequest(ctx, true, meta, []byte(`{
+			"chargePointModel": "Zappi",
+			"chargePointVendor": "Myenergi",
+			"firmwareVersion": "5541"
+		}`))
+		assert.NoError(t, err)
+		assert.Len(t, publisher.events, count+1)
+		assert.Equal(t, EventChargepointBooted, publisher.last().Type)
+	})
+
+	t.Run("StartTransaction", func(t *testing.T) {
+		confirmation, err := machine.handleStartTransactionRequest(ctx, true, meta, []byte(`{
+			"connectorId": 1,
+			"idTag": "TAG-1",
+			"meterStart": 1000,
+			"timestamp": "2024-04-02T11:44:38Z"
+		}`))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, confirmation.TransactionId)
+		assert.Equal(t, types.AuthorizationStatusAccepted, confirmation.IdTagInfo.Status)
+
+		event := publisher.last()
+		assert.Equal(t, EventTransactionStarted, event.Type)
+		data := event.Data.(TransactionStarted)
+		assert.Equal(t, 1, data.TransactionId)
+		assert.Equal(t, 1000, data.MeterStart)
+	})
+
+	t.Run("StopTransaction", func(t *testing.T) {
+		_, err := machine.handleStopTransactionRequest(ctx, true, meta, []byte(`{
+			"meterStop": 2500,
+			"timestamp": "2024-04-02T12:44:38Z",
+			"transactionId": 1,
+			"reason": "EVDisconnected"
+		}`))
+		assert.NoError(t, err)
+
+		event := publisher.events[len(publisher.events)-2]
+		assert.Equal(t, EventTransactionStopped, event.Type)
+		data := event.Data.(TransactionStopped)
+		assert.Equal(t, 2500, data.MeterStop)
+		assert.Equal(t, core.ReasonEVDisconnected, data.Reason)
+
+		event = publisher.last()
+		assert.Equal(t, EventCdrCreated, event.Type)
+		assert.Equal(t, meta.Id+":"+EventCdrCreated, event.Id)
+		cdr := event.Data.(ChargeDetailRecord)
+		assert.NotZero(t, cdr.Id)
+		assert.Equal(t, 1500, cdr.EnergyWh)
+		assert.Equal(t, time.Hour, cdr.Duration)
+	})
+
+	t.Run("StopTransaction_Again", func(t *testing.T) {
+		count := len(publisher.events)
+		_, err := machine.handleStopTransactionRequest(ctx, true, meta, []byte(`{
+			"meterStop": 2600,
+			"timestamp": "2024-04-02T12:45:38Z",
+			"transactionId": 1,
+			"reason": "Local"
+		}`))
+		assert.NoError(t, err)
+		assert.Len(t, publisher.events, count)
+
+		// The transaction and its CDR keep the first stop
+		transaction, err := machine.store.GetTransaction(ctx, meta.Serialnumber, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 2500, *transaction.MeterStop)
+		assert.Equal(t, core.ReasonEVDisconnected, transaction.StopReason)
+		cdr, err := machine.cdrs.GetCdr(ctx, meta.Serialnumber, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 2500, cdr.MeterStop)
+		assert.Equal(t, 1500, cdr.EnergyWh)
+		assert.Equal(t, time.Hour, cdr.Duration)
+	})
+
+	t.Run("StopTransaction_UnknownTransaction", func(t *testing.T) {
+		_, err := machine.handleStopTransactionRequest(ctx, true, meta, []byte(`{
+			"meterStop": 2500,
+			"timestamp": "2024-04-02T12:44:38Z",
+			"transactionId": 99
+		}`))
+		assert.NoError(t, err)
+		assert.Equal(t, EventTransactionStopped, publisher.last().Type)
+	})
+
+	t.Run("StatusNotification", func(t *testing.T) {
+		_, err := machine.handleStatusNotificationRequest(ctx, true, meta, []byte(`{
+			"connectorId": 1,
+			"errorCode": "NoError",
+			"status": "Charging"
+		}`))
+		assert.NoError(t, err)
+
+		event := publisher.last()
+		assert.Equal(t, EventStatusChanged, event.Type)
+		assert.Equal(t, core.ChargePointStatusCharging, event.Data.(StatusChanged).Status)
+	})
+
+	t.Run("StatusNotification_InvalidStatus", func(t *testing.T) {
+		count := len(publisher.events)
+		_, err := machine.handleStatusNotificationRequest(ctx, true, meta, []byte(`{
+			"connectorId": 1,
+			"errorCode": "NoError",
+			"status": "Exploded"
+		}`))
+		assert.Error(t, err)
+		assert.Len(t, publisher.events, count)
+	})
+}
+
+type mockPublisher struct {
+	events []DomainEvent
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, event DomainEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockPublisher) last() DomainEvent {
+	if len(m.events) == 0 {
+		return DomainEvent{}
+	}
+	return m.events[len(m.events)-1]
+}
+
 type mockCache struct {
-	processed []string
-	requests  map[string]v16.RequestBody
+	claims   map[string]MessageClaim
+	requests map[string]v16.RequestBody
 }
 
-func (m *mockCache) HasProcessed(ctx context.Context, id string) (bool, error) {
-	if slices.Contains(m.processed, id) {
-		return true, nil
+func (m *mockCache) ClaimMessage(ctx context.Context, id string, lease time.Duration) (MessageClaim, error) {
+	if claim, ok := m.claims[id]; ok {
+		if claim.State == ClaimAcquired {
+			claim.State = ClaimInProgress
+		}
+		return MessageClaim{Id: id, State: claim.State, Reply: claim.Reply}, nil
 	}
-	return false, nil
+	if m.claims == nil {
+		m.claims = make(map[string]MessageClaim)
+	}
+	claim := MessageClaim{Id: id, Token: id, State: ClaimAcquired}
+	m.claims[id] = claim
+	return claim, nil
 }
 
-func (m *mockCache) AddProcessed(ctx context.Context, id string) error {
-	if m.processed == nil {
-		m.processed = make([]string, 0)
+func (m *mockCache) CompleteMessage(ctx context.Context, claim MessageClaim, reply []byte) error {
+	if m.claims[claim.Id].Token != claim.Token {
+		return ErrClaimLost
 	}
-	m.processed = append(m.processed, id)
+	m.claims[claim.Id] = MessageClaim{Id: claim.Id, State: ClaimCompleted, Reply: reply}
 	return nil
 }
 
-func (m *mockCache) GetRequestFromUuid(ctx context.Context, uuid string) (v16.RequestBody, error) {
-	for _, request := range m.requests {
-		if request.Uuid == uuid {
-			return request, nil
-		}
+func (m *mockCache) ReleaseMessage(ctx context.Context, claim MessageClaim) error {
+	if m.claims[claim.Id].Token != claim.Token {
+		return ErrClaimLost
+	}
+	delete(m.claims, claim.Id)
+	return nil
+}
+
+func (m *mockCache) GetRequestFromUuid(ctx context.Context, meta v16.Meta, uuid string) (v16.RequestBody, error) {
+	request, ok := m.requests[mockRequestKey(meta, uuid)]
+	if !ok {
+		return v16.RequestBody{}, ErrRequestNotFound
 	}
-	return v16.RequestBody{}, fmt.Errorf("request not found")
+	return request, nil
 }
 
-func (m *mockCache) AddRequest(ctx context.Context, meta v16.Meta, request v16.RequestBody) error {
+func (m *mockCache) AddRequest(ctx context.Context, meta v16.Meta, request v16.RequestBody, timeout time.Duration) error {
 	if m.requests == nil {
 		m.requests = make(map[string]v16.RequestBody)
 	}
-	m.requests[request.Uuid] = request
+	m.requests[mockRequestKey(meta, request.Uuid)] = request
 	return nil
 }
 
 func (m *mockCache) RemoveRequest(ctx context.Context, meta v16.Meta, confirmation v16.ConfirmationBody) error {
-	if m.requests == nil {
-		return fmt.Errorf("no requests found")
+	if _, ok := m.requests[mockRequestKey(meta, confirmation.Uuid)]; !ok {
+		return ErrRequestNotFound
 	}
-	delete(m.requests, confirmation.Uuid)
+	delete(m.requests, mockRequestKey(meta, confirmation.Uuid))
 	return nil
 }
 
-type mockStore struct {
+func (m *mockCache) TakeExpiredRequests(ctx context.Context, now time.Time, limit int) ([]PendingRequest, error) {
+	return nil, nil
 }
 
-func (m *mockStore) AddChargepoint(ctx context.Context, request core.BootNotificationRequest) error {
-	return nil
-}
-
-func (m *mockStore) UpdateLastHeartbeat(ctx context.Context, serialnumber string, payload core.HeartbeatConfirmation) error {
-	return nil
+func mockRequestKey(meta v16.Meta, uuid string) string {
+	return meta.Serialnumber + ":" + string(meta.Direction) + ":" + uuid
 }
 
 func setupMachineTest(t *testing.T) (context.Context, v16.Meta, *OcppMachine) {
@@ -415,11 +678,92 @@ func setupMachineTest(t *testing.T) (context.Context, v16.Meta, *OcppMachine) {
 		Id:           "test-id",
 		Serialnumber: "test-serial",
 	}
+	store := NewMemoryStore(WithMemoryStoreTracerProvider(noop.NewTracerProvider()))
 	machine := NewOcppMachine(
 		WithTracerProvider(noop.NewTracerProvider()),
 		WithCache(&mockCache{}),
-		WithStore(&mockStore{}),
+		WithStore(store),
+		WithCdrStore(store),
 	)
 	assert.NotNil(t, machine)
 	return ctx, meta, machine
 }
+
+func TestChargeDetailRecords(t *testing.T) {
+	ctx, meta, machine := setupMachineTest(t)
+	cdrs := machine.cdrs
+	publisher := &mockPublisher{}
+	machine.publisher = publisher
+	tariffs, err := NewTariffs(utils.TariffConfiguration{
+		Tariffs: []utils.TariffDefinitionConfiguration{{
+			ID:              "standard",
+			Currency:        "GBP",
+			StartFee:        "0.50",
+			EnergyPrice:     "0.40",
+			IdlePrice:       "6.00",
+			IdleGracePeriod: 10 * time.Minute,
+		}},
+		Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "standard"}},
+	})
+	assert.NoError(t, err)
+	machine.tariffs = tariffs
+
+	for _, request := range []struct {
+		action  v16.ActionKind
+		payload string
+	}{
+		{v16.ActionKind(core.StatusNotification), `{"connectorId": 1, "errorCode": "NoError", "status": "Preparing", "timestamp": "2025-07-22T09:59:00Z"}`},
+		{v16.ActionKind(core.StartTransaction), `{"connectorId": 1, "idTag": "B4A63CDF", "meterStart": 1000, "timestamp": "2025-07-22T10:00:00Z"}`},
+		{v16.ActionKind(core.StatusNotification), `{"connectorId": 1, "errorCode": "NoError", "status": "Charging", "timestamp": "2025-07-22T10:00:00Z"}`},
+		{v16.ActionKind(core.MeterValues), `{"connectorId": 1, "transactionId": 1, "meterValue": [{"timestamp": "2025-07-22T10:30:00Z", "sampledValue": [
+			{"value": "3.5", "unit": "kWh", "measurand": "Energy.Active.Import.Register"},
+			{"value": "7200", "unit": "W", "measurand": "Power.Active.Import"}
+		]}]}`},
+		{v16.ActionKind(core.MeterValues), `{"connectorId": 1, "meterValue": [{"timestamp": "2025-07-22T10:31:00Z", "sampledValue": [{"value": "9000"}]}]}`},
+		{v16.ActionKind(core.StatusNotification), `{"connectorId": 1, "errorCode": "NoError", "status": "SuspendedEV", "timestamp": "2025-07-22T10:45:00Z"}`},
+		{v16.ActionKind(core.StopTransaction), `{"meterStop": 6000, "timestamp": "2025-07-22T11:00:00Z", "transactionId": 1, "transactionData": [
+			{"timestamp": "2025-07-22T11:00:00Z", "sampledValue": [{"value": "6000", "context": "Transaction.End"}]}
+		]}`},
+	} {
+		_, err := machine.handleRequest(ctx, true, meta, parsedMessage{
+			kind:    v16.Request,
+			action:  request.action.ToPtr(),
+			uuid:    "uuid-000",
+			payload: []byte(request.payload),
+		})
+		assert.NoError(t, err, request.action)
+	}
+
+	// Meter values outside a transaction are not estimated
+	var estimates []CostEstimate
+	for _, event := range publisher.events {
+		if event.Type == EventCostEstimated {
+			estimates = append(estimates, event.Data.(CostEstimate))
+		}
+	}
+	if assert.Len(t, estimates, 1) {
+		assert.Equal(t, 2500, estimates[0].EnergyWh)
+		assert.Equal(t, "1.5", estimates[0].Cost.Total.String())
+	}
+
+	samples, err := cdrs.ListMeterSamples(ctx, meta.Serialnumber, 1)
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2)
+
+	cdr, err := cdrs.GetCdr(ctx, meta.Serialnumber, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "B4A63CDF", cdr.IdTag)
+	assert.Equal(t, 5000, cdr.EnergyWh)
+	assert.Equal(t, 2500, *cdr.SampledEnergyWh)
+	assert.Equal(t, EnergyCheckVerified, cdr.EnergyCheck)
+	assert.Equal(t, core.ReasonLocal, cdr.StopReason)
+	assert.Equal(t, 45*time.Minute, cdr.ChargingTime)
+	assert.Equal(t, 15*time.Minute, cdr.IdleTime)
+	if assert.NotNil(t, cdr.Cost) {
+		assert.Equal(t, "standard", cdr.Cost.TariffId)
+		assert.Equal(t, "2", cdr.Cost.Energy.String())
+		assert.Equal(t, "0.5", cdr.Cost.Idle.String())
+		assert.Equal(t, "3", cdr.Cost.Total.String())
+	}
+	assert.Equal(t, EventCdrCreated, publisher.last().Type)
+}
@@ -0,0 +1,445 @@
+package ocpp
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/squishmeist/ocpp-go/internal/core"
+	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// How long a pending request is kept in the cache, as in RedisCache.
+const pendingRequestTTL = 24 * time.Hour
+
+type MemoryCacheOption func(*MemoryCache)
+
+// Keeps message claims and pending requests in memory, with the semantics of RedisCache, for a single instance.
+// Entries expire after their TTL. In-progress claims and pending requests are live: they are kept until they are
+// completed, released, removed or expire, and are never evicted. Once the cache holds maxEntries completed claims the
+// least recently used is evicted. Once it holds maxLiveEntries live entries, new claims and requests fail with
+// ErrCacheFull until some are done or expire.
+type MemoryCache struct {
+	Tracer         trace.Tracer
+	maxEntries     int
+	maxLiveEntries int
+	now            func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element // completed claims
+	lru       *list.List               // front is most recently used
+	live      map[string]*memoryEntry  // in-progress claims and pending requests
+	expiries  entryHeap                // live entries by expiresAt
+	deadlines entryHeap                // pending requests with a deadline, by deadline
+}
+
+// Represents a cache entry. Value is a memoryClaim or a PendingRequest.
+type memoryEntry struct {
+	key       string
+	value     any
+	expiresAt time.Time
+	deadline  time.Time // of a pending request, zero without one
+
+	// Positions in the expiries and deadlines heaps of a live entry, -1 when not in the heap
+	expiryIndex   int
+	deadlineIndex int
+}
+
+// Represents a message claim: in progress while token is set, completed otherwise.
+type memoryClaim struct {
+	token string
+	reply []byte
+}
+
+// A min-heap of live entries by expiresAt, or by deadline, that tracks the position of each entry so it can be removed.
+type entryHeap struct {
+	entries    []*memoryEntry
+	byDeadline bool
+}
+
+func (h *entryHeap) at(entry *memoryEntry) (time.Time, *int) {
+	if h.byDeadline {
+		return entry.deadline, &entry.deadlineIndex
+	}
+	return entry.expiresAt, &entry.expiryIndex
+}
+
+func (h *entryHeap) Len() int { return len(h.entries) }
+
+func (h *entryHeap) Less(i, j int) bool {
+	a, _ := h.at(h.entries[i])
+	b, _ := h.at(h.entries[j])
+	return a.Before(b)
+}
+
+func (h *entryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	_, index := h.at(h.entries[i])
+	*index = i
+	_, index = h.at(h.entries[j])
+	*index = j
+}
+
+func (h *entryHeap) Push(x any) {
+	entry := x.(*memoryEntry)
+	_, index := h.at(entry)
+	*index = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *entryHeap) Pop() any {
+	last := len(h.entries) - 1
+	entry := h.entries[last]
+	h.entries[last] = nil
+	h.entries = h.entries[:last]
+	_, index := h.at(entry)
+	*index = -1
+	return entry
+}
+
+// Returns the entry at the top of the heap, or nil if it is empty.
+func (h *entryHeap) peek() *memoryEntry {
+	if len(h.entries) == 0 {
+		return nil
+	}
+	return h.entries[0]
+}
+
+// Ensures all required fields are set in the MemoryCache.
+func (c *MemoryCache) Validate() error {
+	if c.Tracer == nil {
+		return fmt.Errorf("tracer provider is not set")
+	}
+	if c.maxEntries <= 0 {
+		return fmt.Errorf("max entries must be positive")
+	}
+	if c.maxLiveEntries <= 0 {
+		return fmt.Errorf("max live entries must be positive")
+	}
+	return nil
+}
+
+func WithMemoryCacheTracerProvider(tp trace.TracerProvider) MemoryCacheOption {
+	return func(c *MemoryCache) {
+		c.Tracer = tp.Tracer("cache")
+	}
+}
+
+// Sets how many completed claims the cache holds before it evicts the least recently used.
+func WithMemoryCacheMaxEntries(maxEntries int) MemoryCacheOption {
+	return func(c *MemoryCache) {
+		if maxEntries > 0 {
+			c.maxEntries = maxEntries
+		}
+	}
+}
+
+// Sets how many in-progress claims and pending requests the cache holds before it refuses new ones with ErrCacheFull.
+func WithMemoryCacheMaxLiveEntries(maxLiveEntries int) MemoryCacheOption {
+	return func(c *MemoryCache) {
+		if maxLiveEntries > 0 {
+			c.maxLiveEntries = maxLiveEntries
+		}
+	}
+}
+
+// Sets the clock entries expire by, for tests.
+func WithMemoryCacheClock(now func() time.Time) MemoryCacheOption {
+	return func(c *MemoryCache) {
+		c.now = now
+	}
+}
+
+// Creates a new MemoryCache with the provided options.
+func NewMemoryCache(opts ...MemoryCacheOption) *MemoryCache {
+	cache := &MemoryCache{
+		maxEntries:     100000,
+		maxLiveEntries: 100000,
+		now:            time.Now,
+		entries:        make(map[string]*list.Element),
+		lru:            list.New(),
+		live:           make(map[string]*memoryEntry),
+		deadlines:      entryHeap{byDeadline: true},
+	}
+
+	for _, opt := range opts {
+		opt(cache)
+	}
+
+	if err := cache.Validate(); err != nil {
+		panic(err)
+	}
+
+	return cache
+}
+
+func (c *MemoryCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.live = make(map[string]*memoryEntry)
+	c.expiries = entryHeap{}
+	c.deadlines = entryHeap{byDeadline: true}
+	return nil
+}
+
+// Returns the entry under key, or nil if there is none or it expired. A completed claim becomes the most recently
+// used. Must be called with mu held.
+func (c *MemoryCache) get(key string) *memoryEntry {
+	c.expireLive()
+
+	if entry, ok := c.live[key]; ok {
+		return entry
+	}
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*memoryEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil
+	}
+
+	c.lru.MoveToFront(element)
+	return entry
+}
+
+// Sets a completed claim under key, evicting the least recently used completed claims past maxEntries. Must be called
+// with mu held.
+func (c *MemoryCache) set(key string, value any, ttl time.Duration) {
+	c.removeLive(key)
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = c.now().Add(ttl)
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key: key, value: value, expiresAt: c.now().Add(ttl)})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// Sets a live entry under key, which is not evicted. A non-zero deadline indexes it for TakeExpiredRequests. Returns
+// ErrCacheFull, leaving the cache as it was, if it already holds maxLiveEntries other live entries. Must be called with
+// mu held.
+func (c *MemoryCache) setLive(key string, value any, ttl time.Duration, deadline time.Time) error {
+	c.expireLive()
+	if _, ok := c.live[key]; !ok && len(c.live) >= c.maxLiveEntries {
+		return ErrCacheFull
+	}
+	c.delete(key)
+
+	entry := &memoryEntry{key: key, value: value, expiresAt: c.now().Add(ttl), deadline: deadline, expiryIndex: -1, deadlineIndex: -1}
+	c.live[key] = entry
+	heap.Push(&c.expiries, entry)
+	if !deadline.IsZero() {
+		heap.Push(&c.deadlines, entry)
+	}
+	return nil
+}
+
+// Removes the live entry under key from the live map and both heaps, returning if there was one. Must be called with
+// mu held.
+func (c *MemoryCache) removeLive(key string) bool {
+	entry, ok := c.live[key]
+	if !ok {
+		return false
+	}
+
+	delete(c.live, key)
+	if entry.expiryIndex >= 0 {
+		heap.Remove(&c.expiries, entry.expiryIndex)
+	}
+	if entry.deadlineIndex >= 0 {
+		heap.Remove(&c.deadlines, entry.deadlineIndex)
+	}
+	return true
+}
+
+// Removes the live entries that expired. Must be called with mu held.
+func (c *MemoryCache) expireLive() {
+	now := c.now()
+	for entry := c.expiries.peek(); entry != nil && !now.Before(entry.expiresAt); entry = c.expiries.peek() {
+		c.removeLive(entry.key)
+	}
+}
+
+// Deletes the entry under key, returning if there was one. Must be called with mu held.
+func (c *MemoryCache) delete(key string) bool {
+	if c.get(key) == nil {
+		return false
+	}
+
+	if c.removeLive(key) {
+		return true
+	}
+	c.lru.Remove(c.entries[key])
+	delete(c.entries, key)
+	return true
+}
+
+func (c *MemoryCache) ClaimMessage(ctx context.Context, id string, lease time.Duration) (MessageClaim, error) {
+	_, span := core.TraceCache(ctx, c.Tracer, "Cache.ClaimMessage")
+	defer span.End()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := "claim:" + tenantScoped(TenantOf(ctx), id)
+	if entry := c.get(key); entry != nil {
+		claim := entry.value.(memoryClaim)
+		if claim.token != "" {
+			return MessageClaim{Id: id, State: ClaimInProgress}, nil
+		}
+		return MessageClaim{Id: id, State: ClaimCompleted, Reply: claim.reply}, nil
+	}
+
+	token := uuid.NewString()
+	if err := c.setLive(key, memoryClaim{token: token}, lease, time.Time{}); err != nil {
+		return MessageClaim{}, fmt.Errorf("failed to claim message with id %s: %w", id, err)
+	}
+	return MessageClaim{Id: id, Token: token, State: ClaimAcquired}, nil
+}
+
+func (c *MemoryCache) CompleteMessage(ctx context.Context, claim MessageClaim, reply []byte) error {
+	_, span := core.TraceCache(ctx, c.Tracer, "Cache.CompleteMessage")
+	defer span.End()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := "claim:" + tenantScoped(TenantOf(ctx), claim.Id)
+	entry := c.get(key)
+	if entry == nil || entry.value.(memoryClaim).token != claim.Token {
+		return fmt.Errorf("failed to complete message with id %s: %w", claim.Id, ErrClaimLost)
+	}
+
+	if len(reply) == 0 {
+		reply = nil
+	}
+	c.set(key, memoryClaim{reply: slices.Clone(reply)}, completedMessageTTL)
+	return nil
+}
+
+func (c *MemoryCache) ReleaseMessage(ctx context.Context, claim MessageClaim) error {
+	_, span := core.TraceCache(ctx, c.Tracer, "Cache.ReleaseMessage")
+	defer span.End()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := "claim:" + tenantScoped(TenantOf(ctx), claim.Id)
+	entry := c.get(key)
+	if entry == nil || entry.value.(memoryClaim).token != claim.Token {
+		return fmt.Errorf("failed to release message with id %s: %w", claim.Id, ErrClaimLost)
+	}
+
+	c.delete(key)
+	return nil
+}
+
+func (c *MemoryCache) GetRequestFromUuid(ctx context.Context, meta v16.Meta, uuid string) (v16.RequestBody, error) {
+	_, span := core.TraceCache(ctx, c.Tracer, "Cache.GetRequestFromUuid")
+	defer span.End()
+
+	key, err := requestKey(TenantOf(ctx), meta, uuid)
+	if err != nil {
+		return v16.RequestBody{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.get(key)
+	if entry == nil {
+		return v16.RequestBody{}, ErrRequestNotFound
+	}
+
+	return entry.value.(PendingRequest).Request, nil
+}
+
+func (c *MemoryCache) AddRequest(ctx context.Context, meta v16.Meta, request v16.RequestBody, timeout time.Duration) error {
+	_, span := core.TraceCache(ctx, c.Tracer, "Cache.AddRequest")
+	defer span.End()
+
+	key, err := requestKey(TenantOf(ctx), meta, request.Uuid)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	pending := PendingRequest{
+		Meta: meta,
+		Request: v16.RequestBody{
+			Uuid:    request.Uuid,
+			Action:  request.Action,
+			Payload: slices.Clone(request.Payload),
+		},
+		AddedAt: now.UTC(),
+		Tenant:  TenantOf(ctx),
+	}
+	if timeout > 0 {
+		pending.Deadline = now.Add(timeout).UTC()
+	}
+	if err := c.setLive(key, pending, pendingRequestTTL, pending.Deadline); err != nil {
+		return fmt.Errorf("failed to add request with uuid %s: %w", request.Uuid, err)
+	}
+	return nil
+}
+
+func (c *MemoryCache) RemoveRequest(ctx context.Context, meta v16.Meta, request v16.ConfirmationBody) error {
+	_, span := core.TraceCache(ctx, c.Tracer, "Cache.RemoveRequest")
+	defer span.End()
+
+	key, err := requestKey(TenantOf(ctx), meta, request.Uuid)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.delete(key) {
+		return ErrRequestNotFound
+	}
+	return nil
+}
+
+func (c *MemoryCache) TakeExpiredRequests(ctx context.Context, now time.Time, limit int) ([]PendingRequest, error) {
+	_, span := core.TraceCache(ctx, c.Tracer, "Cache.TakeExpiredRequests")
+	defer span.End()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expireLive()
+
+	// The deadline index is ordered earliest first, as in RedisCache
+	var expired []PendingRequest
+	for entry := c.deadlines.peek(); entry != nil && len(expired) < limit && !entry.deadline.After(now); entry = c.deadlines.peek() {
+		expired = append(expired, entry.value.(PendingRequest))
+		c.removeLive(entry.key)
+	}
+	return expired, nil
+}
@@ -0,0 +1,162 @@
+package ocpp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	meta := v16.Meta{Serialnumber: "charger-1", Direction: v16.ChargePointToCentralSystem}
+	request := v16.RequestBody{Uuid: "uuid-1", Action: core.Heartbeat, Payload: []byte("{}")}
+
+	t.Run("RequestExpires", func(t *testing.T) {
+		clock := &testClock{now: time.Now()}
+		cache := NewMemoryCache(WithMemoryCacheTracerProvider(noop.NewTracerProvider()), WithMemoryCacheClock(clock.Now))
+
+		assert.NoError(t, cache.AddRequest(ctx, meta, request, 0))
+		clock.Advance(pendingRequestTTL)
+
+		_, err := cache.GetRequestFromUuid(ctx, meta, "uuid-1")
+		assert.ErrorIs(t, err, ErrRequestNotFound)
+	})
+
+	t.Run("CompletedClaimExpires", func(t *testing.T) {
+		clock := &testClock{now: time.Now()}
+		cache := NewMemoryCache(WithMemoryCacheTracerProvider(noop.NewTracerProvider()), WithMemoryCacheClock(clock.Now))
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.CompleteMessage(ctx, claim, []byte("reply")))
+		clock.Advance(completedMessageTTL)
+
+		claim, err = cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, claim.State)
+	})
+
+	t.Run("EvictsLeastRecentlyUsed", func(t *testing.T) {
+		cache := NewMemoryCache(WithMemoryCacheTracerProvider(noop.NewTracerProvider()), WithMemoryCacheMaxEntries(2))
+
+		complete := func(id string) {
+			claim, err := cache.ClaimMessage(ctx, id, time.Minute)
+			assert.NoError(t, err)
+			assert.NoError(t, cache.CompleteMessage(ctx, claim, nil))
+		}
+		claimState := func(id string) ClaimState {
+			claim, err := cache.ClaimMessage(ctx, id, time.Minute)
+			assert.NoError(t, err)
+			return claim.State
+		}
+
+		complete("message-1")
+		complete("message-2")
+		// Using message-1 makes message-2 the least recently used
+		assert.Equal(t, ClaimCompleted, claimState("message-1"))
+		complete("message-3")
+
+		assert.Equal(t, ClaimAcquired, claimState("message-2"))
+		assert.Equal(t, ClaimCompleted, claimState("message-1"))
+		assert.Equal(t, ClaimCompleted, claimState("message-3"))
+	})
+
+	t.Run("DoesNotEvictLiveEntries", func(t *testing.T) {
+		cache := NewMemoryCache(WithMemoryCacheTracerProvider(noop.NewTracerProvider()), WithMemoryCacheMaxEntries(1))
+
+		inProgress, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		for _, uuid := range []string{"uuid-1", "uuid-2"} {
+			assert.NoError(t, cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: uuid, Action: core.Heartbeat}, time.Minute))
+		}
+		for _, id := range []string{"message-2", "message-3"} {
+			claim, err := cache.ClaimMessage(ctx, id, time.Minute)
+			assert.NoError(t, err)
+			assert.NoError(t, cache.CompleteMessage(ctx, claim, nil))
+		}
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimInProgress, claim.State)
+		for _, uuid := range []string{"uuid-1", "uuid-2"} {
+			_, err = cache.GetRequestFromUuid(ctx, meta, uuid)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, cache.CompleteMessage(ctx, inProgress, nil))
+	})
+
+	t.Run("RefusesPastMaxLiveEntries", func(t *testing.T) {
+		clock := &testClock{now: time.Now()}
+		cache := NewMemoryCache(WithMemoryCacheTracerProvider(noop.NewTracerProvider()), WithMemoryCacheClock(clock.Now), WithMemoryCacheMaxLiveEntries(2))
+
+		inProgress, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: "uuid-1", Action: core.Heartbeat}, time.Hour))
+
+		_, err = cache.ClaimMessage(ctx, "message-2", time.Minute)
+		assert.ErrorIs(t, err, ErrCacheFull)
+		err = cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: "uuid-2", Action: core.Heartbeat}, time.Hour)
+		assert.ErrorIs(t, err, ErrCacheFull)
+		class, ok := classifyError(err)
+		assert.True(t, ok)
+		assert.Equal(t, retry.ClassTransient, class)
+
+		// Replacing a live entry is not refused
+		assert.NoError(t, cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: "uuid-1", Action: core.Heartbeat}, time.Hour))
+
+		// Completing a claim makes room
+		assert.NoError(t, cache.CompleteMessage(ctx, inProgress, nil))
+		claim, err := cache.ClaimMessage(ctx, "message-2", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, claim.State)
+
+		// So does a lease running out
+		_, err = cache.ClaimMessage(ctx, "message-3", time.Minute)
+		assert.ErrorIs(t, err, ErrCacheFull)
+		clock.Advance(time.Minute)
+		_, err = cache.ClaimMessage(ctx, "message-3", time.Minute)
+		assert.NoError(t, err)
+	})
+
+	t.Run("TakeExpiredRequestsKeepsRecency", func(t *testing.T) {
+		clock := &testClock{now: time.Now()}
+		cache := NewMemoryCache(WithMemoryCacheTracerProvider(noop.NewTracerProvider()), WithMemoryCacheClock(clock.Now), WithMemoryCacheMaxEntries(2))
+
+		for _, id := range []string{"message-1", "message-2"} {
+			claim, err := cache.ClaimMessage(ctx, id, time.Minute)
+			assert.NoError(t, err)
+			assert.NoError(t, cache.CompleteMessage(ctx, claim, nil))
+		}
+		assert.NoError(t, cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: "uuid-1", Action: core.Heartbeat}, time.Second))
+		assert.NoError(t, cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: "uuid-2", Action: core.Heartbeat}, time.Hour))
+		clock.Advance(time.Minute)
+
+		expired, err := cache.TakeExpiredRequests(ctx, clock.Now(), 10)
+		assert.NoError(t, err)
+		assert.Len(t, expired, 1)
+		assert.Equal(t, "uuid-1", expired[0].Request.Uuid)
+
+		// The sweep did not touch message-1, so it is still the least recently used and is evicted first
+		claim, err := cache.ClaimMessage(ctx, "message-3", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.CompleteMessage(ctx, claim, nil))
+		claim, err = cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, claim.State)
+	})
+}
+
+func TestNewCache(t *testing.T) {
+	_, err := NewCache(noop.NewTracerProvider(), utils.CacheConfiguration{Driver: CacheDriverMemory, MaxEntries: 10})
+	assert.NoError(t, err)
+
+	_, err = NewCache(noop.NewTracerProvider(), utils.CacheConfiguration{Driver: "memcached"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,543 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	iCore "github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type MemoryStoreOption func(*MemoryStore)
+
+// Keeps charge points, transactions, CDRs, data-quality findings and the message journal in memory, with the semantics of DbStore.
+// Nothing is persisted, so it suits tests and single instances that can lose their state on restart.
+type MemoryStore struct {
+	Tracer trace.Tracer
+	now    func() time.Time
+
+	mu sync.Mutex
+	// Stored values are replaced, never changed in place, so the pointers they hold can be handed out
+	chargepoints  map[chargepointKey]Chargepoint
+	transactions  map[int]Transaction
+	lastId        int
+	findings      map[findingKey]*DataQualityFinding
+	lastFindingId int64
+	journal       []JournalEntry
+	lastJournalId int64
+	samples       map[string][]MeterSample     // per tenant
+	statuses      map[string][]ConnectorStatus // per tenant
+	cdrs          map[cdrKey]ChargeDetailRecord
+	lastCdrId     int64
+}
+
+// Identifies a charge point, as the primary key of the chargepoint table.
+type chargepointKey struct {
+	tenant, serialnumber string
+}
+
+// Identifies the CDR of a transaction, as the unique constraint of the charge_detail_record table.
+type cdrKey struct {
+	serialnumber  string
+	transactionId int
+}
+
+// Identifies a distinct data-quality finding, as the unique constraint of the data_quality_finding table.
+type findingKey struct {
+	tenant, serialnumber, kind, field, value string
+}
+
+// Ensures all required fields are set in the MemoryStore.
+func (s *MemoryStore) Validate() error {
+	if s.Tracer == nil {
+		return fmt.Errorf("tracer provider is not set")
+	}
+	return nil
+}
+
+func WithMemoryStoreTracerProvider(tp trace.TracerProvider) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.Tracer = tp.Tracer("store")
+	}
+}
+
+// Sets the clock boots and findings are timestamped with, for tests.
+func WithMemoryStoreClock(now func() time.Time) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.now = now
+	}
+}
+
+// Creates a new MemoryStore with the provided options.
+func NewMemoryStore(opts ...MemoryStoreOption) *MemoryStore {
+	store := &MemoryStore{
+		now:          time.Now,
+		chargepoints: make(map[chargepointKey]Chargepoint),
+		transactions: make(map[int]Transaction),
+		findings:     make(map[findingKey]*DataQualityFinding),
+		samples:      make(map[string][]MeterSample),
+		statuses:     make(map[string][]ConnectorStatus),
+		cdrs:         make(map[cdrKey]ChargeDetailRecord),
+	}
+
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	if err := store.Validate(); err != nil {
+		panic(err)
+	}
+
+	return store
+}
+
+func (s *MemoryStore) AddChargepoint(ctx context.Context, serialnumber string, payload core.BootNotificationRequest) (ChargepointBoot, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddChargepoint")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	boot := ChargepointBoot{
+		Serialnumber:    serialnumber,
+		FirmwareVersion: payload.FirmwareVersion,
+		BootedAt:        s.now().UTC(),
+	}
+
+	tenant := TenantOf(ctx)
+	chargepoint, ok := s.chargepoints[chargepointKey{tenant, serialnumber}]
+	if ok {
+		boot.PreviousFirmwareVersion = chargepoint.FirmwareVersion
+	}
+	// The last heartbeat is kept across boots, everything else is refreshed
+	s.chargepoints[chargepointKey{tenant, serialnumber}] = Chargepoint{
+		Serialnumber:            serialnumber,
+		Model:                   payload.ChargePointModel,
+		Vendor:                  payload.ChargePointVendor,
+		FirmwareVersion:         payload.FirmwareVersion,
+		Iccid:                   payload.Iccid,
+		Imsi:                    payload.Imsi,
+		MeterSerialNumber:       payload.MeterSerialNumber,
+		MeterType:               payload.MeterType,
+		ChargeBoxSerialNumber:   payload.ChargeBoxSerialNumber,
+		ChargePointSerialNumber: payload.ChargePointSerialNumber,
+		LastBoot:                boot.BootedAt,
+		LastHeartbeat:           chargepoint.LastHeartbeat,
+		Tenant:                  tenant,
+	}
+
+	reported := []struct{ field, value string }{
+		{"chargeBoxSerialNumber", payload.ChargeBoxSerialNumber},
+		{"chargePointSerialNumber", payload.ChargePointSerialNumber},
+	}
+	for _, serial := range reported {
+		if serial.value == "" || serial.value == serialnumber {
+			continue
+		}
+		key := findingKey{tenant, serialnumber, FindingSerialNumberMismatch, serial.field, serial.value}
+		if finding, ok := s.findings[key]; ok {
+			finding.LastSeenAt = boot.BootedAt
+			finding.Occurrences++
+			continue
+		}
+		s.lastFindingId++
+		s.findings[key] = &DataQualityFinding{
+			Id:           s.lastFindingId,
+			Serialnumber: serialnumber,
+			Kind:         FindingSerialNumberMismatch,
+			Field:        serial.field,
+			Value:        serial.value,
+			FirstSeenAt:  boot.BootedAt,
+			LastSeenAt:   boot.BootedAt,
+			Occurrences:  1,
+		}
+	}
+
+	return boot, nil
+}
+
+func (s *MemoryStore) GetChargepoint(ctx context.Context, serialnumber string) (Chargepoint, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetChargepoint")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chargepoint, ok := s.chargepoints[chargepointKey{TenantOf(ctx), serialnumber}]
+	if !ok {
+		return Chargepoint{}, fmt.Errorf("serial number %s: %w", serialnumber, ErrChargepointNotFound)
+	}
+	return chargepoint, nil
+}
+
+func (s *MemoryStore) UpdateLastHeartbeat(ctx context.Context, serialnumber string, payload core.HeartbeatConfirmation) error {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.UpdateLastHeartbeat")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := chargepointKey{TenantOf(ctx), serialnumber}
+	chargepoint, ok := s.chargepoints[key]
+	if !ok {
+		return fmt.Errorf("serial number %s: %w", serialnumber, ErrChargepointNotFound)
+	}
+	lastHeartbeat := payload.CurrentTime.Time
+	chargepoint.LastHeartbeat = &lastHeartbeat
+	s.chargepoints[key] = chargepoint
+	return nil
+}
+
+func (s *MemoryStore) StartTransaction(ctx context.Context, serialnumber string, payload core.StartTransactionRequest) (int, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.StartTransaction")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ids are unique across charge points, as in the charge_transaction table
+	s.lastId++
+	s.transactions[s.lastId] = Transaction{
+		Id:           s.lastId,
+		Serialnumber: serialnumber,
+		ConnectorId:  payload.ConnectorId,
+		IdTag:        payload.IdTag,
+		MeterStart:   payload.MeterStart,
+		StartedAt:    payload.Timestamp.Time,
+		Tenant:       TenantOf(ctx),
+	}
+	return s.lastId, nil
+}
+
+func (s *MemoryStore) StopTransaction(ctx context.Context, serialnumber string, payload core.StopTransactionRequest) error {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.StopTransaction")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transaction, ok := s.transactions[payload.TransactionId]
+	if !ok || transaction.Serialnumber != serialnumber || transaction.Tenant != TenantOf(ctx) {
+		return fmt.Errorf("transaction %d of %s: %w", payload.TransactionId, serialnumber, ErrTransactionNotFound)
+	}
+	if transaction.StoppedAt != nil {
+		return fmt.Errorf("transaction %d of %s: %w", payload.TransactionId, serialnumber, ErrTransactionStopped)
+	}
+
+	meterStop := payload.MeterStop
+	stoppedAt := payload.Timestamp.Time
+	transaction.MeterStop = &meterStop
+	transaction.StoppedAt = &stoppedAt
+	transaction.StopReason = payload.Reason
+	s.transactions[payload.TransactionId] = transaction
+	return nil
+}
+
+func (s *MemoryStore) GetTransaction(ctx context.Context, serialnumber string, transactionId int) (Transaction, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetTransaction")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transaction, ok := s.transactions[transactionId]
+	if !ok || transaction.Serialnumber != serialnumber || transaction.Tenant != TenantOf(ctx) {
+		return Transaction{}, fmt.Errorf("transaction %d of %s: %w", transactionId, serialnumber, ErrTransactionNotFound)
+	}
+	return transaction, nil
+}
+
+func (s *MemoryStore) ListTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListTransactions")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return page(s.matchingTransactions(TenantOf(ctx), filter), filter.Offset, filter.Limit), nil
+}
+
+func (s *MemoryStore) CountTransactions(ctx context.Context, filter TransactionFilter) (int, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.CountTransactions")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.matchingTransactions(TenantOf(ctx), filter)), nil
+}
+
+// Returns the transactions of the tenant matching the filter in the order they started, as in DbStore. The caller
+// holds the lock.
+func (s *MemoryStore) matchingTransactions(tenant string, filter TransactionFilter) []Transaction {
+	var transactions []Transaction
+	for _, transaction := range s.transactions {
+		if transaction.Tenant != tenant {
+			continue
+		}
+		samples := slices.DeleteFunc(slices.Clone(s.samples[tenant]), func(sample MeterSample) bool {
+			return sample.Serialnumber != transaction.Serialnumber || sample.TransactionId != transaction.Id
+		})
+		if filter.Matches(transaction, TransactionUpdatedAt(transaction, samples)) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	slices.SortFunc(transactions, func(a, b Transaction) int {
+		return a.Id - b.Id
+	})
+	return transactions
+}
+
+func (s *MemoryStore) ListDataQualityFindings(ctx context.Context, limit int) ([]DataQualityFinding, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListDataQualityFindings")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant := TenantOf(ctx)
+	var findings []DataQualityFinding
+	for key, finding := range s.findings {
+		if key.tenant == tenant {
+			findings = append(findings, *finding)
+		}
+	}
+
+	// Most recently seen first, as in DbStore
+	slices.SortFunc(findings, func(a, b DataQualityFinding) int {
+		if c := b.LastSeenAt.Compare(a.LastSeenAt); c != 0 {
+			return c
+		}
+		return int(b.Id - a.Id)
+	})
+	if len(findings) > limit {
+		findings = findings[:limit]
+	}
+	return findings, nil
+}
+
+func (s *MemoryStore) AppendJournal(ctx context.Context, entries []JournalEntry) error {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.AppendJournal")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		s.lastJournalId++
+		entry.Id = s.lastJournalId
+		entry.Tenant = TenantOf(ctx)
+		s.journal = append(s.journal, entry)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListJournal(ctx context.Context, filter JournalFilter) ([]JournalEntry, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListJournal")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []JournalEntry
+	for _, entry := range s.journal {
+		if entry.Tenant == TenantOf(ctx) && filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	// Oldest first, as in DbStore
+	slices.SortStableFunc(entries, func(a, b JournalEntry) int {
+		return a.RecordedAt.Compare(b.RecordedAt)
+	})
+	if len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) AddMeterSamples(ctx context.Context, samples []MeterSample) error {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddMeterSamples")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant := TenantOf(ctx)
+	s.samples[tenant] = append(s.samples[tenant], samples...)
+	return nil
+}
+
+func (s *MemoryStore) ListMeterSamples(ctx context.Context, serialnumber string, transactionId int) ([]MeterSample, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListMeterSamples")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var samples []MeterSample
+	for _, sample := range s.samples[TenantOf(ctx)] {
+		if sample.Serialnumber == serialnumber && sample.TransactionId == transactionId {
+			samples = append(samples, sample)
+		}
+	}
+	slices.SortStableFunc(samples, func(a, b MeterSample) int {
+		return a.SampledAt.Compare(b.SampledAt)
+	})
+	return samples, nil
+}
+
+func (s *MemoryStore) AddConnectorStatus(ctx context.Context, status ConnectorStatus) error {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddConnectorStatus")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant := TenantOf(ctx)
+	s.statuses[tenant] = append(s.statuses[tenant], status)
+	return nil
+}
+
+func (s *MemoryStore) ListConnectorStatuses(ctx context.Context, serialnumber string, connectorId int, from, to time.Time) ([]ConnectorStatus, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListConnectorStatuses")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var statuses []ConnectorStatus
+	for _, status := range s.statuses[TenantOf(ctx)] {
+		if status.Serialnumber == serialnumber && status.ConnectorId == connectorId && status.ReportedAt.Before(to) {
+			statuses = append(statuses, status)
+		}
+	}
+	slices.SortStableFunc(statuses, func(a, b ConnectorStatus) int {
+		return a.ReportedAt.Compare(b.ReportedAt)
+	})
+
+	// Keep the status in effect at from, the last one reported at or before it
+	first := 0
+	for i, status := range statuses {
+		if !status.ReportedAt.After(from) {
+			first = i
+		}
+	}
+	for first > 0 && statuses[first-1].ReportedAt.Equal(statuses[first].ReportedAt) {
+		first--
+	}
+	return statuses[first:], nil
+}
+
+func (s *MemoryStore) ListLatestConnectorStatuses(ctx context.Context, serialnumber string) ([]ConnectorStatus, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListLatestConnectorStatuses")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Of statuses reported at the same time, the one added last is the latest, as in DbStore
+	latest := make(map[int]ConnectorStatus)
+	for _, status := range s.statuses[TenantOf(ctx)] {
+		if previous, ok := latest[status.ConnectorId]; status.Serialnumber == serialnumber && (!ok || !status.ReportedAt.Before(previous.ReportedAt)) {
+			latest[status.ConnectorId] = status
+		}
+	}
+	statuses := slices.Collect(maps.Values(latest))
+	slices.SortFunc(statuses, func(a, b ConnectorStatus) int {
+		return a.ConnectorId - b.ConnectorId
+	})
+	return statuses, nil
+}
+
+func (s *MemoryStore) AddCdr(ctx context.Context, cdr ChargeDetailRecord) (int64, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddCdr")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := cdrKey{cdr.Serialnumber, cdr.TransactionId}
+	if _, ok := s.cdrs[key]; ok {
+		return 0, fmt.Errorf("transaction %d of %s: %w", cdr.TransactionId, cdr.Serialnumber, ErrCdrExists)
+	}
+	cdr.Tenant = TenantOf(ctx)
+
+	// The pointers are copied, so the CDR cannot be changed through them once it is stored
+	if cdr.SampledEnergyWh != nil {
+		sampled := *cdr.SampledEnergyWh
+		cdr.SampledEnergyWh = &sampled
+	}
+	if cdr.Cost != nil {
+		cost := *cdr.Cost
+		cdr.Cost = &cost
+	}
+
+	s.lastCdrId++
+	cdr.Id = s.lastCdrId
+	s.cdrs[key] = cdr
+	return cdr.Id, nil
+}
+
+func (s *MemoryStore) GetCdr(ctx context.Context, serialnumber string, transactionId int) (ChargeDetailRecord, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetCdr")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cdr, ok := s.cdrs[cdrKey{serialnumber, transactionId}]
+	if !ok || cdr.Tenant != TenantOf(ctx) {
+		return ChargeDetailRecord{}, fmt.Errorf("transaction %d of %s: %w", transactionId, serialnumber, ErrCdrNotFound)
+	}
+	return cdr, nil
+}
+
+func (s *MemoryStore) ListCdrs(ctx context.Context, filter CdrFilter) ([]ChargeDetailRecord, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListCdrs")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return page(s.matchingCdrs(TenantOf(ctx), filter), filter.Offset, filter.Limit), nil
+}
+
+func (s *MemoryStore) CountCdrs(ctx context.Context, filter CdrFilter) (int, error) {
+	_, span := iCore.TraceDB(ctx, s.Tracer, "Store.CountCdrs")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.matchingCdrs(TenantOf(ctx), filter)), nil
+}
+
+// Returns the CDRs of the tenant matching the filter in the order their transactions stopped, as in DbStore. The caller
+// holds the lock.
+func (s *MemoryStore) matchingCdrs(tenant string, filter CdrFilter) []ChargeDetailRecord {
+	var cdrs []ChargeDetailRecord
+	for _, cdr := range s.cdrs {
+		if cdr.Tenant == tenant && filter.Matches(cdr) {
+			cdrs = append(cdrs, cdr)
+		}
+	}
+	slices.SortFunc(cdrs, func(a, b ChargeDetailRecord) int {
+		if c := a.StoppedAt.Compare(b.StoppedAt); c != 0 {
+			return c
+		}
+		return int(a.Id - b.Id)
+	})
+	return cdrs
+}
+
+// Returns the items left after skipping offset of them, at most limit.
+func page[T any](items []T, offset, limit int) []T {
+	items = items[min(offset, len(items)):]
+	return items[:min(limit, len(items))]
+}
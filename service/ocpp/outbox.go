@@ -0,0 +1,354 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Represents the JSON format of a domain event in the outbox.
+type outboxEvent struct {
+	Id           string          `json:"id"`
+	Type         string          `json:"type"`
+	Serialnumber string          `json:"serialnumber"`
+	OccurredAt   time.Time       `json:"occurredAt"`
+	Data         json.RawMessage `json:"data"`
+	Tenant       string          `json:"tenant,omitempty"`
+}
+
+// Publishes domain events by adding them to the outbox, in the transaction of the message that produced them.
+type OutboxPublisher struct {
+	outbox OutboxAdapter
+}
+
+func NewOutboxPublisher(outbox OutboxAdapter) *OutboxPublisher {
+	return &OutboxPublisher{outbox: outbox}
+}
+
+func (p *OutboxPublisher) Publish(ctx context.Context, event DomainEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event data: %w", event.Type, err)
+	}
+
+	payload, err := json.Marshal(outboxEvent{
+		Id:           event.Id,
+		Type:         event.Type,
+		Serialnumber: event.Serialnumber,
+		OccurredAt:   event.OccurredAt,
+		Data:         data,
+		Tenant:       event.Tenant,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+
+	_, err = p.outbox.AddOutbox(ctx, OutboxMessage{
+		Kind:         OutboxKindEvent,
+		Destination:  event.Type,
+		Payload:      payload,
+		Properties:   core.InjectTraceContext(ctx, map[string]any{}),
+		Serialnumber: event.Serialnumber,
+	})
+	return err
+}
+
+type OutboxRelayOption func(*OutboxRelay)
+
+// Sends the messages in the outbox in the order they were written and marks them sent.
+// Replies go to the transport and domain events to the event publisher. A message that fails to send is retried on the
+// next poll, and holds up the later messages of its charge point until it is sent, but not those of other charge
+// points. Once it has failed maxAttempts times it is parked and no longer sent until it is unparked, and the messages
+// after it are sent. Messages are leased while they are sent, so relays of several instances sharing the outbox do not
+// send the same message, and only the oldest unsent message of a charge point is leased, so they do not send its
+// messages out of order. Sending is at least once: a crash between sending and marking a message sent sends it again,
+// with the same id, once its lease runs out.
+type OutboxRelay struct {
+	tracer      trace.Tracer
+	outbox      OutboxAdapter
+	transport   core.Transport
+	publisher   EventPublisher
+	interval    time.Duration
+	batchSize   int
+	retention   time.Duration
+	maxAttempts int
+	lease       time.Duration
+	notify      chan struct{}
+}
+
+// Ensures all required fields are set in the OutboxRelay.
+func (r *OutboxRelay) Validate() error {
+	if r.tracer == nil {
+		return fmt.Errorf("tracer provider is not set")
+	}
+	if r.outbox == nil {
+		return fmt.Errorf("outbox is not set")
+	}
+	if r.transport == nil {
+		return fmt.Errorf("transport is not set")
+	}
+	return nil
+}
+
+func WithOutboxTracerProvider(tp trace.TracerProvider) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.tracer = tp.Tracer("outbox")
+	}
+}
+
+func WithOutboxStore(outbox OutboxAdapter) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.outbox = outbox
+	}
+}
+
+func WithOutboxTransport(transport core.Transport) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.transport = transport
+	}
+}
+
+// Sets the publisher domain events are sent to. Without one, domain events are marked sent without being published.
+func WithOutboxPublisher(publisher EventPublisher) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.publisher = publisher
+	}
+}
+
+// Sets how often the outbox is polled when the relay is not notified.
+func WithOutboxInterval(interval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// Sets how many messages are read from the outbox at a time.
+func WithOutboxBatchSize(size int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// Sets how many times a message may fail to send before it is parked.
+func WithOutboxMaxAttempts(attempts int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if attempts > 0 {
+			r.maxAttempts = attempts
+		}
+	}
+}
+
+// Sets how long messages read from the outbox are leased to the relay. It should be longer than sending a batch takes.
+func WithOutboxLease(lease time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if lease > 0 {
+			r.lease = lease
+		}
+	}
+}
+
+// Sets how long sent messages are kept before they are deleted.
+func WithOutboxRetention(retention time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if retention > 0 {
+			r.retention = retention
+		}
+	}
+}
+
+// Creates a new OutboxRelay with the provided options.
+func NewOutboxRelay(opts ...OutboxRelayOption) *OutboxRelay {
+	relay := &OutboxRelay{
+		interval:    time.Second,
+		batchSize:   100,
+		retention:   24 * time.Hour,
+		maxAttempts: 10,
+		lease:       30 * time.Second,
+		notify:      make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(relay)
+	}
+
+	if err := relay.Validate(); err != nil {
+		slog.Error("Failed to create OutboxRelay", "error", err)
+		panic(err)
+	}
+
+	return relay
+}
+
+// Wakes the relay up to send new messages without waiting for the next poll.
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Sends outbox messages whenever notified or polled, and deletes sent messages past the retention, until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped outbox relay")
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+
+		if err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to send outbox messages", "error", err)
+		}
+
+		if time.Since(lastCleanup) >= time.Hour {
+			if deleted, err := r.outbox.DeleteSentOutbox(ctx, time.Now().Add(-r.retention)); err != nil {
+				slog.Error("Failed to delete sent outbox messages", "error", err)
+			} else if deleted > 0 {
+				slog.Info("Deleted sent outbox messages", "count", deleted)
+			}
+			lastCleanup = time.Now()
+		}
+	}
+}
+
+// Sends the unsent outbox messages in order, skipping those that fail along with the later messages of their charge
+// points. Returns the errors of the messages that failed.
+func (r *OutboxRelay) Flush(ctx context.Context) error {
+	var errs []error
+	for {
+		messages, err := r.outbox.ClaimOutbox(ctx, r.batchSize, r.lease)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		failed := false
+		for _, msg := range messages {
+			if err := r.send(ctx, msg); err != nil {
+				// A send cut short by ctx is not the message's fault, so it does not count as an attempt
+				if ctx.Err() != nil {
+					return errors.Join(append(errs, err)...)
+				}
+				r.fail(ctx, msg, err)
+				errs = append(errs, fmt.Errorf("failed to send outbox message %d: %w", msg.Id, err))
+				failed = true
+				continue
+			}
+
+			if err := r.outbox.MarkOutboxSent(context.WithoutCancel(ctx), msg.Id); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+		}
+
+		// Failed messages are released and would be claimed again, so they wait for the next poll. A charge point has one
+		// message in a batch, so its next message is claimed by the next one.
+		if failed || len(messages) == 0 {
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// Records a failed attempt to send a message, parking it once it has failed maxAttempts times.
+func (r *OutboxRelay) fail(ctx context.Context, msg OutboxMessage, err error) {
+	ctx = context.WithoutCancel(ctx)
+
+	if msg.Attempts+1 < r.maxAttempts {
+		if markErr := r.outbox.MarkOutboxFailed(ctx, msg.Id, err.Error()); markErr != nil {
+			slog.Error("Failed to mark outbox message failed", "error", markErr, "id", msg.Id)
+		}
+		return
+	}
+
+	if parkErr := r.outbox.ParkOutbox(ctx, msg.Id, err.Error()); parkErr != nil {
+		slog.Error("Failed to park outbox message", "error", parkErr, "id", msg.Id)
+		return
+	}
+	slog.Error("Parked outbox message", "id", msg.Id, "kind", msg.Kind, "destination", msg.Destination, "attempts", msg.Attempts+1, "error", err)
+}
+
+// Unparks a parked message and wakes the relay up to send it.
+func (r *OutboxRelay) Unpark(ctx context.Context, id int64) error {
+	if err := r.outbox.UnparkOutbox(ctx, id); err != nil {
+		return err
+	}
+	r.Notify()
+	return nil
+}
+
+// Sends an outbox message for its tenant, continuing the trace of the message that produced it.
+func (r *OutboxRelay) send(ctx context.Context, msg OutboxMessage) error {
+	ctx = WithTenant(ctx, msg.Tenant)
+	ctx, span := r.tracer.Start(core.ExtractTraceContext(ctx, msg.Properties), "Outbox.Send", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.Int64("outbox.id", msg.Id),
+		attribute.String("outbox.kind", string(msg.Kind)),
+		attribute.String("outbox.destination", msg.Destination),
+		attribute.Int("outbox.attempts", msg.Attempts),
+	))
+	defer span.End()
+
+	var err error
+	switch msg.Kind {
+	case OutboxKindReply:
+		err = r.sendReply(ctx, msg)
+	case OutboxKindEvent:
+		err = r.publishEvent(ctx, msg)
+	default:
+		err = fmt.Errorf("unknown outbox message kind %q", msg.Kind)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Outbox message sent")
+	return nil
+}
+
+func (r *OutboxRelay) sendReply(ctx context.Context, msg OutboxMessage) error {
+	event, err := cloudevents.FromStructured(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	return r.transport.SendEvent(ctx, msg.Destination, event)
+}
+
+func (r *OutboxRelay) publishEvent(ctx context.Context, msg OutboxMessage) error {
+	if r.publisher == nil {
+		return nil
+	}
+
+	var event outboxEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to unmarshal outbox event: %w", err)
+	}
+
+	return r.publisher.Publish(ctx, DomainEvent{
+		Id:           event.Id,
+		Type:         event.Type,
+		Serialnumber: event.Serialnumber,
+		OccurredAt:   event.OccurredAt,
+		Data:         event.Data,
+		Tenant:       event.Tenant,
+	})
+}
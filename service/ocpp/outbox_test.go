@@ -0,0 +1,338 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	iCore "github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+
+	reply, err := cloudevents.New(eventSource, "123456789", []byte(`[3, "uuid-1", {}]`))
+	assert.NoError(t, err)
+	replyPayload, err := json.Marshal(reply)
+	assert.NoError(t, err)
+
+	t.Run("SendsInOrder", func(t *testing.T) {
+		store := setupOutboxTest(t)
+		transport := &mockTransport{}
+		publisher := &mockPublisher{}
+		relay := NewOutboxRelay(
+			WithOutboxTracerProvider(noop.NewTracerProvider()),
+			WithOutboxStore(store),
+			WithOutboxTransport(transport),
+			WithOutboxPublisher(publisher),
+		)
+
+		assert.NoError(t, store.InTx(ctx, func(ctx context.Context) error {
+			if _, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: replyPayload, Serialnumber: "123456789"}); err != nil {
+				return err
+			}
+			return NewOutboxPublisher(store).Publish(ctx, DomainEvent{
+				Id:           "message-1:" + EventStatusChanged,
+				Type:         EventStatusChanged,
+				Serialnumber: "123456789",
+				Data:         StatusChanged{ConnectorId: 1, Status: core.ChargePointStatusCharging},
+			})
+		}))
+
+		assert.NoError(t, relay.Flush(ctx))
+
+		assert.Len(t, transport.sent, 1)
+		assert.Equal(t, "socket-commands", transport.sent[0].topic)
+		assert.Equal(t, reply.ID, transport.sent[0].event.ID)
+		assert.JSONEq(t, string(reply.Data), string(transport.sent[0].event.Data))
+
+		assert.Len(t, publisher.events, 1)
+		event := publisher.last()
+		assert.Equal(t, "message-1:"+EventStatusChanged, event.Id)
+		assert.JSONEq(t, `{"connectorId":1,"status":"Charging","errorCode":"","timestamp":"0001-01-01T00:00:00Z"}`, string(event.Data.(json.RawMessage)))
+
+		unsent, err := store.ListUnsentOutbox(ctx, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, unsent)
+	})
+
+	t.Run("FailureSkipsMessage", func(t *testing.T) {
+		store := setupOutboxTest(t)
+		transport := &mockTransport{}
+		relay := NewOutboxRelay(
+			WithOutboxTracerProvider(noop.NewTracerProvider()),
+			WithOutboxStore(store),
+			WithOutboxTransport(transport),
+			WithOutboxPublisher(&mockPublisher{}),
+		)
+
+		// An event that cannot be read fails every time it is sent, but does not hold up another charge point
+		_, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindEvent, Destination: EventStatusChanged, Payload: []byte(`not json`), Serialnumber: "charger-1"})
+		assert.NoError(t, err)
+		_, err = store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: replyPayload, Serialnumber: "charger-2"})
+		assert.NoError(t, err)
+
+		assert.Error(t, relay.Flush(ctx))
+		assert.Len(t, transport.sent, 1)
+
+		unsent, err := store.ListUnsentOutbox(ctx, 10)
+		assert.NoError(t, err)
+		assert.Len(t, unsent, 1)
+		assert.Equal(t, OutboxKindEvent, unsent[0].Kind)
+		assert.Equal(t, 1, unsent[0].Attempts)
+		assert.Contains(t, unsent[0].LastError, "failed to unmarshal outbox event")
+	})
+
+	t.Run("FailureHoldsBackChargepoint", func(t *testing.T) {
+		store := setupOutboxTest(t)
+		transport := &mockTransport{}
+		relay := NewOutboxRelay(
+			WithOutboxTracerProvider(noop.NewTracerProvider()),
+			WithOutboxStore(store),
+			WithOutboxTransport(transport),
+			WithOutboxPublisher(&mockPublisher{}),
+			WithOutboxMaxAttempts(2),
+		)
+
+		failing, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindEvent, Destination: EventStatusChanged, Payload: []byte(`not json`), Serialnumber: "123456789"})
+		assert.NoError(t, err)
+		_, err = store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: replyPayload, Serialnumber: "123456789"})
+		assert.NoError(t, err)
+
+		// The reply is not sent before the event written before it
+		assert.Error(t, relay.Flush(ctx))
+		assert.Empty(t, transport.sent)
+
+		// Nor while the failed event is leased by another relay
+		claimed, err := store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{failing}, outboxIds(claimed))
+		assert.NoError(t, relay.Flush(ctx))
+		assert.Empty(t, transport.sent)
+		assert.NoError(t, store.MarkOutboxFailed(ctx, failing, "connection refused"))
+
+		// Once the event is parked, the reply is sent
+		assert.Error(t, relay.Flush(ctx))
+		assert.NoError(t, relay.Flush(ctx))
+		assert.Len(t, transport.sent, 1)
+	})
+
+	t.Run("ParksAfterMaxAttempts", func(t *testing.T) {
+		store := setupOutboxTest(t)
+		transport := &mockTransport{err: errors.New("connection refused")}
+		relay := NewOutboxRelay(
+			WithOutboxTracerProvider(noop.NewTracerProvider()),
+			WithOutboxStore(store),
+			WithOutboxTransport(transport),
+			WithOutboxMaxAttempts(2),
+		)
+
+		id, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: replyPayload})
+		assert.NoError(t, err)
+
+		assert.Error(t, relay.Flush(ctx))
+		assert.Error(t, relay.Flush(ctx))
+		assert.NoError(t, relay.Flush(ctx), "expected parked message not to be sent")
+
+		unsent, err := store.ListUnsentOutbox(ctx, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, unsent)
+
+		parked, err := store.ListParkedOutbox(ctx, 10)
+		assert.NoError(t, err)
+		assert.Len(t, parked, 1)
+		assert.Equal(t, id, parked[0].Id)
+		assert.Equal(t, 2, parked[0].Attempts)
+		assert.Equal(t, "connection refused", parked[0].LastError)
+		assert.NotNil(t, parked[0].ParkedAt)
+
+		transport.err = nil
+		assert.NoError(t, relay.Unpark(ctx, id))
+		assert.ErrorIs(t, relay.Unpark(ctx, id), ErrOutboxNotParked)
+		assert.NoError(t, relay.Flush(ctx))
+		assert.Len(t, transport.sent, 1)
+
+		parked, err = store.ListParkedOutbox(ctx, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, parked)
+	})
+}
+
+func TestOutboxClaim(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("LeasedMessagesNotClaimedAgain", func(t *testing.T) {
+		store := setupOutboxTest(t)
+		for i := range 3 {
+			_, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`), Serialnumber: fmt.Sprintf("charger-%d", i)})
+			assert.NoError(t, err)
+		}
+
+		first, err := store.ClaimOutbox(ctx, 2, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1, 2}, outboxIds(first))
+
+		second, err := store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{3}, outboxIds(second))
+
+		none, err := store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Empty(t, none)
+
+		// A failed message is released, so it can be claimed again
+		assert.NoError(t, store.MarkOutboxFailed(ctx, 1, "connection refused"))
+		retried, err := store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1}, outboxIds(retried))
+	})
+
+	t.Run("OldestMessageOfChargepoint", func(t *testing.T) {
+		store := setupOutboxTest(t)
+		for _, serialnumber := range []string{"charger-1", "charger-1", "charger-2"} {
+			_, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`), Serialnumber: serialnumber})
+			assert.NoError(t, err)
+		}
+		// The same serial number is another charge point in another tenant
+		_, err := store.AddOutbox(WithTenant(ctx, "operator-a"), OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`), Serialnumber: "charger-1"})
+		assert.NoError(t, err)
+
+		claimed, err := store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1, 3, 4}, outboxIds(claimed))
+
+		// A failed message is claimed again before the next message of its charge point
+		assert.NoError(t, store.MarkOutboxFailed(ctx, 1, "connection refused"))
+		claimed, err = store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1}, outboxIds(claimed))
+
+		assert.NoError(t, store.MarkOutboxSent(ctx, 1))
+		claimed, err = store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{2}, outboxIds(claimed))
+	})
+
+	t.Run("ExpiredLeaseClaimedAgain", func(t *testing.T) {
+		store := setupOutboxTest(t)
+		_, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`)})
+		assert.NoError(t, err)
+
+		claimed, err := store.ClaimOutbox(ctx, 10, time.Millisecond)
+		assert.NoError(t, err)
+		assert.Len(t, claimed, 1)
+
+		time.Sleep(5 * time.Millisecond)
+		claimed, err = store.ClaimOutbox(ctx, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Len(t, claimed, 1)
+	})
+}
+
+func outboxIds(messages []OutboxMessage) []int64 {
+	ids := make([]int64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.Id
+	}
+	return ids
+}
+
+func TestOutboxTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RollbackDiscardsChanges", func(t *testing.T) {
+		store := setupOutboxTest(t)
+
+		err := store.InTx(ctx, func(ctx context.Context) error {
+			if err := store.MarkProcessed(ctx, "message-1"); err != nil {
+				return err
+			}
+			if _, err := store.StartTransaction(ctx, "123456789", core.StartTransactionRequest{ConnectorId: 1, IdTag: "TAG", Timestamp: types.Now()}); err != nil {
+				return err
+			}
+			if _, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`)}); err != nil {
+				return err
+			}
+			return errors.New("handler failed")
+		})
+		assert.Error(t, err)
+
+		unsent, err := store.ListUnsentOutbox(ctx, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, unsent)
+
+		// The message was not marked processed, so it can be processed again
+		assert.NoError(t, store.MarkProcessed(ctx, "message-1"))
+	})
+
+	t.Run("AlreadyProcessed", func(t *testing.T) {
+		store := setupOutboxTest(t)
+
+		assert.NoError(t, store.InTx(ctx, func(ctx context.Context) error {
+			return store.MarkProcessed(ctx, "message-1")
+		}))
+
+		err := store.InTx(ctx, func(ctx context.Context) error {
+			return store.MarkProcessed(ctx, "message-1")
+		})
+		assert.ErrorIs(t, err, ErrAlreadyProcessed)
+	})
+}
+
+func setupOutboxTest(t *testing.T) *DbStore {
+	t.Helper()
+
+	queries, database, err := db.Connect(utils.DatabaseConfiguration{
+		Driver:   "sqlite3",
+		Protocol: "file",
+		Address:  t.TempDir() + "/ocpp.db",
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+
+	return NewDbStore(noop.NewTracerProvider(), queries, database)
+}
+
+type sentEvent struct {
+	topic string
+	event cloudevents.Event
+}
+
+type mockTransport struct {
+	sent []sentEvent
+	err  error
+}
+
+func (m *mockTransport) SendMessage(ctx context.Context, topic string, message *iCore.Message) error {
+	return m.err
+}
+
+func (m *mockTransport) SendEvent(ctx context.Context, topic string, event cloudevents.Event) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentEvent{topic: topic, event: event})
+	return nil
+}
+
+func (m *mockTransport) ReceiveMessage(ctx context.Context, topic, subscription string, handler iCore.MessageHandler) error {
+	return nil
+}
+
+func (m *mockTransport) Wait(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockTransport) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,1164 @@
+package ocpp
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	iCore "github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db/pgschemas"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Stores in PostgreSQL through a pool of pgx connections, with the semantics of DbStore.
+type PgStore struct {
+	Tracer  trace.Tracer
+	pool    *pgxpool.Pool
+	queries *pgschemas.Queries
+}
+
+func NewPgStore(tp trace.TracerProvider, queries *pgschemas.Queries, pool *pgxpool.Pool) *PgStore {
+	return &PgStore{
+		Tracer:  tp.Tracer("store"),
+		pool:    pool,
+		queries: queries,
+	}
+}
+
+// Context key of the transaction started by PgStore.InTx.
+type pgTxKey struct{}
+
+// Returns the queries bound to the transaction of ctx, if InTx started one.
+func (s *PgStore) q(ctx context.Context) *pgschemas.Queries {
+	if tx, ok := ctx.Value(pgTxKey{}).(pgx.Tx); ok {
+		return s.queries.WithTx(tx)
+	}
+	return s.queries
+}
+
+// Runs fn in a transaction, committing it if fn succeeds and rolling it back otherwise.
+// Store calls made with the context passed to fn take part in the transaction. Nested calls join the outer transaction.
+func (s *PgStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pgTxKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.InTx")
+	defer span.End()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return handleDBError(ctx, "to begin transaction", err)
+	}
+
+	if err := fn(context.WithValue(ctx, pgTxKey{}, tx)); err != nil {
+		if rollbackErr := tx.Rollback(context.WithoutCancel(ctx)); rollbackErr != nil {
+			slog.Error("failed to roll back transaction", "error", rollbackErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return handleDBError(ctx, "to commit transaction", err)
+	}
+
+	return nil
+}
+
+// Closes the connections of the pool, waiting for those in use to be released.
+func (s *PgStore) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+func (s *PgStore) AddChargepoint(ctx context.Context, serialnumber string, payload core.BootNotificationRequest) (ChargepointBoot, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddChargepoint")
+	defer span.End()
+
+	boot := ChargepointBoot{
+		Serialnumber:    serialnumber,
+		FirmwareVersion: payload.FirmwareVersion,
+		BootedAt:        types.Now().Time,
+	}
+
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		previous, err := s.q(ctx).GetChargepoint(ctx, pgschemas.GetChargepointParams{
+			TenantID:     TenantOf(ctx),
+			SerialNumber: boot.Serialnumber,
+		})
+		switch {
+		case err == nil:
+			boot.PreviousFirmwareVersion = previous.FirmwareVersion
+		case !errors.Is(err, pgx.ErrNoRows):
+			return handleDBError(ctx, "to get chargepoint", err)
+		}
+
+		_, err = s.q(ctx).UpsertChargepoint(ctx, pgschemas.UpsertChargepointParams{
+			TenantID:                TenantOf(ctx),
+			SerialNumber:            boot.Serialnumber,
+			Model:                   payload.ChargePointModel,
+			Vendor:                  payload.ChargePointVendor,
+			FirmwareVersion:         payload.FirmwareVersion,
+			Iicid:                   nullText(payload.Iccid),
+			Imsi:                    nullText(payload.Imsi),
+			MeterSerialNumber:       nullText(payload.MeterSerialNumber),
+			MeterType:               nullText(payload.MeterType),
+			LastBoot:                boot.BootedAt,
+			ChargeBoxSerialNumber:   nullText(payload.ChargeBoxSerialNumber),
+			ChargePointSerialNumber: nullText(payload.ChargePointSerialNumber),
+		})
+		if err != nil {
+			return handleDBError(ctx, "to add chargepoint", err)
+		}
+
+		_, err = s.q(ctx).InsertBootHistory(ctx, pgschemas.InsertBootHistoryParams{
+			TenantID:                TenantOf(ctx),
+			SerialNumber:            boot.Serialnumber,
+			Model:                   payload.ChargePointModel,
+			Vendor:                  payload.ChargePointVendor,
+			FirmwareVersion:         payload.FirmwareVersion,
+			PreviousFirmwareVersion: nullText(boot.PreviousFirmwareVersion),
+			BootedAt:                boot.BootedAt,
+		})
+		if err != nil {
+			return handleDBError(ctx, "to add boot history", err)
+		}
+
+		reported := []struct{ field, value string }{
+			{"chargeBoxSerialNumber", payload.ChargeBoxSerialNumber},
+			{"chargePointSerialNumber", payload.ChargePointSerialNumber},
+		}
+		for _, serial := range reported {
+			if serial.value == "" || serial.value == serialnumber {
+				continue
+			}
+			slog.Warn("Chargepoint reported a different serial number",
+				"serialnumber", serialnumber,
+				"field", serial.field,
+				"value", serial.value,
+			)
+			err := s.q(ctx).UpsertDataQualityFinding(ctx, pgschemas.UpsertDataQualityFindingParams{
+				TenantID:     TenantOf(ctx),
+				SerialNumber: serialnumber,
+				Kind:         FindingSerialNumberMismatch,
+				Field:        serial.field,
+				Value:        serial.value,
+				FirstSeenAt:  boot.BootedAt,
+				LastSeenAt:   boot.BootedAt,
+			})
+			if err != nil {
+				return handleDBError(ctx, "to add data quality finding", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ChargepointBoot{}, err
+	}
+
+	return boot, nil
+}
+
+func (s *PgStore) GetChargepoint(ctx context.Context, serialnumber string) (Chargepoint, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetChargepoint")
+	defer span.End()
+
+	row, err := s.q(ctx).GetChargepoint(ctx, pgschemas.GetChargepointParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Chargepoint{}, fmt.Errorf("serial number %s: %w", serialnumber, ErrChargepointNotFound)
+	}
+	if err != nil {
+		return Chargepoint{}, handleDBError(ctx, "to get chargepoint", err)
+	}
+
+	return Chargepoint{
+		Serialnumber:            row.SerialNumber,
+		Model:                   row.Model,
+		Vendor:                  row.Vendor,
+		FirmwareVersion:         row.FirmwareVersion,
+		Iccid:                   textOf(row.Iicid),
+		Imsi:                    textOf(row.Imsi),
+		MeterSerialNumber:       textOf(row.MeterSerialNumber),
+		MeterType:               textOf(row.MeterType),
+		ChargeBoxSerialNumber:   textOf(row.ChargeBoxSerialNumber),
+		ChargePointSerialNumber: textOf(row.ChargePointSerialNumber),
+		LastBoot:                row.LastBoot,
+		Tenant:                  row.TenantID,
+		LastHeartbeat:           row.LastHeartbeat,
+	}, nil
+}
+
+func (s *PgStore) UpdateLastHeartbeat(ctx context.Context, serialnumber string, payload core.HeartbeatConfirmation) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.UpdateLastHeartbeat")
+	defer span.End()
+
+	lastHeartbeat := payload.CurrentTime.Time
+	_, err := s.q(ctx).UpdateChargepointLastHeartbeat(ctx, pgschemas.UpdateChargepointLastHeartbeatParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  serialnumber,
+		LastHeartbeat: &lastHeartbeat,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("serial number %s: %w", serialnumber, ErrChargepointNotFound)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to update last heartbeat", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) StartTransaction(ctx context.Context, serialnumber string, payload core.StartTransactionRequest) (int, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.StartTransaction")
+	defer span.End()
+
+	id, err := s.q(ctx).InsertTransaction(ctx, pgschemas.InsertTransactionParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
+		ConnectorID:  int64(payload.ConnectorId),
+		IdTag:        payload.IdTag,
+		MeterStart:   int64(payload.MeterStart),
+		StartedAt:    payload.Timestamp.Time,
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to start transaction", err)
+	}
+
+	return int(id), nil
+}
+
+func (s *PgStore) StopTransaction(ctx context.Context, serialnumber string, payload core.StopTransactionRequest) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.StopTransaction")
+	defer span.End()
+
+	meterStop := int64(payload.MeterStop)
+	stoppedAt := payload.Timestamp.Time
+	_, err := s.q(ctx).StopTransaction(ctx, pgschemas.StopTransactionParams{
+		TenantID:     TenantOf(ctx),
+		MeterStop:    &meterStop,
+		StoppedAt:    &stoppedAt,
+		StopReason:   nullText(string(payload.Reason)),
+		ID:           int64(payload.TransactionId),
+		SerialNumber: serialnumber,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either the transaction is not known or it has already stopped
+		if _, err := s.GetTransaction(ctx, serialnumber, payload.TransactionId); err != nil {
+			return err
+		}
+		return fmt.Errorf("transaction %d of %s: %w", payload.TransactionId, serialnumber, ErrTransactionStopped)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to stop transaction", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) GetTransaction(ctx context.Context, serialnumber string, transactionId int) (Transaction, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetTransaction")
+	defer span.End()
+
+	row, err := s.q(ctx).GetTransaction(ctx, pgschemas.GetTransactionParams{
+		TenantID:     TenantOf(ctx),
+		ID:           int64(transactionId),
+		SerialNumber: serialnumber,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Transaction{}, fmt.Errorf("transaction %d of %s: %w", transactionId, serialnumber, ErrTransactionNotFound)
+	}
+	if err != nil {
+		return Transaction{}, handleDBError(ctx, "to get transaction", err)
+	}
+
+	return pgTransaction(row), nil
+}
+
+func (s *PgStore) ListTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListTransactions")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListTransactions(ctx, pgschemas.ListTransactionsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumbers: filter.Serialnumbers,
+		UpdatedFrom:   nullTime(filter.UpdatedFrom),
+		UpdatedTo:     nullTime(filter.UpdatedTo),
+		Limit:         int32(filter.Limit),
+		Offset:        int32(filter.Offset),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list transactions", err)
+	}
+
+	transactions := make([]Transaction, 0, len(rows))
+	for _, row := range rows {
+		transactions = append(transactions, pgTransaction(row))
+	}
+
+	return transactions, nil
+}
+
+func (s *PgStore) CountTransactions(ctx context.Context, filter TransactionFilter) (int, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.CountTransactions")
+	defer span.End()
+
+	count, err := s.q(ctx).CountTransactions(ctx, pgschemas.CountTransactionsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumbers: filter.Serialnumbers,
+		UpdatedFrom:   nullTime(filter.UpdatedFrom),
+		UpdatedTo:     nullTime(filter.UpdatedTo),
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to count transactions", err)
+	}
+
+	return int(count), nil
+}
+
+// Returns the transaction stored in a charge_transaction row.
+func pgTransaction(row pgschemas.ChargeTransaction) Transaction {
+	transaction := Transaction{
+		Id:           int(row.ID),
+		Serialnumber: row.SerialNumber,
+		ConnectorId:  int(row.ConnectorID),
+		IdTag:        row.IdTag,
+		MeterStart:   int(row.MeterStart),
+		StartedAt:    row.StartedAt,
+		StoppedAt:    row.StoppedAt,
+		StopReason:   core.Reason(textOf(row.StopReason)),
+		Tenant:       row.TenantID,
+	}
+	if row.MeterStop != nil {
+		meterStop := int(*row.MeterStop)
+		transaction.MeterStop = &meterStop
+	}
+	return transaction
+}
+
+func (s *PgStore) Quarantine(ctx context.Context, msg QuarantinedMessage) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.Quarantine")
+	defer span.End()
+
+	properties, err := json.Marshal(msg.Properties)
+	if err != nil {
+		return 0, handleDBError(ctx, "to marshal quarantined message properties", err)
+	}
+
+	quarantinedAt := msg.QuarantinedAt
+	if quarantinedAt.IsZero() {
+		quarantinedAt = time.Now()
+	}
+
+	id, err := s.q(ctx).InsertQuarantinedMessage(ctx, pgschemas.InsertQuarantinedMessageParams{
+		MessageID:     msg.MessageId,
+		SerialNumber:  nullText(msg.Serialnumber),
+		Topic:         msg.Topic,
+		Subscription:  msg.Subscription,
+		ContentType:   nullText(msg.ContentType),
+		Properties:    string(properties),
+		Body:          msg.Body,
+		Error:         msg.Error,
+		ErrorClass:    msg.ErrorClass,
+		Attempts:      int64(msg.Attempts),
+		QuarantinedAt: quarantinedAt,
+		TenantID:      TenantOf(ctx),
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to quarantine message", err)
+	}
+
+	return id, nil
+}
+
+func (s *PgStore) GetQuarantined(ctx context.Context, id int64) (QuarantinedMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetQuarantined")
+	defer span.End()
+
+	row, err := s.q(ctx).GetQuarantinedMessage(ctx, pgschemas.GetQuarantinedMessageParams{
+		TenantID: TenantOf(ctx),
+		ID:       id,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return QuarantinedMessage{}, fmt.Errorf("quarantined message %d not found", id)
+	}
+	if err != nil {
+		return QuarantinedMessage{}, handleDBError(ctx, "to get quarantined message", err)
+	}
+
+	return pgQuarantinedMessage(row)
+}
+
+func (s *PgStore) ListQuarantined(ctx context.Context, limit int) ([]QuarantinedMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListQuarantined")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListQuarantinedMessages(ctx, pgschemas.ListQuarantinedMessagesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list quarantined messages", err)
+	}
+
+	messages := make([]QuarantinedMessage, 0, len(rows))
+	for _, row := range rows {
+		msg, err := pgQuarantinedMessage(row)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (s *PgStore) MarkRedriven(ctx context.Context, id int64) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkRedriven")
+	defer span.End()
+
+	redrivenAt := time.Now()
+	_, err := s.q(ctx).MarkQuarantinedMessageRedriven(ctx, pgschemas.MarkQuarantinedMessageRedrivenParams{
+		RedrivenAt: &redrivenAt,
+		TenantID:   TenantOf(ctx),
+		ID:         id,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("quarantined message %d not found or already redriven", id)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to mark quarantined message redriven", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) RecordWebhookDelivery(ctx context.Context, delivery WebhookDelivery) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.RecordWebhookDelivery")
+	defer span.End()
+
+	createdAt := delivery.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	params := pgschemas.InsertWebhookDeliveryParams{
+		EventID:     delivery.EventId,
+		EventType:   delivery.EventType,
+		Url:         delivery.URL,
+		Attempts:    int64(delivery.Attempts),
+		Error:       nullText(delivery.Error),
+		CreatedAt:   createdAt,
+		DeliveredAt: delivery.DeliveredAt,
+		TenantID:    TenantOf(ctx),
+	}
+	if delivery.StatusCode != 0 {
+		statusCode := int64(delivery.StatusCode)
+		params.StatusCode = &statusCode
+	}
+
+	id, err := s.q(ctx).InsertWebhookDelivery(ctx, params)
+	if err != nil {
+		return 0, handleDBError(ctx, "to record webhook delivery", err)
+	}
+
+	return id, nil
+}
+
+func (s *PgStore) ListWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListWebhookDeliveries")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListWebhookDeliveries(ctx, pgschemas.ListWebhookDeliveriesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list webhook deliveries", err)
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		delivery := WebhookDelivery{
+			Id:          row.ID,
+			EventId:     row.EventID,
+			EventType:   row.EventType,
+			URL:         row.Url,
+			Attempts:    int(row.Attempts),
+			Error:       textOf(row.Error),
+			CreatedAt:   row.CreatedAt,
+			DeliveredAt: row.DeliveredAt,
+			Tenant:      row.TenantID,
+		}
+		if row.StatusCode != nil {
+			delivery.StatusCode = int(*row.StatusCode)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (s *PgStore) ListDataQualityFindings(ctx context.Context, limit int) ([]DataQualityFinding, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListDataQualityFindings")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListDataQualityFindings(ctx, pgschemas.ListDataQualityFindingsParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list data quality findings", err)
+	}
+
+	findings := make([]DataQualityFinding, 0, len(rows))
+	for _, row := range rows {
+		findings = append(findings, DataQualityFinding{
+			Id:           row.ID,
+			Serialnumber: row.SerialNumber,
+			Kind:         row.Kind,
+			Field:        row.Field,
+			Value:        row.Value,
+			FirstSeenAt:  row.FirstSeenAt,
+			LastSeenAt:   row.LastSeenAt,
+			Occurrences:  int(row.Occurrences),
+		})
+	}
+
+	return findings, nil
+}
+
+func (s *PgStore) AppendJournal(ctx context.Context, entries []JournalEntry) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AppendJournal")
+	defer span.End()
+
+	return s.InTx(ctx, func(ctx context.Context) error {
+		for _, entry := range entries {
+			params := pgschemas.InsertJournalEntryParams{
+				Direction:    string(entry.Direction),
+				SerialNumber: entry.Serialnumber,
+				MessageID:    nullText(entry.MessageId),
+				Action:       nullText(entry.Action),
+				Body:         entry.Body,
+				TraceID:      nullText(entry.TraceId),
+				Outcome:      entry.Outcome,
+				Error:        nullText(entry.Error),
+				LatencyUs:    entry.Latency.Microseconds(),
+				RecordedAt:   entry.RecordedAt,
+				TenantID:     TenantOf(ctx),
+			}
+			if entry.TypeId != 0 {
+				typeId := int64(entry.TypeId)
+				params.TypeID = &typeId
+			}
+			if err := s.q(ctx).InsertJournalEntry(ctx, params); err != nil {
+				return handleDBError(ctx, "to append journal entry", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PgStore) ListJournal(ctx context.Context, filter JournalFilter) ([]JournalEntry, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListJournal")
+	defer span.End()
+
+	params := pgschemas.ListJournalEntriesParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: nullText(filter.Serialnumber),
+		Action:       nullText(filter.Action),
+		Limit:        int32(filter.Limit),
+	}
+	if !filter.From.IsZero() {
+		params.RecordedFrom = &filter.From
+	}
+	if !filter.To.IsZero() {
+		params.RecordedTo = &filter.To
+	}
+
+	rows, err := s.q(ctx).ListJournalEntries(ctx, params)
+	if err != nil {
+		return nil, handleDBError(ctx, "to list journal entries", err)
+	}
+
+	entries := make([]JournalEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := JournalEntry{
+			Id:           row.ID,
+			Direction:    JournalDirection(row.Direction),
+			Serialnumber: row.SerialNumber,
+			MessageId:    textOf(row.MessageID),
+			Action:       textOf(row.Action),
+			Body:         row.Body,
+			TraceId:      textOf(row.TraceID),
+			Outcome:      row.Outcome,
+			Error:        textOf(row.Error),
+			Latency:      time.Duration(row.LatencyUs) * time.Microsecond,
+			RecordedAt:   row.RecordedAt,
+			Tenant:       row.TenantID,
+		}
+		if row.TypeID != nil {
+			entry.TypeId = int(*row.TypeID)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (s *PgStore) AddMeterSamples(ctx context.Context, samples []MeterSample) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddMeterSamples")
+	defer span.End()
+
+	return s.InTx(ctx, func(ctx context.Context) error {
+		for _, sample := range samples {
+			err := s.q(ctx).InsertMeterSample(ctx, pgschemas.InsertMeterSampleParams{
+				TenantID:      TenantOf(ctx),
+				SerialNumber:  sample.Serialnumber,
+				TransactionID: int64(sample.TransactionId),
+				ConnectorID:   int64(sample.ConnectorId),
+				Context:       nullText(string(sample.Context)),
+				RegisterWh:    int64(sample.RegisterWh),
+				SampledAt:     sample.SampledAt,
+			})
+			if err != nil {
+				return handleDBError(ctx, "to add meter sample", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PgStore) ListMeterSamples(ctx context.Context, serialnumber string, transactionId int) ([]MeterSample, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListMeterSamples")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListMeterSamples(ctx, pgschemas.ListMeterSamplesParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  serialnumber,
+		TransactionID: int64(transactionId),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list meter samples", err)
+	}
+
+	samples := make([]MeterSample, 0, len(rows))
+	for _, row := range rows {
+		samples = append(samples, MeterSample{
+			Serialnumber:  row.SerialNumber,
+			TransactionId: int(row.TransactionID),
+			ConnectorId:   int(row.ConnectorID),
+			Context:       types.ReadingContext(textOf(row.Context)),
+			RegisterWh:    int(row.RegisterWh),
+			SampledAt:     row.SampledAt,
+		})
+	}
+
+	return samples, nil
+}
+
+func (s *PgStore) AddConnectorStatus(ctx context.Context, status ConnectorStatus) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddConnectorStatus")
+	defer span.End()
+
+	err := s.q(ctx).InsertConnectorStatus(ctx, pgschemas.InsertConnectorStatusParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: status.Serialnumber,
+		ConnectorID:  int64(status.ConnectorId),
+		Status:       string(status.Status),
+		ErrorCode:    string(status.ErrorCode),
+		Info:         nullText(status.Info),
+		ReportedAt:   status.ReportedAt,
+	})
+	if err != nil {
+		return handleDBError(ctx, "to add connector status", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) ListConnectorStatuses(ctx context.Context, serialnumber string, connectorId int, from, to time.Time) ([]ConnectorStatus, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListConnectorStatuses")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListConnectorStatuses(ctx, pgschemas.ListConnectorStatusesParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
+		ConnectorID:  int64(connectorId),
+		ReportedTo:   to,
+		ReportedFrom: from,
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list connector statuses", err)
+	}
+
+	statuses := make([]ConnectorStatus, 0, len(rows))
+	for _, row := range rows {
+		statuses = append(statuses, pgConnectorStatus(row))
+	}
+
+	return statuses, nil
+}
+
+func (s *PgStore) ListLatestConnectorStatuses(ctx context.Context, serialnumber string) ([]ConnectorStatus, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListLatestConnectorStatuses")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListLatestConnectorStatuses(ctx, pgschemas.ListLatestConnectorStatusesParams{
+		TenantID:     TenantOf(ctx),
+		SerialNumber: serialnumber,
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list latest connector statuses", err)
+	}
+
+	statuses := make([]ConnectorStatus, 0, len(rows))
+	for _, row := range rows {
+		statuses = append(statuses, pgConnectorStatus(row))
+	}
+
+	return statuses, nil
+}
+
+// Returns the status stored in a connector_status row.
+func pgConnectorStatus(row pgschemas.ConnectorStatus) ConnectorStatus {
+	return ConnectorStatus{
+		Serialnumber: row.SerialNumber,
+		ConnectorId:  int(row.ConnectorID),
+		Status:       core.ChargePointStatus(row.Status),
+		ErrorCode:    core.ChargePointErrorCode(row.ErrorCode),
+		Info:         textOf(row.Info),
+		ReportedAt:   row.ReportedAt,
+	}
+}
+
+func (s *PgStore) AddCdr(ctx context.Context, cdr ChargeDetailRecord) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddCdr")
+	defer span.End()
+
+	params := pgschemas.InsertChargeDetailRecordParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  cdr.Serialnumber,
+		TransactionID: int64(cdr.TransactionId),
+		ConnectorID:   int64(cdr.ConnectorId),
+		IdTag:         cdr.IdTag,
+		StartedAt:     cdr.StartedAt,
+		StoppedAt:     cdr.StoppedAt,
+		DurationS:     int64(cdr.Duration / time.Second),
+		MeterStart:    int64(cdr.MeterStart),
+		MeterStop:     int64(cdr.MeterStop),
+		EnergyWh:      int64(cdr.EnergyWh),
+		EnergyCheck:   string(cdr.EnergyCheck),
+		StopReason:    string(cdr.StopReason),
+		ChargingS:     int64(cdr.ChargingTime / time.Second),
+		IdleS:         int64(cdr.IdleTime / time.Second),
+		CreatedAt:     cdr.CreatedAt,
+	}
+	if cdr.SampledEnergyWh != nil {
+		sampled := int64(*cdr.SampledEnergyWh)
+		params.SampledEnergyWh = &sampled
+	}
+	if cdr.Cost != nil {
+		params.TariffID = &cdr.Cost.TariffId
+		params.Currency = &cdr.Cost.Currency
+		params.StartFee = numericOf(cdr.Cost.StartFee)
+		params.EnergyCost = numericOf(cdr.Cost.Energy)
+		params.TimeCost = numericOf(cdr.Cost.Time)
+		params.IdleCost = numericOf(cdr.Cost.Idle)
+		params.TotalCost = numericOf(cdr.Cost.Total)
+	}
+
+	id, err := s.q(ctx).InsertChargeDetailRecord(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("transaction %d of %s: %w", cdr.TransactionId, cdr.Serialnumber, ErrCdrExists)
+	}
+	if err != nil {
+		return 0, handleDBError(ctx, "to add charge detail record", err)
+	}
+
+	return id, nil
+}
+
+func (s *PgStore) GetCdr(ctx context.Context, serialnumber string, transactionId int) (ChargeDetailRecord, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.GetCdr")
+	defer span.End()
+
+	row, err := s.q(ctx).GetChargeDetailRecord(ctx, pgschemas.GetChargeDetailRecordParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  serialnumber,
+		TransactionID: int64(transactionId),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ChargeDetailRecord{}, fmt.Errorf("transaction %d of %s: %w", transactionId, serialnumber, ErrCdrNotFound)
+	}
+	if err != nil {
+		return ChargeDetailRecord{}, handleDBError(ctx, "to get charge detail record", err)
+	}
+
+	return pgChargeDetailRecord(row), nil
+}
+
+func (s *PgStore) ListCdrs(ctx context.Context, filter CdrFilter) ([]ChargeDetailRecord, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListCdrs")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListChargeDetailRecords(ctx, pgschemas.ListChargeDetailRecordsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  nullText(filter.Serialnumber),
+		SerialNumbers: filter.Serialnumbers,
+		StoppedFrom:   nullTime(filter.From),
+		StoppedTo:     nullTime(filter.To),
+		CreatedFrom:   nullTime(filter.CreatedFrom),
+		CreatedTo:     nullTime(filter.CreatedTo),
+		Limit:         int32(filter.Limit),
+		Offset:        int32(filter.Offset),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list charge detail records", err)
+	}
+
+	cdrs := make([]ChargeDetailRecord, 0, len(rows))
+	for _, row := range rows {
+		cdrs = append(cdrs, pgChargeDetailRecord(row))
+	}
+
+	return cdrs, nil
+}
+
+func (s *PgStore) CountCdrs(ctx context.Context, filter CdrFilter) (int, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.CountCdrs")
+	defer span.End()
+
+	count, err := s.q(ctx).CountChargeDetailRecords(ctx, pgschemas.CountChargeDetailRecordsParams{
+		TenantID:      TenantOf(ctx),
+		SerialNumber:  nullText(filter.Serialnumber),
+		SerialNumbers: filter.Serialnumbers,
+		StoppedFrom:   nullTime(filter.From),
+		StoppedTo:     nullTime(filter.To),
+		CreatedFrom:   nullTime(filter.CreatedFrom),
+		CreatedTo:     nullTime(filter.CreatedTo),
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to count charge detail records", err)
+	}
+
+	return int(count), nil
+}
+
+// Returns the CDR stored in a charge_detail_record row.
+func pgChargeDetailRecord(row pgschemas.ChargeDetailRecord) ChargeDetailRecord {
+	cdr := ChargeDetailRecord{
+		Id:            row.ID,
+		Serialnumber:  row.SerialNumber,
+		TransactionId: int(row.TransactionID),
+		ConnectorId:   int(row.ConnectorID),
+		IdTag:         row.IdTag,
+		StartedAt:     row.StartedAt,
+		StoppedAt:     row.StoppedAt,
+		Duration:      time.Duration(row.DurationS) * time.Second,
+		MeterStart:    int(row.MeterStart),
+		MeterStop:     int(row.MeterStop),
+		EnergyWh:      int(row.EnergyWh),
+		EnergyCheck:   EnergyCheck(row.EnergyCheck),
+		StopReason:    core.Reason(row.StopReason),
+		ChargingTime:  time.Duration(row.ChargingS) * time.Second,
+		IdleTime:      time.Duration(row.IdleS) * time.Second,
+		CreatedAt:     row.CreatedAt,
+		Tenant:        row.TenantID,
+	}
+	if row.SampledEnergyWh != nil {
+		sampled := int(*row.SampledEnergyWh)
+		cdr.SampledEnergyWh = &sampled
+	}
+	if row.TariffID != nil {
+		cdr.Cost = &CostBreakdown{
+			TariffId: *row.TariffID,
+			Currency: textOf(row.Currency),
+			StartFee: decimalOf(row.StartFee),
+			Energy:   decimalOf(row.EnergyCost),
+			Time:     decimalOf(row.TimeCost),
+			Idle:     decimalOf(row.IdleCost),
+			Total:    decimalOf(row.TotalCost),
+		}
+	}
+	return cdr
+}
+
+// Returns the decimal as a NUMERIC.
+func numericOf(d decimal.Decimal) pgtype.Numeric {
+	return pgtype.Numeric{Int: d.Coefficient(), Exp: d.Exponent(), Valid: true}
+}
+
+// Returns the decimal of a NUMERIC, zero when it is NULL.
+func decimalOf(n pgtype.Numeric) decimal.Decimal {
+	if !n.Valid || n.Int == nil {
+		return decimal.Zero
+	}
+	return decimal.NewFromBigInt(n.Int, n.Exp)
+}
+
+func (s *PgStore) MarkProcessed(ctx context.Context, messageId string) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkProcessed")
+	defer span.End()
+
+	_, err := s.q(ctx).InsertProcessedMessage(ctx, pgschemas.InsertProcessedMessageParams{
+		MessageID:   messageId,
+		ProcessedAt: time.Now(),
+		TenantID:    TenantOf(ctx),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("message %s: %w", messageId, ErrAlreadyProcessed)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to mark message processed", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) AddOutbox(ctx context.Context, msg OutboxMessage) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.AddOutbox")
+	defer span.End()
+
+	properties, err := json.Marshal(msg.Properties)
+	if err != nil {
+		return 0, handleDBError(ctx, "to marshal outbox message properties", err)
+	}
+
+	createdAt := msg.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	id, err := s.q(ctx).InsertOutboxMessage(ctx, pgschemas.InsertOutboxMessageParams{
+		Kind:         string(msg.Kind),
+		Destination:  msg.Destination,
+		Payload:      msg.Payload,
+		Properties:   string(properties),
+		CreatedAt:    createdAt,
+		TenantID:     TenantOf(ctx),
+		SerialNumber: msg.Serialnumber,
+	})
+	if err != nil {
+		return 0, handleDBError(ctx, "to add outbox message", err)
+	}
+
+	return id, nil
+}
+
+func (s *PgStore) ListUnsentOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListUnsentOutbox")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListUnsentOutboxMessages(ctx, pgschemas.ListUnsentOutboxMessagesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list unsent outbox messages", err)
+	}
+
+	return pgOutboxMessages(rows)
+}
+
+func (s *PgStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ClaimOutbox")
+	defer span.End()
+
+	now := time.Now()
+	claimedUntil := now.Add(lease)
+	rows, err := s.q(ctx).ClaimOutboxMessages(ctx, pgschemas.ClaimOutboxMessagesParams{
+		ClaimedUntil: &claimedUntil,
+		Now:          &now,
+		Limit:        int32(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to claim outbox messages", err)
+	}
+
+	messages, err := pgOutboxMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING does not keep the order of the subquery
+	slices.SortFunc(messages, func(a, b OutboxMessage) int { return cmp.Compare(a.Id, b.Id) })
+	return messages, nil
+}
+
+func (s *PgStore) MarkOutboxSent(ctx context.Context, id int64) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkOutboxSent")
+	defer span.End()
+
+	sentAt := time.Now()
+	if err := s.q(ctx).MarkOutboxMessageSent(ctx, pgschemas.MarkOutboxMessageSentParams{
+		SentAt: &sentAt,
+		ID:     id,
+	}); err != nil {
+		return handleDBError(ctx, "to mark outbox message sent", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) MarkOutboxFailed(ctx context.Context, id int64, reason string) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.MarkOutboxFailed")
+	defer span.End()
+
+	if err := s.q(ctx).MarkOutboxMessageFailed(ctx, pgschemas.MarkOutboxMessageFailedParams{
+		LastError: nullText(reason),
+		ID:        id,
+	}); err != nil {
+		return handleDBError(ctx, "to mark outbox message failed", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) ParkOutbox(ctx context.Context, id int64, reason string) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ParkOutbox")
+	defer span.End()
+
+	parkedAt := time.Now()
+	if err := s.q(ctx).ParkOutboxMessage(ctx, pgschemas.ParkOutboxMessageParams{
+		LastError: nullText(reason),
+		ParkedAt:  &parkedAt,
+		ID:        id,
+	}); err != nil {
+		return handleDBError(ctx, "to park outbox message", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) ListParkedOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.ListParkedOutbox")
+	defer span.End()
+
+	rows, err := s.q(ctx).ListParkedOutboxMessages(ctx, pgschemas.ListParkedOutboxMessagesParams{
+		TenantID: TenantOf(ctx),
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		return nil, handleDBError(ctx, "to list parked outbox messages", err)
+	}
+
+	return pgOutboxMessages(rows)
+}
+
+func (s *PgStore) UnparkOutbox(ctx context.Context, id int64) error {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.UnparkOutbox")
+	defer span.End()
+
+	_, err := s.q(ctx).UnparkOutboxMessage(ctx, pgschemas.UnparkOutboxMessageParams{
+		TenantID: TenantOf(ctx),
+		ID:       id,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("outbox message %d: %w", id, ErrOutboxNotParked)
+	}
+	if err != nil {
+		return handleDBError(ctx, "to unpark outbox message", err)
+	}
+
+	return nil
+}
+
+func (s *PgStore) DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := iCore.TraceDB(ctx, s.Tracer, "Store.DeleteSentOutbox")
+	defer span.End()
+
+	deleted, err := s.q(ctx).DeleteSentOutboxMessages(ctx, &before)
+	if err != nil {
+		return 0, handleDBError(ctx, "to delete sent outbox messages", err)
+	}
+
+	return deleted, nil
+}
+
+func pgOutboxMessages(rows []pgschemas.Outbox) ([]OutboxMessage, error) {
+	messages := make([]OutboxMessage, 0, len(rows))
+	for _, row := range rows {
+		var properties map[string]any
+		if err := json.Unmarshal([]byte(row.Properties), &properties); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal outbox message properties: %w", err)
+		}
+
+		messages = append(messages, OutboxMessage{
+			Id:           row.ID,
+			Kind:         OutboxKind(row.Kind),
+			Destination:  row.Destination,
+			Payload:      row.Payload,
+			Properties:   properties,
+			CreatedAt:    row.CreatedAt,
+			SentAt:       row.SentAt,
+			Attempts:     int(row.Attempts),
+			LastError:    textOf(row.LastError),
+			ParkedAt:     row.ParkedAt,
+			Serialnumber: row.SerialNumber,
+			Tenant:       row.TenantID,
+		})
+	}
+
+	return messages, nil
+}
+
+func pgQuarantinedMessage(row pgschemas.Quarantine) (QuarantinedMessage, error) {
+	var properties map[string]any
+	if err := json.Unmarshal([]byte(row.Properties), &properties); err != nil {
+		return QuarantinedMessage{}, fmt.Errorf("failed to unmarshal quarantined message properties: %w", err)
+	}
+
+	return QuarantinedMessage{
+		Id:            row.ID,
+		MessageId:     row.MessageID,
+		Serialnumber:  textOf(row.SerialNumber),
+		Topic:         row.Topic,
+		Subscription:  row.Subscription,
+		ContentType:   textOf(row.ContentType),
+		Properties:    properties,
+		Body:          row.Body,
+		Error:         row.Error,
+		ErrorClass:    row.ErrorClass,
+		Attempts:      int(row.Attempts),
+		QuarantinedAt: row.QuarantinedAt,
+		RedrivenAt:    row.RedrivenAt,
+		Tenant:        row.TenantID,
+	}, nil
+}
+
+// Returns a pointer to value, or nil when it is empty, to store empty strings as NULL.
+func nullText(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// Returns a pointer to value, or nil when it is zero, to pass unset bounds as NULL.
+func nullTime(value time.Time) *time.Time {
+	if value.IsZero() {
+		return nil
+	}
+	return &value
+}
+
+// Returns the value of a nullable column, empty when it is NULL.
+func textOf(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
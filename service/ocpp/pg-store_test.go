@@ -0,0 +1,186 @@
+package ocpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db"
+	"github.com/squishmeist/ocpp-go/service/ocpp/db/pgschemas"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Connection string of the PostgreSQL database the PgStore tests run against. They are skipped when it is not set.
+const postgresDSNEnv = "OCPP_TEST_POSTGRES_DSN"
+
+// Connects a PgStore to the test database and empties its tables.
+func setupPgStoreTest(t *testing.T) *PgStore {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	ctx := context.Background()
+	queries, pool, err := db.ConnectPostgres(ctx, utils.DatabaseConfiguration{
+		Driver:   db.DriverPostgres,
+		Address:  dsn,
+		PoolSize: 4,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(pool.Close)
+
+	_, err = pool.Exec(ctx, `TRUNCATE chargepoint, boot_history, quarantine, charge_transaction, webhook_delivery,
+		processed_message, outbox, data_quality_finding, message_journal, meter_sample, connector_status,
+		charge_detail_record RESTART IDENTITY`)
+	assert.NoError(t, err)
+
+	return NewPgStore(noop.NewTracerProvider(), queries, pool)
+}
+
+func TestPgStoreTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RollbackDiscardsChanges", func(t *testing.T) {
+		store := setupPgStoreTest(t)
+
+		err := store.InTx(ctx, func(ctx context.Context) error {
+			if err := store.MarkProcessed(ctx, "message-1"); err != nil {
+				return err
+			}
+			if _, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`)}); err != nil {
+				return err
+			}
+			return errors.New("handler failed")
+		})
+		assert.Error(t, err)
+
+		unsent, err := store.ListUnsentOutbox(ctx, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, unsent)
+		assert.NoError(t, store.MarkProcessed(ctx, "message-1"))
+	})
+
+	t.Run("AlreadyProcessed", func(t *testing.T) {
+		store := setupPgStoreTest(t)
+
+		assert.NoError(t, store.MarkProcessed(ctx, "message-1"))
+		err := store.InTx(ctx, func(ctx context.Context) error {
+			return store.MarkProcessed(ctx, "message-1")
+		})
+		assert.ErrorIs(t, err, ErrAlreadyProcessed)
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		store := setupPgStoreTest(t)
+
+		id, err := store.AddOutbox(ctx, OutboxMessage{
+			Kind:        OutboxKindReply,
+			Destination: "socket-commands",
+			Payload:     []byte(`{}`),
+			Properties:  map[string]any{"serialnumber": "charger-1"},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, store.MarkOutboxFailed(ctx, id, "transport down"))
+
+		unsent, err := store.ListUnsentOutbox(ctx, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, unsent, 1) {
+			assert.Equal(t, "transport down", unsent[0].LastError)
+			assert.Equal(t, 1, unsent[0].Attempts)
+			assert.Equal(t, "charger-1", unsent[0].Properties["serialnumber"])
+		}
+
+		assert.NoError(t, store.MarkOutboxSent(ctx, id))
+		deleted, err := store.DeleteSentOutbox(ctx, types.Now().Time.Add(1))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+	})
+
+	t.Run("ClaimOutbox_Concurrent", func(t *testing.T) {
+		store := setupPgStoreTest(t)
+
+		for i := range 20 {
+			_, err := store.AddOutbox(ctx, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`), Serialnumber: fmt.Sprintf("charger-%d", i)})
+			assert.NoError(t, err)
+		}
+
+		// Relays of several instances claiming at the same time each get different messages
+		claimed := make(chan []OutboxMessage, 4)
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				messages, err := store.ClaimOutbox(ctx, 10, time.Minute)
+				assert.NoError(t, err)
+				claimed <- messages
+			}()
+		}
+		wg.Wait()
+		close(claimed)
+
+		seen := map[int64]bool{}
+		for messages := range claimed {
+			for _, msg := range messages {
+				assert.False(t, seen[msg.Id], "expected message %d to be claimed once", msg.Id)
+				seen[msg.Id] = true
+			}
+		}
+		assert.Len(t, seen, 20)
+	})
+}
+
+func TestPgStoreBootHistory(t *testing.T) {
+	ctx := context.Background()
+	store := setupPgStoreTest(t)
+	request := core.BootNotificationRequest{
+		ChargePointModel:  "Zappi",
+		ChargePointVendor: "Myenergi",
+		FirmwareVersion:   "5540",
+	}
+
+	_, err := store.AddChargepoint(ctx, "charger-1", request)
+	assert.NoError(t, err)
+	request.FirmwareVersion = "5541"
+	_, err = store.AddChargepoint(ctx, "charger-1", request)
+	assert.NoError(t, err)
+
+	history, err := store.queries.ListBootHistory(ctx, pgschemas.ListBootHistoryParams{SerialNumber: "charger-1", Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "5541", history[0].FirmwareVersion)
+		assert.Equal(t, "5540", textOf(history[0].PreviousFirmwareVersion))
+		assert.Nil(t, history[1].PreviousFirmwareVersion)
+	}
+}
+
+func TestPgStoreCdrImmutable(t *testing.T) {
+	ctx := context.Background()
+	store := setupPgStoreTest(t)
+
+	_, err := store.AddCdr(ctx, ChargeDetailRecord{Serialnumber: "charger-1", TransactionId: 1, EnergyCheck: EnergyCheckUnverified})
+	assert.NoError(t, err)
+
+	_, err = store.pool.Exec(ctx, `UPDATE charge_detail_record SET energy_wh = 1`)
+	assert.ErrorContains(t, err, "immutable")
+	_, err = store.pool.Exec(ctx, `DELETE FROM charge_detail_record`)
+	assert.ErrorContains(t, err, "immutable")
+}
+
+func TestPgStoreTenants(t *testing.T) {
+	testDurableStoreTenants(t, func(t *testing.T) durableStore {
+		return setupPgStoreTest(t)
+	})
+}
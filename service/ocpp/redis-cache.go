@@ -2,75 +2,296 @@ package ocpp
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
 	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type RedisCache struct {
 	Tracer trace.Tracer
-	client *redis.Client
+	client redis.UniversalClient
 }
 
-func NewRedisCache(tp trace.TracerProvider, address string) *RedisCache {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     address,
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
-
+// Creates a RedisCache on the client, a single node, Sentinel or Cluster client.
+func NewRedisCache(tp trace.TracerProvider, client redis.UniversalClient) *RedisCache {
 	return &RedisCache{
 		Tracer: tp.Tracer("cache"),
-		client: rdb,
+		client: client,
 	}
 }
 
+// Creates a Redis client from the cache configuration: a Sentinel client when MasterName is set, a Cluster client
+// in Cluster mode or with several addresses, and a single node client otherwise.
+func NewRedisClient(config utils.CacheConfiguration) (redis.UniversalClient, error) {
+	opts, err := redisOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewUniversalClient(opts), nil
+}
+
+// Returns the client options of the cache configuration.
+func redisOptions(config utils.CacheConfiguration) (*redis.UniversalOptions, error) {
+	if len(config.Addrs) == 0 {
+		return nil, fmt.Errorf("no redis address is set")
+	}
+	if config.Cluster && config.MasterName != "" {
+		return nil, fmt.Errorf("redis cluster mode and sentinel master name cannot both be set")
+	}
+	if config.Cluster && config.DB != 0 {
+		return nil, fmt.Errorf("redis cluster mode only supports DB 0")
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            config.Addrs,
+		Username:         config.Username,
+		Password:         config.Password,
+		DB:               config.DB,
+		MasterName:       config.MasterName,
+		SentinelUsername: config.SentinelUsername,
+		SentinelPassword: config.SentinelPassword,
+		IsClusterMode:    config.Cluster,
+		PoolSize:         config.PoolSize,
+		MinIdleConns:     config.MinIdleConns,
+		PoolTimeout:      config.PoolTimeout,
+		DialTimeout:      config.DialTimeout,
+		ReadTimeout:      config.ReadTimeout,
+		WriteTimeout:     config.WriteTimeout,
+	}
+
+	if config.TLS.Enabled {
+		tlsConfig, err := redisTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	return opts, nil
+}
+
+// Returns the TLS configuration of the cache, with the CA certificates and client certificate read from their files.
+func redisTLSConfig(config utils.CacheTLSConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
 
-func (c *RedisCache) HasProcessed(ctx context.Context, id string) (bool, error) {
-	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.HasProcessed")
+// Prefixes of the values of message claims. An in-progress claim holds the token of its holder, a completed one the reply.
+const (
+	claimInProgressPrefix = "in-progress:"
+	claimCompletedPrefix  = "completed:"
+)
+
+// How long a completed message is remembered, so redeliveries get the stored reply.
+const completedMessageTTL = 24 * time.Hour
+
+// Value a message was marked processed with before messages were claimed.
+const legacyProcessedMarker = "1"
+
+// Returns the key of a message claim, scoped by the tenant.
+func claimKey(tenant, id string) string {
+	return tenantScoped(tenant, "claim:"+id)
+}
+
+// Claims a message for the token, unless it is claimed already, and returns the value of the claim: the token when it
+// was acquired, the value of the existing claim otherwise. Setting and reading it in one script means a claim that
+// expires or is released in between cannot be missed.
+var claimMessageScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return ARGV[1]
+end
+return redis.call("GET", KEYS[1])
+`)
+
+// Stores the reply of a claimed message, if the claim is still held by the token.
+var completeMessageScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// Deletes a claim, if it is still held by the token.
+var releaseMessageScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (c *RedisCache) ClaimMessage(ctx context.Context, id string, lease time.Duration) (MessageClaim, error) {
+	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.ClaimMessage")
 	defer span.End()
 
-	val, err := c.client.Get(ctx, id).Result()
+	token := uuid.NewString()
+	val, err := claimMessageScript.Run(ctx, c.client, []string{claimKey(TenantOf(ctx), id)},
+		claimInProgressPrefix+token, lease.Milliseconds(),
+	).Text()
+	if err != nil {
+		return MessageClaim{}, fmt.Errorf("error trying to claim message with id %s: %w", id, err)
+	}
+	if val == claimInProgressPrefix+token {
+		return c.resolveLegacyClaim(ctx, MessageClaim{Id: id, Token: token, State: ClaimAcquired})
+	}
 
-	if err == redis.Nil {
-		return false, nil
+	if reply, ok := strings.CutPrefix(val, claimCompletedPrefix); ok {
+		claim := MessageClaim{Id: id, State: ClaimCompleted}
+		if reply != "" {
+			claim.Reply = []byte(reply)
+		}
+		return claim, nil
 	}
+	return MessageClaim{Id: id, State: ClaimInProgress}, nil
+}
 
+// Messages used to be marked processed, and then claimed, under their bare id. An acquired claim of a message that
+// still has such a key, until it expires, takes over its outcome: the message is completed with the reply the key
+// holds, if any, or released to the instance still processing it under the old key.
+func (c *RedisCache) resolveLegacyClaim(ctx context.Context, claim MessageClaim) (MessageClaim, error) {
+	val, err := c.client.Get(ctx, tenantScoped(TenantOf(ctx), claim.Id)).Result()
+	if err == redis.Nil {
+		return claim, nil
+	}
 	if err != nil {
-		return false, err
+		if releaseErr := c.ReleaseMessage(ctx, claim); releaseErr != nil {
+			err = errors.Join(err, releaseErr)
+		}
+		return MessageClaim{}, fmt.Errorf("error trying to read legacy claim of message with id %s: %w", claim.Id, err)
+	}
+
+	var reply []byte
+	switch {
+	case val == legacyProcessedMarker:
+	case strings.HasPrefix(val, claimCompletedPrefix):
+		if stored := strings.TrimPrefix(val, claimCompletedPrefix); stored != "" {
+			reply = []byte(stored)
+		}
+	case strings.HasPrefix(val, claimInProgressPrefix):
+		if err := c.ReleaseMessage(ctx, claim); err != nil {
+			return MessageClaim{}, err
+		}
+		return MessageClaim{Id: claim.Id, State: ClaimInProgress}, nil
+	default:
+		return claim, nil
+	}
+
+	if err := c.CompleteMessage(ctx, claim, reply); err != nil {
+		return MessageClaim{}, err
 	}
+	return MessageClaim{Id: claim.Id, State: ClaimCompleted, Reply: reply}, nil
+}
+
+func (c *RedisCache) CompleteMessage(ctx context.Context, claim MessageClaim, reply []byte) error {
+	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.CompleteMessage")
+	defer span.End()
 
-	return val == "1", nil
+	completed, err := completeMessageScript.Run(ctx, c.client, []string{claimKey(TenantOf(ctx), claim.Id)},
+		claimInProgressPrefix+claim.Token, claimCompletedPrefix+string(reply), completedMessageTTL.Milliseconds(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("error trying to complete message with id %s: %w", claim.Id, err)
+	}
+	if completed == 0 {
+		return fmt.Errorf("failed to complete message with id %s: %w", claim.Id, ErrClaimLost)
+	}
+	return nil
 }
 
-func (c *RedisCache) AddProcessed(ctx context.Context, id string) error {
-	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.AddProcessed")
+func (c *RedisCache) ReleaseMessage(ctx context.Context, claim MessageClaim) error {
+	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.ReleaseMessage")
 	defer span.End()
-	if err := c.client.Set(ctx, id, "1", 24*time.Hour).Err(); err != nil {
-		return fmt.Errorf("error trying to set message with id %s: %w", id, err)
+
+	released, err := releaseMessageScript.Run(ctx, c.client, []string{claimKey(TenantOf(ctx), claim.Id)}, claimInProgressPrefix+claim.Token).Int()
+	if err != nil {
+		return fmt.Errorf("error trying to release message with id %s: %w", claim.Id, err)
+	}
+	if released == 0 {
+		return fmt.Errorf("failed to release message with id %s: %w", claim.Id, ErrClaimLost)
 	}
 	return nil
 }
 
-func (c *RedisCache) GetRequestFromUuid(ctx context.Context, uuid string) (v16.RequestBody, error) {
+// Returns the key of a pending request, scoped by the tenant, the serial number of the charge point and the direction
+// of the request.
+func requestKey(tenant string, meta v16.Meta, uuid string) (string, error) {
+	if meta.Serialnumber == "" {
+		return "", fmt.Errorf("serialnumber is not set")
+	}
+	if !meta.Direction.IsValid() {
+		return "", fmt.Errorf("invalid direction %q", meta.Direction)
+	}
+	return tenantScoped(tenant, "request:"+meta.Serialnumber+":"+string(meta.Direction)+":"+uuid), nil
+}
+
+// Returns the key scoped by the tenant. Keys of the default tenant are left as they are, so entries cached before
+// tenants were introduced are still found.
+func tenantScoped(tenant, key string) string {
+	if tenant == "" {
+		return key
+	}
+	return "tenant:" + tenant + ":" + key
+}
+
+func (c *RedisCache) GetRequestFromUuid(ctx context.Context, meta v16.Meta, uuid string) (v16.RequestBody, error) {
 	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.GetRequestFromUuid")
 	defer span.End()
 
-	result, err := c.client.HGetAll(ctx, "request:"+uuid).Result()
+	key, err := requestKey(TenantOf(ctx), meta, uuid)
+	if err != nil {
+		return v16.RequestBody{}, err
+	}
+
+	result, err := c.client.HGetAll(ctx, key).Result()
 
 	if err != nil {
 		return v16.RequestBody{}, err
 	}
 
 	if len(result) == 0 {
-		return v16.RequestBody{}, fmt.Errorf("request not found")
+		return v16.RequestBody{}, ErrRequestNotFound
 	}
 
 	if _, ok := result["uuid"]; !ok {
@@ -90,20 +311,38 @@ func (c *RedisCache) GetRequestFromUuid(ctx context.Context, uuid string) (v16.R
 	}, nil
 }
 
-func (c *RedisCache) AddRequest(ctx context.Context, meta v16.Meta, request v16.RequestBody) error {
+// Sorted set of the keys of pending requests, scored by their deadline in unix milliseconds.
+const requestDeadlinesKey = "request-deadlines"
+
+func (c *RedisCache) AddRequest(ctx context.Context, meta v16.Meta, request v16.RequestBody, timeout time.Duration) error {
 	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.AddRequest")
 	defer span.End()
 
+	key, err := requestKey(TenantOf(ctx), meta, request.Uuid)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
 	requestMap := map[string]any{
-		"uuid":    request.Uuid,
-		"action":  string(request.Action),
-		"payload": string(request.Payload),
+		"uuid":         request.Uuid,
+		"action":       string(request.Action),
+		"payload":      string(request.Payload),
+		"serialnumber": meta.Serialnumber,
+		"direction":    string(meta.Direction),
+		"messageid":    meta.Id,
+		"addedat":      now.UnixMilli(),
+		"tenant":       TenantOf(ctx),
 	}
 
-	if err := c.client.HSet(ctx, "request:"+request.Uuid, requestMap).Err(); err != nil {
-		return err
+	// Not a transaction: in Cluster mode the request and the deadlines may live on different nodes
+	pipe := c.client.Pipeline()
+	pipe.HSet(ctx, key, requestMap)
+	pipe.Expire(ctx, key, 24*time.Hour)
+	if timeout > 0 {
+		pipe.ZAdd(ctx, requestDeadlinesKey, redis.Z{Score: float64(now.Add(timeout).UnixMilli()), Member: key})
 	}
-	if err := c.client.Expire(ctx, "request:"+request.Uuid, 24*time.Hour).Err(); err != nil {
+	if _, err := pipe.Exec(ctx); err != nil {
 		return err
 	}
 
@@ -114,18 +353,135 @@ func (c *RedisCache) RemoveRequest(ctx context.Context, meta v16.Meta, request v
 	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.RemoveRequest")
 	defer span.End()
 
-	exists, err := c.client.Exists(ctx, "request:"+request.Uuid).Result()
+	key, err := requestKey(TenantOf(ctx), meta, request.Uuid)
 	if err != nil {
 		return err
 	}
 
-	if exists == 0 {
-		return fmt.Errorf("request not found")
+	pipe := c.client.Pipeline()
+	removed := pipe.Del(ctx, key)
+	pipe.ZRem(ctx, requestDeadlinesKey, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
 	}
 
-	if err := c.client.Del(ctx, "request:"+request.Uuid).Err(); err != nil {
-		return err
+	if removed.Val() == 0 {
+		return ErrRequestNotFound
 	}
 
 	return nil
 }
+
+func (c *RedisCache) TakeExpiredRequests(ctx context.Context, now time.Time, limit int) ([]PendingRequest, error) {
+	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.TakeExpiredRequests")
+	defer span.End()
+
+	expired, err := c.client.ZRangeByScoreWithScores(ctx, requestDeadlinesKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []PendingRequest
+	for _, z := range expired {
+		key := z.Member.(string)
+
+		// Whoever removes the deadline takes the request, so concurrent sweepers never report it twice
+		taken, err := c.client.ZRem(ctx, requestDeadlinesKey, key).Result()
+		if err != nil {
+			return requests, err
+		}
+		if taken == 0 {
+			continue
+		}
+
+		result, err := c.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return requests, err
+		}
+		if err := c.client.Del(ctx, key).Err(); err != nil {
+			return requests, err
+		}
+		if len(result) == 0 {
+			// The request expired from the cache before its deadline was reached
+			continue
+		}
+
+		addedAt, _ := strconv.ParseInt(result["addedat"], 10, 64)
+		requests = append(requests, PendingRequest{
+			Meta: v16.Meta{
+				Id:           result["messageid"],
+				Serialnumber: result["serialnumber"],
+				Direction:    v16.Direction(result["direction"]),
+			},
+			Request: v16.RequestBody{
+				Uuid:    result["uuid"],
+				Action:  v16.ActionKind(result["action"]),
+				Payload: []byte(result["payload"]),
+			},
+			AddedAt:  time.UnixMilli(addedAt).UTC(),
+			Deadline: time.UnixMilli(int64(z.Score)).UTC(),
+			Tenant:   result["tenant"],
+		})
+	}
+
+	return requests, nil
+}
+
+// Deletes the pending requests stored before they were scoped by charge point, under request:<uuid>. They carry no
+// serial number, so they cannot be moved to the scoped keys without risking pairing a confirmation with the request
+// of another charge point. Returns how many were deleted.
+func (c *RedisCache) MigrateLegacyRequests(ctx context.Context) (int, error) {
+	ctx, span := core.TraceCache(ctx, c.Tracer, "Cache.MigrateLegacyRequests")
+	defer span.End()
+
+	deleted := 0
+	migrate := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, "request:*", 100).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+
+			scoped, err := client.HExists(ctx, key, "serialnumber").Result()
+			if err != nil {
+				return err
+			}
+			if scoped {
+				continue
+			}
+
+			if err := client.Del(ctx, key).Err(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return iter.Err()
+	}
+
+	// SCAN only covers the node it is sent to, so a Cluster is scanned master by master
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return migrate(ctx, client)
+		})
+		return deleted, err
+	}
+	if err := migrate(ctx, c.client); err != nil {
+		return deleted, err
+	}
+
+	return deleted, nil
+}
+
+// Deletes the pending requests stored before they were scoped by charge point. Only RedisCache has legacy requests.
+func (o *Ocpp) MigrateLegacyRequests(ctx context.Context) (int, error) {
+	redisCache, ok := o.cache.(*RedisCache)
+	if !ok {
+		return 0, fmt.Errorf("cache driver %q has no legacy requests", o.config.Cache.Driver)
+	}
+	return redisCache.MigrateLegacyRequests(ctx)
+}
@@ -2,8 +2,16 @@ package ocpp
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
 	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
 	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
 	"github.com/stretchr/testify/assert"
@@ -17,22 +25,21 @@ func TestRedisCache(t *testing.T) {
 	err := redis.AddRequest(ctx, v16.Meta{
 		Id:           "test-id",
 		Serialnumber: "test-serialnumber",
+		Direction:    v16.ChargePointToCentralSystem,
 	}, v16.RequestBody{
 		Uuid:    "test-uuid",
 		Action:  core.Heartbeat,
 		Payload: []byte("{}"),
-	})
+	}, 0)
 	assert.NoError(t, err, "expected no error when adding request")
-	err = redis.AddProcessed(ctx, "test-id")
-	assert.NoError(t, err, "expected no error when adding processed id")
 
 	t.Cleanup(func() {
-		keys, err := redis.client.Keys(ctx, "test-id*").Result()
+		keys, err := redis.client.Keys(ctx, "claim:test-id*").Result()
 		if err == nil && len(keys) > 0 {
 			redis.client.Del(ctx, keys...)
 		}
 
-		keys, err = redis.client.Keys(ctx, "request:test-uuid*").Result()
+		keys, err = redis.client.Keys(ctx, "request:test-serialnumber:*").Result()
 		if err == nil && len(keys) > 0 {
 			redis.client.Del(ctx, keys...)
 		}
@@ -42,27 +49,30 @@ func TestRedisCache(t *testing.T) {
 		}
 	})
 
-	t.Run("HasProcessed_Unknown Id", func(t *testing.T) {
-		processed, err := redis.HasProcessed(ctx, "unknown-id")
+	t.Run("ClaimMessage_Unknown Id", func(t *testing.T) {
+		claim, err := redis.ClaimMessage(ctx, "test-id", time.Minute)
 		assert.Nil(t, err, "expected no error for unknown id")
-		assert.False(t, processed, "expected processed to be false for unknown id")
+		assert.Equal(t, ClaimAcquired, claim.State, "expected claim to be acquired for unknown id")
+		assert.NoError(t, redis.CompleteMessage(ctx, claim, []byte("reply")))
 	})
 
-	t.Run("HasProcessed_Known Id", func(t *testing.T) {
-		processed, err := redis.HasProcessed(ctx, "test-id")
+	t.Run("ClaimMessage_Known Id", func(t *testing.T) {
+		claim, err := redis.ClaimMessage(ctx, "test-id", time.Minute)
 		assert.Nil(t, err, "expected no error for valid id")
-		assert.True(t, processed, "expected processed to be true for valid id")
+		assert.Equal(t, ClaimCompleted, claim.State, "expected claim to be completed for valid id")
+		assert.Equal(t, []byte("reply"), claim.Reply)
 	})
 
 	t.Run("AddRequest_Valid", func(t *testing.T) {
 		err := redis.AddRequest(ctx, v16.Meta{
 			Id:           "test-id2",
 			Serialnumber: "test-serialnumber",
+			Direction:    v16.ChargePointToCentralSystem,
 		}, v16.RequestBody{
 			Uuid:    "test-uuid2",
 			Action:  core.Heartbeat,
 			Payload: []byte("{}"),
-		})
+		}, 0)
 		assert.NoError(t, err, "expected no error for valid input")
 	})
 
@@ -70,16 +80,18 @@ func TestRedisCache(t *testing.T) {
 		err := redis.AddRequest(ctx, v16.Meta{
 			Id:           "test-id3",
 			Serialnumber: "test-serialnumber",
+			Direction:    v16.ChargePointToCentralSystem,
 		}, v16.RequestBody{
 			Uuid:    "test-uuid3",
 			Action:  core.Heartbeat,
 			Payload: []byte("{}"),
-		})
+		}, 0)
 		assert.NoError(t, err, "expected no error for valid input")
 
 		err = redis.RemoveRequest(ctx, v16.Meta{
 			Id:           "test-id3",
 			Serialnumber: "test-serialnumber",
+			Direction:    v16.ChargePointToCentralSystem,
 		}, v16.ConfirmationBody{
 			Uuid: "test-uuid3",
 		})
@@ -90,6 +102,7 @@ func TestRedisCache(t *testing.T) {
 		err := redis.RemoveRequest(ctx, v16.Meta{
 			Id:           "test-unknown",
 			Serialnumber: "test-serialnumber",
+			Direction:    v16.ChargePointToCentralSystem,
 		}, v16.ConfirmationBody{
 			Uuid: "unknown-uuid",
 		})
@@ -97,7 +110,10 @@ func TestRedisCache(t *testing.T) {
 	})
 
 	t.Run("GetRequestFromUuid_Valid", func(t *testing.T) {
-		request, err := redis.GetRequestFromUuid(ctx, "test-uuid")
+		request, err := redis.GetRequestFromUuid(ctx, v16.Meta{
+			Serialnumber: "test-serialnumber",
+			Direction:    v16.ChargePointToCentralSystem,
+		}, "test-uuid")
 		assert.NoError(t, err, "expected no error for valid input")
 		assert.Equal(t, "test-uuid", request.Uuid)
 		assert.Equal(t, v16.ActionKind(core.Heartbeat), request.Action)
@@ -105,17 +121,178 @@ func TestRedisCache(t *testing.T) {
 	})
 
 	t.Run("GetRequestFromUuid_Unknown", func(t *testing.T) {
-		_, err := redis.GetRequestFromUuid(ctx, "unknown-uuid")
+		_, err := redis.GetRequestFromUuid(ctx, v16.Meta{
+			Serialnumber: "test-serialnumber",
+			Direction:    v16.ChargePointToCentralSystem,
+		}, "unknown-uuid")
 		assert.Error(t, err, "expected error for unknown uuid")
 	})
 }
 
+func TestRedisCacheLegacyClaims(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ProcessedMarker_Completed", func(t *testing.T) {
+		server, cache := setupMiniredisTest(t)
+		// Processed before messages were claimed
+		assert.NoError(t, server.Set("message-1", legacyProcessedMarker))
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimCompleted, claim.State)
+		assert.Nil(t, claim.Reply)
+
+		claim, err = cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimCompleted, claim.State)
+	})
+
+	t.Run("CompletedClaim_KeepsReply", func(t *testing.T) {
+		server, cache := setupMiniredisTest(t)
+		assert.NoError(t, server.Set("message-1", claimCompletedPrefix+"reply"))
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimCompleted, claim.State)
+		assert.Equal(t, []byte("reply"), claim.Reply)
+	})
+
+	t.Run("InProgressClaim_Released", func(t *testing.T) {
+		server, cache := setupMiniredisTest(t)
+		assert.NoError(t, server.Set("message-1", claimInProgressPrefix+"token"))
+
+		claim, err := cache.ClaimMessage(ctx, "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimInProgress, claim.State)
+		assert.False(t, server.Exists(claimKey("", "message-1")))
+	})
+
+	t.Run("OtherTenant_NotAffected", func(t *testing.T) {
+		server, cache := setupMiniredisTest(t)
+		assert.NoError(t, server.Set("message-1", legacyProcessedMarker))
+
+		claim, err := cache.ClaimMessage(WithTenant(ctx, "operator-b"), "message-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, ClaimAcquired, claim.State)
+	})
+}
+
+func TestRedisCacheMigrateLegacyRequests(t *testing.T) {
+	ctx := context.Background()
+	charger1 := v16.Meta{Serialnumber: "charger-1", Direction: v16.ChargePointToCentralSystem}
+	request := v16.RequestBody{Uuid: "uuid-heartbeat", Action: core.Heartbeat, Payload: []byte("{}")}
+
+	server, cache := setupMiniredisTest(t)
+
+	server.HSet("request:uuid-heartbeat", "uuid", "uuid-heartbeat", "action", "Heartbeat", "payload", "{}")
+	assert.NoError(t, cache.AddRequest(ctx, charger1, request, 0))
+
+	deleted, err := cache.MigrateLegacyRequests(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.False(t, server.Exists("request:uuid-heartbeat"))
+
+	_, err = cache.GetRequestFromUuid(ctx, charger1, "uuid-heartbeat")
+	assert.NoError(t, err)
+}
+
+func TestNewRedisClient(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("AuthAndDB", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		server.RequireUserAuth("ocpp", "secret")
+
+		client, err := NewRedisClient(utils.CacheConfiguration{Addrs: []string{server.Addr()}, Username: "ocpp", Password: "secret", DB: 2})
+		assert.NoError(t, err)
+		defer client.Close()
+		assert.NoError(t, client.Set(ctx, "key", "value", 0).Err())
+		assert.True(t, server.DB(2).Exists("key"))
+
+		wrong, err := NewRedisClient(utils.CacheConfiguration{Addrs: []string{server.Addr()}, Username: "ocpp", Password: "wrong"})
+		assert.NoError(t, err)
+		defer wrong.Close()
+		assert.Error(t, wrong.Ping(ctx).Err())
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		// The httptest certificate is valid for 127.0.0.1, where miniredis listens
+		https := httptest.NewUnstartedServer(nil)
+		https.StartTLS()
+		https.Close()
+		server, err := miniredis.RunTLS(&tls.Config{Certificates: https.TLS.Certificates})
+		assert.NoError(t, err)
+		defer server.Close()
+
+		caFile := t.TempDir() + "/ca.pem"
+		assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: https.Certificate().Raw}), 0o600))
+
+		client, err := NewRedisClient(utils.CacheConfiguration{Addrs: []string{server.Addr()}, TLS: utils.CacheTLSConfiguration{Enabled: true, CAFile: caFile}})
+		assert.NoError(t, err)
+		defer client.Close()
+		assert.NoError(t, client.Ping(ctx).Err())
+
+		untrusted, err := NewRedisClient(utils.CacheConfiguration{Addrs: []string{server.Addr()}, TLS: utils.CacheTLSConfiguration{Enabled: true}})
+		assert.NoError(t, err)
+		defer untrusted.Close()
+		assert.Error(t, untrusted.Ping(ctx).Err())
+	})
+
+	t.Run("Cluster", func(t *testing.T) {
+		server := miniredis.RunT(t)
+
+		client, err := NewRedisClient(utils.CacheConfiguration{Addrs: []string{server.Addr()}, Cluster: true})
+		assert.NoError(t, err)
+		defer client.Close()
+		assert.IsType(t, &goredis.ClusterClient{}, client)
+
+		cache := NewRedisCache(noop.NewTracerProvider(), client)
+		meta := v16.Meta{Serialnumber: "charger-1", Direction: v16.ChargePointToCentralSystem}
+		assert.NoError(t, cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: "uuid-1", Action: core.Heartbeat, Payload: []byte("{}")}, time.Second))
+		_, err = cache.GetRequestFromUuid(ctx, meta, "uuid-1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Sentinel", func(t *testing.T) {
+		opts, err := redisOptions(utils.CacheConfiguration{Addrs: []string{"sentinel-1:26379", "sentinel-2:26379"}, MasterName: "mymaster", SentinelPassword: "secret"})
+		assert.NoError(t, err)
+		assert.Equal(t, "mymaster", opts.Failover().MasterName)
+		assert.Equal(t, []string{"sentinel-1:26379", "sentinel-2:26379"}, opts.Failover().SentinelAddrs)
+		assert.Equal(t, "secret", opts.Failover().SentinelPassword)
+	})
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		_, err := NewRedisClient(utils.CacheConfiguration{})
+		assert.Error(t, err)
+		_, err = NewRedisClient(utils.CacheConfiguration{Addrs: []string{"localhost:6379"}, Cluster: true, MasterName: "mymaster"})
+		assert.Error(t, err)
+		_, err = NewRedisClient(utils.CacheConfiguration{Addrs: []string{"localhost:6379"}, Cluster: true, DB: 1})
+		assert.Error(t, err)
+		_, err = NewRedisClient(utils.CacheConfiguration{Addrs: []string{"localhost:6379"}, TLS: utils.CacheTLSConfiguration{Enabled: true, CAFile: "missing.pem"}})
+		assert.Error(t, err)
+	})
+}
+
+func setupMiniredisTest(t *testing.T) (*miniredis.Miniredis, *RedisCache) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client, err := NewRedisClient(utils.CacheConfiguration{Addrs: []string{server.Addr()}})
+	assert.NoError(t, err)
+	cache := NewRedisCache(noop.NewTracerProvider(), client)
+	t.Cleanup(func() { cache.Close() })
+
+	return server, cache
+}
+
 func setupRedisTest(t *testing.T) (context.Context, *RedisCache) {
 	ctx := context.Background()
-	redis := NewRedisCache(noop.NewTracerProvider(), "localhost:6379")
+	client, err := NewRedisClient(utils.CacheConfiguration{Addrs: []string{"localhost:6379"}})
+	assert.NoError(t, err)
+	redis := NewRedisCache(noop.NewTracerProvider(), client)
 
 	// Test connection
-	err := redis.client.Ping(ctx).Err()
+	err = redis.client.Ping(ctx).Err()
 	assert.Nil(t, err, "expected successful connection to Redis")
 
 	return ctx, redis
@@ -0,0 +1,200 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type RequestSweeperOption func(*RequestSweeper)
+
+// Reports pending requests that were not confirmed before their deadline. Each timed out request is removed from the
+// cache and reported once, with an EventRequestTimedOut domain event, a span event and the ocpp.requests.timed_out counter.
+type RequestSweeper struct {
+	tracer    trace.Tracer
+	meter     metric.Meter
+	cache     CacheAdapter
+	publisher EventPublisher
+	interval  time.Duration
+	batchSize int
+	timedOut  metric.Int64Counter
+}
+
+// Ensures all required fields are set in the RequestSweeper.
+func (s *RequestSweeper) Validate() error {
+	if s.tracer == nil {
+		return fmt.Errorf("tracer provider is not set")
+	}
+	if s.cache == nil {
+		return fmt.Errorf("cache is not set")
+	}
+	return nil
+}
+
+func WithSweeperTracerProvider(tp trace.TracerProvider) RequestSweeperOption {
+	return func(s *RequestSweeper) {
+		s.tracer = tp.Tracer("request-sweeper")
+	}
+}
+
+// Sets the meter provider the timed out counter is recorded with. Without one the counter is not recorded.
+func WithSweeperMeterProvider(mp metric.MeterProvider) RequestSweeperOption {
+	return func(s *RequestSweeper) {
+		s.meter = mp.Meter("ocpp")
+	}
+}
+
+func WithSweeperCache(cache CacheAdapter) RequestSweeperOption {
+	return func(s *RequestSweeper) {
+		s.cache = cache
+	}
+}
+
+// Sets the publisher EventRequestTimedOut events are published to. Without one no events are published.
+func WithSweeperPublisher(publisher EventPublisher) RequestSweeperOption {
+	return func(s *RequestSweeper) {
+		s.publisher = publisher
+	}
+}
+
+// Sets how often pending requests are checked for their deadline.
+func WithSweeperInterval(interval time.Duration) RequestSweeperOption {
+	return func(s *RequestSweeper) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+// Creates a new RequestSweeper with the provided options.
+func NewRequestSweeper(opts ...RequestSweeperOption) *RequestSweeper {
+	sweeper := &RequestSweeper{
+		meter:     noop.NewMeterProvider().Meter("ocpp"),
+		interval:  5 * time.Second,
+		batchSize: 100,
+	}
+
+	for _, opt := range opts {
+		opt(sweeper)
+	}
+
+	if err := sweeper.Validate(); err != nil {
+		slog.Error("Failed to create RequestSweeper", "error", err)
+		panic(err)
+	}
+
+	timedOut, err := sweeper.meter.Int64Counter("ocpp.requests.timed_out",
+		metric.WithDescription("Pending OCPP requests that were not confirmed before their deadline"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		slog.Error("Failed to create RequestSweeper", "error", err)
+		panic(err)
+	}
+	sweeper.timedOut = timedOut
+
+	return sweeper
+}
+
+// Reports timed out requests every interval until ctx is cancelled.
+func (s *RequestSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped request sweeper")
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to sweep pending requests", "error", err)
+		}
+	}
+}
+
+// Reports the pending requests whose deadline has passed and returns how many there were.
+// A request is taken from the cache before it is reported, so if publishing its event fails the event is lost,
+// but the span event and the counter are still recorded.
+func (s *RequestSweeper) Sweep(ctx context.Context) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "RequestSweeper.Sweep")
+	defer span.End()
+
+	swept := 0
+	for {
+		requests, err := s.cache.TakeExpiredRequests(ctx, time.Now(), s.batchSize)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return swept, err
+		}
+
+		for _, pending := range requests {
+			s.report(ctx, pending)
+			swept++
+		}
+
+		if len(requests) < s.batchSize {
+			span.SetAttributes(attribute.Int("requests.timed_out", swept))
+			span.SetStatus(codes.Ok, "Pending requests swept")
+			return swept, nil
+		}
+	}
+}
+
+// Reports a timed out request in the tenant it was added in.
+func (s *RequestSweeper) report(ctx context.Context, pending PendingRequest) {
+	ctx = WithTenant(ctx, pending.Tenant)
+	slog.Warn("Request timed out",
+		"serialnumber", pending.Meta.Serialnumber,
+		"tenant", pending.Tenant,
+		"direction", pending.Meta.Direction,
+		"action", pending.Request.Action,
+		"uuid", pending.Request.Uuid,
+		"deadline", pending.Deadline,
+	)
+
+	trace.SpanFromContext(ctx).AddEvent("request timed out", trace.WithAttributes(
+		attribute.String("serialnumber", pending.Meta.Serialnumber),
+		attribute.String("tenant", pending.Tenant),
+		attribute.String("direction", string(pending.Meta.Direction)),
+		attribute.String("action", string(pending.Request.Action)),
+		attribute.String("uuid", pending.Request.Uuid),
+	))
+
+	s.timedOut.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("action", string(pending.Request.Action)),
+		attribute.String("direction", string(pending.Meta.Direction)),
+	))
+
+	if s.publisher == nil {
+		return
+	}
+
+	event := DomainEvent{
+		Id:           pending.Meta.Id + ":" + EventRequestTimedOut,
+		Type:         EventRequestTimedOut,
+		Serialnumber: pending.Meta.Serialnumber,
+		OccurredAt:   time.Now().UTC(),
+		Data: RequestTimedOut{
+			Uuid:      pending.Request.Uuid,
+			Action:    pending.Request.Action,
+			Direction: pending.Meta.Direction,
+			SentAt:    pending.AddedAt,
+			Deadline:  pending.Deadline,
+		},
+		Tenant: pending.Tenant,
+	}
+	if err := s.publisher.Publish(ctx, event); err != nil {
+		slog.Error("Failed to publish request timed out event", "error", err, "id", event.Id)
+	}
+}
@@ -0,0 +1,80 @@
+package ocpp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRequestSweeper(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReportsTimedOutRequests", func(t *testing.T) {
+		_, cache := setupMiniredisTest(t)
+		publisher := &mockPublisher{}
+		reader := sdkmetric.NewManualReader()
+		sweeper := NewRequestSweeper(
+			WithSweeperTracerProvider(noop.NewTracerProvider()),
+			WithSweeperMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+			WithSweeperCache(cache),
+			WithSweeperPublisher(publisher),
+		)
+
+		meta := v16.Meta{Id: "message-1", Serialnumber: "charger-1", Direction: v16.CentralSystemToChargePoint}
+		assert.NoError(t, cache.AddRequest(ctx, meta, v16.RequestBody{Uuid: "uuid-1", Action: core.Reset, Payload: []byte(`{"type":"Soft"}`)}, time.Millisecond))
+		assert.NoError(t, cache.AddRequest(ctx, v16.Meta{Id: "message-2", Serialnumber: "charger-2", Direction: v16.ChargePointToCentralSystem}, v16.RequestBody{Uuid: "uuid-2", Action: core.Heartbeat, Payload: []byte("{}")}, time.Hour))
+		time.Sleep(10 * time.Millisecond)
+
+		swept, err := sweeper.Sweep(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, swept)
+
+		assert.Len(t, publisher.events, 1)
+		event := publisher.last()
+		assert.Equal(t, "message-1:"+EventRequestTimedOut, event.Id)
+		assert.Equal(t, EventRequestTimedOut, event.Type)
+		assert.Equal(t, "charger-1", event.Serialnumber)
+		data := event.Data.(RequestTimedOut)
+		assert.Equal(t, "uuid-1", data.Uuid)
+		assert.Equal(t, v16.ActionKind(core.Reset), data.Action)
+		assert.Equal(t, v16.CentralSystemToChargePoint, data.Direction)
+
+		var metrics metricdata.ResourceMetrics
+		assert.NoError(t, reader.Collect(ctx, &metrics))
+		assert.Len(t, metrics.ScopeMetrics, 1)
+		counter := metrics.ScopeMetrics[0].Metrics[0]
+		assert.Equal(t, "ocpp.requests.timed_out", counter.Name)
+		points := counter.Data.(metricdata.Sum[int64]).DataPoints
+		assert.Len(t, points, 1)
+		assert.Equal(t, int64(1), points[0].Value)
+		action, _ := points[0].Attributes.Value("action")
+		assert.Equal(t, string(core.Reset), action.AsString())
+
+		// A timed out request is reported once
+		swept, err = sweeper.Sweep(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, swept)
+	})
+
+	t.Run("WithoutPublisher", func(t *testing.T) {
+		_, cache := setupMiniredisTest(t)
+		sweeper := NewRequestSweeper(
+			WithSweeperTracerProvider(noop.NewTracerProvider()),
+			WithSweeperCache(cache),
+		)
+
+		assert.NoError(t, cache.AddRequest(ctx, v16.Meta{Id: "message-1", Serialnumber: "charger-1", Direction: v16.ChargePointToCentralSystem}, v16.RequestBody{Uuid: "uuid-1", Action: core.Heartbeat, Payload: []byte("{}")}, time.Millisecond))
+		time.Sleep(10 * time.Millisecond)
+
+		swept, err := sweeper.Sweep(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, swept)
+	})
+}
@@ -0,0 +1,242 @@
+package ocpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Application property counting how often a message has been rescheduled.
+const rescheduleCountProperty = "retrycount"
+
+// Recognises the transient errors of the store and cache: a locked or busy SQLite database, a PostgreSQL serialization
+// failure, deadlock, lost connection or shutdown, an exhausted Redis pool and a full memory cache.
+// Dropped connections are recognised by the default classifier.
+func classifyError(err error) (retry.Class, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"), // connection exception
+			pgErr.Code == "40001", // serialization_failure
+			pgErr.Code == "40P01", // deadlock_detected
+			pgErr.Code == "53300", // too_many_connections
+			pgErr.Code == "55P03", // lock_not_available
+			pgErr.Code == "57P01": // admin_shutdown
+			return retry.ClassTransient, true
+		}
+		return retry.ClassPermanent, true
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		if sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked {
+			return retry.ClassTransient, true
+		}
+		return retry.ClassPermanent, true
+	}
+	if errors.Is(err, redis.ErrPoolTimeout) || errors.Is(err, ErrCacheFull) {
+		return retry.ClassTransient, true
+	}
+	return retry.ClassPermanent, false
+}
+
+// Returns the in-process retry policy from the configuration.
+func retryPolicy(config utils.RetryConfiguration) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:     config.MaxAttempts,
+		InitialInterval: config.InitialInterval,
+		MaxInterval:     config.MaxInterval,
+		Multiplier:      config.Multiplier,
+		Jitter:          config.Jitter,
+	}
+}
+
+// Returns the policy for rescheduling a message through scheduled enqueue, once in-process retries are exhausted.
+func reschedulePolicy(config utils.RetryConfiguration) retry.Policy {
+	return retry.Policy{
+		InitialInterval: config.RescheduleInterval,
+		Multiplier:      config.Multiplier,
+		Jitter:          config.Jitter,
+	}
+}
+
+// Wraps a handler with the retry policy:
+//   - transient errors are retried in-process with exponential backoff and jitter,
+//   - when in-process attempts are exhausted the message is retried later, up to MaxReschedules times:
+//     on transports that schedule messages a copy is scheduled and the original completed,
+//     on transports that redeliver the error is returned marked transient for the transport to redeliver, which
+//     ordered transports do even if they schedule messages, so the message keeps its place before the ones after it,
+//     on other transports the message is not retried later,
+//   - permanent errors, and transient ones past MaxReschedules, are quarantined and the original completed.
+//
+// If rescheduling or quarantining fails the error is returned, so the message is abandoned and redelivered.
+func (o *Ocpp) withRetry(handler core.MessageHandler) core.MessageHandler {
+	policy := retryPolicy(o.config.Retry)
+
+	return func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+		attempts := 0
+		err := retry.Do(ctx, policy, func(ctx context.Context) error {
+			attempts++
+			return handler(ctx, topic, subscription, msg)
+		}, classifyError)
+		if err == nil {
+			return nil
+		}
+
+		class := retry.Classify(err, classifyError)
+		scheduler, canSchedule := o.client.(core.Scheduler)
+		redeliverer, canRedeliver := o.client.(core.Redeliverer)
+		if orderer, ok := o.client.(core.Orderer); ok && orderer.Ordered() && canRedeliver {
+			canSchedule = false
+		}
+		reschedules, maxReschedules := rescheduleCount(msg.Properties), o.config.Retry.MaxReschedules
+		switch {
+		case canSchedule:
+		case canRedeliver:
+			reschedules = max(msg.DeliveryCount-1, 0)
+			maxReschedules = min(maxReschedules, redeliverer.MaxDeliveries()-1)
+		default:
+			maxReschedules = 0
+		}
+		ctx, span := o.tracerProvider.Tracer("ocpp").Start(ctx, "handleFailure", trace.WithAttributes(
+			attribute.String("id", msg.ID),
+			attribute.String("error.class", class.String()),
+			attribute.Int("attempts", attempts),
+			attribute.Int("reschedules", reschedules),
+		))
+		defer span.End()
+		span.RecordError(err)
+
+		if class == retry.ClassTransient && reschedules < maxReschedules {
+			if canSchedule {
+				return o.reschedule(ctx, scheduler, topic, msg, reschedules+1)
+			}
+			return retry.Transient(err)
+		}
+
+		return o.quarantineMessage(ctx, topic, subscription, msg, class, reschedules*max(policy.MaxAttempts, 1)+attempts, err)
+	}
+}
+
+// Schedules a copy of the message on the topic after the reschedule backoff. The copy has an id of its own, so the
+// duplicate detection of the transport does not drop it, and keeps the id of the original in a property.
+func (o *Ocpp) reschedule(ctx context.Context, scheduler core.Scheduler, topic string, msg *core.Message, count int) error {
+	delay := reschedulePolicy(o.config.Retry).Backoff(count)
+
+	copied := &core.Message{
+		ID:          uuid.NewString(),
+		ContentType: msg.ContentType,
+		Properties:  core.CopyProperties(msg.Properties),
+		Body:        msg.Body,
+	}
+	copied.Properties[rescheduleCountProperty] = int64(count)
+	copied.Properties[core.OriginalIDProperty] = core.OriginalMessageID(msg)
+
+	if err := scheduler.ScheduleMessage(ctx, topic, copied, time.Now().Add(delay)); err != nil {
+		return fmt.Errorf("failed to reschedule message %s: %w", msg.ID, err)
+	}
+
+	slog.Warn("Rescheduled message after transient failure", "id", msg.ID, "reschedule", count, "delay", delay)
+	return nil
+}
+
+// Stores the message and its failure in the quarantine store, for the tenant of the message. A message whose tenant
+// cannot be resolved, such as one naming an unknown tenant, is quarantined for the tenant of ctx.
+func (o *Ocpp) quarantineMessage(
+	ctx context.Context,
+	topic, subscription string,
+	msg *core.Message,
+	class retry.Class,
+	attempts int,
+	cause error,
+) error {
+	quarantined := QuarantinedMessage{
+		MessageId:    core.OriginalMessageID(msg),
+		Serialnumber: propertyString(msg.Properties, core.SessionKeyProperty),
+		Topic:        topic,
+		Subscription: subscription,
+		ContentType:  msg.ContentType,
+		Properties:   core.CopyProperties(msg.Properties),
+		Body:         msg.Body,
+		Error:        cause.Error(),
+		ErrorClass:   class.String(),
+		Attempts:     attempts,
+	}
+
+	if event, err := core.CloudEventFromMessage(msg); err == nil && o.tenants != nil {
+		if tenant, err := o.tenants.Resolve(event.Tenant, event.Subject); err == nil {
+			ctx = WithTenant(ctx, tenant)
+		}
+	}
+
+	id, err := o.quarantine.Quarantine(ctx, quarantined)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message %s: %w", msg.ID, errors.Join(err, cause))
+	}
+
+	slog.Error("Quarantined message", "id", msg.ID, "quarantineId", id, "class", class, "attempts", attempts, "error", cause)
+	return nil
+}
+
+// Sends a quarantined message back to the topic it was received on, with its original properties, and marks it redriven.
+func (o *Ocpp) Redrive(ctx context.Context, id int64) error {
+	msg, err := o.quarantine.GetQuarantined(ctx, id)
+	if err != nil {
+		return err
+	}
+	if msg.RedrivenAt != nil {
+		return fmt.Errorf("quarantined message %d was already redriven at %s", id, msg.RedrivenAt)
+	}
+
+	message := &core.Message{
+		ID:          msg.MessageId,
+		ContentType: msg.ContentType,
+		Properties:  core.CopyProperties(msg.Properties),
+		Body:        msg.Body,
+	}
+	delete(message.Properties, rescheduleCountProperty)
+	delete(message.Properties, core.OriginalIDProperty)
+
+	if err := o.client.SendMessage(ctx, msg.Topic, message); err != nil {
+		return fmt.Errorf("failed to redrive quarantined message %d: %w", id, err)
+	}
+
+	return o.quarantine.MarkRedriven(ctx, id)
+}
+
+// Lists quarantined messages that have not been redriven, oldest first.
+func (o *Ocpp) ListQuarantined(ctx context.Context, limit int) ([]QuarantinedMessage, error) {
+	return o.quarantine.ListQuarantined(ctx, limit)
+}
+
+func rescheduleCount(properties map[string]any) int {
+	switch count := properties[rescheduleCountProperty].(type) {
+	case int64:
+		return int(count)
+	case int32:
+		return int(count)
+	case int:
+		return count
+	case float64:
+		return int(count)
+	default:
+		return 0
+	}
+}
+
+func propertyString(properties map[string]any, key string) string {
+	value, _ := properties[key].(string)
+	return value
+}
@@ -0,0 +1,239 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type mockQuarantine struct {
+	messages []QuarantinedMessage
+}
+
+func (m *mockQuarantine) Quarantine(ctx context.Context, msg QuarantinedMessage) (int64, error) {
+	msg.Id = int64(len(m.messages) + 1)
+	msg.Tenant = TenantOf(ctx)
+	m.messages = append(m.messages, msg)
+	return msg.Id, nil
+}
+
+func (m *mockQuarantine) GetQuarantined(ctx context.Context, id int64) (QuarantinedMessage, error) {
+	if id < 1 || int(id) > len(m.messages) {
+		return QuarantinedMessage{}, fmt.Errorf("quarantined message %d not found", id)
+	}
+	return m.messages[id-1], nil
+}
+
+func (m *mockQuarantine) ListQuarantined(ctx context.Context, limit int) ([]QuarantinedMessage, error) {
+	return m.messages, nil
+}
+
+func (m *mockQuarantine) MarkRedriven(ctx context.Context, id int64) error {
+	return nil
+}
+
+func setupRetryTest() (*Ocpp, *mockQuarantine) {
+	quarantine := &mockQuarantine{}
+	return &Ocpp{
+		tracerProvider: noop.NewTracerProvider(),
+		config: utils.Configuration{
+			Retry: utils.RetryConfiguration{
+				MaxAttempts:     3,
+				InitialInterval: time.Millisecond,
+				MaxInterval:     time.Millisecond,
+				Multiplier:      2,
+			},
+		},
+		quarantine: quarantine,
+	}, quarantine
+}
+
+func TestWithRetry(t *testing.T) {
+	msg := &core.Message{
+		ID:         "message-123",
+		Body:       []byte(`[2, "uuid-123", "Heartbeat", {}]`),
+		Properties: map[string]any{"serialnumber": "123456789"},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		o, quarantine := setupRetryTest()
+		calls := 0
+		handler := o.withRetry(func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			calls++
+			if calls == 1 {
+				return sqlite3.Error{Code: sqlite3.ErrBusy}
+			}
+			return nil
+		})
+
+		assert.NoError(t, handler(context.Background(), "topic", "sub", msg))
+		assert.Equal(t, 2, calls)
+		assert.Empty(t, quarantine.messages)
+	})
+
+	t.Run("PermanentQuarantined", func(t *testing.T) {
+		o, quarantine := setupRetryTest()
+		calls := 0
+		handler := o.withRetry(func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			calls++
+			return fmt.Errorf("failed to process message: invalid payload")
+		})
+
+		assert.NoError(t, handler(context.Background(), "topic", "sub", msg))
+		assert.Equal(t, 1, calls)
+		assert.Len(t, quarantine.messages, 1)
+		assert.Equal(t, "message-123", quarantine.messages[0].MessageId)
+		assert.Equal(t, "123456789", quarantine.messages[0].Serialnumber)
+		assert.Equal(t, "topic", quarantine.messages[0].Topic)
+		assert.Equal(t, retry.ClassPermanent.String(), quarantine.messages[0].ErrorClass)
+		assert.Equal(t, 1, quarantine.messages[0].Attempts)
+	})
+
+	t.Run("TransientExhaustedQuarantined", func(t *testing.T) {
+		o, quarantine := setupRetryTest()
+		calls := 0
+		handler := o.withRetry(func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			calls++
+			return sqlite3.Error{Code: sqlite3.ErrLocked}
+		})
+
+		assert.NoError(t, handler(context.Background(), "topic", "sub", msg))
+		assert.Equal(t, 3, calls)
+		assert.Len(t, quarantine.messages, 1)
+		assert.Equal(t, retry.ClassTransient.String(), quarantine.messages[0].ErrorClass)
+		assert.Equal(t, 3, quarantine.messages[0].Attempts)
+	})
+
+	t.Run("QuarantinedForTenant", func(t *testing.T) {
+		o, quarantine := setupRetryTest()
+		tenants, err := NewTenants(utils.TenancyConfiguration{
+			Tenants: []utils.TenantConfiguration{{ID: "operator-a", Serialnumbers: []string{"123456789"}}},
+		}, utils.BootConfiguration{})
+		assert.NoError(t, err)
+		o.tenants = tenants
+		event, err := cloudevents.New(eventSource, "123456789", []byte(`[2, "uuid-123", "Heartbeat", {}]`))
+		assert.NoError(t, err)
+		eventMsg, err := core.NewCloudEventMessage(event, cloudevents.ModeBinary)
+		assert.NoError(t, err)
+		handler := o.withRetry(func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+			return fmt.Errorf("failed to process message: invalid payload")
+		})
+
+		assert.NoError(t, handler(context.Background(), "topic", "sub", eventMsg))
+		if assert.Len(t, quarantine.messages, 1) {
+			assert.Equal(t, "operator-a", quarantine.messages[0].Tenant)
+		}
+	})
+}
+
+func TestClassifyError(t *testing.T) {
+	t.Run("Postgres", func(t *testing.T) {
+		for code, expected := range map[string]retry.Class{
+			"40001": retry.ClassTransient,
+			"40P01": retry.ClassTransient,
+			"08006": retry.ClassTransient,
+			"57P01": retry.ClassTransient,
+			"23505": retry.ClassPermanent,
+			"42P01": retry.ClassPermanent,
+		} {
+			class, ok := classifyError(fmt.Errorf("failed to add chargepoint: %w", &pgconn.PgError{Code: code}))
+			assert.True(t, ok, "expected code %s to be classified", code)
+			assert.Equal(t, expected, class, "code %s", code)
+		}
+	})
+
+	t.Run("SQLite", func(t *testing.T) {
+		class, ok := classifyError(sqlite3.Error{Code: sqlite3.ErrBusy})
+		assert.True(t, ok)
+		assert.Equal(t, retry.ClassTransient, class)
+	})
+}
+
+// Represents a transport that schedules messages, and redelivers them in order when ordered.
+type mockSchedulingTransport struct {
+	mockTransport
+	ordered   bool
+	scheduled []*core.Message
+}
+
+func (m *mockSchedulingTransport) ScheduleMessage(ctx context.Context, topic string, message *core.Message, enqueueAt time.Time) error {
+	m.scheduled = append(m.scheduled, message)
+	return nil
+}
+
+func (m *mockSchedulingTransport) MaxDeliveries() int {
+	return 10
+}
+
+func (m *mockSchedulingTransport) Ordered() bool {
+	return m.ordered
+}
+
+func TestReschedule(t *testing.T) {
+	msg := &core.Message{
+		ID:            "message-123",
+		Body:          []byte(`[2, "uuid-123", "Heartbeat", {}]`),
+		Properties:    map[string]any{"serialnumber": "123456789"},
+		DeliveryCount: 1,
+	}
+	transient := func(ctx context.Context, topic, subscription string, msg *core.Message) error {
+		return sqlite3.Error{Code: sqlite3.ErrBusy}
+	}
+
+	t.Run("ScheduledCopy", func(t *testing.T) {
+		o, quarantine := setupRetryTest()
+		o.config.Retry.MaxReschedules = 2
+		transport := &mockSchedulingTransport{}
+		o.client = transport
+
+		assert.NoError(t, o.withRetry(transient)(context.Background(), "topic", "sub", msg))
+		assert.Empty(t, quarantine.messages)
+		if assert.Len(t, transport.scheduled, 1) {
+			// The copy has an id of its own, so duplicate detection does not drop it
+			copied := transport.scheduled[0]
+			assert.NotEqual(t, msg.ID, copied.ID)
+			assert.Equal(t, msg.ID, copied.Properties[core.OriginalIDProperty])
+			assert.Equal(t, int64(1), copied.Properties[rescheduleCountProperty])
+			assert.Equal(t, msg.ID, core.OriginalMessageID(copied))
+		}
+		assert.NotContains(t, msg.Properties, core.OriginalIDProperty)
+	})
+
+	t.Run("OrderedRedelivered", func(t *testing.T) {
+		o, quarantine := setupRetryTest()
+		o.config.Retry.MaxReschedules = 2
+		transport := &mockSchedulingTransport{ordered: true}
+		o.client = transport
+
+		err := o.withRetry(transient)(context.Background(), "topic", "sub", msg)
+		assert.Error(t, err)
+		assert.Equal(t, retry.ClassTransient, retry.Classify(err, nil))
+		assert.Empty(t, transport.scheduled)
+		assert.Empty(t, quarantine.messages)
+	})
+
+	t.Run("CopyQuarantinedUnderOriginalId", func(t *testing.T) {
+		o, quarantine := setupRetryTest()
+		o.client = &mockSchedulingTransport{}
+		copied := &core.Message{
+			ID:         "copy-1",
+			Body:       msg.Body,
+			Properties: map[string]any{"serialnumber": "123456789", core.OriginalIDProperty: msg.ID, rescheduleCountProperty: int64(2)},
+		}
+
+		assert.NoError(t, o.withRetry(transient)(context.Background(), "topic", "sub", copied))
+		if assert.Len(t, quarantine.messages, 1) {
+			assert.Equal(t, msg.ID, quarantine.messages[0].MessageId)
+		}
+	})
+}
@@ -2,27 +2,56 @@ package ocpp
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
 	"github.com/squishmeist/ocpp-go/internal/core"
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
 	"github.com/squishmeist/ocpp-go/internal/core/utils"
-	"github.com/squishmeist/ocpp-go/service/ocpp/db"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
 	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// Source of the CloudEvents sent by ocpp.
+const eventSource = "/ocpp-go/ocpp"
+
+// How long a message claim is held before someone else may claim the message. Outlasts the in-process retries of a message.
+const messageClaimLease = 5 * time.Minute
+
 type OcppOption func(*Ocpp)
 
 type Ocpp struct {
 	ctx            context.Context
 	tracerProvider trace.TracerProvider
 	config         utils.Configuration
-	client         *core.AzureServiceBusClient
+	client         core.Transport
 	machine        *OcppMachine
+	cache          CacheAdapter
+	store          Store
+	quarantine     QuarantineAdapter
+	webhooks       *WebhookDispatcher
+	webhookLog     WebhookLogAdapter
+	dataQuality    DataQualityAdapter
+	outbox         OutboxAdapter
+	journal        *Journal // nil when journaling is disabled
+	tariffs        *Tariffs // nil when no tariffs are configured
+	tenants        *Tenants
+	relay          *OutboxRelay
+	sweeper        *RequestSweeper
+	meterProvider  metric.MeterProvider
+	workersDone    chan struct{}
 }
 
 func (o *Ocpp) Validate() error {
@@ -32,11 +61,11 @@ func (o *Ocpp) Validate() error {
 	if o.ctx == nil {
 		return fmt.Errorf("context is not set")
 	}
-	if o.config == (utils.Configuration{}) {
+	if reflect.DeepEqual(o.config, utils.Configuration{}) {
 		return fmt.Errorf("configuration is not set")
 	}
 	if o.client == nil {
-		return fmt.Errorf("azure service bus client is not set")
+		return fmt.Errorf("transport is not set")
 	}
 	return nil
 }
@@ -53,6 +82,13 @@ func WithOcppTracerProvider(tp trace.TracerProvider) OcppOption {
 	}
 }
 
+// Sets the meter provider metrics are recorded with. Without one no metrics are recorded.
+func WithOcppMeterProvider(mp metric.MeterProvider) OcppOption {
+	return func(o *Ocpp) {
+		o.meterProvider = mp
+	}
+}
+
 func WithOcppConfig(config utils.Configuration) OcppOption {
 	return func(o *Ocpp) {
 		o.config = config
@@ -60,35 +96,101 @@ func WithOcppConfig(config utils.Configuration) OcppOption {
 }
 
 func NewOcpp(opts ...OcppOption) *Ocpp {
-	start := &Ocpp{}
+	start := &Ocpp{
+		meterProvider: noop.NewMeterProvider(),
+	}
 
 	for _, opt := range opts {
 		opt(start)
 	}
 
-	client, err := core.NewAzureServiceBusClient(
-		core.WithAzureServiceBusServiceName("ocpp"),
-		core.WithAzureServiceBusConnectionString(start.config.AzureServiceBus.ConnectionString),
-	)
+	client, err := core.NewTransport("ocpp", start.config)
 	if err != nil {
-		slog.Error("Failed to create Azure Service Bus client", "error", err)
+		slog.Error("Failed to create transport", "error", err, "transport", start.config.Transport)
 		panic(err)
 	}
 	start.client = client
 
-	queries, _, err := db.Connect(start.config.Database)
+	store, err := NewStore(start.ctx, start.tracerProvider, start.config.Database)
 	if err != nil {
-		slog.Error("failed to connect to database", "error", err)
+		slog.Error("failed to connect to database", "error", err, "driver", start.config.Database.Driver)
 		panic(err)
 	}
-	store := NewDbStore(start.tracerProvider, queries)
-	cache := NewRedisCache(start.tracerProvider, "localhost:6379")
+	start.store = store
+	start.quarantine = store
+	start.webhookLog = store
+	start.dataQuality = store
+	start.outbox = store
+	cache, err := NewCache(start.tracerProvider, start.config.Cache)
+	if err != nil {
+		slog.Error("Failed to create cache", "error", err, "driver", start.config.Cache.Driver)
+		panic(err)
+	}
+	start.cache = cache
 
-	machine := NewOcppMachine(
+	machineOpts := []OcppMachineOption{
 		WithTracerProvider(start.tracerProvider),
 		WithCache(cache),
 		WithStore(store),
-	)
+		WithCdrStore(store),
+		WithRequestTimeouts(start.config.RequestTimeout),
+	}
+	sweeperOpts := []RequestSweeperOption{
+		WithSweeperTracerProvider(start.tracerProvider),
+		WithSweeperMeterProvider(start.meterProvider),
+		WithSweeperCache(cache),
+		WithSweeperInterval(start.config.RequestTimeout.SweepInterval),
+	}
+	relayOpts := []OutboxRelayOption{
+		WithOutboxTracerProvider(start.tracerProvider),
+		WithOutboxStore(store),
+		WithOutboxTransport(client),
+		WithOutboxInterval(start.config.Outbox.PollInterval),
+		WithOutboxBatchSize(start.config.Outbox.BatchSize),
+		WithOutboxRetention(start.config.Outbox.Retention),
+		WithOutboxMaxAttempts(start.config.Outbox.MaxAttempts),
+		WithOutboxLease(start.config.Outbox.Lease),
+	}
+	if len(start.config.Webhook.Endpoints) > 0 {
+		start.webhooks = NewWebhookDispatcher(append(
+			WebhookOptions(start.config.Webhook),
+			WithWebhookTracerProvider(start.tracerProvider),
+			WithWebhookLog(store),
+		)...)
+		// Domain events go through the outbox, and the relay hands them to the webhooks
+		machineOpts = append(machineOpts, WithPublisher(NewOutboxPublisher(store)))
+		sweeperOpts = append(sweeperOpts, WithSweeperPublisher(NewOutboxPublisher(store)))
+		relayOpts = append(relayOpts, WithOutboxPublisher(start.webhooks))
+	}
+	tenants, err := NewTenants(start.config.Tenancy, start.config.Boot)
+	if err != nil {
+		slog.Error("Failed to read tenants", "error", err)
+		panic(err)
+	}
+	start.tenants = tenants
+	machineOpts = append(machineOpts, WithTenants(tenants))
+	if len(start.config.Tariff.Tariffs) > 0 || slices.ContainsFunc(start.config.Tenancy.Tenants, func(tenant utils.TenantConfiguration) bool {
+		return len(tenant.Tariff.Tariffs) > 0
+	}) {
+		tariffs, err := NewTenantTariffs(start.config.Tariff, start.config.Tenancy.Tenants)
+		if err != nil {
+			slog.Error("Failed to read tariffs", "error", err)
+			panic(err)
+		}
+		start.tariffs = tariffs
+		machineOpts = append(machineOpts, WithTariffs(tariffs))
+	}
+	if start.config.Journal.Enabled {
+		start.journal = NewJournal(append(
+			JournalOptions(start.config.Journal),
+			WithJournalTracerProvider(start.tracerProvider),
+			WithJournalStore(store),
+		)...)
+	}
+	start.relay = NewOutboxRelay(relayOpts...)
+	start.sweeper = NewRequestSweeper(sweeperOpts...)
+
+	machine := NewOcppMachine(machineOpts...)
 	start.machine = machine
 
 	if err := start.Validate(); err != nil {
@@ -99,80 +201,374 @@ func NewOcpp(opts ...OcppOption) *Ocpp {
 	return start
 }
 
+// Returns the most recently seen data-quality findings, newest first.
+func (o *Ocpp) ListDataQualityFindings(ctx context.Context, limit int) ([]DataQualityFinding, error) {
+	return o.dataQuality.ListDataQualityFindings(ctx, limit)
+}
+
+// Returns the CDRs matching the filter, in the order their transactions stopped.
+func (o *Ocpp) ListCdrs(ctx context.Context, filter CdrFilter) ([]ChargeDetailRecord, error) {
+	return o.store.ListCdrs(ctx, filter)
+}
+
+// Returns the estimated cost of a transaction in progress as of now, or the cost of a stopped transaction.
+// Returns false when no tariff applies to it.
+func (o *Ocpp) EstimateCost(ctx context.Context, serialnumber string, transactionId int) (CostEstimate, bool, error) {
+	if o.tariffs == nil {
+		return CostEstimate{}, false, nil
+	}
+
+	transaction, err := o.store.GetTransaction(ctx, serialnumber, transactionId)
+	if err != nil {
+		return CostEstimate{}, false, err
+	}
+	now := time.Now().UTC()
+	until := now
+	if transaction.StoppedAt != nil {
+		until = *transaction.StoppedAt
+	}
+	samples, statuses, err := transactionUsage(ctx, o.store, transaction, until)
+	if err != nil {
+		return CostEstimate{}, false, err
+	}
+
+	estimate, ok := o.tariffs.Estimate(transaction, samples, statuses, now)
+	return estimate, ok, nil
+}
+
+// Returns the outbox messages parked after failing to send too many times, in the order they were parked.
+func (o *Ocpp) ListParkedOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	return o.outbox.ListParkedOutbox(ctx, limit)
+}
+
+// Unparks a parked outbox message, so the relay sends it again.
+func (o *Ocpp) UnparkOutbox(ctx context.Context, id int64) error {
+	return o.relay.Unpark(ctx, id)
+}
+
+// Returns the journaled frames matching the filter, oldest first.
+func (o *Ocpp) ListJournal(ctx context.Context, filter JournalFilter) ([]JournalEntry, error) {
+	return o.store.ListJournal(ctx, filter)
+}
+
+// Returns the store of the Ocpp, for modules serving what it records.
+func (o *Ocpp) Store() Store {
+	return o.store
+}
+
+// Returns the configured tariffs, or nil when there are none.
+func (o *Ocpp) Tariffs() *Tariffs {
+	return o.tariffs
+}
+
+// Starts the outbox relay and the request sweeper, and receives messages from the inbound topic until the context is cancelled.
 func (o *Ocpp) Start() error {
-	defer o.client.Close(o.ctx)
-	inbound := o.config.AzureServiceBus.TopicInbound
+	inbound, _ := o.config.Topics()
 
-	handler := o.handler()
-	o.client.ReceiveMessage(o.ctx, inbound.Name, inbound.Subscription, handler)
+	o.workersDone = make(chan struct{})
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		o.relay.Run(o.ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		o.sweeper.Run(o.ctx)
+	}()
+	go func() {
+		workers.Wait()
+		close(o.workersDone)
+	}()
+
+	handler := o.withRetry(o.handler())
+	if err := o.client.ReceiveMessage(o.ctx, inbound.Name, inbound.Subscription, handler); err != nil {
+		return fmt.Errorf("failed to receive messages: %w", err)
+	}
 
 	return nil
 }
 
+// Waits for in-flight messages to finish within the context deadline, sends what is left in the outbox,
+// delivers queued webhooks, appends queued journal entries, flushes pending spans, and closes the transport, the cache and the database in that order.
+func (o *Ocpp) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if err := o.client.Wait(ctx); err != nil {
+		slog.Error("Failed to wait for in-flight messages", "error", err)
+		errs = append(errs, err)
+	}
+
+	if o.workersDone != nil {
+		select {
+		case <-o.workersDone:
+		case <-ctx.Done():
+		}
+	}
+	if err := o.relay.Flush(ctx); err != nil {
+		slog.Error("Failed to send outbox messages", "error", err)
+		errs = append(errs, err)
+	}
+
+	if o.webhooks != nil {
+		if err := o.webhooks.Close(ctx); err != nil {
+			slog.Error("Failed to deliver queued webhooks", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if o.journal != nil {
+		if err := o.journal.Close(ctx); err != nil {
+			slog.Error("Failed to append queued journal entries", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if flusher, ok := o.tracerProvider.(interface{ ForceFlush(context.Context) error }); ok {
+		if err := flusher.ForceFlush(ctx); err != nil {
+			slog.Error("Failed to flush tracer provider", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if err := o.client.Close(ctx); err != nil {
+		slog.Error("Failed to close transport", "error", err)
+		errs = append(errs, err)
+	}
+
+	if closer, ok := o.cache.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("Failed to close cache", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if err := o.store.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
 func (o *Ocpp) handler() core.MessageHandler {
-	inbound, outbound := o.config.AzureServiceBus.TopicInbound, o.config.AzureServiceBus.TopicOutbound
+	inbound, outbound := o.config.Topics()
 
-	return func(ctx context.Context, topic, subscription string, msg *azservicebus.ReceivedMessage) error {
-		ctx, span := o.tracerProvider.Tracer("ocpp").Start(ctx, "processMessage", trace.WithAttributes(
-			attribute.String("id", msg.MessageID),
-			attribute.String("serialnumber", msg.ApplicationProperties["serialnumber"].(string)),
+	return func(ctx context.Context, topic, subscription string, msg *core.Message) (err error) {
+		started := time.Now()
+		// ctx carries the remote span context extracted from the message traceparent, continuing the sender's trace
+		ctx, span := o.tracerProvider.Tracer("ocpp").Start(ctx, "processMessage", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+			attribute.String("id", msg.ID),
 			attribute.String("topic", inbound.Name),
 			attribute.String("subscription", inbound.Subscription),
 			attribute.String("body", string(msg.Body)),
 		))
 		defer span.End()
 
-		serialnumber, ok := msg.ApplicationProperties["serialnumber"].(string)
-		if !ok {
-			err := fmt.Errorf("serialnumber not found in message properties")
+		event, err := core.CloudEventFromMessage(msg)
+		if err != nil {
+			err := fmt.Errorf("failed to read cloud event from message: %w", err)
 			slog.Error("Failed to process message", "error", err)
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			span.End()
 			return err
 		}
+		span.SetAttributes(
+			attribute.String("cloudevents.event_id", event.ID),
+			attribute.String("cloudevents.event_type", event.Type),
+			attribute.String("cloudevents.event_source", event.Source),
+			attribute.String("serialnumber", event.Subject),
+		)
 
-		body, err := o.machine.HandleMessage(ctx, v16.Meta{
-			Id:           msg.MessageID,
-			Serialnumber: serialnumber,
-		}, msg.Body)
-		if err != nil {
+		serialnumber := event.Subject
+		if serialnumber == "" {
+			err := fmt.Errorf("serialnumber not found in message")
+			slog.Error("Failed to process message", "error", err)
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			span.End()
 			return err
 		}
 
-		if err := o.machine.cache.AddProcessed(ctx, msg.MessageID); err != nil {
-			slog.Error("Failed to add message to processed cache", "error", err)
+		// Everything the message touches is kept apart per tenant, carried in ctx
+		tenant, err := o.tenants.Resolve(event.Tenant, serialnumber)
+		if err != nil {
+			err := fmt.Errorf("failed to resolve tenant of message: %w", err)
+			slog.Error("Failed to process message", "error", err, "serialnumber", serialnumber)
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			span.End()
 			return err
 		}
-		slog.Info("Message processed successfully")
+		ctx = WithTenant(ctx, tenant)
+		span.SetAttributes(attribute.String("tenant", tenant))
+
+		// Every delivery of the frame is journaled with its outcome once it is handled
+		journaled := journalEntry(JournalInbound, serialnumber, event.Data)
+		journaled.TraceId = span.SpanContext().TraceID().String()
+		journaled.Tenant = tenant
+		duplicate := false
+		defer func() {
+			journaled.Latency = time.Since(started)
+			switch {
+			case err != nil:
+				journaled.Outcome = JournalOutcomeFailed
+				journaled.Error = err.Error()
+			case duplicate:
+				journaled.Outcome = JournalOutcomeDuplicate
+			default:
+				journaled.Outcome = JournalOutcomeProcessed
+			}
+			o.record(journaled)
+		}()
 
-		if body == nil {
-			slog.Info("No response body to send")
-			span.SetStatus(codes.Ok, "Message processed successfully")
+		// Claim the message so no one else processes it at the same time
+		claim, err := o.machine.cache.ClaimMessage(ctx, event.ID, messageClaimLease)
+		if err != nil {
+			slog.Error("Failed to claim message", "error", err, "id", event.ID, "tenant", tenant)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			return err
+		}
+		switch claim.State {
+		case ClaimInProgress:
+			err := retry.Transient(fmt.Errorf("failed to claim message with id %s: %w", event.ID, ErrMessageInProgress))
+			slog.Info("Message is being processed elsewhere", "id", event.ID, "tenant", tenant)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			return err
+		case ClaimCompleted:
+			slog.Info("Message already processed", "id", event.ID, "tenant", tenant)
+			span.AddEvent("message already processed")
+			duplicate = true
+			if err := o.resendReply(ctx, outbound.Name, serialnumber, claim.Reply); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				span.End()
+				return err
+			}
+			if reply, err := cloudevents.FromStructured(claim.Reply); err == nil {
+				o.recordOutbound(journaled, reply.Data, started)
+			}
+			span.SetStatus(codes.Ok, "Message already processed")
 			span.End()
 			return nil
 		}
 
-		if err := o.client.SendMessage(ctx, outbound.Name, &azservicebus.Message{
-			ApplicationProperties: map[string]any{
-				"serialnumber": serialnumber,
-			},
-			Body: body,
-		}); err != nil {
+		// The store changes, the processed marker and the reply and events in the outbox are committed together
+		var reply, frame []byte
+		err = o.outbox.InTx(ctx, func(ctx context.Context) error {
+			if err := o.outbox.MarkProcessed(ctx, event.ID); err != nil {
+				return err
+			}
+
+			body, err := o.machine.HandleMessage(ctx, v16.Meta{
+				Id:           event.ID,
+				Serialnumber: serialnumber,
+			}, event.Data)
+			if err != nil {
+				return err
+			}
+
+			if body == nil {
+				slog.Info("No response body to send")
+				return nil
+			}
+
+			replyEvent, err := cloudevents.New(eventSource, serialnumber, body)
+			if err != nil {
+				return err
+			}
+			replyEvent.Tenant = tenant
+			payload, err := json.Marshal(replyEvent)
+			if err != nil {
+				return err
+			}
+
+			if _, err := o.outbox.AddOutbox(ctx, OutboxMessage{
+				Kind:         OutboxKindReply,
+				Destination:  outbound.Name,
+				Payload:      payload,
+				Properties:   core.InjectTraceContext(ctx, map[string]any{}),
+				Serialnumber: serialnumber,
+			}); err != nil {
+				return err
+			}
+			reply, frame = payload, body
+			return nil
+		})
+		if errors.Is(err, ErrAlreadyProcessed) {
+			// The claim was forgotten, but the database remembers the message
+			slog.Info("Message already processed", "id", event.ID, "tenant", tenant)
+			span.AddEvent("message already processed")
+			duplicate = true
+		} else if err != nil {
+			if releaseErr := o.machine.cache.ReleaseMessage(context.WithoutCancel(ctx), claim); releaseErr != nil {
+				slog.Error("Failed to release message claim", "error", releaseErr, "id", event.ID, "tenant", tenant)
+			}
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			span.End()
 			return err
 		}
+		o.relay.Notify()
+		if frame != nil {
+			o.recordOutbound(journaled, frame, started)
+		}
+
+		// The changes are committed, so a claim that cannot be completed is only logged: the database filters the redelivery
+		if err := o.machine.cache.CompleteMessage(ctx, claim, reply); err != nil {
+			slog.Warn("Failed to complete message claim", "error", err, "id", event.ID, "tenant", tenant)
+			span.RecordError(err)
+		}
+		slog.Info("Message processed successfully", "id", event.ID, "tenant", tenant)
 
-		span.SetStatus(codes.Ok, "Message sent successfully")
+		span.SetStatus(codes.Ok, "Message processed successfully")
 		span.End()
 		return nil
 	}
 }
+
+// Sends the stored reply of an already processed message again, through the outbox. The reply keeps its CloudEvent id,
+// so receivers can tell it is the original confirmation.
+func (o *Ocpp) resendReply(ctx context.Context, topic, serialnumber string, reply []byte) error {
+	if reply == nil {
+		return nil
+	}
+
+	if _, err := o.outbox.AddOutbox(ctx, OutboxMessage{
+		Kind:         OutboxKindReply,
+		Destination:  topic,
+		Payload:      reply,
+		Properties:   core.InjectTraceContext(ctx, map[string]any{}),
+		Serialnumber: serialnumber,
+	}); err != nil {
+		return fmt.Errorf("failed to resend reply: %w", err)
+	}
+	o.relay.Notify()
+	return nil
+}
+
+// Queues a journal entry, if journaling is enabled.
+func (o *Ocpp) record(entry JournalEntry) {
+	if o.journal != nil {
+		o.journal.Record(entry)
+	}
+}
+
+// Queues a journal entry for the reply frame to an inbound frame, queued in the outbox. A reply carries no action,
+// so it is journaled with the action of the frame it replies to.
+func (o *Ocpp) recordOutbound(inbound JournalEntry, frame []byte, started time.Time) {
+	outbound := journalEntry(JournalOutbound, inbound.Serialnumber, frame)
+	if outbound.Action == "" {
+		outbound.Action = inbound.Action
+	}
+	outbound.TraceId = inbound.TraceId
+	outbound.Tenant = inbound.Tenant
+	outbound.Outcome = JournalOutcomeQueued
+	outbound.Latency = time.Since(started)
+	o.record(outbound)
+}
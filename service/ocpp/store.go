@@ -2,20 +2,402 @@ package ocpp
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"time"
 
 	v16 "github.com/squishmeist/ocpp-go/service/ocpp/v1.6"
 	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
 )
 
 type StoreAdapter interface {
-	AddChargepoint(ctx context.Context, payload core.BootNotificationRequest) error
+	// Adds the charge point under serialnumber, its identity on the transport, or refreshes it if it booted before, and
+	// records the boot in its boot history. Serial numbers in the payload that differ from serialnumber are recorded
+	// as data-quality findings.
+	AddChargepoint(ctx context.Context, serialnumber string, payload core.BootNotificationRequest) (ChargepointBoot, error)
+	// Returns the charge point, or ErrChargepointNotFound if it never booted.
+	GetChargepoint(ctx context.Context, serialnumber string) (Chargepoint, error)
+	// Updates the last heartbeat, returning ErrChargepointNotFound if the charge point never booted.
 	UpdateLastHeartbeat(ctx context.Context, serialnumber string, payload core.HeartbeatConfirmation) error
+	// Stores a started transaction and returns its transaction id.
+	StartTransaction(ctx context.Context, serialnumber string, payload core.StartTransactionRequest) (int, error)
+	// Stops a transaction, returning ErrTransactionNotFound if the charge point has no transaction with the id, or
+	// ErrTransactionStopped if it has already stopped, leaving it as it was.
+	StopTransaction(ctx context.Context, serialnumber string, payload core.StopTransactionRequest) error
+	// Returns a transaction, or ErrTransactionNotFound if the charge point has no transaction with the id.
+	GetTransaction(ctx context.Context, serialnumber string, transactionId int) (Transaction, error)
+	// Returns the transactions matching the filter, in the order they started.
+	ListTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error)
+	// Returns how many transactions match the filter, ignoring its offset and limit.
+	CountTransactions(ctx context.Context, filter TransactionFilter) (int, error)
 }
 
+// Represents a charge point as of its last boot. The serial numbers and ICCID, IMSI and meter details are empty when
+// it did not report them, and LastHeartbeat is nil until its first heartbeat.
+type Chargepoint struct {
+	Serialnumber            string
+	Model                   string
+	Vendor                  string
+	FirmwareVersion         string
+	Iccid                   string
+	Imsi                    string
+	MeterSerialNumber       string
+	MeterType               string
+	ChargeBoxSerialNumber   string
+	ChargePointSerialNumber string
+	LastBoot                time.Time
+	LastHeartbeat           *time.Time
+	Tenant                  string
+}
+
+// Returned when a charge point is not known.
+var ErrChargepointNotFound = errors.New("chargepoint not found")
+
+// Represents a charging transaction. MeterStop and StoppedAt are nil while it has not stopped.
+type Transaction struct {
+	Id           int
+	Serialnumber string
+	ConnectorId  int
+	IdTag        string
+	MeterStart   int
+	StartedAt    time.Time
+	MeterStop    *int
+	StoppedAt    *time.Time
+	StopReason   core.Reason
+	Tenant       string
+}
+
+// Represents what transactions to list. Zero times match everything, and a nil Serialnumbers every charge point.
+// A transaction is updated when it stops, or while in progress when its latest meter reading is taken, or else when
+// it starts. Offset transactions are skipped before Limit are listed.
+type TransactionFilter struct {
+	Serialnumbers []string
+	UpdatedFrom   time.Time // inclusive
+	UpdatedTo     time.Time // exclusive
+	Offset        int
+	Limit         int
+}
+
+// Returns when a transaction was last updated, given its meter readings: when it stopped, or while in progress when
+// its latest reading was taken, or else when it started.
+func TransactionUpdatedAt(transaction Transaction, samples []MeterSample) time.Time {
+	if transaction.StoppedAt != nil {
+		return *transaction.StoppedAt
+	}
+	var latest *time.Time
+	for _, sample := range samples {
+		if latest == nil || sample.SampledAt.After(*latest) {
+			latest = &sample.SampledAt
+		}
+	}
+	if latest != nil {
+		return *latest
+	}
+	return transaction.StartedAt
+}
+
+// Checks if a transaction updated at updatedAt matches the filter.
+func (f TransactionFilter) Matches(transaction Transaction, updatedAt time.Time) bool {
+	return (f.Serialnumbers == nil || slices.Contains(f.Serialnumbers, transaction.Serialnumber)) &&
+		(f.UpdatedFrom.IsZero() || !updatedAt.Before(f.UpdatedFrom)) &&
+		(f.UpdatedTo.IsZero() || updatedAt.Before(f.UpdatedTo))
+}
+
+// Represents a boot of a charge point. PreviousFirmwareVersion is the firmware version of its previous boot, empty on
+// its first boot.
+type ChargepointBoot struct {
+	Serialnumber            string
+	FirmwareVersion         string
+	PreviousFirmwareVersion string
+	BootedAt                time.Time
+}
+
+// Checks if the charge point booted before with a different firmware version.
+func (b ChargepointBoot) FirmwareChanged() bool {
+	return b.PreviousFirmwareVersion != "" && b.PreviousFirmwareVersion != b.FirmwareVersion
+}
+
+// Returned when a transaction is not known for a charge point.
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// Returned when stopping a transaction that has already stopped.
+var ErrTransactionStopped = errors.New("transaction already stopped")
+
 type CacheAdapter interface {
-	HasProcessed(ctx context.Context, id string) (bool, error)
-	AddProcessed(ctx context.Context, id string) error
-	GetRequestFromUuid(ctx context.Context, uuid string) (v16.RequestBody, error)
-	AddRequest(ctx context.Context, meta v16.Meta, request v16.RequestBody) error
+	// Claims a message for processing for the lease. The claim is acquired if no one else holds it, otherwise the
+	// returned claim tells if the message is being processed by someone else or was completed, with the stored reply.
+	ClaimMessage(ctx context.Context, id string, lease time.Duration) (MessageClaim, error)
+	// Marks a claimed message completed and stores its reply, returning ErrClaimLost if the lease ran out and the
+	// claim is no longer held.
+	CompleteMessage(ctx context.Context, claim MessageClaim, reply []byte) error
+	// Releases a claimed message so it can be claimed again, returning ErrClaimLost if the claim is no longer held.
+	ReleaseMessage(ctx context.Context, claim MessageClaim) error
+	// Pending requests are kept per charge point and direction, from meta.Serialnumber and meta.Direction, the direction
+	// the request was sent in. A request is only found with the serial number and direction it was added with.
+	GetRequestFromUuid(ctx context.Context, meta v16.Meta, uuid string) (v16.RequestBody, error)
+	// Adds a pending request that should be confirmed within the timeout. A timeout of zero never times out.
+	AddRequest(ctx context.Context, meta v16.Meta, request v16.RequestBody, timeout time.Duration) error
 	RemoveRequest(ctx context.Context, meta v16.Meta, request v16.ConfirmationBody) error
+	// Removes and returns up to limit pending requests whose deadline is before now. Each request is returned once,
+	// also when several instances take expired requests at the same time.
+	TakeExpiredRequests(ctx context.Context, now time.Time, limit int) ([]PendingRequest, error)
+}
+
+// Represents a request waiting for its confirmation. Meta holds the id of the message that carried the request,
+// the serial number of the charge point and the direction of the request.
+type PendingRequest struct {
+	Meta     v16.Meta
+	Request  v16.RequestBody
+	AddedAt  time.Time
+	Deadline time.Time
+	Tenant   string
+}
+
+// Returned when no pending request matches a confirmation.
+var ErrRequestNotFound = errors.New("request not found")
+
+// Represents the state of a message claim.
+type ClaimState string
+
+const (
+	// The claim was acquired and the message should be processed.
+	ClaimAcquired ClaimState = "acquired"
+	// The message is being processed under someone else's claim.
+	ClaimInProgress ClaimState = "in-progress"
+	// The message was processed, and the claim holds its reply.
+	ClaimCompleted ClaimState = "completed"
+)
+
+// Represents a claim on a message. Token identifies the holder of an acquired claim, and Reply is the stored reply
+// of a completed message, nil if it had none.
+type MessageClaim struct {
+	Id    string
+	Token string
+	State ClaimState
+	Reply []byte
+}
+
+// Returned when completing or releasing a claim whose lease ran out.
+var ErrClaimLost = errors.New("message claim lost")
+
+// Returned when the cache holds as many in-progress claims and pending requests as it may. It is transient, so the
+// message is retried once some are done.
+var ErrCacheFull = errors.New("cache full")
+
+// Returned when a message is being processed under someone else's claim.
+var ErrMessageInProgress = errors.New("message is being processed")
+
+// Keeps quarantined messages per tenant: each method works on those of the tenant of ctx.
+type QuarantineAdapter interface {
+	Quarantine(ctx context.Context, msg QuarantinedMessage) (int64, error)
+	GetQuarantined(ctx context.Context, id int64) (QuarantinedMessage, error)
+	ListQuarantined(ctx context.Context, limit int) ([]QuarantinedMessage, error)
+	MarkRedriven(ctx context.Context, id int64) error
+}
+
+// Represents a message that failed permanently or ran out of retries, with the context needed to inspect and redrive it.
+type QuarantinedMessage struct {
+	Id            int64
+	MessageId     string
+	Serialnumber  string
+	Topic         string
+	Subscription  string
+	ContentType   string
+	Properties    map[string]any
+	Body          []byte
+	Error         string
+	ErrorClass    string
+	Attempts      int
+	QuarantinedAt time.Time
+	RedrivenAt    *time.Time
+	Tenant        string
+}
+
+type DataQualityAdapter interface {
+	ListDataQualityFindings(ctx context.Context, limit int) ([]DataQualityFinding, error)
+}
+
+// Kinds of data-quality findings.
+const (
+	// A serial number reported by a charge point differs from its identity on the transport.
+	FindingSerialNumberMismatch = "serial_number_mismatch"
+)
+
+// Represents a problem found in what a charge point reported. Field is the payload field and Value what was reported.
+// A finding seen again is not added twice, its LastSeenAt and Occurrences are updated instead.
+type DataQualityFinding struct {
+	Id           int64
+	Serialnumber string
+	Kind         string
+	Field        string
+	Value        string
+	FirstSeenAt  time.Time
+	LastSeenAt   time.Time
+	Occurrences  int
+}
+
+// Keeps webhook deliveries per tenant: each method works on those of the tenant of ctx.
+type WebhookLogAdapter interface {
+	RecordWebhookDelivery(ctx context.Context, delivery WebhookDelivery) (int64, error)
+	ListWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error)
+}
+
+// Represents the outcome of posting a domain event to a webhook endpoint.
+type WebhookDelivery struct {
+	Id          int64
+	EventId     string
+	EventType   string
+	URL         string
+	StatusCode  int // 0 when no response was received
+	Attempts    int
+	Error       string
+	CreatedAt   time.Time
+	DeliveredAt *time.Time // nil when the delivery failed
+	Tenant      string
+}
+
+type CdrAdapter interface {
+	// Adds the energy register readings of a transaction.
+	AddMeterSamples(ctx context.Context, samples []MeterSample) error
+	// Returns the energy register readings of a transaction, oldest first.
+	ListMeterSamples(ctx context.Context, serialnumber string, transactionId int) ([]MeterSample, error)
+	// Adds a status reported for a connector.
+	AddConnectorStatus(ctx context.Context, status ConnectorStatus) error
+	// Returns the status the connector had at from, if it reported one before, followed by the statuses it reported
+	// until to, oldest first.
+	ListConnectorStatuses(ctx context.Context, serialnumber string, connectorId int, from, to time.Time) ([]ConnectorStatus, error)
+	// Returns the last status reported for each connector of a charge point, by connector id.
+	ListLatestConnectorStatuses(ctx context.Context, serialnumber string) ([]ConnectorStatus, error)
+	// Adds the CDR of a stopped transaction and returns its id, or ErrCdrExists if the transaction has one.
+	// A CDR is never changed or deleted once added.
+	AddCdr(ctx context.Context, cdr ChargeDetailRecord) (int64, error)
+	// Returns the CDR of a transaction, or ErrCdrNotFound if it has none.
+	GetCdr(ctx context.Context, serialnumber string, transactionId int) (ChargeDetailRecord, error)
+	// Returns the CDRs matching the filter, in the order their transactions stopped.
+	ListCdrs(ctx context.Context, filter CdrFilter) ([]ChargeDetailRecord, error)
+	// Returns how many CDRs match the filter, ignoring its offset and limit.
+	CountCdrs(ctx context.Context, filter CdrFilter) (int, error)
+}
+
+type JournalAdapter interface {
+	// Appends the entries to the message journal of the tenant of ctx.
+	AppendJournal(ctx context.Context, entries []JournalEntry) error
+	// Returns the journal entries of the tenant of ctx matching the filter, oldest first.
+	ListJournal(ctx context.Context, filter JournalFilter) ([]JournalEntry, error)
+}
+
+// Represents the direction of a journaled frame, as seen from the central system.
+type JournalDirection string
+
+const (
+	JournalInbound  JournalDirection = "inbound"
+	JournalOutbound JournalDirection = "outbound"
+)
+
+// Outcomes of a journaled frame.
+const (
+	// An inbound frame was handled and its changes committed.
+	JournalOutcomeProcessed = "processed"
+	// An inbound frame had been processed before, so only its reply was sent again.
+	JournalOutcomeDuplicate = "duplicate"
+	// An inbound frame failed; Error says why.
+	JournalOutcomeFailed = "failed"
+	// An outbound frame was written to the outbox, to be sent by the outbox relay.
+	JournalOutcomeQueued = "queued"
+)
+
+// Represents an OCPP frame received from or sent to a charge point. MessageId, Action and TypeId are read from the frame
+// and are empty when it could not be read. Latency is how long the frame took to process. Tenant is the tenant of the
+// charge point, which the journal appends the entry for.
+type JournalEntry struct {
+	Id           int64
+	Direction    JournalDirection
+	Serialnumber string
+	MessageId    string
+	Action       string
+	TypeId       int // 2 for a CALL, 3 for a CALLRESULT, 4 for a CALLERROR
+	Body         []byte
+	TraceId      string
+	Outcome      string
+	Error        string
+	Latency      time.Duration
+	RecordedAt   time.Time
+	Tenant       string
+}
+
+// Represents what journal entries to list. Empty fields and zero times match everything.
+type JournalFilter struct {
+	Serialnumber string
+	Action       string
+	From         time.Time // inclusive
+	To           time.Time // exclusive
+	Limit        int
+}
+
+// Checks if the entry matches the filter.
+func (f JournalFilter) Matches(entry JournalEntry) bool {
+	return (f.Serialnumber == "" || entry.Serialnumber == f.Serialnumber) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.From.IsZero() || !entry.RecordedAt.Before(f.From)) &&
+		(f.To.IsZero() || entry.RecordedAt.Before(f.To))
+}
+
+type OutboxAdapter interface {
+	// Runs fn in a transaction. Store and outbox calls made with the context passed to fn take part in it.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// Records an inbound message as processed in the tenant of ctx, returning ErrAlreadyProcessed if it was before.
+	MarkProcessed(ctx context.Context, messageId string) error
+	// Adds a message to the outbox for the tenant of ctx.
+	AddOutbox(ctx context.Context, msg OutboxMessage) (int64, error)
+	// Returns the unsent messages of the tenant of ctx, oldest first.
+	ListUnsentOutbox(ctx context.Context, limit int) ([]OutboxMessage, error)
+	// Leases up to limit unsent messages of any tenant, oldest first, that no one else holds a lease on, so that with
+	// several instances each message is sent by one of them. A leased message is not returned again until the lease
+	// runs out or it is marked failed. Only the oldest unsent message of a charge point is leased, so a later one is
+	// not sent before an earlier one that is leased elsewhere or failed has been sent or parked.
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, id int64) error
+	// Records a failed attempt to send a message and releases its lease.
+	MarkOutboxFailed(ctx context.Context, id int64, reason string) error
+	// Records the last failed attempt to send a message and parks it, so it is no longer sent.
+	ParkOutbox(ctx context.Context, id int64, reason string) error
+	// Returns the parked messages of the tenant of ctx, in the order they were parked.
+	ListParkedOutbox(ctx context.Context, limit int) ([]OutboxMessage, error)
+	// Unparks a message of the tenant of ctx and resets its attempts, so it is sent again, returning ErrOutboxNotParked
+	// if it is not parked.
+	UnparkOutbox(ctx context.Context, id int64) error
+	DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Returned when unparking an outbox message that is not parked.
+var ErrOutboxNotParked = errors.New("outbox message not parked")
+
+// Returned when an inbound message has already been processed.
+var ErrAlreadyProcessed = errors.New("message already processed")
+
+// Represents what an outbox message carries.
+type OutboxKind string
+
+const (
+	// A structured CloudEvent sent to the transport topic named by Destination
+	OutboxKindReply OutboxKind = "reply"
+	// A DomainEvent published to the event publisher; Destination is the event type
+	OutboxKindEvent OutboxKind = "event"
+)
+
+// Represents a reply or domain event written with the changes of the message that produced it, waiting to be sent.
+// ParkedAt is set once it failed to send too many times, and it is no longer sent until it is unparked.
+type OutboxMessage struct {
+	Id           int64
+	Kind         OutboxKind
+	Destination  string
+	Payload      []byte
+	Properties   map[string]any // trace context of the message that produced it
+	CreatedAt    time.Time
+	SentAt       *time.Time
+	Attempts     int
+	LastError    string
+	ParkedAt     *time.Time
+	Serialnumber string // of the charge point it is for, whose messages are sent in the order they were written
+	Tenant       string // of the message or event that produced it, which it is sent for
 }
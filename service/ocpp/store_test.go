@@ -0,0 +1,1007 @@
+package ocpp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/types"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Represents what a store under conformance test implements.
+type conformanceStore interface {
+	StoreAdapter
+	DataQualityAdapter
+	JournalAdapter
+	CdrAdapter
+}
+
+// Creates an empty store for a conformance test.
+type storeSetup func(t *testing.T) conformanceStore
+
+func TestDbStoreConformance(t *testing.T) {
+	testStoreAdapter(t, func(t *testing.T) conformanceStore {
+		return setupOutboxTest(t)
+	})
+}
+
+func TestPgStoreConformance(t *testing.T) {
+	testStoreAdapter(t, func(t *testing.T) conformanceStore {
+		return setupPgStoreTest(t)
+	})
+}
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testStoreAdapter(t, func(t *testing.T) conformanceStore {
+		return NewMemoryStore(WithMemoryStoreTracerProvider(noop.NewTracerProvider()))
+	})
+}
+
+// Runs the tests every StoreAdapter has to pass.
+func testStoreAdapter(t *testing.T, setup storeSetup) {
+	t.Run("Chargepoints", func(t *testing.T) { testStoreChargepoints(t, setup) })
+	t.Run("Heartbeats", func(t *testing.T) { testStoreHeartbeats(t, setup) })
+	t.Run("Transactions", func(t *testing.T) { testStoreTransactions(t, setup) })
+	t.Run("Concurrency", func(t *testing.T) { testStoreConcurrency(t, setup) })
+	t.Run("Journal", func(t *testing.T) { testStoreJournal(t, setup) })
+	t.Run("Cdrs", func(t *testing.T) { testStoreCdrs(t, setup) })
+	t.Run("Tenants", func(t *testing.T) { testStoreTenants(t, setup) })
+}
+
+func testStoreChargepoints(t *testing.T, setup storeSetup) {
+	ctx := context.Background()
+	request := core.BootNotificationRequest{
+		ChargeBoxSerialNumber:   "charger-1",
+		ChargePointSerialNumber: "ZAPPI-0001",
+		ChargePointModel:        "Zappi",
+		ChargePointVendor:       "Myenergi",
+		FirmwareVersion:         "5540",
+		Iccid:                   "iccid-1",
+	}
+
+	t.Run("Unknown", func(t *testing.T) {
+		store := setup(t)
+
+		_, err := store.GetChargepoint(ctx, "charger-1")
+		assert.ErrorIs(t, err, ErrChargepointNotFound)
+	})
+
+	t.Run("FirstBoot", func(t *testing.T) {
+		store := setup(t)
+
+		boot, err := store.AddChargepoint(ctx, "charger-1", request)
+		assert.NoError(t, err)
+		assert.Equal(t, "charger-1", boot.Serialnumber)
+		assert.Equal(t, "5540", boot.FirmwareVersion)
+		assert.Empty(t, boot.PreviousFirmwareVersion)
+		assert.False(t, boot.FirmwareChanged())
+
+		chargepoint, err := store.GetChargepoint(ctx, "charger-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "Zappi", chargepoint.Model)
+		assert.Equal(t, "Myenergi", chargepoint.Vendor)
+		assert.Equal(t, "iccid-1", chargepoint.Iccid)
+		assert.Equal(t, "charger-1", chargepoint.ChargeBoxSerialNumber)
+		assert.Equal(t, "ZAPPI-0001", chargepoint.ChargePointSerialNumber)
+		assert.WithinDuration(t, boot.BootedAt, chargepoint.LastBoot, time.Millisecond)
+		assert.Nil(t, chargepoint.LastHeartbeat)
+	})
+
+	t.Run("Reboot_Refreshes", func(t *testing.T) {
+		store := setup(t)
+
+		_, err := store.AddChargepoint(ctx, "charger-1", request)
+		assert.NoError(t, err)
+
+		rebooted := request
+		rebooted.FirmwareVersion = "5541"
+		rebooted.Iccid = ""
+		rebooted.MeterType = "meter-type"
+		boot, err := store.AddChargepoint(ctx, "charger-1", rebooted)
+		assert.NoError(t, err, "expected no error when the chargepoint boots again")
+		assert.Equal(t, "5540", boot.PreviousFirmwareVersion)
+		assert.True(t, boot.FirmwareChanged())
+
+		chargepoint, err := store.GetChargepoint(ctx, "charger-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "5541", chargepoint.FirmwareVersion)
+		assert.Empty(t, chargepoint.Iccid)
+		assert.Equal(t, "meter-type", chargepoint.MeterType)
+	})
+
+	t.Run("Identity_WithoutChargeBoxSerialNumber", func(t *testing.T) {
+		store := setup(t)
+
+		boot, err := store.AddChargepoint(ctx, "charger-2", core.BootNotificationRequest{
+			ChargePointModel:  "Zappi",
+			ChargePointVendor: "Myenergi",
+			FirmwareVersion:   "5540",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "charger-2", boot.Serialnumber)
+
+		chargepoint, err := store.GetChargepoint(ctx, "charger-2")
+		assert.NoError(t, err)
+		assert.Empty(t, chargepoint.ChargeBoxSerialNumber)
+
+		findings, err := store.ListDataQualityFindings(ctx, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, findings)
+	})
+
+	t.Run("DataQualityFindings", func(t *testing.T) {
+		store := setup(t)
+
+		for range 2 {
+			_, err := store.AddChargepoint(ctx, "charger-1", request)
+			assert.NoError(t, err)
+		}
+		mismatch := request
+		mismatch.ChargeBoxSerialNumber = "CB-0001"
+		mismatch.ChargePointSerialNumber = ""
+		_, err := store.AddChargepoint(ctx, "charger-1", mismatch)
+		assert.NoError(t, err)
+
+		findings, err := store.ListDataQualityFindings(ctx, 10)
+		assert.NoError(t, err)
+		assert.Len(t, findings, 2, "expected one finding per distinct mismatch")
+
+		assert.Equal(t, "chargeBoxSerialNumber", findings[0].Field, "expected most recently seen first")
+		assert.Equal(t, "CB-0001", findings[0].Value)
+		assert.Equal(t, 1, findings[0].Occurrences)
+
+		assert.Equal(t, "charger-1", findings[1].Serialnumber)
+		assert.Equal(t, FindingSerialNumberMismatch, findings[1].Kind)
+		assert.Equal(t, "chargePointSerialNumber", findings[1].Field)
+		assert.Equal(t, "ZAPPI-0001", findings[1].Value)
+		assert.Equal(t, 2, findings[1].Occurrences)
+		assert.False(t, findings[1].LastSeenAt.Before(findings[1].FirstSeenAt))
+
+		findings, err = store.ListDataQualityFindings(ctx, 1)
+		assert.NoError(t, err)
+		assert.Len(t, findings, 1)
+	})
+}
+
+func testStoreHeartbeats(t *testing.T, setup storeSetup) {
+	ctx := context.Background()
+	heartbeat := core.HeartbeatConfirmation{CurrentTime: types.NewDateTime(time.Date(2025, 7, 22, 11, 25, 25, 0, time.UTC))}
+
+	t.Run("Unknown", func(t *testing.T) {
+		store := setup(t)
+
+		assert.ErrorIs(t, store.UpdateLastHeartbeat(ctx, "charger-1", heartbeat), ErrChargepointNotFound)
+	})
+
+	t.Run("KeptAcrossBoots", func(t *testing.T) {
+		store := setup(t)
+
+		_, err := store.AddChargepoint(ctx, "charger-1", core.BootNotificationRequest{ChargePointModel: "Zappi", ChargePointVendor: "Myenergi"})
+		assert.NoError(t, err)
+		assert.NoError(t, store.UpdateLastHeartbeat(ctx, "charger-1", heartbeat))
+
+		chargepoint, err := store.GetChargepoint(ctx, "charger-1")
+		assert.NoError(t, err)
+		if assert.NotNil(t, chargepoint.LastHeartbeat) {
+			assert.True(t, heartbeat.CurrentTime.Equal(*chargepoint.LastHeartbeat))
+		}
+
+		_, err = store.AddChargepoint(ctx, "charger-1", core.BootNotificationRequest{ChargePointModel: "Zappi", ChargePointVendor: "Myenergi"})
+		assert.NoError(t, err)
+		chargepoint, err = store.GetChargepoint(ctx, "charger-1")
+		assert.NoError(t, err)
+		assert.NotNil(t, chargepoint.LastHeartbeat)
+	})
+}
+
+func testStoreTransactions(t *testing.T, setup storeSetup) {
+	ctx := context.Background()
+	startedAt := time.Date(2024, 4, 2, 11, 44, 38, 0, time.UTC)
+	start := core.StartTransactionRequest{
+		ConnectorId: 1,
+		IdTag:       "TAG-1",
+		MeterStart:  1000,
+		Timestamp:   types.NewDateTime(startedAt),
+	}
+
+	t.Run("StartAndStop", func(t *testing.T) {
+		store := setup(t)
+
+		id, err := store.StartTransaction(ctx, "charger-1", start)
+		assert.NoError(t, err)
+		assert.Positive(t, id)
+
+		transaction, err := store.GetTransaction(ctx, "charger-1", id)
+		assert.NoError(t, err)
+		assert.Equal(t, id, transaction.Id)
+		assert.Equal(t, "charger-1", transaction.Serialnumber)
+		assert.Equal(t, 1, transaction.ConnectorId)
+		assert.Equal(t, "TAG-1", transaction.IdTag)
+		assert.Equal(t, 1000, transaction.MeterStart)
+		assert.True(t, startedAt.Equal(transaction.StartedAt))
+		assert.Nil(t, transaction.MeterStop)
+		assert.Nil(t, transaction.StoppedAt)
+
+		stoppedAt := startedAt.Add(time.Hour)
+		assert.NoError(t, store.StopTransaction(ctx, "charger-1", core.StopTransactionRequest{
+			TransactionId: id,
+			MeterStop:     2500,
+			Timestamp:     types.NewDateTime(stoppedAt),
+			Reason:        core.ReasonEVDisconnected,
+		}))
+
+		transaction, err = store.GetTransaction(ctx, "charger-1", id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, transaction.MeterStop) && assert.NotNil(t, transaction.StoppedAt) {
+			assert.Equal(t, 2500, *transaction.MeterStop)
+			assert.True(t, stoppedAt.Equal(*transaction.StoppedAt))
+		}
+		assert.Equal(t, core.ReasonEVDisconnected, transaction.StopReason)
+	})
+
+	t.Run("UniqueIds", func(t *testing.T) {
+		store := setup(t)
+
+		first, err := store.StartTransaction(ctx, "charger-1", start)
+		assert.NoError(t, err)
+		second, err := store.StartTransaction(ctx, "charger-2", start)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("ScopedBySerialnumber", func(t *testing.T) {
+		store := setup(t)
+
+		id, err := store.StartTransaction(ctx, "charger-1", start)
+		assert.NoError(t, err)
+
+		_, err = store.GetTransaction(ctx, "charger-2", id)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+		err = store.StopTransaction(ctx, "charger-2", core.StopTransactionRequest{TransactionId: id, MeterStop: 2500, Timestamp: types.Now()})
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+	})
+
+	t.Run("ListTransactions", func(t *testing.T) {
+		store := setup(t)
+		var ids []int
+		for i, serialnumber := range []string{"charger-1", "charger-2", "charger-1"} {
+			started := start
+			started.Timestamp = types.NewDateTime(startedAt.Add(time.Duration(i) * time.Hour))
+			id, err := store.StartTransaction(ctx, serialnumber, started)
+			assert.NoError(t, err)
+			ids = append(ids, id)
+		}
+		// Updated when the first stopped, when the second started, and at the latest reading of the third
+		assert.NoError(t, store.StopTransaction(ctx, "charger-1", core.StopTransactionRequest{
+			TransactionId: ids[0],
+			MeterStop:     2500,
+			Timestamp:     types.NewDateTime(startedAt.Add(3 * time.Hour)),
+		}))
+		assert.NoError(t, store.AddMeterSamples(ctx, []MeterSample{
+			{Serialnumber: "charger-1", TransactionId: ids[2], ConnectorId: 1, RegisterWh: 1500, SampledAt: startedAt.Add(4 * time.Hour)},
+			{Serialnumber: "charger-1", TransactionId: ids[2], ConnectorId: 1, RegisterWh: 1200, SampledAt: startedAt.Add(2*time.Hour + time.Minute)},
+		}))
+		listed := func(filter TransactionFilter) []int {
+			transactions, err := store.ListTransactions(ctx, filter)
+			assert.NoError(t, err)
+			var listed []int
+			for _, transaction := range transactions {
+				listed = append(listed, transaction.Id)
+			}
+			return listed
+		}
+
+		assert.Equal(t, ids, listed(TransactionFilter{Limit: 10}))
+		assert.Equal(t, []int{ids[0], ids[2]}, listed(TransactionFilter{Serialnumbers: []string{"charger-1", "charger-3"}, Limit: 10}))
+		assert.Empty(t, listed(TransactionFilter{Serialnumbers: []string{}, Limit: 10}))
+		assert.Equal(t, []int{ids[1]}, listed(TransactionFilter{Offset: 1, Limit: 1}))
+
+		// UpdatedFrom is inclusive and UpdatedTo exclusive, whatever their time zone
+		zone := time.FixedZone("CEST", 2*60*60)
+		filter := TransactionFilter{UpdatedFrom: startedAt.Add(time.Hour).In(zone), UpdatedTo: startedAt.Add(4 * time.Hour).In(zone), Limit: 10}
+		assert.Equal(t, []int{ids[0], ids[1]}, listed(filter))
+
+		count, err := store.CountTransactions(ctx, filter)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+		count, err = store.CountTransactions(ctx, TransactionFilter{Serialnumbers: []string{"charger-1"}, Limit: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("StoppedTwice", func(t *testing.T) {
+		store := setup(t)
+		id, err := store.StartTransaction(ctx, "charger-1", start)
+		assert.NoError(t, err)
+		assert.NoError(t, store.StopTransaction(ctx, "charger-1", core.StopTransactionRequest{
+			TransactionId: id,
+			MeterStop:     2500,
+			Timestamp:     types.NewDateTime(startedAt.Add(time.Hour)),
+			Reason:        core.ReasonEVDisconnected,
+		}))
+
+		err = store.StopTransaction(ctx, "charger-1", core.StopTransactionRequest{
+			TransactionId: id,
+			MeterStop:     2600,
+			Timestamp:     types.NewDateTime(startedAt.Add(2 * time.Hour)),
+			Reason:        core.ReasonLocal,
+		})
+		assert.ErrorIs(t, err, ErrTransactionStopped)
+
+		transaction, err := store.GetTransaction(ctx, "charger-1", id)
+		assert.NoError(t, err)
+		assert.Equal(t, 2500, *transaction.MeterStop)
+		assert.True(t, transaction.StoppedAt.Equal(startedAt.Add(time.Hour)))
+		assert.Equal(t, core.ReasonEVDisconnected, transaction.StopReason)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		store := setup(t)
+
+		_, err := store.GetTransaction(ctx, "charger-1", 99)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+		err = store.StopTransaction(ctx, "charger-1", core.StopTransactionRequest{TransactionId: 99, MeterStop: 2500, Timestamp: types.Now()})
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+	})
+}
+
+func testStoreConcurrency(t *testing.T, setup storeSetup) {
+	ctx := context.Background()
+	store := setup(t)
+
+	const workers = 10
+	ids := make(chan int, workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := store.StartTransaction(ctx, "charger-1", core.StartTransactionRequest{
+				ConnectorId: 1,
+				IdTag:       "TAG-1",
+				Timestamp:   types.Now(),
+			})
+			assert.NoError(t, err)
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		assert.False(t, seen[id], "expected transaction id %d to be handed out once", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, workers)
+}
+
+func testStoreJournal(t *testing.T, setup storeSetup) {
+	ctx := context.Background()
+	recordedAt := time.Date(2025, 7, 22, 11, 0, 0, 0, time.UTC)
+	entries := []JournalEntry{
+		{
+			Direction:    JournalInbound,
+			Serialnumber: "charger-1",
+			MessageId:    "msg-1",
+			Action:       "Heartbeat",
+			TypeId:       2,
+			Body:         []byte(`[2,"msg-1","Heartbeat",{}]`),
+			TraceId:      "4bf92f3577b34da6a3ce929d0e0e4736",
+			Outcome:      JournalOutcomeProcessed,
+			Latency:      1500 * time.Microsecond,
+			RecordedAt:   recordedAt.Add(2 * time.Minute),
+		},
+		{
+			Direction:    JournalInbound,
+			Serialnumber: "charger-1",
+			MessageId:    "msg-2",
+			Action:       "BootNotification",
+			TypeId:       2,
+			Body:         []byte(`[2,"msg-2","BootNotification",{}]`),
+			Outcome:      JournalOutcomeFailed,
+			Error:        "invalid payload",
+			RecordedAt:   recordedAt,
+		},
+		{
+			Direction:    JournalOutbound,
+			Serialnumber: "charger-2",
+			MessageId:    "msg-3",
+			Action:       "Heartbeat",
+			TypeId:       3,
+			Body:         []byte(`[3,"msg-3",{}]`),
+			Outcome:      JournalOutcomeQueued,
+			RecordedAt:   recordedAt.Add(time.Minute),
+		},
+		{
+			Direction:    JournalInbound,
+			Serialnumber: "charger-2",
+			Body:         []byte(`not a frame`),
+			Outcome:      JournalOutcomeFailed,
+			RecordedAt:   recordedAt.Add(3 * time.Minute),
+		},
+	}
+
+	t.Run("OldestFirst", func(t *testing.T) {
+		store := setup(t)
+		assert.NoError(t, store.AppendJournal(ctx, entries))
+
+		journal, err := store.ListJournal(ctx, JournalFilter{Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, journal, 4) {
+			assert.Equal(t, []string{"msg-2", "msg-3", "msg-1", ""},
+				[]string{journal[0].MessageId, journal[1].MessageId, journal[2].MessageId, journal[3].MessageId})
+			assert.NotZero(t, journal[0].Id)
+			assert.Equal(t, "invalid payload", journal[0].Error)
+
+			entry := journal[2]
+			assert.Equal(t, JournalInbound, entry.Direction)
+			assert.Equal(t, "charger-1", entry.Serialnumber)
+			assert.Equal(t, "Heartbeat", entry.Action)
+			assert.Equal(t, 2, entry.TypeId)
+			assert.Equal(t, []byte(`[2,"msg-1","Heartbeat",{}]`), entry.Body)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry.TraceId)
+			assert.Equal(t, JournalOutcomeProcessed, entry.Outcome)
+			assert.Equal(t, 1500*time.Microsecond, entry.Latency)
+			assert.True(t, entry.RecordedAt.Equal(recordedAt.Add(2*time.Minute)))
+
+			assert.Zero(t, journal[3].TypeId)
+			assert.Empty(t, journal[3].Action)
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		store := setup(t)
+		assert.NoError(t, store.AppendJournal(ctx, entries))
+
+		journal, err := store.ListJournal(ctx, JournalFilter{Serialnumber: "charger-1", Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, journal, 2)
+
+		journal, err = store.ListJournal(ctx, JournalFilter{Action: "Heartbeat", Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, journal, 2)
+
+		journal, err = store.ListJournal(ctx, JournalFilter{Serialnumber: "charger-2", Action: "Heartbeat", Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, journal, 1) {
+			assert.Equal(t, "msg-3", journal[0].MessageId)
+		}
+
+		// From is inclusive and To exclusive, whatever their time zone
+		zone := time.FixedZone("CEST", 2*60*60)
+		journal, err = store.ListJournal(ctx, JournalFilter{
+			From:  recordedAt.Add(time.Minute).In(zone),
+			To:    recordedAt.Add(3 * time.Minute).In(zone),
+			Limit: 10,
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, journal, 2) {
+			assert.Equal(t, "msg-3", journal[0].MessageId)
+			assert.Equal(t, "msg-1", journal[1].MessageId)
+		}
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		store := setup(t)
+		assert.NoError(t, store.AppendJournal(ctx, entries))
+
+		journal, err := store.ListJournal(ctx, JournalFilter{Limit: 2})
+		assert.NoError(t, err)
+		if assert.Len(t, journal, 2) {
+			assert.Equal(t, "msg-2", journal[0].MessageId)
+		}
+	})
+}
+
+func testStoreCdrs(t *testing.T, setup storeSetup) {
+	ctx := context.Background()
+	startedAt := time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC)
+	sampled := 4900
+	cdr := ChargeDetailRecord{
+		Serialnumber:    "charger-1",
+		TransactionId:   1,
+		ConnectorId:     1,
+		IdTag:           "B4A63CDF",
+		StartedAt:       startedAt,
+		StoppedAt:       startedAt.Add(time.Hour),
+		Duration:        time.Hour,
+		MeterStart:      1000,
+		MeterStop:       6000,
+		EnergyWh:        5000,
+		SampledEnergyWh: &sampled,
+		EnergyCheck:     EnergyCheckVerified,
+		StopReason:      core.ReasonEVDisconnected,
+		ChargingTime:    45 * time.Minute,
+		IdleTime:        15 * time.Minute,
+		CreatedAt:       startedAt.Add(time.Hour + time.Second),
+	}
+
+	t.Run("MeterSamples", func(t *testing.T) {
+		store := setup(t)
+		assert.NoError(t, store.AddMeterSamples(ctx, []MeterSample{
+			{Serialnumber: "charger-1", TransactionId: 1, ConnectorId: 1, RegisterWh: 3000, SampledAt: startedAt.Add(30 * time.Minute)},
+			{Serialnumber: "charger-1", TransactionId: 1, ConnectorId: 1, Context: types.ReadingContextTransactionBegin, RegisterWh: 1000, SampledAt: startedAt},
+			{Serialnumber: "charger-1", TransactionId: 2, ConnectorId: 1, RegisterWh: 9000, SampledAt: startedAt},
+			{Serialnumber: "charger-2", TransactionId: 1, ConnectorId: 1, RegisterWh: 9000, SampledAt: startedAt},
+		}))
+
+		samples, err := store.ListMeterSamples(ctx, "charger-1", 1)
+		assert.NoError(t, err)
+		if assert.Len(t, samples, 2) {
+			assert.Equal(t, 1000, samples[0].RegisterWh)
+			assert.Equal(t, types.ReadingContextTransactionBegin, samples[0].Context)
+			assert.True(t, samples[0].SampledAt.Equal(startedAt))
+			assert.Equal(t, 3000, samples[1].RegisterWh)
+			assert.Empty(t, samples[1].Context)
+		}
+
+		samples, err = store.ListMeterSamples(ctx, "charger-1", 3)
+		assert.NoError(t, err)
+		assert.Empty(t, samples)
+	})
+
+	t.Run("ConnectorStatuses", func(t *testing.T) {
+		store := setup(t)
+		for _, status := range []ConnectorStatus{
+			{Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusAvailable, ReportedAt: startedAt.Add(-2 * time.Hour)},
+			{Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusPreparing, ReportedAt: startedAt.Add(-time.Minute)},
+			{Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusCharging, ReportedAt: startedAt.Add(time.Minute)},
+			{Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusSuspendedEV, ErrorCode: core.NoError, Info: "full", ReportedAt: startedAt.Add(45 * time.Minute)},
+			{Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusFinishing, ReportedAt: startedAt.Add(time.Hour)},
+			{Serialnumber: "charger-1", ConnectorId: 2, Status: core.ChargePointStatusCharging, ReportedAt: startedAt},
+		} {
+			assert.NoError(t, store.AddConnectorStatus(ctx, status))
+		}
+
+		// The window starts at the last status reported before it, and stops before its end
+		statuses, err := store.ListConnectorStatuses(ctx, "charger-1", 1, startedAt, startedAt.Add(time.Hour))
+		assert.NoError(t, err)
+		if assert.Len(t, statuses, 3) {
+			assert.Equal(t, []core.ChargePointStatus{core.ChargePointStatusPreparing, core.ChargePointStatusCharging, core.ChargePointStatusSuspendedEV},
+				[]core.ChargePointStatus{statuses[0].Status, statuses[1].Status, statuses[2].Status})
+			assert.Equal(t, core.NoError, statuses[2].ErrorCode)
+			assert.Equal(t, "full", statuses[2].Info)
+			assert.True(t, statuses[2].ReportedAt.Equal(startedAt.Add(45*time.Minute)))
+		}
+
+		statuses, err = store.ListConnectorStatuses(ctx, "charger-1", 3, startedAt, startedAt.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Empty(t, statuses)
+	})
+
+	t.Run("LatestConnectorStatuses", func(t *testing.T) {
+		store := setup(t)
+		for _, status := range []ConnectorStatus{
+			{Serialnumber: "charger-1", ConnectorId: 2, Status: core.ChargePointStatusCharging, ReportedAt: startedAt},
+			{Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusFaulted, ReportedAt: startedAt.Add(time.Hour)},
+			{Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusAvailable, ReportedAt: startedAt},
+			{Serialnumber: "charger-1", ConnectorId: 2, Status: core.ChargePointStatusFinishing, ReportedAt: startedAt},
+			{Serialnumber: "charger-2", ConnectorId: 1, Status: core.ChargePointStatusCharging, ReportedAt: startedAt.Add(2 * time.Hour)},
+		} {
+			assert.NoError(t, store.AddConnectorStatus(ctx, status))
+		}
+
+		// Of statuses reported at the same time, the one added last is the latest
+		statuses, err := store.ListLatestConnectorStatuses(ctx, "charger-1")
+		assert.NoError(t, err)
+		if assert.Len(t, statuses, 2) {
+			assert.Equal(t, 1, statuses[0].ConnectorId)
+			assert.Equal(t, core.ChargePointStatusFaulted, statuses[0].Status)
+			assert.True(t, statuses[0].ReportedAt.Equal(startedAt.Add(time.Hour)))
+			assert.Equal(t, 2, statuses[1].ConnectorId)
+			assert.Equal(t, core.ChargePointStatusFinishing, statuses[1].Status)
+		}
+
+		statuses, err = store.ListLatestConnectorStatuses(ctx, "charger-3")
+		assert.NoError(t, err)
+		assert.Empty(t, statuses)
+	})
+
+	t.Run("Cdr", func(t *testing.T) {
+		store := setup(t)
+		id, err := store.AddCdr(ctx, cdr)
+		assert.NoError(t, err)
+		assert.NotZero(t, id)
+
+		stored, err := store.GetCdr(ctx, "charger-1", 1)
+		assert.NoError(t, err)
+		expected := cdr
+		expected.Id = id
+		assert.True(t, stored.StartedAt.Equal(expected.StartedAt))
+		assert.True(t, stored.StoppedAt.Equal(expected.StoppedAt))
+		assert.True(t, stored.CreatedAt.Equal(expected.CreatedAt))
+		stored.StartedAt, stored.StoppedAt, stored.CreatedAt = expected.StartedAt, expected.StoppedAt, expected.CreatedAt
+		assert.Equal(t, expected, stored)
+
+		// A CDR is written once
+		changed := cdr
+		changed.MeterStop = 9000
+		_, err = store.AddCdr(ctx, changed)
+		assert.ErrorIs(t, err, ErrCdrExists)
+		stored, err = store.GetCdr(ctx, "charger-1", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 6000, stored.MeterStop)
+
+		_, err = store.GetCdr(ctx, "charger-1", 2)
+		assert.ErrorIs(t, err, ErrCdrNotFound)
+	})
+
+	t.Run("Cost", func(t *testing.T) {
+		store := setup(t)
+		priced := cdr
+		priced.Cost = &CostBreakdown{
+			TariffId: "standard",
+			Currency: "GBP",
+			StartFee: decimal.RequireFromString("0.50"),
+			Energy:   decimal.RequireFromString("2.25"),
+			Time:     decimal.Zero,
+			Idle:     decimal.RequireFromString("1.05"),
+			Total:    decimal.RequireFromString("3.80"),
+		}
+		_, err := store.AddCdr(ctx, priced)
+		assert.NoError(t, err)
+
+		stored, err := store.GetCdr(ctx, "charger-1", 1)
+		assert.NoError(t, err)
+		if assert.NotNil(t, stored.Cost) {
+			assert.Equal(t, "standard", stored.Cost.TariffId)
+			assert.Equal(t, "GBP", stored.Cost.Currency)
+			for _, amount := range []struct{ expected, actual decimal.Decimal }{
+				{priced.Cost.StartFee, stored.Cost.StartFee},
+				{priced.Cost.Energy, stored.Cost.Energy},
+				{priced.Cost.Time, stored.Cost.Time},
+				{priced.Cost.Idle, stored.Cost.Idle},
+				{priced.Cost.Total, stored.Cost.Total},
+			} {
+				assert.True(t, amount.expected.Equal(amount.actual), "%s is not %s", amount.actual, amount.expected)
+			}
+		}
+
+		cdrs, err := store.ListCdrs(ctx, CdrFilter{Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, cdrs, 1) && assert.NotNil(t, cdrs[0].Cost) {
+			assert.True(t, cdrs[0].Cost.Total.Equal(priced.Cost.Total))
+		}
+	})
+
+	t.Run("Unverified", func(t *testing.T) {
+		store := setup(t)
+		unverified := cdr
+		unverified.SampledEnergyWh = nil
+		unverified.EnergyCheck = EnergyCheckUnverified
+		_, err := store.AddCdr(ctx, unverified)
+		assert.NoError(t, err)
+
+		stored, err := store.GetCdr(ctx, "charger-1", 1)
+		assert.NoError(t, err)
+		assert.Nil(t, stored.SampledEnergyWh)
+		assert.Nil(t, stored.Cost)
+		assert.Equal(t, EnergyCheckUnverified, stored.EnergyCheck)
+	})
+
+	t.Run("ListCdrs", func(t *testing.T) {
+		store := setup(t)
+		for i, serialnumber := range []string{"charger-1", "charger-2", "charger-1"} {
+			record := cdr
+			record.Serialnumber = serialnumber
+			record.TransactionId = i + 1
+			record.StoppedAt = cdr.StoppedAt.Add(time.Duration(2-i) * time.Hour)
+			_, err := store.AddCdr(ctx, record)
+			assert.NoError(t, err)
+		}
+
+		cdrs, err := store.ListCdrs(ctx, CdrFilter{Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, cdrs, 3) {
+			assert.Equal(t, []int{3, 2, 1}, []int{cdrs[0].TransactionId, cdrs[1].TransactionId, cdrs[2].TransactionId})
+		}
+
+		cdrs, err = store.ListCdrs(ctx, CdrFilter{Serialnumber: "charger-1", Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, cdrs, 2)
+
+		// From is inclusive and To exclusive, whatever their time zone
+		zone := time.FixedZone("CEST", 2*60*60)
+		cdrs, err = store.ListCdrs(ctx, CdrFilter{
+			From:  cdr.StoppedAt.Add(time.Hour).In(zone),
+			To:    cdr.StoppedAt.Add(2 * time.Hour).In(zone),
+			Limit: 10,
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, cdrs, 1) {
+			assert.Equal(t, 2, cdrs[0].TransactionId)
+		}
+
+		cdrs, err = store.ListCdrs(ctx, CdrFilter{Limit: 2})
+		assert.NoError(t, err)
+		assert.Len(t, cdrs, 2)
+
+		cdrs, err = store.ListCdrs(ctx, CdrFilter{Offset: 1, Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, cdrs, 2) {
+			assert.Equal(t, 2, cdrs[0].TransactionId)
+		}
+
+		cdrs, err = store.ListCdrs(ctx, CdrFilter{Serialnumbers: []string{"charger-2", "charger-3"}, Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, cdrs, 1) {
+			assert.Equal(t, 2, cdrs[0].TransactionId)
+		}
+		cdrs, err = store.ListCdrs(ctx, CdrFilter{Serialnumbers: []string{}, Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, cdrs)
+
+		count, err := store.CountCdrs(ctx, CdrFilter{Serialnumber: "charger-1", Limit: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("CreatedAt", func(t *testing.T) {
+		store := setup(t)
+		for i := range 3 {
+			record := cdr
+			record.TransactionId = i + 1
+			record.CreatedAt = cdr.CreatedAt.Add(time.Duration(i) * time.Hour)
+			_, err := store.AddCdr(ctx, record)
+			assert.NoError(t, err)
+		}
+
+		filter := CdrFilter{CreatedFrom: cdr.CreatedAt.Add(time.Hour), CreatedTo: cdr.CreatedAt.Add(2 * time.Hour), Limit: 10}
+		cdrs, err := store.ListCdrs(ctx, filter)
+		assert.NoError(t, err)
+		if assert.Len(t, cdrs, 1) {
+			assert.Equal(t, 2, cdrs[0].TransactionId)
+		}
+		count, err := store.CountCdrs(ctx, filter)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func testStoreTenants(t *testing.T, setup storeSetup) {
+	operatorA := WithTenant(context.Background(), "operator-a")
+	operatorB := WithTenant(context.Background(), "operator-b")
+	startedAt := time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC)
+	boot := core.BootNotificationRequest{
+		ChargeBoxSerialNumber: "ZAPPI-0001",
+		ChargePointModel:      "Zappi",
+		ChargePointVendor:     "Myenergi",
+		FirmwareVersion:       "5540",
+	}
+
+	t.Run("Chargepoints", func(t *testing.T) {
+		store := setup(t)
+
+		_, err := store.AddChargepoint(operatorA, "charger-1", boot)
+		assert.NoError(t, err)
+		_, err = store.GetChargepoint(operatorB, "charger-1")
+		assert.ErrorIs(t, err, ErrChargepointNotFound)
+		assert.ErrorIs(t, store.UpdateLastHeartbeat(operatorB, "charger-1", core.HeartbeatConfirmation{CurrentTime: types.Now()}), ErrChargepointNotFound)
+
+		// The same serial number is another charge point in another tenant
+		other := boot
+		other.FirmwareVersion = "6000"
+		booted, err := store.AddChargepoint(operatorB, "charger-1", other)
+		assert.NoError(t, err)
+		assert.Empty(t, booted.PreviousFirmwareVersion)
+
+		chargepoint, err := store.GetChargepoint(operatorA, "charger-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "operator-a", chargepoint.Tenant)
+		assert.Equal(t, "5540", chargepoint.FirmwareVersion)
+
+		findings, err := store.ListDataQualityFindings(operatorA, 10)
+		assert.NoError(t, err)
+		assert.Len(t, findings, 1)
+		findings, err = store.ListDataQualityFindings(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, findings)
+	})
+
+	t.Run("Transactions", func(t *testing.T) {
+		store := setup(t)
+
+		id, err := store.StartTransaction(operatorA, "charger-1", core.StartTransactionRequest{
+			ConnectorId: 1,
+			IdTag:       "TAG-1",
+			MeterStart:  1000,
+			Timestamp:   types.NewDateTime(startedAt),
+		})
+		assert.NoError(t, err)
+
+		_, err = store.GetTransaction(operatorB, "charger-1", id)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+		err = store.StopTransaction(operatorB, "charger-1", core.StopTransactionRequest{TransactionId: id, MeterStop: 2500, Timestamp: types.Now()})
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+
+		transaction, err := store.GetTransaction(operatorA, "charger-1", id)
+		assert.NoError(t, err)
+		assert.Equal(t, "operator-a", transaction.Tenant)
+
+		count, err := store.CountTransactions(operatorA, TransactionFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+		transactions, err := store.ListTransactions(operatorB, TransactionFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, transactions)
+	})
+
+	t.Run("Cdrs", func(t *testing.T) {
+		store := setup(t)
+
+		assert.NoError(t, store.AddMeterSamples(operatorA, []MeterSample{
+			{Serialnumber: "charger-1", TransactionId: 1, ConnectorId: 1, RegisterWh: 3000, SampledAt: startedAt},
+		}))
+		assert.NoError(t, store.AddConnectorStatus(operatorA, ConnectorStatus{
+			Serialnumber: "charger-1", ConnectorId: 1, Status: core.ChargePointStatusCharging, ReportedAt: startedAt,
+		}))
+		_, err := store.AddCdr(operatorA, ChargeDetailRecord{
+			Serialnumber:  "charger-1",
+			TransactionId: 1,
+			ConnectorId:   1,
+			StartedAt:     startedAt,
+			StoppedAt:     startedAt.Add(time.Hour),
+			EnergyCheck:   EnergyCheckUnverified,
+			StopReason:    core.ReasonLocal,
+			CreatedAt:     startedAt.Add(time.Hour),
+		})
+		assert.NoError(t, err)
+
+		samples, err := store.ListMeterSamples(operatorB, "charger-1", 1)
+		assert.NoError(t, err)
+		assert.Empty(t, samples)
+		statuses, err := store.ListLatestConnectorStatuses(operatorB, "charger-1")
+		assert.NoError(t, err)
+		assert.Empty(t, statuses)
+		statuses, err = store.ListConnectorStatuses(operatorB, "charger-1", 1, startedAt, startedAt.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Empty(t, statuses)
+		_, err = store.GetCdr(operatorB, "charger-1", 1)
+		assert.ErrorIs(t, err, ErrCdrNotFound)
+		count, err := store.CountCdrs(operatorB, CdrFilter{})
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+
+		cdrs, err := store.ListCdrs(operatorA, CdrFilter{Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, cdrs, 1) {
+			assert.Equal(t, "operator-a", cdrs[0].Tenant)
+		}
+	})
+
+	t.Run("Journal", func(t *testing.T) {
+		store := setup(t)
+
+		assert.NoError(t, store.AppendJournal(operatorA, []JournalEntry{{
+			Direction:    JournalInbound,
+			Serialnumber: "charger-1",
+			MessageId:    "msg-1",
+			Body:         []byte(`[2,"msg-1","Heartbeat",{}]`),
+			Outcome:      JournalOutcomeProcessed,
+			RecordedAt:   startedAt,
+		}}))
+
+		journal, err := store.ListJournal(operatorB, JournalFilter{Serialnumber: "charger-1", Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, journal)
+		journal, err = store.ListJournal(context.Background(), JournalFilter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, journal)
+
+		journal, err = store.ListJournal(operatorA, JournalFilter{Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, journal, 1) {
+			assert.Equal(t, "operator-a", journal[0].Tenant)
+		}
+	})
+}
+
+// Represents what a store keeping quarantined messages, webhook deliveries and the outbox implements.
+type durableStore interface {
+	QuarantineAdapter
+	WebhookLogAdapter
+	OutboxAdapter
+}
+
+// Runs the tenant tests of quarantined messages, webhook deliveries, processed messages and the outbox.
+func testDurableStoreTenants(t *testing.T, setup func(t *testing.T) durableStore) {
+	operatorA := WithTenant(context.Background(), "operator-a")
+	operatorB := WithTenant(context.Background(), "operator-b")
+
+	t.Run("ProcessedMessages", func(t *testing.T) {
+		store := setup(t)
+
+		assert.NoError(t, store.MarkProcessed(operatorA, "message-1"))
+		// The same message id is another message in another tenant
+		assert.NoError(t, store.MarkProcessed(operatorB, "message-1"))
+		assert.ErrorIs(t, store.MarkProcessed(operatorA, "message-1"), ErrAlreadyProcessed)
+	})
+
+	t.Run("Quarantine", func(t *testing.T) {
+		store := setup(t)
+
+		id, err := store.Quarantine(operatorA, QuarantinedMessage{
+			MessageId:    "message-1",
+			Serialnumber: "charger-1",
+			Topic:        "socket-events",
+			Body:         []byte(`{}`),
+			Error:        "invalid payload",
+			ErrorClass:   "permanent",
+			Attempts:     1,
+		})
+		assert.NoError(t, err)
+
+		_, err = store.GetQuarantined(operatorB, id)
+		assert.Error(t, err)
+		assert.Error(t, store.MarkRedriven(operatorB, id))
+		messages, err := store.ListQuarantined(operatorB, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, messages)
+
+		msg, err := store.GetQuarantined(operatorA, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "operator-a", msg.Tenant)
+		assert.Nil(t, msg.RedrivenAt)
+		assert.NoError(t, store.MarkRedriven(operatorA, id))
+	})
+
+	t.Run("WebhookDeliveries", func(t *testing.T) {
+		store := setup(t)
+
+		_, err := store.RecordWebhookDelivery(operatorA, WebhookDelivery{
+			EventId:    "event-1",
+			EventType:  "transaction.started",
+			URL:        "http://localhost/webhook",
+			StatusCode: 200,
+			Attempts:   1,
+		})
+		assert.NoError(t, err)
+
+		deliveries, err := store.ListWebhookDeliveries(operatorB, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, deliveries)
+
+		deliveries, err = store.ListWebhookDeliveries(operatorA, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, deliveries, 1) {
+			assert.Equal(t, "operator-a", deliveries[0].Tenant)
+		}
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		store := setup(t)
+
+		id, err := store.AddOutbox(operatorA, OutboxMessage{Kind: OutboxKindReply, Destination: "socket-commands", Payload: []byte(`{}`)})
+		assert.NoError(t, err)
+
+		unsent, err := store.ListUnsentOutbox(operatorB, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, unsent)
+
+		// The relay claims the messages of every tenant
+		claimed, err := store.ClaimOutbox(context.Background(), 10, time.Minute)
+		assert.NoError(t, err)
+		if assert.Len(t, claimed, 1) {
+			assert.Equal(t, "operator-a", claimed[0].Tenant)
+		}
+
+		assert.NoError(t, store.ParkOutbox(context.Background(), id, "transport down"))
+		parked, err := store.ListParkedOutbox(operatorB, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, parked)
+		assert.ErrorIs(t, store.UnparkOutbox(operatorB, id), ErrOutboxNotParked)
+
+		parked, err = store.ListParkedOutbox(operatorA, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, parked, 1) {
+			assert.Equal(t, "operator-a", parked[0].Tenant)
+		}
+		assert.NoError(t, store.UnparkOutbox(operatorA, id))
+	})
+}
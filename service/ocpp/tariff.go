@@ -0,0 +1,439 @@
+package ocpp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+)
+
+// Represents a time-of-day band of a tariff, which replaces its energy and time prices from Start until End.
+type TariffBand struct {
+	Start       time.Duration // since midnight, in the time zone of the tariff
+	End         time.Duration // a band that ends before it starts runs past midnight
+	EnergyPrice decimal.Decimal
+	TimePrice   decimal.Decimal
+}
+
+// Checks if the band covers the time of day.
+func (b TariffBand) covers(timeOfDay time.Duration) bool {
+	if b.Start < b.End {
+		return timeOfDay >= b.Start && timeOfDay < b.End
+	}
+	return timeOfDay >= b.Start || timeOfDay < b.End
+}
+
+// Represents how a charging session is priced, in the currency of the tariff. A session pays the start fee, the energy
+// price per kWh, the time price per hour charging, and the idle price per hour idle once the grace period is used up.
+// Bands change the energy and time prices by the time of day.
+type Tariff struct {
+	Id              string
+	Currency        string
+	StartFee        decimal.Decimal
+	EnergyPrice     decimal.Decimal
+	TimePrice       decimal.Decimal
+	IdlePrice       decimal.Decimal
+	IdleGracePeriod time.Duration
+	Location        *time.Location // time zone of the bands; UTC when nil
+	Bands           []TariffBand
+}
+
+// Represents the cost of a session under a tariff. Each component is rounded to two decimals and Total is their sum.
+type CostBreakdown struct {
+	TariffId string          `json:"tariffId"`
+	Currency string          `json:"currency"`
+	StartFee decimal.Decimal `json:"startFee"`
+	Energy   decimal.Decimal `json:"energy"`
+	Time     decimal.Decimal `json:"time"`
+	Idle     decimal.Decimal `json:"idle"`
+	Total    decimal.Decimal `json:"total"`
+}
+
+// Represents the estimated cost of a transaction, as if it stopped at EstimatedAt with its latest register reading.
+type CostEstimate struct {
+	TransactionId int           `json:"transactionId"`
+	EnergyWh      int           `json:"energyWh"`
+	Cost          CostBreakdown `json:"cost"`
+	EstimatedAt   time.Time     `json:"estimatedAt"`
+}
+
+// Represents a stretch of time in which the energy and time prices of a tariff do not change.
+type tariffPeriod struct {
+	from, to    time.Time
+	energyPrice decimal.Decimal
+	timePrice   decimal.Decimal
+}
+
+// Represents energy charged evenly between two register readings.
+type energySegment struct {
+	from, to time.Time
+	wh       decimal.Decimal
+}
+
+var (
+	whPerKWh  = decimal.NewFromInt(1000)
+	nsPerHour = decimal.NewFromInt(int64(time.Hour))
+)
+
+// Returns the cost of the CDR under the tariff. The energy is spread evenly between the register readings of the
+// session, so every band prices the energy charged in it; without readings it is spread over the whole session. The
+// time price applies while the connector was Charging, as in the CDR.
+func (t Tariff) Price(cdr ChargeDetailRecord, samples []MeterSample, statuses []ConnectorStatus) CostBreakdown {
+	energy := decimal.Zero
+	for _, segment := range energySegments(cdr, samples) {
+		length := segment.to.Sub(segment.from)
+		for _, period := range t.periods(segment.from, segment.to) {
+			wh := segment.wh
+			if length > 0 {
+				wh = wh.Mul(decimal.NewFromInt(int64(period.to.Sub(period.from)))).Div(decimal.NewFromInt(int64(length)))
+			}
+			energy = energy.Add(wh.Mul(period.energyPrice).Div(whPerKWh))
+		}
+	}
+
+	charging := decimal.Zero
+	for _, stretch := range chargingPeriods(cdr.StartedAt, cdr.StoppedAt, statuses) {
+		for _, period := range t.periods(stretch[0], stretch[1]) {
+			charging = charging.Add(hours(period.to.Sub(period.from)).Mul(period.timePrice))
+		}
+	}
+
+	idle := hours(max(cdr.IdleTime-t.IdleGracePeriod, 0)).Mul(t.IdlePrice)
+
+	cost := CostBreakdown{
+		TariffId: t.Id,
+		Currency: t.Currency,
+		StartFee: t.StartFee.Round(2),
+		Energy:   energy.Round(2),
+		Time:     charging.Round(2),
+		Idle:     idle.Round(2),
+	}
+	cost.Total = cost.StartFee.Add(cost.Energy).Add(cost.Time).Add(cost.Idle)
+	return cost
+}
+
+// Returns the duration in hours.
+func hours(d time.Duration) decimal.Decimal {
+	return decimal.NewFromInt(int64(d)).Div(nsPerHour)
+}
+
+// Returns the time zone of the bands.
+func (t Tariff) location() *time.Location {
+	if t.Location == nil {
+		return time.UTC
+	}
+	return t.Location
+}
+
+// Returns the energy and time prices at the time.
+func (t Tariff) pricesAt(at time.Time) (energy, charging decimal.Decimal) {
+	local := at.In(t.location())
+	timeOfDay := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+	for _, band := range t.Bands {
+		if band.covers(timeOfDay) {
+			return band.EnergyPrice, band.TimePrice
+		}
+	}
+	return t.EnergyPrice, t.TimePrice
+}
+
+// Splits from-to at the band edges, into periods with the prices that apply in them.
+func (t Tariff) periods(from, to time.Time) []tariffPeriod {
+	cuts := []time.Time{from}
+	if len(t.Bands) > 0 && to.After(from) {
+		loc := t.location()
+		year, month, day := from.In(loc).Date()
+		for midnight := time.Date(year, month, day, 0, 0, 0, 0, loc); midnight.Before(to); midnight = midnight.AddDate(0, 0, 1) {
+			for _, band := range t.Bands {
+				for _, edge := range []time.Duration{band.Start, band.End} {
+					cut := time.Date(midnight.Year(), midnight.Month(), midnight.Day(), int(edge/time.Hour), int(edge%time.Hour/time.Minute), 0, 0, loc)
+					if cut.After(from) && cut.Before(to) {
+						cuts = append(cuts, cut)
+					}
+				}
+			}
+		}
+		slices.SortFunc(cuts, func(a, b time.Time) int { return a.Compare(b) })
+		cuts = slices.CompactFunc(cuts, func(a, b time.Time) bool { return a.Equal(b) })
+	}
+	cuts = append(cuts, to)
+
+	periods := make([]tariffPeriod, 0, len(cuts)-1)
+	for i := range len(cuts) - 1 {
+		energy, charging := t.pricesAt(cuts[i])
+		periods = append(periods, tariffPeriod{from: cuts[i], to: cuts[i+1], energyPrice: energy, timePrice: charging})
+	}
+	return periods
+}
+
+// Returns the energy of the CDR between its register readings, from meter start to meter stop. Readings outside the
+// session are left out, and readings and a meter stop that go down, or readings past meter stop, are clamped, so the
+// segments add up to its energy and none is negative.
+func energySegments(cdr ChargeDetailRecord, samples []MeterSample) []energySegment {
+	samples = slices.Clone(samples)
+	slices.SortStableFunc(samples, func(a, b MeterSample) int {
+		return a.SampledAt.Compare(b.SampledAt)
+	})
+
+	at, wh := cdr.StartedAt, cdr.MeterStart
+	var segments []energySegment
+	add := func(to time.Time, register int) {
+		if register != wh {
+			segments = append(segments, energySegment{from: at, to: to, wh: decimal.NewFromInt(int64(register - wh))})
+		}
+		at, wh = to, register
+	}
+	for _, sample := range samples {
+		if !sample.SampledAt.After(cdr.StartedAt) || !sample.SampledAt.Before(cdr.StoppedAt) {
+			continue
+		}
+		add(sample.SampledAt, min(max(sample.RegisterWh, wh), max(cdr.MeterStop, wh)))
+	}
+	add(cdr.StoppedAt, max(cdr.MeterStop, wh))
+	return segments
+}
+
+// Represents the configured tariffs, and which charge points and idTag groups they are assigned to. A tenant with
+// tariffs of its own is priced with those instead.
+type Tariffs struct {
+	tariffs     map[string]Tariff
+	groups      map[string][]string // groups per idTag, keyed in upper case as idTags are case-insensitive
+	assignments []utils.TariffAssignmentConfiguration
+	tenants     map[string]*Tariffs
+}
+
+// Creates the tariffs of the configuration. Returns an error for a price, time zone or band that cannot be read, or an
+// assignment to an unknown tariff.
+func NewTariffs(config utils.TariffConfiguration) (*Tariffs, error) {
+	tariffs := &Tariffs{
+		tariffs: make(map[string]Tariff, len(config.Tariffs)),
+		groups:  make(map[string][]string),
+	}
+
+	for _, definition := range config.Tariffs {
+		tariff, err := newTariff(definition)
+		if err != nil {
+			return nil, fmt.Errorf("tariff %q: %w", definition.ID, err)
+		}
+		if _, ok := tariffs.tariffs[tariff.Id]; ok {
+			return nil, fmt.Errorf("tariff %q is defined twice", tariff.Id)
+		}
+		tariffs.tariffs[tariff.Id] = tariff
+	}
+
+	for group, idTags := range config.Groups {
+		for _, idTag := range idTags {
+			key := strings.ToUpper(idTag)
+			tariffs.groups[key] = append(tariffs.groups[key], strings.ToLower(group))
+		}
+	}
+
+	for _, assignment := range config.Assignments {
+		if _, ok := tariffs.tariffs[assignment.Tariff]; !ok {
+			return nil, fmt.Errorf("assignment of unknown tariff %q", assignment.Tariff)
+		}
+		groups := make([]string, len(assignment.Groups))
+		for i, group := range assignment.Groups {
+			groups[i] = strings.ToLower(group)
+		}
+		assignment.Groups = groups
+		tariffs.assignments = append(tariffs.assignments, assignment)
+	}
+
+	return tariffs, nil
+}
+
+// Creates the tariffs of the configuration, and those of every tenant that defines tariffs of its own. Returns an
+// error as NewTariffs does.
+func NewTenantTariffs(config utils.TariffConfiguration, tenants []utils.TenantConfiguration) (*Tariffs, error) {
+	tariffs, err := NewTariffs(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tariffs.tenants = make(map[string]*Tariffs)
+	for _, tenant := range tenants {
+		if len(tenant.Tariff.Tariffs) == 0 {
+			continue
+		}
+		tenantTariffs, err := NewTariffs(tenant.Tariff)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", tenant.ID, err)
+		}
+		tariffs.tenants[tenant.ID] = tenantTariffs
+	}
+
+	return tariffs, nil
+}
+
+// Returns the tariffs of the tenant, the configured tariffs unless it has its own.
+func (t *Tariffs) forTenant(tenant string) *Tariffs {
+	if tariffs, ok := t.tenants[tenant]; ok {
+		return tariffs
+	}
+	return t
+}
+
+// Creates a tariff from its configuration. Empty prices are zero, and empty band prices those of the tariff.
+func newTariff(config utils.TariffDefinitionConfiguration) (Tariff, error) {
+	if config.ID == "" {
+		return Tariff{}, fmt.Errorf("id is not set")
+	}
+	if config.Currency == "" {
+		return Tariff{}, fmt.Errorf("currency is not set")
+	}
+
+	tariff := Tariff{
+		Id:              config.ID,
+		Currency:        config.Currency,
+		IdleGracePeriod: config.IdleGracePeriod,
+	}
+	for _, price := range []struct {
+		value string
+		price *decimal.Decimal
+	}{
+		{config.StartFee, &tariff.StartFee},
+		{config.EnergyPrice, &tariff.EnergyPrice},
+		{config.TimePrice, &tariff.TimePrice},
+		{config.IdlePrice, &tariff.IdlePrice},
+	} {
+		if err := parsePrice(price.value, price.price); err != nil {
+			return Tariff{}, err
+		}
+	}
+
+	if config.TimeZone != "" {
+		location, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			return Tariff{}, err
+		}
+		tariff.Location = location
+	}
+
+	for _, bandConfig := range config.Bands {
+		band := TariffBand{EnergyPrice: tariff.EnergyPrice, TimePrice: tariff.TimePrice}
+		var err error
+		if band.Start, err = parseTimeOfDay(bandConfig.Start); err != nil {
+			return Tariff{}, err
+		}
+		if band.End, err = parseTimeOfDay(bandConfig.End); err != nil {
+			return Tariff{}, err
+		}
+		if band.Start == band.End {
+			return Tariff{}, fmt.Errorf("band %s-%s is empty", bandConfig.Start, bandConfig.End)
+		}
+		if err := parsePrice(bandConfig.EnergyPrice, &band.EnergyPrice); err != nil {
+			return Tariff{}, err
+		}
+		if err := parsePrice(bandConfig.TimePrice, &band.TimePrice); err != nil {
+			return Tariff{}, err
+		}
+		tariff.Bands = append(tariff.Bands, band)
+	}
+
+	return tariff, nil
+}
+
+// Sets the price from its decimal string, leaving it as it is when the string is empty.
+func parsePrice(value string, price *decimal.Decimal) error {
+	if value == "" {
+		return nil
+	}
+	parsed, err := decimal.NewFromString(value)
+	if err != nil {
+		return fmt.Errorf("invalid price %q: %w", value, err)
+	}
+	if parsed.IsNegative() {
+		return fmt.Errorf("invalid price %q: must not be negative", value)
+	}
+	*price = parsed
+	return nil
+}
+
+// Returns the time since midnight of an HH:MM time of day.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: %w", value, err)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// Returns the tariff of a session of the idTag on the charge point. An assignment to a group of the idTag goes before
+// one to the charge point, which goes before the default. An assignment to both must match both and goes first, and
+// of equal assignments the first listed wins. Returns false when no tariff applies.
+func (t *Tariffs) Resolve(serialnumber, idTag string) (Tariff, bool) {
+	groups := t.groups[strings.ToUpper(idTag)]
+
+	best, bestScore := "", -1
+	for _, assignment := range t.assignments {
+		score := 0
+		if len(assignment.Serialnumbers) > 0 {
+			if !slices.Contains(assignment.Serialnumbers, serialnumber) {
+				continue
+			}
+			score += 1
+		}
+		if len(assignment.Groups) > 0 {
+			if !slices.ContainsFunc(assignment.Groups, func(group string) bool { return slices.Contains(groups, group) }) {
+				continue
+			}
+			score += 2
+		}
+		if score > bestScore {
+			best, bestScore = assignment.Tariff, score
+		}
+	}
+	if bestScore < 0 {
+		return Tariff{}, false
+	}
+	return t.tariffs[best], true
+}
+
+// Returns the cost of the CDR under the tariff of its session in its tenant, or nil when no tariff applies.
+func (t *Tariffs) Price(cdr ChargeDetailRecord, samples []MeterSample, statuses []ConnectorStatus) *CostBreakdown {
+	tariff, ok := t.forTenant(cdr.Tenant).Resolve(cdr.Serialnumber, cdr.IdTag)
+	if !ok {
+		return nil
+	}
+	cost := tariff.Price(cdr, samples, statuses)
+	return &cost
+}
+
+// Returns the cost of a transaction as if it stopped at the time with its latest register reading, or the cost of a
+// stopped transaction. Returns false when no tariff applies.
+func (t *Tariffs) Estimate(transaction Transaction, samples []MeterSample, statuses []ConnectorStatus, at time.Time) (CostEstimate, bool) {
+	if transaction.StoppedAt == nil {
+		meterStop := transaction.MeterStart
+		var latest time.Time
+		for _, sample := range samples {
+			if !sample.SampledAt.Before(latest) {
+				latest, meterStop = sample.SampledAt, max(sample.RegisterWh, transaction.MeterStart)
+			}
+		}
+		stoppedAt := at
+		if stoppedAt.Before(transaction.StartedAt) {
+			stoppedAt = transaction.StartedAt
+		}
+		transaction.MeterStop, transaction.StoppedAt = &meterStop, &stoppedAt
+	}
+
+	cdr, err := NewChargeDetailRecord(transaction, samples, statuses)
+	if err != nil {
+		return CostEstimate{}, false
+	}
+	cost := t.Price(cdr, samples, statuses)
+	if cost == nil {
+		return CostEstimate{}, false
+	}
+	return CostEstimate{
+		TransactionId: transaction.Id,
+		EnergyWh:      cdr.EnergyWh,
+		Cost:          *cost,
+		EstimatedAt:   at,
+	}, true
+}
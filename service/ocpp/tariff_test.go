@@ -0,0 +1,283 @@
+package ocpp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTariffs(t *testing.T) {
+	t.Run("Bands", func(t *testing.T) {
+		tariffs, err := NewTariffs(utils.TariffConfiguration{
+			Tariffs: []utils.TariffDefinitionConfiguration{{
+				ID:          "standard",
+				Currency:    "GBP",
+				EnergyPrice: "0.45",
+				TimePrice:   "1.20",
+				TimeZone:    "Europe/London",
+				Bands: []utils.TariffBandConfiguration{
+					{Start: "23:30", End: "05:30", EnergyPrice: "0.10"},
+				},
+			}},
+			Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "standard"}},
+		})
+		assert.NoError(t, err)
+
+		tariff, ok := tariffs.Resolve("charger-1", "B4A63CDF")
+		assert.True(t, ok)
+		assert.Equal(t, "Europe/London", tariff.Location.String())
+		if assert.Len(t, tariff.Bands, 1) {
+			band := tariff.Bands[0]
+			assert.Equal(t, 23*time.Hour+30*time.Minute, band.Start)
+			assert.Equal(t, 5*time.Hour+30*time.Minute, band.End)
+			assert.Equal(t, "0.1", band.EnergyPrice.String())
+			// The time price of the tariff applies in the band
+			assert.Equal(t, "1.2", band.TimePrice.String())
+		}
+		assert.True(t, tariff.StartFee.IsZero())
+	})
+
+	for name, config := range map[string]utils.TariffConfiguration{
+		"NoCurrency":    {Tariffs: []utils.TariffDefinitionConfiguration{{ID: "standard"}}},
+		"InvalidPrice":  {Tariffs: []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", EnergyPrice: "0,45"}}},
+		"NegativePrice": {Tariffs: []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", StartFee: "-1"}}},
+		"InvalidZone":   {Tariffs: []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", TimeZone: "Mars/Olympus"}}},
+		"InvalidBand":   {Tariffs: []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", Bands: []utils.TariffBandConfiguration{{Start: "7am", End: "09:00"}}}}},
+		"EmptyBand":     {Tariffs: []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", Bands: []utils.TariffBandConfiguration{{Start: "09:00", End: "09:00"}}}}},
+		"DuplicateId":   {Tariffs: []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP"}, {ID: "standard", Currency: "EUR"}}},
+		"UnknownTariff": {Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "standard"}}},
+		"NoId":          {Tariffs: []utils.TariffDefinitionConfiguration{{Currency: "GBP"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewTariffs(config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTariffsResolve(t *testing.T) {
+	tariffs, err := NewTariffs(utils.TariffConfiguration{
+		Tariffs: []utils.TariffDefinitionConfiguration{
+			{ID: "standard", Currency: "GBP"},
+			{ID: "depot", Currency: "GBP"},
+			{ID: "fleet", Currency: "GBP"},
+			{ID: "fleet-depot", Currency: "GBP"},
+		},
+		Groups: map[string][]string{"fleet": {"B4A63CDF"}, "staff": {"0FA1C2D3"}},
+		Assignments: []utils.TariffAssignmentConfiguration{
+			{Tariff: "standard"},
+			{Tariff: "fleet", Groups: []string{"Fleet"}},
+			{Tariff: "depot", Serialnumbers: []string{"depot-1", "depot-2"}},
+			{Tariff: "fleet-depot", Serialnumbers: []string{"depot-2"}, Groups: []string{"fleet"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		serialnumber, idTag, tariff string
+	}{
+		{"charger-1", "0FA1C2D3", "standard"},
+		{"depot-1", "0FA1C2D3", "depot"},
+		{"charger-1", "B4A63CDF", "fleet"},
+		{"charger-1", "b4a63cdf", "fleet"}, // idTags are case-insensitive
+		{"depot-1", "B4A63CDF", "fleet"},
+		{"depot-2", "B4A63CDF", "fleet-depot"},
+	} {
+		tariff, ok := tariffs.Resolve(test.serialnumber, test.idTag)
+		assert.True(t, ok)
+		assert.Equal(t, test.tariff, tariff.Id, "%s on %s", test.idTag, test.serialnumber)
+	}
+
+	t.Run("NoDefault", func(t *testing.T) {
+		tariffs, err := NewTariffs(utils.TariffConfiguration{
+			Tariffs:     []utils.TariffDefinitionConfiguration{{ID: "depot", Currency: "GBP"}},
+			Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "depot", Serialnumbers: []string{"depot-1"}}},
+		})
+		assert.NoError(t, err)
+
+		_, ok := tariffs.Resolve("charger-1", "B4A63CDF")
+		assert.False(t, ok)
+		assert.Nil(t, tariffs.Price(ChargeDetailRecord{Serialnumber: "charger-1", IdTag: "B4A63CDF"}, nil, nil))
+	})
+}
+
+func TestTariffPrice(t *testing.T) {
+	startedAt := time.Date(2025, 7, 22, 22, 0, 0, 0, time.UTC)
+	cdr := ChargeDetailRecord{
+		Serialnumber: "charger-1",
+		IdTag:        "B4A63CDF",
+		StartedAt:    startedAt,
+		StoppedAt:    startedAt.Add(2 * time.Hour),
+		Duration:     2 * time.Hour,
+		MeterStart:   1000,
+		MeterStop:    21000,
+		EnergyWh:     20000,
+		ChargingTime: 2 * time.Hour,
+	}
+	price := func(value string) decimal.Decimal {
+		return decimal.RequireFromString(value)
+	}
+
+	t.Run("Flat", func(t *testing.T) {
+		tariff := Tariff{
+			Id:          "standard",
+			Currency:    "GBP",
+			StartFee:    price("0.50"),
+			EnergyPrice: price("0.333"),
+			TimePrice:   price("0.10"),
+		}
+		cost := tariff.Price(cdr, nil, nil)
+		assert.Equal(t, "standard", cost.TariffId)
+		assert.Equal(t, "GBP", cost.Currency)
+		assert.Equal(t, "0.5", cost.StartFee.String())
+		assert.Equal(t, "6.66", cost.Energy.String())
+		assert.Equal(t, "0.2", cost.Time.String())
+		assert.True(t, cost.Idle.IsZero())
+		assert.Equal(t, "7.36", cost.Total.String())
+	})
+
+	t.Run("MeterStopBelowMeterStart", func(t *testing.T) {
+		// The meter was reset during the session, so there is no energy to price
+		reset := cdr
+		reset.MeterStop = 400
+		reset.EnergyWh = 0
+		tariff := Tariff{Id: "standard", Currency: "GBP", EnergyPrice: price("0.333")}
+
+		cost := tariff.Price(reset, nil, nil)
+		assert.True(t, cost.Energy.IsZero())
+		assert.True(t, cost.Total.IsZero())
+
+		// Readings are clamped to the meter stop as well, so the segments still add up to the energy of the CDR
+		cost = tariff.Price(reset, []MeterSample{{RegisterWh: 1500, SampledAt: startedAt.Add(time.Hour)}}, nil)
+		assert.True(t, cost.Energy.IsZero())
+		assert.True(t, cost.Total.IsZero())
+	})
+
+	t.Run("Bands", func(t *testing.T) {
+		// From 23:00 the energy and time are cheaper, so the second hour costs less
+		tariff := Tariff{
+			EnergyPrice: price("0.40"),
+			TimePrice:   price("1.00"),
+			Bands: []TariffBand{
+				{Start: 23 * time.Hour, End: 6 * time.Hour, EnergyPrice: price("0.10"), TimePrice: price("0.50")},
+			},
+		}
+
+		// Without readings the energy is spread over the session
+		cost := tariff.Price(cdr, nil, nil)
+		assert.Equal(t, "5", cost.Energy.String())
+		assert.Equal(t, "1.5", cost.Time.String())
+
+		// The readings tell 15 kWh were charged in the first hour and 5 kWh in the second
+		cost = tariff.Price(cdr, []MeterSample{
+			{RegisterWh: 16000, SampledAt: startedAt.Add(time.Hour)},
+		}, nil)
+		assert.Equal(t, "6.5", cost.Energy.String())
+	})
+
+	t.Run("TimeZone", func(t *testing.T) {
+		london, err := time.LoadLocation("Europe/London")
+		assert.NoError(t, err)
+		// 23:00 UTC is 00:00 in London in summer
+		tariff := Tariff{
+			EnergyPrice: price("0.40"),
+			Location:    london,
+			Bands:       []TariffBand{{Start: 0, End: 6 * time.Hour, EnergyPrice: price("0.10")}},
+		}
+		cost := tariff.Price(cdr, nil, nil)
+		assert.Equal(t, "5", cost.Energy.String())
+	})
+
+	t.Run("IdleGracePeriod", func(t *testing.T) {
+		tariff := Tariff{
+			IdlePrice:       price("6.00"),
+			IdleGracePeriod: 15 * time.Minute,
+		}
+		idle := cdr
+		idle.ChargingTime, idle.IdleTime = 80*time.Minute, 40*time.Minute
+		statuses := []ConnectorStatus{
+			{Status: core.ChargePointStatusCharging, ReportedAt: startedAt},
+			{Status: core.ChargePointStatusSuspendedEV, ReportedAt: startedAt.Add(80 * time.Minute)},
+		}
+
+		cost := tariff.Price(idle, nil, statuses)
+		assert.Equal(t, "2.5", cost.Idle.String())
+
+		idle.ChargingTime, idle.IdleTime = 110*time.Minute, 10*time.Minute
+		cost = tariff.Price(idle, nil, statuses)
+		assert.True(t, cost.Idle.IsZero())
+	})
+
+	t.Run("ChargingTime", func(t *testing.T) {
+		tariff := Tariff{TimePrice: price("3.00")}
+		cost := tariff.Price(cdr, nil, []ConnectorStatus{
+			{Status: core.ChargePointStatusCharging, ReportedAt: startedAt},
+			{Status: core.ChargePointStatusSuspendedEV, ReportedAt: startedAt.Add(20 * time.Minute)},
+		})
+		assert.Equal(t, "1", cost.Time.String())
+	})
+}
+
+func TestTariffsEstimate(t *testing.T) {
+	tariffs, err := NewTariffs(utils.TariffConfiguration{
+		Tariffs:     []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", StartFee: "0.50", EnergyPrice: "0.40"}},
+		Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "standard"}},
+	})
+	assert.NoError(t, err)
+
+	startedAt := time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC)
+	transaction := Transaction{Id: 1, Serialnumber: "charger-1", ConnectorId: 1, IdTag: "B4A63CDF", MeterStart: 1000, StartedAt: startedAt}
+	samples := []MeterSample{
+		{RegisterWh: 6000, SampledAt: startedAt.Add(30 * time.Minute)},
+		{RegisterWh: 3500, SampledAt: startedAt.Add(15 * time.Minute)},
+	}
+
+	estimate, ok := tariffs.Estimate(transaction, samples, nil, startedAt.Add(30*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 1, estimate.TransactionId)
+	assert.Equal(t, 5000, estimate.EnergyWh)
+	assert.Equal(t, "2.5", estimate.Cost.Total.String())
+	assert.True(t, estimate.EstimatedAt.Equal(startedAt.Add(30*time.Minute)))
+
+	// Before any reading only the start fee is due
+	estimate, ok = tariffs.Estimate(transaction, nil, nil, startedAt.Add(time.Minute))
+	assert.True(t, ok)
+	assert.Zero(t, estimate.EnergyWh)
+	assert.Equal(t, "0.5", estimate.Cost.Total.String())
+}
+
+func TestTenantTariffs(t *testing.T) {
+	tariffs, err := NewTenantTariffs(utils.TariffConfiguration{
+		Tariffs:     []utils.TariffDefinitionConfiguration{{ID: "standard", Currency: "GBP", EnergyPrice: "0.40"}},
+		Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "standard"}},
+	}, []utils.TenantConfiguration{
+		{ID: "operator-a", Tariff: utils.TariffConfiguration{
+			Tariffs:     []utils.TariffDefinitionConfiguration{{ID: "operator-a", Currency: "EUR", EnergyPrice: "0.30"}},
+			Assignments: []utils.TariffAssignmentConfiguration{{Tariff: "operator-a"}},
+		}},
+		{ID: "operator-b"},
+	})
+	assert.NoError(t, err)
+
+	startedAt := time.Date(2025, 7, 22, 10, 0, 0, 0, time.UTC)
+	cdr := ChargeDetailRecord{Serialnumber: "charger-1", StartedAt: startedAt, StoppedAt: startedAt.Add(time.Hour), MeterStop: 10000}
+
+	for tenant, expected := range map[string]string{"": "standard", "operator-a": "operator-a", "operator-b": "standard"} {
+		cdr.Tenant = tenant
+		cost := tariffs.Price(cdr, nil, nil)
+		if assert.NotNil(t, cost, tenant) {
+			assert.Equal(t, expected, cost.TariffId, tenant)
+		}
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewTenantTariffs(utils.TariffConfiguration{}, []utils.TenantConfiguration{
+			{ID: "operator-a", Tariff: utils.TariffConfiguration{Tariffs: []utils.TariffDefinitionConfiguration{{ID: "operator-a"}}}},
+		})
+		assert.ErrorContains(t, err, "operator-a")
+	})
+}
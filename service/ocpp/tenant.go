@@ -0,0 +1,133 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+)
+
+// Key of the tenant in a context.
+type tenantKey struct{}
+
+// Returns a copy of ctx that carries the tenant. Stores and caches keep the data of every tenant apart, and use the
+// tenant of the context they are called with.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Returns the tenant carried by ctx, empty for the default tenant.
+func TenantOf(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Represents how the BootNotification of a charge point is answered.
+type BootPolicy struct {
+	Status   core.RegistrationStatus
+	Interval time.Duration
+}
+
+// Represents the configured tenants, which charge points are routed to them and how their boots are answered.
+type Tenants struct {
+	fallback string
+	tenants  map[string]utils.TenantConfiguration
+	routes   map[string]string // tenant per serial number
+	boot     BootPolicy
+}
+
+// Creates the tenants of the configuration, answering boots with the boot policy unless a tenant has its own. Returns
+// an error for a tenant without an id or defined twice, a serial number routed to two tenants, or an unknown boot status.
+func NewTenants(config utils.TenancyConfiguration, boot utils.BootConfiguration) (*Tenants, error) {
+	tenants := &Tenants{
+		fallback: config.Default,
+		tenants:  make(map[string]utils.TenantConfiguration, len(config.Tenants)),
+		routes:   make(map[string]string),
+	}
+
+	var err error
+	if tenants.boot, err = newBootPolicy(boot, BootPolicy{Status: core.RegistrationStatusAccepted, Interval: 30 * time.Second}); err != nil {
+		return nil, err
+	}
+
+	for _, tenant := range config.Tenants {
+		if tenant.ID == "" {
+			return nil, fmt.Errorf("tenant id is not set")
+		}
+		if _, ok := tenants.tenants[tenant.ID]; ok {
+			return nil, fmt.Errorf("tenant %q is defined twice", tenant.ID)
+		}
+		if _, err := newBootPolicy(tenant.Boot, tenants.boot); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", tenant.ID, err)
+		}
+		for _, serialnumber := range tenant.Serialnumbers {
+			if routed, ok := tenants.routes[serialnumber]; ok {
+				return nil, fmt.Errorf("charge point %q is routed to tenants %q and %q", serialnumber, routed, tenant.ID)
+			}
+			tenants.routes[serialnumber] = tenant.ID
+		}
+		tenants.tenants[tenant.ID] = tenant
+	}
+
+	if _, ok := tenants.tenants[tenants.fallback]; tenants.fallback != "" && !ok {
+		return nil, fmt.Errorf("default tenant %q is not defined", tenants.fallback)
+	}
+
+	return tenants, nil
+}
+
+// Creates a boot policy from its configuration. Empty fields are those of the fallback.
+func newBootPolicy(config utils.BootConfiguration, fallback BootPolicy) (BootPolicy, error) {
+	policy := fallback
+	if config.Status != "" {
+		switch status := core.RegistrationStatus(config.Status); status {
+		case core.RegistrationStatusAccepted, core.RegistrationStatusPending, core.RegistrationStatusRejected:
+			policy.Status = status
+		default:
+			return BootPolicy{}, fmt.Errorf("invalid boot status %q", config.Status)
+		}
+	}
+	if config.Interval < 0 {
+		return BootPolicy{}, fmt.Errorf("invalid boot interval %s: must not be negative", config.Interval)
+	}
+	if config.Interval > 0 {
+		policy.Interval = config.Interval
+	}
+	return policy, nil
+}
+
+// Returns the tenant of a message of the charge point: the tenant it is routed to, or else the default tenant. A
+// tenant carried by the message must be configured and be that tenant, so a message cannot move a charge point that is
+// not routed out of the default tenant.
+func (t *Tenants) Resolve(property, serialnumber string) (string, error) {
+	routed, ok := t.routes[serialnumber]
+	if !ok {
+		routed = t.fallback
+	}
+	if property == "" {
+		return routed, nil
+	}
+	if _, known := t.tenants[property]; !known {
+		return "", fmt.Errorf("unknown tenant %q", property)
+	}
+	if routed != property {
+		if !ok {
+			return "", fmt.Errorf("charge point %q is not routed, so it is in the default tenant %q, not %q", serialnumber, routed, property)
+		}
+		return "", fmt.Errorf("charge point %q is routed to tenant %q, not %q", serialnumber, routed, property)
+	}
+	return routed, nil
+}
+
+// Returns how boots of charge points in the tenant are answered.
+func (t *Tenants) BootPolicy(tenant string) BootPolicy {
+	config, ok := t.tenants[tenant]
+	if !ok {
+		return t.boot
+	}
+	// Validated in NewTenants
+	policy, _ := newBootPolicy(config.Boot, t.boot)
+	return policy
+}
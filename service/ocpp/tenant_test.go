@@ -0,0 +1,100 @@
+package ocpp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/service/ocpp/v1.6/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantOf(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, TenantOf(ctx))
+	assert.Equal(t, "operator-a", TenantOf(WithTenant(ctx, "operator-a")))
+}
+
+func TestNewTenants(t *testing.T) {
+	for name, config := range map[string]utils.TenancyConfiguration{
+		"MissingId":      {Tenants: []utils.TenantConfiguration{{Serialnumbers: []string{"charger-1"}}}},
+		"DefinedTwice":   {Tenants: []utils.TenantConfiguration{{ID: "operator-a"}, {ID: "operator-a"}}},
+		"RoutedTwice":    {Tenants: []utils.TenantConfiguration{{ID: "operator-a", Serialnumbers: []string{"charger-1"}}, {ID: "operator-b", Serialnumbers: []string{"charger-1"}}}},
+		"UnknownDefault": {Default: "operator-c", Tenants: []utils.TenantConfiguration{{ID: "operator-a"}}},
+		"InvalidStatus":  {Tenants: []utils.TenantConfiguration{{ID: "operator-a", Boot: utils.BootConfiguration{Status: "Maybe"}}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewTenants(config, utils.BootConfiguration{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTenantsResolve(t *testing.T) {
+	tenants, err := NewTenants(utils.TenancyConfiguration{
+		Tenants: []utils.TenantConfiguration{
+			{ID: "operator-a", Serialnumbers: []string{"charger-1"}},
+			{ID: "operator-b"},
+		},
+	}, utils.BootConfiguration{})
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		property, serialnumber, tenant string
+	}{
+		{"", "charger-1", "operator-a"},
+		{"", "charger-2", ""},
+		{"operator-a", "charger-1", "operator-a"},
+	} {
+		tenant, err := tenants.Resolve(test.property, test.serialnumber)
+		assert.NoError(t, err)
+		assert.Equal(t, test.tenant, tenant, "%q on %s", test.property, test.serialnumber)
+	}
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := tenants.Resolve("operator-c", "charger-2")
+		assert.Error(t, err)
+	})
+
+	t.Run("RoutedElsewhere", func(t *testing.T) {
+		_, err := tenants.Resolve("operator-b", "charger-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("NotRouted", func(t *testing.T) {
+		// A charge point that is not routed is in the default tenant, whatever tenant its message names
+		_, err := tenants.Resolve("operator-b", "charger-2")
+		assert.Error(t, err)
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		tenants, err := NewTenants(utils.TenancyConfiguration{
+			Default: "operator-b",
+			Tenants: []utils.TenantConfiguration{{ID: "operator-a"}, {ID: "operator-b"}},
+		}, utils.BootConfiguration{})
+		assert.NoError(t, err)
+
+		tenant, err := tenants.Resolve("", "charger-2")
+		assert.NoError(t, err)
+		assert.Equal(t, "operator-b", tenant)
+		tenant, err = tenants.Resolve("operator-b", "charger-2")
+		assert.NoError(t, err)
+		assert.Equal(t, "operator-b", tenant)
+		_, err = tenants.Resolve("operator-a", "charger-2")
+		assert.Error(t, err)
+	})
+}
+
+func TestTenantsBootPolicy(t *testing.T) {
+	tenants, err := NewTenants(utils.TenancyConfiguration{
+		Tenants: []utils.TenantConfiguration{
+			{ID: "operator-a", Boot: utils.BootConfiguration{Status: "Pending"}},
+		},
+	}, utils.BootConfiguration{Interval: time.Minute})
+	assert.NoError(t, err)
+
+	assert.Equal(t, BootPolicy{Status: core.RegistrationStatusAccepted, Interval: time.Minute}, tenants.BootPolicy(""))
+	assert.Equal(t, BootPolicy{Status: core.RegistrationStatusPending, Interval: time.Minute}, tenants.BootPolicy("operator-a"))
+	assert.Equal(t, BootPolicy{Status: core.RegistrationStatusAccepted, Interval: time.Minute}, tenants.BootPolicy("operator-b"))
+}
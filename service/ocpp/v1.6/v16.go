@@ -24,6 +24,31 @@ func (m MessageKind) IsValid() bool {
 type Meta struct {
 	Id           string
 	Serialnumber string
+	// Direction the message was sent in. Empty when the transport does not tell, in which case a request is taken to be
+	// sent in the direction of its action and a confirmation to answer a request of the Charge Point.
+	Direction Direction
+}
+
+// Represents the direction an OCPP message is sent in.
+type Direction string
+
+// Defines the directions of messages in OCPP.
+const (
+	ChargePointToCentralSystem Direction = "cp-cs"
+	CentralSystemToChargePoint Direction = "cs-cp"
+)
+
+// Checks if the Direction is valid.
+func (d Direction) IsValid() bool {
+	return d == ChargePointToCentralSystem || d == CentralSystemToChargePoint
+}
+
+// Returns the opposite direction, the one a confirmation to a request in this direction is sent in.
+func (d Direction) Reverse() Direction {
+	if d == CentralSystemToChargePoint {
+		return ChargePointToCentralSystem
+	}
+	return CentralSystemToChargePoint
 }
 
 // Represents the action kind in OCPP.
@@ -55,6 +80,25 @@ func (a ActionKind) IsValid() bool {
 		a == firmware.UpdateFirmware
 }
 
+// Returns the direction requests of the action are sent in. DataTransfer may be sent either way and is taken to come from the Charge Point.
+func (a ActionKind) Direction() Direction {
+	switch a {
+	case core.Authorize,
+		core.BootNotification,
+		core.DataTransfer,
+		firmware.DiagnosticsStatusNotification,
+		firmware.FirmwareStatusNotification,
+		core.Heartbeat,
+		core.MeterValues,
+		core.StartTransaction,
+		core.StatusNotification,
+		core.StopTransaction:
+		return ChargePointToCentralSystem
+	default:
+		return CentralSystemToChargePoint
+	}
+}
+
 // Checks if the ActionKind is valid.
 func (a ActionKind) ToPtr() *ActionKind {
 	if a.IsValid() {
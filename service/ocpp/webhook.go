@@ -0,0 +1,398 @@
+package ocpp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/internal/core/utils"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers of a webhook request.
+const (
+	WebhookIdHeader        = "Webhook-Id"
+	WebhookTimestampHeader = "Webhook-Timestamp"
+	WebhookSignatureHeader = "Webhook-Signature"
+)
+
+// Represents an HTTP endpoint domain events are posted to.
+type WebhookEndpoint struct {
+	URL    string
+	Secret string
+	// Event types posted to the endpoint. A type ending in ".*" matches every type with that prefix. Empty for all types.
+	Events []string
+}
+
+// Checks if the endpoint wants events of eventType.
+func (e WebhookEndpoint) Accepts(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, filter := range e.Events {
+		if filter == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(filter, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Represents a domain event waiting to be posted to an endpoint.
+type webhookRequest struct {
+	// Carries the span context of the message the event came from, without its cancellation
+	ctx   context.Context
+	event DomainEvent
+	body  []byte
+}
+
+type WebhookOption func(*WebhookDispatcher)
+
+// Posts domain events to webhook endpoints as structured CloudEvents, signed with HMAC-SHA256.
+// Each endpoint has its own queue and worker, so a slow endpoint does not hold up the others and receives events in order.
+// Failed posts are retried with backoff, and every delivery is recorded in the delivery log.
+type WebhookDispatcher struct {
+	tracer    trace.Tracer
+	client    *http.Client
+	endpoints []WebhookEndpoint
+	policy    retry.Policy
+	log       WebhookLogAdapter
+	queueSize int
+
+	queues []chan webhookRequest
+	mu     sync.RWMutex
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Ensures all required fields are set in the WebhookDispatcher.
+func (d *WebhookDispatcher) Validate() error {
+	if d.tracer == nil {
+		return fmt.Errorf("tracer provider is not set")
+	}
+	if d.log == nil {
+		return fmt.Errorf("delivery log is not set")
+	}
+	for _, endpoint := range d.endpoints {
+		if endpoint.URL == "" {
+			return fmt.Errorf("webhook endpoint url is not set")
+		}
+		if endpoint.Secret == "" {
+			return fmt.Errorf("secret of webhook endpoint %s is not set", endpoint.URL)
+		}
+	}
+	return nil
+}
+
+func WithWebhookTracerProvider(tp trace.TracerProvider) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		d.tracer = tp.Tracer("webhook")
+	}
+}
+
+func WithWebhookEndpoints(endpoints ...WebhookEndpoint) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		d.endpoints = append(d.endpoints, endpoints...)
+	}
+}
+
+// Sets the log deliveries are recorded in.
+func WithWebhookLog(log WebhookLogAdapter) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		d.log = log
+	}
+}
+
+func WithWebhookHTTPClient(client *http.Client) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		if client != nil {
+			d.client = client
+		}
+	}
+}
+
+// Sets how often and how quickly a failed post is retried.
+func WithWebhookRetryPolicy(policy retry.Policy) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		d.policy = policy
+	}
+}
+
+// Sets how many events may wait per endpoint before new events are dropped.
+func WithWebhookQueueSize(size int) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		if size > 0 {
+			d.queueSize = size
+		}
+	}
+}
+
+// Returns the options for the webhook configuration.
+func WebhookOptions(config utils.WebhookConfiguration) []WebhookOption {
+	endpoints := make([]WebhookEndpoint, len(config.Endpoints))
+	for i, endpoint := range config.Endpoints {
+		endpoints[i] = WebhookEndpoint{
+			URL:    endpoint.URL,
+			Secret: endpoint.Secret,
+			Events: endpoint.Events,
+		}
+	}
+
+	return []WebhookOption{
+		WithWebhookEndpoints(endpoints...),
+		WithWebhookHTTPClient(&http.Client{Timeout: config.Timeout}),
+		WithWebhookRetryPolicy(retry.Policy{
+			MaxAttempts:     config.MaxAttempts,
+			InitialInterval: config.InitialInterval,
+			MaxInterval:     config.MaxInterval,
+			Multiplier:      2,
+			Jitter:          0.2,
+		}),
+		WithWebhookQueueSize(config.QueueSize),
+	}
+}
+
+// Creates a new WebhookDispatcher and starts a worker per endpoint.
+func NewWebhookDispatcher(opts ...WebhookOption) *WebhookDispatcher {
+	dispatcher := &WebhookDispatcher{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		policy:    retry.DefaultPolicy(),
+		queueSize: 1000,
+	}
+
+	for _, opt := range opts {
+		opt(dispatcher)
+	}
+
+	if err := dispatcher.Validate(); err != nil {
+		slog.Error("Failed to create WebhookDispatcher", "error", err)
+		panic(err)
+	}
+
+	dispatcher.ctx, dispatcher.cancel = context.WithCancel(context.Background())
+	dispatcher.queues = make([]chan webhookRequest, len(dispatcher.endpoints))
+	for i, endpoint := range dispatcher.endpoints {
+		queue := make(chan webhookRequest, dispatcher.queueSize)
+		dispatcher.queues[i] = queue
+
+		dispatcher.wg.Add(1)
+		go func() {
+			defer dispatcher.wg.Done()
+			for request := range queue {
+				dispatcher.deliver(request, endpoint)
+			}
+		}()
+	}
+
+	return dispatcher
+}
+
+// Queues the event for every endpoint that accepts its type. An endpoint whose queue is full does not get the event,
+// and the drop is recorded as a failed delivery. The event is still accepted, so it is not published to the other
+// endpoints again.
+func (d *WebhookDispatcher) Publish(ctx context.Context, event DomainEvent) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return fmt.Errorf("webhook dispatcher is closed")
+	}
+
+	body, err := webhookBody(event)
+	if err != nil {
+		return err
+	}
+
+	// Deliveries are recorded for the tenant of the event
+	request := webhookRequest{
+		ctx:   trace.ContextWithSpanContext(WithTenant(context.Background(), event.Tenant), trace.SpanContextFromContext(ctx)),
+		event: event,
+		body:  body,
+	}
+
+	for i, endpoint := range d.endpoints {
+		if !endpoint.Accepts(event.Type) {
+			continue
+		}
+
+		select {
+		case d.queues[i] <- request:
+		default:
+			slog.Warn("Webhook queue is full, dropping event", "url", endpoint.URL, "id", event.Id, "type", event.Type)
+			d.record(request, endpoint, 0, 0, fmt.Errorf("webhook queue of %s is full", endpoint.URL))
+		}
+	}
+
+	return nil
+}
+
+// Stops accepting events and waits for the queued events to be delivered.
+// When ctx is done first, the deliveries in progress are cancelled.
+func (d *WebhookDispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return fmt.Errorf("queued webhooks were not delivered: %w", ctx.Err())
+	}
+}
+
+// Posts the event to the endpoint, retrying transient failures, and records the delivery.
+func (d *WebhookDispatcher) deliver(request webhookRequest, endpoint WebhookEndpoint) {
+	ctx, span := d.tracer.Start(request.ctx, "Webhook.Deliver", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("url", endpoint.URL),
+		attribute.String("event.id", request.event.Id),
+		attribute.String("event.type", request.event.Type),
+	))
+	defer span.End()
+
+	// Stop retrying once the dispatcher is closed and its deadline has passed
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	defer context.AfterFunc(d.ctx, stop)()
+
+	var attempts, statusCode int
+	err := retry.Do(ctx, d.policy, func(ctx context.Context) error {
+		attempts++
+		var err error
+		statusCode, err = d.post(ctx, endpoint, request)
+		return err
+	})
+
+	span.SetAttributes(attribute.Int("attempts", attempts), attribute.Int("http.status_code", statusCode))
+	if err != nil {
+		slog.Error("Failed to deliver webhook", "error", err, "url", endpoint.URL, "id", request.event.Id, "attempts", attempts)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Ok, "Webhook delivered")
+	}
+
+	d.record(request, endpoint, statusCode, attempts, err)
+}
+
+// Posts the signed event once. Server errors, 408 and 429 responses and network errors are transient.
+func (d *WebhookDispatcher) post(ctx context.Context, endpoint WebhookEndpoint, request webhookRequest) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(request.body))
+	if err != nil {
+		return 0, retry.Permanent(err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", cloudevents.ContentTypeStructured)
+	req.Header.Set(WebhookIdHeader, request.event.Id)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, timestamp, request.body))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return resp.StatusCode, retry.Transient(fmt.Errorf("webhook responded with %d", resp.StatusCode))
+	default:
+		return resp.StatusCode, retry.Permanent(fmt.Errorf("webhook responded with %d", resp.StatusCode))
+	}
+}
+
+// Records the outcome of a delivery in the delivery log.
+func (d *WebhookDispatcher) record(request webhookRequest, endpoint WebhookEndpoint, statusCode, attempts int, err error) {
+	delivery := WebhookDelivery{
+		EventId:    request.event.Id,
+		EventType:  request.event.Type,
+		URL:        endpoint.URL,
+		StatusCode: statusCode,
+		Attempts:   attempts,
+		CreatedAt:  time.Now(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		deliveredAt := time.Now()
+		delivery.DeliveredAt = &deliveredAt
+	}
+
+	if _, err := d.log.RecordWebhookDelivery(request.ctx, delivery); err != nil {
+		slog.Error("Failed to record webhook delivery", "error", err, "url", endpoint.URL, "id", request.event.Id)
+	}
+}
+
+// Returns the signature of a webhook body: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret>.
+// Receivers recompute it from the Webhook-Timestamp header and the raw body, and reject stale timestamps.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encodes a domain event as a structured CloudEvent.
+func webhookBody(event DomainEvent) ([]byte, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s event data: %w", event.Type, err)
+	}
+
+	return json.Marshal(cloudevents.Event{
+		ID:              event.Id,
+		Source:          eventSource,
+		SpecVersion:     cloudevents.SpecVersion,
+		Type:            event.Type,
+		DataContentType: cloudevents.ContentTypeJSON,
+		Subject:         event.Serialnumber,
+		Time:            event.OccurredAt,
+		Tenant:          event.Tenant,
+		Data:            data,
+	})
+}
+
+// Returns the most recent webhook deliveries, newest first.
+func (o *Ocpp) ListWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	return o.webhookLog.ListWebhookDeliveries(ctx, limit)
+}
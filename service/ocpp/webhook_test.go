@@ -0,0 +1,244 @@
+package ocpp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/squishmeist/ocpp-go/internal/core/retry"
+	"github.com/squishmeist/ocpp-go/pkg/cloudevents"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	event := DomainEvent{
+		Id:           "message-123:" + EventTransactionStarted,
+		Type:         EventTransactionStarted,
+		Serialnumber: "123456789",
+		OccurredAt:   time.Now().UTC(),
+		Data:         TransactionStarted{TransactionId: 1, ConnectorId: 1, IdTag: "TAG", MeterStart: 100},
+	}
+
+	t.Run("SignedCloudEvent", func(t *testing.T) {
+		received := make(chan *http.Request, 1)
+		bodies := make(chan []byte, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received <- r
+			bodies <- body
+		}))
+		defer server.Close()
+
+		log := &mockWebhookLog{}
+		dispatcher := setupWebhookTest(t, log, WebhookEndpoint{URL: server.URL, Secret: "secret"})
+
+		assert.NoError(t, dispatcher.Publish(context.Background(), event))
+		assert.NoError(t, dispatcher.Close(context.Background()))
+
+		r := <-received
+		body := <-bodies
+		assert.Equal(t, cloudevents.ContentTypeStructured, r.Header.Get("Content-Type"))
+		assert.Equal(t, event.Id, r.Header.Get(WebhookIdHeader))
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		assert.NoError(t, err)
+		assert.Equal(t, SignWebhook("secret", timestamp, body), r.Header.Get(WebhookSignatureHeader))
+		assert.NotEqual(t, SignWebhook("other", timestamp, body), r.Header.Get(WebhookSignatureHeader))
+
+		decoded, err := cloudevents.FromStructured(body)
+		assert.NoError(t, err)
+		assert.Equal(t, event.Id, decoded.ID)
+		assert.Equal(t, EventTransactionStarted, decoded.Type)
+		assert.Equal(t, "123456789", decoded.Subject)
+		assert.JSONEq(t, `{"transactionId":1,"connectorId":1,"idTag":"TAG","meterStart":100,"timestamp":"0001-01-01T00:00:00Z"}`, string(decoded.Data))
+
+		deliveries := log.all()
+		assert.Len(t, deliveries, 1)
+		assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+		assert.NotNil(t, deliveries[0].DeliveredAt)
+	})
+
+	t.Run("RecordedForTenant", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		log := &mockWebhookLog{}
+		dispatcher := setupWebhookTest(t, log, WebhookEndpoint{URL: server.URL, Secret: "secret"})
+
+		tenantEvent := event
+		tenantEvent.Tenant = "operator-a"
+		assert.NoError(t, dispatcher.Publish(context.Background(), tenantEvent))
+		assert.NoError(t, dispatcher.Close(context.Background()))
+
+		deliveries := log.all()
+		if assert.Len(t, deliveries, 1) {
+			assert.Equal(t, "operator-a", deliveries[0].Tenant)
+		}
+	})
+
+	t.Run("EventFilter", func(t *testing.T) {
+		var billing, crm atomic.Int32
+		billingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { billing.Add(1) }))
+		defer billingServer.Close()
+		crmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { crm.Add(1) }))
+		defer crmServer.Close()
+
+		log := &mockWebhookLog{}
+		dispatcher := setupWebhookTest(t, log,
+			WebhookEndpoint{URL: billingServer.URL, Secret: "billing", Events: []string{"ocpp.transaction.*"}},
+			WebhookEndpoint{URL: crmServer.URL, Secret: "crm", Events: []string{EventChargepointBooted}},
+		)
+
+		assert.NoError(t, dispatcher.Publish(context.Background(), event))
+		assert.NoError(t, dispatcher.Publish(context.Background(), DomainEvent{Id: "message-456:" + EventStatusChanged, Type: EventStatusChanged}))
+		assert.NoError(t, dispatcher.Close(context.Background()))
+
+		assert.Equal(t, int32(1), billing.Load())
+		assert.Equal(t, int32(0), crm.Load())
+		assert.Len(t, log.all(), 1)
+	})
+
+	t.Run("TransientFailureRetried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		log := &mockWebhookLog{}
+		dispatcher := setupWebhookTest(t, log, WebhookEndpoint{URL: server.URL, Secret: "secret"})
+
+		assert.NoError(t, dispatcher.Publish(context.Background(), event))
+		assert.NoError(t, dispatcher.Close(context.Background()))
+
+		deliveries := log.all()
+		assert.Len(t, deliveries, 1)
+		assert.Equal(t, 3, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+		assert.NotNil(t, deliveries[0].DeliveredAt)
+	})
+
+	t.Run("PermanentFailureLogged", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		log := &mockWebhookLog{}
+		dispatcher := setupWebhookTest(t, log, WebhookEndpoint{URL: server.URL, Secret: "secret"})
+
+		assert.NoError(t, dispatcher.Publish(context.Background(), event))
+		assert.NoError(t, dispatcher.Close(context.Background()))
+
+		assert.Equal(t, int32(1), calls.Load())
+		deliveries := log.all()
+		assert.Len(t, deliveries, 1)
+		assert.Equal(t, http.StatusBadRequest, deliveries[0].StatusCode)
+		assert.Nil(t, deliveries[0].DeliveredAt)
+		assert.Contains(t, deliveries[0].Error, "400")
+	})
+
+	t.Run("FullQueueDropsForThatEndpointOnly", func(t *testing.T) {
+		started := make(chan struct{}, 3)
+		release := make(chan struct{})
+		var slow, healthy atomic.Int32
+		slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slow.Add(1)
+			started <- struct{}{}
+			<-release
+		}))
+		defer slowServer.Close()
+		healthyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { healthy.Add(1) }))
+		defer healthyServer.Close()
+
+		log := &mockWebhookLog{}
+		dispatcher := NewWebhookDispatcher(
+			WithWebhookTracerProvider(noop.NewTracerProvider()),
+			WithWebhookLog(log),
+			WithWebhookEndpoints(WebhookEndpoint{URL: slowServer.URL, Secret: "slow"}, WebhookEndpoint{URL: healthyServer.URL, Secret: "healthy"}),
+			WithWebhookQueueSize(1),
+		)
+
+		// The slow endpoint is posting the first event and has the second queued, so the third is dropped for it
+		assert.NoError(t, dispatcher.Publish(context.Background(), event))
+		<-started
+		for i, id := range []string{"message-2", "message-3"} {
+			assert.NoError(t, dispatcher.Publish(context.Background(), DomainEvent{Id: id, Type: EventTransactionStarted}))
+			assert.Eventually(t, func() bool { return healthy.Load() == int32(i+2) }, time.Second, time.Millisecond)
+		}
+		close(release)
+		assert.NoError(t, dispatcher.Close(context.Background()))
+
+		assert.Equal(t, int32(2), slow.Load())
+		assert.Equal(t, int32(3), healthy.Load())
+		var dropped []WebhookDelivery
+		for _, delivery := range log.all() {
+			if delivery.DeliveredAt == nil {
+				dropped = append(dropped, delivery)
+			}
+		}
+		assert.Len(t, dropped, 1)
+		assert.Equal(t, slowServer.URL, dropped[0].URL)
+		assert.Equal(t, "message-3", dropped[0].EventId)
+		assert.Contains(t, dropped[0].Error, "full")
+	})
+
+	t.Run("PublishAfterClose", func(t *testing.T) {
+		dispatcher := setupWebhookTest(t, &mockWebhookLog{}, WebhookEndpoint{URL: "http://localhost", Secret: "secret"})
+		assert.NoError(t, dispatcher.Close(context.Background()))
+		assert.Error(t, dispatcher.Publish(context.Background(), event))
+	})
+}
+
+func TestWebhookEndpointAccepts(t *testing.T) {
+	assert.True(t, WebhookEndpoint{}.Accepts(EventStatusChanged))
+	assert.True(t, WebhookEndpoint{Events: []string{"ocpp.transaction.*"}}.Accepts(EventTransactionStopped))
+	assert.True(t, WebhookEndpoint{Events: []string{EventChargepointBooted}}.Accepts(EventChargepointBooted))
+	assert.False(t, WebhookEndpoint{Events: []string{"ocpp.transaction.*"}}.Accepts(EventChargepointBooted))
+}
+
+func setupWebhookTest(t *testing.T, log WebhookLogAdapter, endpoints ...WebhookEndpoint) *WebhookDispatcher {
+	t.Helper()
+
+	return NewWebhookDispatcher(
+		WithWebhookTracerProvider(noop.NewTracerProvider()),
+		WithWebhookLog(log),
+		WithWebhookEndpoints(endpoints...),
+		WithWebhookRetryPolicy(retry.Policy{MaxAttempts: 3, InitialInterval: time.Millisecond}),
+	)
+}
+
+type mockWebhookLog struct {
+	mu         sync.Mutex
+	deliveries []WebhookDelivery
+}
+
+func (m *mockWebhookLog) RecordWebhookDelivery(ctx context.Context, delivery WebhookDelivery) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.Tenant = TenantOf(ctx)
+	m.deliveries = append(m.deliveries, delivery)
+	return int64(len(m.deliveries)), nil
+}
+
+func (m *mockWebhookLog) ListWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	return m.all(), nil
+}
+
+func (m *mockWebhookLog) all() []WebhookDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]WebhookDelivery(nil), m.deliveries...)
+}